@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/config"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/internal/service/issuer"
+)
+
+// Registers a client in the clients table or replaces the one with the same id.
+// Confidential clients get a new secret, it's printed once and only its hash is stored.
+func main() {
+	var (
+		id           string
+		name         string
+		grantTypes   string
+		redirectURIs string
+		scopes       string
+		accessTTL    time.Duration
+		refreshTTL   time.Duration
+		public       bool
+	)
+	flag.StringVar(&id, "id", "", "client id the app sends")
+	flag.StringVar(&name, "name", "", "name shown on the consent page")
+	flag.StringVar(&grantTypes, "grant-types", models.GrantPassword+","+models.GrantRefreshToken, "comma separated grant types the client can use")
+	flag.StringVar(&redirectURIs, "redirect-uris", "", "comma separated redirect uris for the authorization code grant")
+	flag.StringVar(&scopes, "scopes", "", "comma separated scopes the client can request, none by default, required for client_credentials")
+	flag.DurationVar(&accessTTL, "access-ttl", 0, "access token lifetime, the configured one by default")
+	flag.DurationVar(&refreshTTL, "refresh-ttl", 0, "refresh token lifetime, the configured one by default")
+	flag.BoolVar(&public, "public", false, "the client can't keep a secret, like the mobile and CLI apps")
+
+	// read config file, also parses the flags above
+	cfg := config.MustLoad()
+
+	if id == "" {
+		log.Fatal("--id is required")
+	}
+
+	client := models.Client{
+		ClientID:     id,
+		Name:         name,
+		GrantTypes:   splitList(grantTypes),
+		RedirectURIs: splitList(redirectURIs),
+		Scopes:       splitList(scopes),
+		AccessTTL:    accessTTL,
+		RefreshTTL:   refreshTTL,
+	}
+	if client.Name == "" {
+		client.Name = id
+	}
+	if client.Allows(models.GrantAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		log.Fatal("--redirect-uris are required for the authorization_code grant")
+	}
+	// a service token without scopes can't call anything
+	if client.Allows(models.GrantClientCredentials) && len(client.Scopes) == 0 {
+		log.Fatal("--scopes are required for the client_credentials grant")
+	}
+
+	var secret string
+	if !public {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			log.Fatal(err)
+		}
+		secret = base64.RawURLEncoding.EncodeToString(b)
+		client.SecretHash = issuer.HashSecret(secret)
+	}
+
+	db, err := postgres.New(cfg.Postgres.ConnString())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := db.SaveClient(context.Background(), client); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("client %q saved", id)
+	if secret != "" {
+		log.Printf("client secret, it won't be shown again: %s", secret)
+	}
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/kuromii5/miku-notes-auth/internal/config"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/pkg/email"
+)
+
+// Brings the stored emails to the form login and registration look them up by,
+// with the same normalizer: lowercase, punycode domains and, with email.provider_rules,
+// the mailbox of known providers. Run it before migrating and after turning provider_rules on.
+//
+// Accounts that would end up with the same email are listed and nothing is changed,
+// they have to be merged or renamed by hand first.
+func main() {
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", false, "only report the changes and collisions, don't write anything")
+
+	// read config file, also parses the flags above
+	cfg := config.MustLoad()
+
+	db, err := postgres.New(cfg.Postgres.ConnString())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	emails, err := db.UserEmails(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	normalizer := email.New(cfg.Email.ProviderRules)
+
+	var (
+		changes = make(map[int32]string)
+		owners  = make(map[string][]int32)
+	)
+	for id, stored := range emails {
+		normalized, err := normalizer.Normalize(stored)
+		if err != nil {
+			// left as it is, the user can't log in with it either way
+			log.Printf("user %d (%s): %v", id, stored, err)
+			normalized = stored
+		}
+
+		owners[normalized] = append(owners[normalized], id)
+		if normalized != stored {
+			changes[id] = normalized
+		}
+	}
+
+	var collisions []string
+	for normalized, ids := range owners {
+		if len(ids) < 2 {
+			continue
+		}
+
+		slices.Sort(ids)
+		var list []string
+		for _, id := range ids {
+			list = append(list, emails[id])
+		}
+		collisions = append(collisions, normalized+": "+strings.Join(list, ", "))
+	}
+	if len(collisions) > 0 {
+		slices.Sort(collisions)
+		log.Fatalf("accounts with the same normalized email found, resolve them before normalizing:\n%s",
+			strings.Join(collisions, "\n"))
+	}
+
+	log.Printf("%d users, %d emails to normalize", len(emails), len(changes))
+
+	if dryRun {
+		for id, normalized := range changes {
+			log.Printf("user %d: %s -> %s", id, emails[id], normalized)
+		}
+		return
+	}
+
+	if err := db.UpdateEmails(ctx, changes); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("emails normalized")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kuromii5/miku-notes-auth/internal/config"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/pkg/email"
+)
+
+const batchSize = 1000
+
+// Imports users with their foreign password hashes from a CSV or JSONL file.
+// Hashes are stored in tagged formats that pkg/hasher verifies,
+// and replaced with the current algorithm on the first login.
+//
+// CSV needs a header with columns: email,scheme,hash,salt,iterations,created_at
+// JSONL has one object per line with the same keys.
+func main() {
+	var (
+		path   string
+		format string
+		dryRun bool
+	)
+	flag.StringVar(&path, "file", "", "path to CSV or JSONL file with users")
+	flag.StringVar(&format, "format", "", "csv or jsonl, detected from file extension by default")
+	flag.BoolVar(&dryRun, "dry-run", false, "only validate the file, don't write anything")
+
+	// read config file, also parses the flags above
+	cfg := config.MustLoad()
+
+	if path == "" {
+		log.Fatal("--file is required")
+	}
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []record
+	switch format {
+	case "csv":
+		records, err = readCSV(file)
+	case "jsonl":
+		records, err = readJSONL(file)
+	default:
+		err = fmt.Errorf("unknown format %q, use csv or jsonl", format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	normalizer := email.New(cfg.Email.ProviderRules)
+
+	var (
+		users   []models.User
+		invalid int
+	)
+	for i, r := range records {
+		user, err := r.user(normalizer)
+		if err != nil {
+			log.Printf("record %d (%s): %v", i+1, r.Email, err)
+			invalid++
+			continue
+		}
+
+		users = append(users, user)
+	}
+
+	log.Printf("%d records read, %d valid, %d invalid", len(records), len(users), invalid)
+
+	if dryRun {
+		return
+	}
+
+	db, err := postgres.New(cfg.Postgres.ConnString())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var imported int
+	for start := 0; start < len(users); start += batchSize {
+		batch := users[start:min(start+batchSize, len(users))]
+
+		n, err := db.ImportUsers(context.Background(), batch)
+		if err != nil {
+			log.Fatalf("batch starting at user %d: %v", start+1, err)
+		}
+		imported += n
+	}
+
+	log.Printf("%d users imported, %d skipped because email is already taken", imported, len(users)-imported)
+}
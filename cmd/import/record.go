@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/pkg/email"
+	"github.com/kuromii5/miku-notes-auth/pkg/hasher"
+)
+
+// record is a single user exported from the old app.
+// For sha256 and pbkdf2-* schemes hash and salt are hex encoded,
+// bcrypt and argon2id hashes are taken as they are.
+type record struct {
+	Email      string `json:"email"`
+	Scheme     string `json:"scheme"`
+	Hash       string `json:"hash"`
+	Salt       string `json:"salt"`
+	Iterations int    `json:"iterations"`
+	CreatedAt  string `json:"created_at"` // RFC 3339, optional
+}
+
+func (r record) user(normalizer *email.Normalizer) (models.User, error) {
+	emailAddr, err := normalizer.Normalize(r.Email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	hash, err := r.encodeHash()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		Email:        emailAddr,
+		PasswordHash: hash,
+	}
+
+	if r.CreatedAt != "" {
+		user.CreatedAt, err = time.Parse(time.RFC3339, r.CreatedAt)
+		if err != nil {
+			return models.User{}, fmt.Errorf("invalid created_at: %w", err)
+		}
+	}
+
+	return user, nil
+}
+
+// encodeHash converts the foreign hash into the tagged format of pkg/hasher
+func (r record) encodeHash() ([]byte, error) {
+	switch scheme := strings.ToLower(r.Scheme); {
+	case scheme == "sha256":
+		salt, digest, err := r.decodeHex()
+		if err != nil {
+			return nil, err
+		}
+
+		return hasher.EncodeSaltedSHA256(salt, digest), nil
+
+	case strings.HasPrefix(scheme, "pbkdf2-"):
+		salt, key, err := r.decodeHex()
+		if err != nil {
+			return nil, err
+		}
+
+		return hasher.EncodePBKDF2(strings.TrimPrefix(scheme, "pbkdf2-"), r.Iterations, salt, key)
+
+	case scheme == "bcrypt":
+		return passthrough(hasher.NewBcrypt(0), r.Hash)
+
+	case scheme == "argon2id":
+		return passthrough(hasher.NewArgon2id(hasher.DefaultArgon2Params), r.Hash)
+
+	default:
+		return nil, fmt.Errorf("unknown hash scheme %q", r.Scheme)
+	}
+}
+
+func (r record) decodeHex() ([]byte, []byte, error) {
+	salt, err := hex.DecodeString(r.Salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("salt is not hex: %w", err)
+	}
+
+	hash, err := hex.DecodeString(r.Hash)
+	if err != nil || len(hash) == 0 {
+		return nil, nil, errors.New("hash is not hex")
+	}
+
+	return salt, hash, nil
+}
+
+// passthrough checks that an already encoded hash can be parsed
+func passthrough(alg hasher.Algorithm, hash string) ([]byte, error) {
+	if !alg.Match([]byte(hash)) {
+		return nil, hasher.ErrInvalidHash
+	}
+	if _, err := alg.Outdated([]byte(hash)); err != nil {
+		return nil, fmt.Errorf("%w: %v", hasher.ErrInvalidHash, err)
+	}
+
+	return []byte(hash), nil
+}
+
+func readCSV(r io.Reader) ([]record, error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"email", "scheme", "hash"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("csv header misses %q column", required)
+		}
+	}
+
+	column := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var records []record
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+
+		r := record{
+			Email:     column(row, "email"),
+			Scheme:    column(row, "scheme"),
+			Hash:      column(row, "hash"),
+			Salt:      column(row, "salt"),
+			CreatedAt: column(row, "created_at"),
+		}
+		if iterations := column(row, "iterations"); iterations != "" {
+			r.Iterations, err = strconv.Atoi(iterations)
+			if err != nil {
+				return nil, fmt.Errorf("csv line %d: invalid iterations: %w", line, err)
+			}
+		}
+
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+func readJSONL(r io.Reader) ([]record, error) {
+	scanner := bufio.NewScanner(r)
+
+	var records []record
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("jsonl line %d: %w", line, err)
+		}
+
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kuromii5/miku-notes-auth/pkg/email"
+	"github.com/kuromii5/miku-notes-auth/pkg/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// sha256("salt" || "password")
+	sha256Digest = "13601bda4ea78e55a07b98866d2be6be0744e3866f13c00c811cab608a28f322"
+	// pbkdf2-sha256("password", "salt", 4096)
+	pbkdf2Key = "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"
+	// bcrypt of "password" with cost 4
+	bcryptHash = "$2a$04$SSSOX3sZemkCJDJFMMkxg.NL8YEey6BUv6dztt7j.YGM2PS7ItrFu"
+)
+
+func TestReadCSV(t *testing.T) {
+	t.Parallel()
+
+	input := "Email, Scheme,hash,salt,iterations,created_at\n" +
+		"Miku@Example.com,sha256," + sha256Digest + ",73616c74,,2020-01-02T03:04:05Z\n" +
+		"rin@example.com,pbkdf2-sha256," + pbkdf2Key + ",73616c74,4096,\n" +
+		"len@example.com,bcrypt," + bcryptHash + ",,,\n"
+
+	records, err := readCSV(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, record{
+		Email:     "Miku@Example.com",
+		Scheme:    "sha256",
+		Hash:      sha256Digest,
+		Salt:      "73616c74",
+		CreatedAt: "2020-01-02T03:04:05Z",
+	}, records[0])
+	assert.Equal(t, 4096, records[1].Iterations)
+	assert.Equal(t, bcryptHash, records[2].Hash)
+
+	// every record turns into a hash the hasher verifies
+	h := hasher.New(hasher.NewBcrypt(4), hasher.NewSaltedSHA256(), hasher.NewPBKDF2("sha256", 1000))
+	for _, r := range records {
+		user, err := r.user(email.New(false))
+		require.NoError(t, err, r.Email)
+		assert.NoError(t, h.CheckPassword("password", user.PasswordHash), r.Email)
+	}
+}
+
+func TestReadCSV_Malformed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{name: "empty", input: "", err: "failed to read csv header"},
+		{name: "missing column", input: "email,hash\nmiku@example.com,abcd\n", err: `misses "scheme" column`},
+		{name: "bad iterations", input: "email,scheme,hash,iterations\nmiku@example.com,pbkdf2-sha1,abcd,many\n", err: "csv line 2: invalid iterations"},
+		{name: "wrong field count", input: "email,scheme,hash\nmiku@example.com,bcrypt\n", err: "csv line 2"},
+		{name: "bare quote", input: "email,scheme,hash\nmiku@example.com,bcrypt,\"ab\"c\n", err: "csv line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := readCSV(strings.NewReader(tt.input))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	t.Parallel()
+
+	input := `{"email":"miku@example.com","scheme":"pbkdf2-sha256","hash":"` + pbkdf2Key + `","salt":"73616c74","iterations":4096}
+
+{"email":"rin@example.com","scheme":"bcrypt","hash":"` + bcryptHash + `"}
+`
+	records, err := readJSONL(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, 4096, records[0].Iterations)
+	assert.Equal(t, "rin@example.com", records[1].Email)
+
+	_, err = readJSONL(strings.NewReader(input + "{\"email\": \n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "jsonl line 4")
+
+	_, err = readJSONL(strings.NewReader(`{"email":"miku@example.com","iterations":"4096"}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "jsonl line 1")
+}
+
+func TestRecord_User(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		record record
+		err    error
+	}{
+		{name: "unknown scheme", record: record{Email: "miku@example.com", Scheme: "md5", Hash: "abcd"}},
+		{name: "salt not hex", record: record{Email: "miku@example.com", Scheme: "sha256", Hash: sha256Digest, Salt: "salt"}},
+		{name: "hash not hex", record: record{Email: "miku@example.com", Scheme: "sha256", Hash: "digest", Salt: "73616c74"}},
+		{name: "empty hash", record: record{Email: "miku@example.com", Scheme: "sha256", Salt: "73616c74"}},
+		{name: "unknown digest", record: record{Email: "miku@example.com", Scheme: "pbkdf2-md5", Hash: pbkdf2Key, Salt: "73616c74", Iterations: 1000}, err: hasher.ErrUnknownAlgorithm},
+		{name: "no iterations", record: record{Email: "miku@example.com", Scheme: "pbkdf2-sha256", Hash: pbkdf2Key, Salt: "73616c74"}, err: hasher.ErrInvalidHash},
+		{name: "too many iterations", record: record{Email: "miku@example.com", Scheme: "pbkdf2-sha256", Hash: pbkdf2Key, Salt: "73616c74", Iterations: 1 << 30}, err: hasher.ErrInvalidHash},
+		{name: "too costly bcrypt", record: record{Email: "miku@example.com", Scheme: "bcrypt", Hash: "$2a$31$SSSOX3sZemkCJDJFMMkxg.NL8YEey6BUv6dztt7j.YGM2PS7ItrFu"}, err: hasher.ErrInvalidHash},
+		{name: "zero argon2id iterations", record: record{Email: "miku@example.com", Scheme: "argon2id", Hash: "$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"}, err: hasher.ErrInvalidHash},
+		{name: "broken bcrypt", record: record{Email: "miku@example.com", Scheme: "bcrypt", Hash: "$2a$04$short"}, err: hasher.ErrInvalidHash},
+		{name: "not argon2id", record: record{Email: "miku@example.com", Scheme: "argon2id", Hash: bcryptHash}, err: hasher.ErrInvalidHash},
+		{name: "invalid email", record: record{Email: "miku", Scheme: "bcrypt", Hash: bcryptHash}},
+		{name: "invalid created_at", record: record{Email: "miku@example.com", Scheme: "bcrypt", Hash: bcryptHash, CreatedAt: "yesterday"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := tt.record.user(email.New(false))
+			require.Error(t, err)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
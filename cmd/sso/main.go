@@ -27,16 +27,38 @@ func main() {
 	app := app.New(
 		log,
 		cfg.GRPC.Port,
-		cfg.GRPC.ConnectionToken,
+		cfg.GRPC.AdminPort,
+		cfg.GRPC.AdminConnectionToken,
+		cfg.GRPC.TLS,
+		cfg.GRPC.Callers,
 		postgresConnStr,
 		cfg.Tokens.Secret,
 		cfg.Tokens.RedisAddr,
 		cfg.Tokens.AccessTTL,
 		cfg.Tokens.RefreshTTL,
+		cfg.Tokens.ServiceTTL,
+		cfg.Lockout,
+		cfg.Email,
+		cfg.Hasher,
+		cfg.Breach,
+		cfg.PasswordPolicy,
+		cfg.MFA,
+		cfg.WebAuthn,
+		cfg.Mail,
+		cfg.LoginCode,
+		cfg.TrustedDevices,
+		cfg.SMS,
+		cfg.OAuth,
+		cfg.OIDC,
+		cfg.DeviceGrant,
+		cfg.AntiEnumeration,
 	)
 
 	// run the server as goroutine
 	go app.Server.MustRun()
+	if app.HTTP != nil {
+		go app.HTTP.MustRun()
+	}
 
 	// graceful shutdown
 	shutdown := make(chan os.Signal, 1)
@@ -44,6 +66,9 @@ func main() {
 	s := <-shutdown
 	log.Info("shutdown", slog.String("signal", s.String()))
 
+	if app.HTTP != nil {
+		app.HTTP.Shutdown()
+	}
 	app.Server.Shutdown()
 	log.Info("Server is stopped")
 }
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+
+	"github.com/kuromii5/miku-notes-auth/internal/grpcauth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryInterceptor for validating the bearer token
+func (s *serverAPI) validateBearerTokenInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	token, err := grpcauth.BearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the token
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.connectionToken)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization token")
+	}
+
+	// Call the handler to proceed with the actual RPC
+	return handler(ctx, req)
+}
@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type serverAPI struct {
+	sso.UnimplementedAuthAdminServer
+	admin           Admin
+	connectionToken string
+}
+
+//go:generate mockgen -source=server.go -destination=mock/server.go
+type Admin interface {
+	SearchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error)
+	UserSessions(ctx context.Context, userID int32) ([]models.Session, error)
+	ForceLogout(ctx context.Context, userID int32) error
+	DisableUser(ctx context.Context, userID int32) error
+	SuspendUser(ctx context.Context, userID int32, reason string, until time.Time) error
+	EnableUser(ctx context.Context, userID int32) error
+	UnlockUser(ctx context.Context, userID int32) error
+	RequirePasswordChange(ctx context.Context, userID int32) error
+	DeleteUser(ctx context.Context, userID int32) error
+}
+
+func RegisterServer(admin Admin, connectionToken string, opts ...grpc.ServerOption) *grpc.Server {
+	server := &serverAPI{admin: admin, connectionToken: connectionToken}
+
+	// admin server has its own credentials, separate from the public auth server
+	interceptor := grpc.UnaryInterceptor(server.validateBearerTokenInterceptor)
+	gRPC := grpc.NewServer(append(opts, interceptor)...)
+
+	sso.RegisterAuthAdminServer(gRPC, server)
+
+	return gRPC
+}
+
+func (s *serverAPI) SearchUsers(ctx context.Context, req *sso.SearchUsersRequest) (*sso.SearchUsersResponse, error) {
+	filter, err := searchFilter(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	users, err := s.admin.SearchUsers(ctx, filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to search users")
+	}
+
+	resp := &sso.SearchUsersResponse{
+		Users: make([]*sso.UserInfo, 0, len(users)),
+	}
+	for _, user := range users {
+		info := &sso.UserInfo{
+			Id:               user.ID,
+			Email:            user.Email,
+			Status:           user.Status,
+			SuspensionReason: user.SuspensionReason,
+			CreatedAt:        user.CreatedAt.Unix(),
+			UpdatedAt:        user.UpdatedAt.Unix(),
+		}
+		if !user.SuspendedUntil.IsZero() {
+			info.SuspendedUntil = user.SuspendedUntil.Unix()
+		}
+
+		resp.Users = append(resp.Users, info)
+	}
+
+	// a full page means there might be more users after the last one
+	if len(users) > 0 && len(users) == filter.Limit {
+		resp.NextPageToken = strconv.Itoa(int(users[len(users)-1].ID))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) GetUserSessions(ctx context.Context, req *sso.GetUserSessionsRequest) (*sso.GetUserSessionsResponse, error) {
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidUserID.Error())
+	}
+
+	sessions, err := s.admin.UserSessions(ctx, req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err, "failed to get user sessions")
+	}
+
+	resp := &sso.GetUserSessionsResponse{
+		Sessions: make([]*sso.Session, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &sso.Session{
+			Fingerprint: session.Fingerprint,
+			ExpiresIn:   int64(session.ExpiresIn.Seconds()),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ForceLogout(ctx context.Context, req *sso.ForceLogoutRequest) (*sso.ForceLogoutResponse, error) {
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidUserID.Error())
+	}
+
+	if err := s.admin.ForceLogout(ctx, req.GetUserId()); err != nil {
+		return nil, toStatus(err, "failed to log out user")
+	}
+
+	return &sso.ForceLogoutResponse{}, nil
+}
+
+func (s *serverAPI) DisableUser(ctx context.Context, req *sso.DisableUserRequest) (*sso.DisableUserResponse, error) {
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidUserID.Error())
+	}
+
+	if err := s.admin.DisableUser(ctx, req.GetUserId()); err != nil {
+		return nil, toStatus(err, "failed to disable user")
+	}
+
+	return &sso.DisableUserResponse{}, nil
+}
+
+func (s *serverAPI) SuspendUser(ctx context.Context, req *sso.SuspendUserRequest) (*sso.SuspendUserResponse, error) {
+	until, err := validateSuspendRequest(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.admin.SuspendUser(ctx, req.GetUserId(), req.GetReason(), until); err != nil {
+		return nil, toStatus(err, "failed to suspend user")
+	}
+
+	return &sso.SuspendUserResponse{}, nil
+}
+
+func (s *serverAPI) EnableUser(ctx context.Context, req *sso.EnableUserRequest) (*sso.EnableUserResponse, error) {
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidUserID.Error())
+	}
+
+	if err := s.admin.EnableUser(ctx, req.GetUserId()); err != nil {
+		return nil, toStatus(err, "failed to enable user")
+	}
+
+	return &sso.EnableUserResponse{}, nil
+}
+
+func (s *serverAPI) UnlockUser(ctx context.Context, req *sso.UnlockUserRequest) (*sso.UnlockUserResponse, error) {
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidUserID.Error())
+	}
+
+	if err := s.admin.UnlockUser(ctx, req.GetUserId()); err != nil {
+		return nil, toStatus(err, "failed to unlock user")
+	}
+
+	return &sso.UnlockUserResponse{}, nil
+}
+
+func (s *serverAPI) RequirePasswordChange(ctx context.Context, req *sso.RequirePasswordChangeRequest) (*sso.RequirePasswordChangeResponse, error) {
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidUserID.Error())
+	}
+
+	if err := s.admin.RequirePasswordChange(ctx, req.GetUserId()); err != nil {
+		return nil, toStatus(err, "failed to require password change")
+	}
+
+	return &sso.RequirePasswordChangeResponse{}, nil
+}
+
+func (s *serverAPI) DeleteUser(ctx context.Context, req *sso.DeleteUserRequest) (*sso.DeleteUserResponse, error) {
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidUserID.Error())
+	}
+
+	if err := s.admin.DeleteUser(ctx, req.GetUserId()); err != nil {
+		return nil, toStatus(err, "failed to delete user")
+	}
+
+	return &sso.DeleteUserResponse{}, nil
+}
+
+// toStatus maps service errors shared by every user action to gRPC codes
+func toStatus(err error, msg string) error {
+	if errors.Is(err, service.ErrUserNotFound) {
+		return status.Error(codes.NotFound, "user not found")
+	}
+
+	return status.Error(codes.Internal, msg)
+}
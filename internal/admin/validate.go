@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+
+	maxReasonLength = 500
+)
+
+var (
+	ErrInvalidUserID    = errors.New("invalid user id")
+	ErrInvalidPageSize  = errors.New("page size can't be negative")
+	ErrInvalidPageToken = errors.New("invalid page token")
+	ErrReasonRequired   = errors.New("suspension reason is required")
+	ErrReasonTooLong    = errors.New("max suspension reason length is 500")
+	ErrUntilInPast      = errors.New("suspension end time must be in the future")
+)
+
+func searchFilter(req *sso.SearchUsersRequest) (models.UserFilter, error) {
+	if req.GetUserId() < 0 {
+		return models.UserFilter{}, ErrInvalidUserID
+	}
+	if req.GetPageSize() < 0 {
+		return models.UserFilter{}, ErrInvalidPageSize
+	}
+
+	filter := models.UserFilter{
+		ID:          req.GetUserId(),
+		EmailPrefix: req.GetEmailPrefix(),
+		Limit:       int(req.GetPageSize()),
+	}
+
+	switch {
+	case filter.Limit == 0:
+		filter.Limit = defaultPageSize
+	case filter.Limit > maxPageSize:
+		filter.Limit = maxPageSize
+	}
+
+	// page token is the id of the last user on the previous page
+	if token := req.GetPageToken(); token != "" {
+		afterID, err := strconv.ParseInt(token, 10, 32)
+		if err != nil || afterID < 0 {
+			return models.UserFilter{}, ErrInvalidPageToken
+		}
+
+		filter.AfterID = int32(afterID)
+	}
+
+	return filter, nil
+}
+
+// validateSuspendRequest returns the suspension end time, zero means indefinitely
+func validateSuspendRequest(req *sso.SuspendUserRequest) (time.Time, error) {
+	if req.GetUserId() <= 0 {
+		return time.Time{}, ErrInvalidUserID
+	}
+
+	reason := strings.TrimSpace(req.GetReason())
+	if reason == "" {
+		return time.Time{}, ErrReasonRequired
+	}
+	if utf8.RuneCountInString(reason) > maxReasonLength {
+		return time.Time{}, ErrReasonTooLong
+	}
+
+	if req.GetUntil() == 0 {
+		return time.Time{}, nil
+	}
+
+	until := time.Unix(req.GetUntil(), 0)
+	if !until.After(time.Now()) {
+		return time.Time{}, ErrUntilInPast
+	}
+
+	return until, nil
+}
@@ -1,29 +1,77 @@
 package app
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
 	"log/slog"
+	"os"
+	"strings"
 	"time"
 
 	grpcapp "github.com/kuromii5/miku-notes-auth/internal/app/grpc"
+	httpapp "github.com/kuromii5/miku-notes-auth/internal/app/http"
+	"github.com/kuromii5/miku-notes-auth/internal/auth"
+	"github.com/kuromii5/miku-notes-auth/internal/config"
+	"github.com/kuromii5/miku-notes-auth/internal/openid"
 	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
 	"github.com/kuromii5/miku-notes-auth/internal/repo/redis"
 	"github.com/kuromii5/miku-notes-auth/internal/service"
+	"github.com/kuromii5/miku-notes-auth/internal/service/devicegrant"
+	"github.com/kuromii5/miku-notes-auth/internal/service/issuer"
+	"github.com/kuromii5/miku-notes-auth/internal/service/lockout"
+	"github.com/kuromii5/miku-notes-auth/internal/service/logincode"
+	"github.com/kuromii5/miku-notes-auth/internal/service/mfa"
+	"github.com/kuromii5/miku-notes-auth/internal/service/passkey"
+	"github.com/kuromii5/miku-notes-auth/internal/service/smscode"
+	"github.com/kuromii5/miku-notes-auth/internal/service/social"
 	"github.com/kuromii5/miku-notes-auth/internal/service/tokens"
+	"github.com/kuromii5/miku-notes-auth/pkg/email"
+	"github.com/kuromii5/miku-notes-auth/pkg/hasher"
+	"github.com/kuromii5/miku-notes-auth/pkg/mail"
+	"github.com/kuromii5/miku-notes-auth/pkg/oidc"
+	"github.com/kuromii5/miku-notes-auth/pkg/pwned"
+	"github.com/kuromii5/miku-notes-auth/pkg/secretbox"
+	"github.com/kuromii5/miku-notes-auth/pkg/sms"
+	"github.com/kuromii5/miku-notes-auth/pkg/webauthn"
 )
 
 type App struct {
 	Server *grpcapp.GRPCApp
+	// serves the OpenID Connect provider, nil when it's off
+	HTTP *httpapp.HTTPApp
 }
 
 func New(
 	log *slog.Logger,
 	port int,
-	connToken string,
+	adminPort int,
+	adminConnToken string,
+	tlsCfg config.GrpcTLSConfig,
+	callers map[string][]string,
 	dbPath string,
 	secret string,
 	redisAddr string,
 	accessTTL time.Duration,
 	refreshTTL time.Duration,
+	serviceTTL time.Duration,
+	lockoutCfg config.LockoutConfig,
+	emailCfg config.EmailConfig,
+	hasherCfg config.HasherConfig,
+	breachCfg config.BreachConfig,
+	policyCfg config.PasswordPolicyConfig,
+	mfaCfg config.MFAConfig,
+	webAuthnCfg config.WebAuthnConfig,
+	mailCfg config.MailConfig,
+	loginCodeCfg config.LoginCodeConfig,
+	devicesCfg config.TrustedDevicesConfig,
+	smsCfg config.SMSConfig,
+	oauthCfg config.OAuthConfig,
+	oidcCfg config.OIDCConfig,
+	deviceGrantCfg config.DeviceGrantConfig,
+	antiEnumeration bool,
 ) *App {
 	db, err := postgres.New(dbPath)
 	if err != nil {
@@ -33,10 +81,296 @@ func New(
 	// define refresh token storage and manager
 	// it's just part of authService
 	tokenStorage := redis.New(redisAddr)
-	tokenManager := tokens.New(log, secret, accessTTL, refreshTTL, tokenStorage, tokenStorage, tokenStorage)
+	tokenManager := tokens.New(log, secret, accessTTL, refreshTTL, serviceTTL, tokenStorage, tokenStorage, tokenStorage)
 
-	authService := service.New(log, db, db, tokenManager)
-	app := grpcapp.New(log, port, connToken, authService)
+	// failed login attempts are tracked in the same redis
+	limiter := lockout.New(
+		log,
+		lockoutCfg.MaxAttempts,
+		lockoutCfg.Window,
+		lockoutCfg.BaseDelay,
+		lockoutCfg.MaxDelay,
+		tokenStorage,
+	)
 
-	return &App{Server: app}
+	normalizer := email.New(emailCfg.ProviderRules)
+
+	mfaManager := mfa.New(log, mfaCfg.Issuer, mfaCfg.Skew, newSecretBox(mfaCfg.EncryptionKey), db)
+
+	// ceremony challenges live in redis until the browser answers
+	passkeyManager := passkey.New(log, newRelyingParty(webAuthnCfg), db, tokenStorage)
+
+	// anti-enumeration answers sign ups only by email
+	mailer := newMailer(mailCfg)
+	if antiEnumeration && mailer == nil {
+		panic("anti_enumeration needs mail to send confirmation emails")
+	}
+
+	// codes are hashed with a key derived from the token secret
+	loginCodeManager := logincode.New(
+		log,
+		[]byte(secret),
+		loginCodeCfg.TTL,
+		loginCodeCfg.MaxAttempts,
+		loginCodeCfg.Cooldown,
+		loginCodeCfg.LinkURL,
+		tokenStorage,
+		mailer,
+	)
+
+	// send counters share the redis with the codes
+	smsCodeManager := smscode.New(
+		log,
+		[]byte(secret),
+		smsCfg.TTL,
+		smsCfg.MaxAttempts,
+		smsCfg.PerNumberLimit,
+		smsCfg.PerIPLimit,
+		smsCfg.LimitWindow,
+		tokenStorage,
+		newSMSSender(smsCfg),
+	)
+
+	// login states wait in redis while the user is at the provider
+	socialManager := social.New(log, newOAuthProviders(oauthCfg), tokenStorage)
+
+	// devices poll redis until the user approves their code in the web app
+	deviceGrantManager := devicegrant.New(
+		log,
+		deviceGrantCfg.TTL,
+		deviceGrantCfg.Interval,
+		deviceGrantCfg.VerificationURL,
+		tokenStorage,
+	)
+
+	passwordHasher := newHasher(hasherCfg)
+
+	// keep the interface nil, not a nil pointer, when the dataset isn't mounted
+	var breachChecker service.BreachChecker
+	if breachCfg.Dir != "" {
+		breachChecker = pwned.New(breachCfg.Dir, breachCfg.MinCount)
+	}
+
+	policy, err := auth.NewPasswordPolicy(policyCfg)
+	if err != nil {
+		panic(err)
+	}
+
+	authService := service.New(
+		log,
+		db,
+		db,
+		db,
+		db,
+		db,
+		db,
+		tokenManager,
+		limiter,
+		mfaManager,
+		passkeyManager,
+		loginCodeManager,
+		smsCodeManager,
+		socialManager,
+		deviceGrantManager,
+		normalizer,
+		passwordHasher,
+		policy,
+		policyCfg.HistorySize,
+		policyCfg.MaxAge,
+		time.Duration(devicesCfg.TrustDays)*24*time.Hour,
+		breachChecker,
+	)
+	adminService := service.NewAdmin(log, db, tokenStorage, limiter)
+
+	app, err := grpcapp.New(log, port, adminPort, adminConnToken, tlsCfg, callers, authService, adminService, antiEnumeration)
+	if err != nil {
+		panic(err)
+	}
+
+	if oidcCfg.Issuer == "" {
+		return &App{Server: app}
+	}
+
+	// authorization requests and codes wait in redis like the other login states
+	issuerManager := issuer.New(
+		log,
+		oidcCfg.Issuer,
+		loadSigningKey(oidcCfg.SigningKeyFile),
+		db,
+		oidcCfg.LoginTTL,
+		oidcCfg.CodeTTL,
+		oidcCfg.IDTokenTTL,
+		tokenStorage,
+	)
+	provider := service.NewProvider(log, authService, tokenManager, issuerManager)
+
+	return &App{
+		Server: app,
+		HTTP:   httpapp.New(log, oidcCfg.Port, openid.NewHandler(log, provider)),
+	}
+}
+
+// newHasher hashes with the configured algorithm and keeps the other one for verifying old hashes
+func newHasher(cfg config.HasherConfig) *hasher.Hasher {
+	params := hasher.DefaultArgon2Params
+	params.Memory = cfg.Argon2Memory
+	params.Iterations = cfg.Argon2Iterations
+	params.Parallelism = cfg.Argon2Parallelism
+	if err := params.Validate(); err != nil {
+		panic(fmt.Sprintf("argon2id parameters out of bounds: m=%d, t=%d, p=%d", params.Memory, params.Iterations, params.Parallelism))
+	}
+
+	argon := hasher.NewArgon2id(params)
+	bcrypt := hasher.NewBcrypt(cfg.BcryptCost)
+
+	// formats of users imported from the old notes app
+	sha256 := hasher.NewSaltedSHA256()
+	pbkdf2 := hasher.NewPBKDF2("sha256", 600_000)
+
+	peppers := loadPeppers(cfg)
+
+	switch cfg.Algorithm {
+	case "argon2id":
+		return hasher.NewPeppered(peppers, argon, bcrypt, sha256, pbkdf2)
+	case "bcrypt":
+		return hasher.NewPeppered(peppers, bcrypt, argon, sha256, pbkdf2)
+	default:
+		panic(fmt.Sprintf("unknown password hashing algorithm: %s", cfg.Algorithm))
+	}
+}
+
+// newSecretBox returns nil when no key is configured
+func newSecretBox(encodedKey string) *secretbox.Box {
+	if encodedKey == "" {
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		panic(fmt.Sprintf("mfa encryption key is not valid base64: %v", err))
+	}
+
+	box, err := secretbox.New(key)
+	if err != nil {
+		panic(err)
+	}
+
+	return box
+}
+
+// newRelyingParty returns nil when no relying party id is configured
+func newRelyingParty(cfg config.WebAuthnConfig) *webauthn.RelyingParty {
+	if cfg.RPID == "" {
+		return nil
+	}
+	if len(cfg.Origins) == 0 {
+		panic("webauthn origins are required with a relying party id")
+	}
+
+	return webauthn.New(cfg.RPID, cfg.RPName, cfg.Origins)
+}
+
+// newMailer returns a nil interface when mail isn't configured
+func newMailer(cfg config.MailConfig) logincode.Mailer {
+	switch {
+	case cfg.SMTPHost != "":
+		return mail.NewSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	case cfg.OutboxDir != "":
+		return mail.NewOutbox(cfg.OutboxDir, cfg.From)
+	default:
+		return nil
+	}
+}
+
+// newSMSSender returns a nil interface when no provider is configured
+func newSMSSender(cfg config.SMSConfig) smscode.SMSSender {
+	if cfg.ProviderURL == "" {
+		return nil
+	}
+
+	return sms.NewHTTP(cfg.ProviderURL, cfg.ProviderToken, cfg.From, cfg.Timeout)
+}
+
+func newOAuthProviders(cfg config.OAuthConfig) map[string]social.Provider {
+	providers := make(map[string]social.Provider, len(cfg.Providers))
+	for name, p := range cfg.Providers {
+		if p.Issuer == "" && (p.AuthURL == "" || p.TokenURL == "" || p.UserInfoURL == "") {
+			panic(fmt.Sprintf("oauth provider %s needs an issuer or the auth, token and userinfo urls", name))
+		}
+
+		providers[name] = oidc.New(oidc.Config{
+			Issuer:         p.Issuer,
+			AuthURL:        p.AuthURL,
+			TokenURL:       p.TokenURL,
+			UserInfoURL:    p.UserInfoURL,
+			ClientID:       p.ClientID,
+			ClientSecret:   p.ClientSecret,
+			RedirectURL:    p.RedirectURL,
+			Scopes:         p.Scopes,
+			EmailsVerified: p.EmailsVerified,
+		}, cfg.Timeout)
+	}
+
+	return providers
+}
+
+// loadSigningKey reads a PKCS#1 or PKCS#8 RSA private key
+func loadSigningKey(path string) *rsa.PrivateKey {
+	if path == "" {
+		panic("oidc signing key file is required with an issuer")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(fmt.Sprintf("failed to read oidc signing key: %v", err))
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		panic("oidc signing key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse oidc signing key: %v", err))
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		panic("oidc signing key is not an RSA key")
+	}
+
+	return key
+}
+
+// loadPeppers returns nil when no pepper is configured
+func loadPeppers(cfg config.HasherConfig) *hasher.Peppers {
+	entries := cfg.Peppers
+	if cfg.PepperFile != "" {
+		data, err := os.ReadFile(cfg.PepperFile)
+		if err != nil {
+			panic(fmt.Sprintf("failed to read pepper file: %v", err))
+		}
+
+		entries = append(entries, strings.Split(string(data), "\n")...)
+	}
+
+	keys, err := hasher.ParsePeppers(entries)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse peppers: %v", err))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	peppers, err := hasher.NewPeppers(cfg.PepperVersion, keys)
+	if err != nil {
+		panic(fmt.Sprintf("invalid pepper config: %v", err))
+	}
+
+	return peppers
 }
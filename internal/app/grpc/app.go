@@ -1,30 +1,106 @@
 package grpcapp
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 
+	"github.com/kuromii5/miku-notes-auth/internal/admin"
 	"github.com/kuromii5/miku-notes-auth/internal/auth"
+	"github.com/kuromii5/miku-notes-auth/internal/config"
+	"github.com/kuromii5/miku-notes-auth/pkg/certs"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var (
+	ErrClientCAWithoutTLS    = errors.New("client_ca_file and require_client_cert need cert_file")
+	ErrClientCertWithoutCA   = errors.New("require_client_cert needs client_ca_file to verify the certificates")
+	ErrInvalidReloadInterval = errors.New("reload_interval must be positive")
 )
 
 type GRPCApp struct {
-	log             *slog.Logger
-	server          *grpc.Server
-	port            int
-	connectionToken string
+	log    *slog.Logger
+	server *grpc.Server
+	port   int
+
+	// admin server listens on its own port with its own token,
+	// so it can be kept off the public network
+	adminServer *grpc.Server
+	adminPort   int
+
+	// nil when the servers run without TLS
+	certs *certs.Reloader
 }
 
-func New(log *slog.Logger, port int, connectionToken string, authGRPC auth.Auth) *GRPCApp {
-	server := auth.RegisterServer(authGRPC, connectionToken)
+func New(
+	log *slog.Logger,
+	port int,
+	adminPort int,
+	adminConnectionToken string,
+	tlsCfg config.GrpcTLSConfig,
+	callers map[string][]string,
+	authGRPC auth.Auth,
+	adminGRPC admin.Admin,
+	antiEnumeration bool,
+) (*GRPCApp, error) {
+	const f = "grpcapp.New"
+
+	if err := validateTLS(tlsCfg); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	var (
+		opts     []grpc.ServerOption
+		reloader *certs.Reloader
+	)
+	if tlsCfg.CertFile != "" {
+		var err error
+		reloader, err = certs.New(log, tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+		reloader.Watch(tlsCfg.ReloadInterval)
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.Config(tlsCfg.RequireClientCert))))
+	}
+
+	server, err := auth.RegisterServer(authGRPC, tlsCfg.Identities, callers, antiEnumeration, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+	adminServer := admin.RegisterServer(adminGRPC, adminConnectionToken, opts...)
 
 	return &GRPCApp{
-		log:             log,
-		server:          server,
-		port:            port,
-		connectionToken: connectionToken,
+		log:         log,
+		server:      server,
+		port:        port,
+		adminServer: adminServer,
+		adminPort:   adminPort,
+		certs:       reloader,
+	}, nil
+}
+
+// validateTLS refuses settings that would quietly run with less verification than asked for
+func validateTLS(tlsCfg config.GrpcTLSConfig) error {
+	if tlsCfg.CertFile == "" {
+		if tlsCfg.ClientCAFile != "" || tlsCfg.RequireClientCert {
+			return ErrClientCAWithoutTLS
+		}
+
+		return nil
+	}
+
+	if tlsCfg.RequireClientCert && tlsCfg.ClientCAFile == "" {
+		return ErrClientCertWithoutCA
+	}
+	// the certificates are watched with a ticker, it can't tick every 0s
+	if tlsCfg.ReloadInterval <= 0 {
+		return ErrInvalidReloadInterval
 	}
+
+	return nil
 }
 
 func (a *GRPCApp) run() error {
@@ -35,13 +111,29 @@ func (a *GRPCApp) run() error {
 		return fmt.Errorf("%s:%w", f, err)
 	}
 
+	adminL, err := net.Listen("tcp", fmt.Sprintf(":%d", a.adminPort))
+	if err != nil {
+		l.Close()
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
 	a.log.Info("Starting gRPC server",
 		slog.Int("port", a.port),
 		slog.String("func", f),
 		slog.String("addr", l.Addr().String()),
 	)
+	a.log.Info("Starting gRPC admin server",
+		slog.Int("port", a.adminPort),
+		slog.String("func", f),
+		slog.String("addr", adminL.Addr().String()),
+	)
 
-	if err := a.server.Serve(l); err != nil {
+	// whichever server stops first brings the app down
+	errs := make(chan error, 2)
+	go func() { errs <- a.server.Serve(l) }()
+	go func() { errs <- a.adminServer.Serve(adminL) }()
+
+	if err := <-errs; err != nil {
 		return fmt.Errorf("%s:%w", f, err)
 	}
 
@@ -61,5 +153,10 @@ func (a *GRPCApp) Shutdown() {
 		slog.String("f", f),
 	)
 
+	a.adminServer.GracefulStop()
 	a.server.GracefulStop()
+
+	if a.certs != nil {
+		a.certs.Close()
+	}
 }
@@ -0,0 +1,71 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout is how long requests in flight get to finish
+const shutdownTimeout = 10 * time.Second
+
+type HTTPApp struct {
+	log    *slog.Logger
+	server *http.Server
+	port   int
+}
+
+func New(log *slog.Logger, port int, handler http.Handler) *HTTPApp {
+	return &HTTPApp{
+		log:  log,
+		port: port,
+		server: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (a *HTTPApp) run() error {
+	const f = "httpapp.Run"
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	a.log.Info("Starting HTTP server",
+		slog.Int("port", a.port),
+		slog.String("func", f),
+		slog.String("addr", l.Addr().String()),
+	)
+
+	if err := a.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+func (a *HTTPApp) MustRun() {
+	if err := a.run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *HTTPApp) Shutdown() {
+	const f = "httpapp.Stop"
+
+	a.log.Info("Stopping HTTP server",
+		slog.String("f", f),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	_ = a.server.Shutdown(ctx)
+}
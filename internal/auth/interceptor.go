@@ -2,39 +2,137 @@ package auth
 
 import (
 	"context"
-	"fmt"
+	"slices"
 
+	"github.com/kuromii5/miku-notes-auth/internal/grpcauth"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/pkg/certs"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
-// UnaryInterceptor for validating the bearer token
+// scopes of service tokens, each one opens a group of RPCs
+const (
+	// ValidateAccessToken, for the services behind the gateway
+	ScopeValidate = "auth.validate"
+	// every other RPC, for the gateway that serves the apps
+	ScopeGateway = "auth.gateway"
+)
+
+// accessTokenRequest is a request made for a logged in user
+type accessTokenRequest interface {
+	GetAccessToken() string
+}
+
+type callerKey struct{}
+
+// CallerFromContext returns the service that made the call
+func CallerFromContext(ctx context.Context) (models.ServiceCaller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(models.ServiceCaller)
+
+	return caller, ok
+}
+
+// UnaryInterceptor for authenticating the calling service
 func (s *serverAPI) validateBearerTokenInterceptor(
 	ctx context.Context,
 	req interface{},
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (interface{}, error) {
-	// Extract metadata from incoming context
-	md, ok := metadata.FromIncomingContext(ctx)
+	policy, ok := s.policies[info.FullMethod]
 	if !ok {
-		return nil, status.Error(codes.Unauthenticated, "missing metadata")
+		return nil, status.Error(codes.PermissionDenied, "method is not allowed")
+	}
+	if policy.Public {
+		return handler(ctx, req)
 	}
 
-	// Get the authorization tokens from metadata
-	tokens := md.Get("authorization")
-	if len(tokens) == 0 {
-		return nil, status.Error(codes.Unauthenticated, "missing authorization token")
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Validate the token
-	connectionToken := tokens[0]
-	if connectionToken != fmt.Sprintf("Bearer %s", s.connectionToken) {
-		return nil, status.Error(codes.Unauthenticated, "invalid authorization token")
+	if err := s.authorize(ctx, policy, caller, req); err != nil {
+		return nil, err
 	}
 
 	// Call the handler to proceed with the actual RPC
-	return handler(ctx, req)
+	return handler(context.WithValue(ctx, callerKey{}, caller), req)
+}
+
+// authorize checks the caller and the request against the policy of the method
+func (s *serverAPI) authorize(ctx context.Context, policy MethodPolicy, caller models.ServiceCaller, req interface{}) error {
+	if len(policy.Callers) > 0 &&
+		!slices.Contains(policy.Callers, caller.ClientID) &&
+		!slices.Contains(policy.Callers, caller.Identity) {
+		return status.Errorf(codes.PermissionDenied, "caller %s is not allowed", caller.ClientID)
+	}
+
+	for _, scope := range policy.Scopes {
+		if !caller.HasScope(scope) {
+			return status.Errorf(codes.PermissionDenied, "caller lacks the %s scope", scope)
+		}
+	}
+
+	if !policy.UserToken {
+		return nil
+	}
+
+	tokenReq, ok := req.(accessTokenRequest)
+	if !ok || tokenReq.GetAccessToken() == "" {
+		return status.Error(codes.PermissionDenied, "user access token is required")
+	}
+
+	if _, err := s.auth.ValidateAccessToken(ctx, tokenReq.GetAccessToken()); err != nil {
+		if st := inactiveStatus(err); st != nil {
+			return st
+		}
+
+		return status.Error(codes.PermissionDenied, "invalid user access token")
+	}
+
+	return nil
+}
+
+// authenticate identifies the calling service by its client certificate,
+// or by its service token when the certificate has no identity with scopes
+func (s *serverAPI) authenticate(ctx context.Context) (models.ServiceCaller, error) {
+	if identity := peerIdentity(ctx); identity != "" {
+		if scopes, ok := s.identities[identity]; ok {
+			return models.ServiceCaller{ClientID: identity, Scopes: scopes, Identity: identity}, nil
+		}
+	}
+
+	token, err := grpcauth.BearerToken(ctx)
+	if err != nil {
+		return models.ServiceCaller{}, err
+	}
+
+	// Validate the service token
+	caller, err := s.auth.ValidateServiceToken(ctx, token)
+	if err != nil {
+		return models.ServiceCaller{}, status.Error(codes.Unauthenticated, "invalid authorization token")
+	}
+	caller.Identity = peerIdentity(ctx)
+
+	return caller, nil
+}
+
+// peerIdentity returns the identity of the verified client certificate, empty without mTLS
+func peerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return certs.Identity(info.State.VerifiedChains[0][0])
 }
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"fmt"
+	"maps"
+
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+)
+
+// MethodPolicy is who may call an RPC
+type MethodPolicy struct {
+	// called without service credentials, like the exchange of them for a token
+	Public bool
+	// client ids or certificate identities allowed to call, any caller with the scopes when empty
+	Callers []string
+	// the RPC acts for a user, so the request carries a valid access token of an active user
+	UserToken bool
+	// every one of them is required
+	Scopes []string
+}
+
+// methodPolicies holds a policy for every RPC, methods missing here are refused
+var methodPolicies = map[string]MethodPolicy{
+	sso.Auth_IssueServiceToken_FullMethodName: {Public: true},
+
+	sso.Auth_ValidateAccessToken_FullMethodName: {Scopes: []string{ScopeValidate}},
+
+	sso.Auth_Register_FullMethodName:                  {Scopes: []string{ScopeGateway}},
+	sso.Auth_Login_FullMethodName:                     {Scopes: []string{ScopeGateway}},
+	sso.Auth_GetAccessToken_FullMethodName:            {Scopes: []string{ScopeGateway}},
+	sso.Auth_Logout_FullMethodName:                    {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_UpdatePassword_FullMethodName:            {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_SetNewPassword_FullMethodName:            {Scopes: []string{ScopeGateway}},
+	sso.Auth_EnrollTOTP_FullMethodName:                {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_ConfirmTOTP_FullMethodName:               {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_VerifyMFA_FullMethodName:                 {Scopes: []string{ScopeGateway}},
+	sso.Auth_GenerateRecoveryCodes_FullMethodName:     {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_RecoverAccount_FullMethodName:            {Scopes: []string{ScopeGateway}},
+	sso.Auth_BeginPasskeyRegistration_FullMethodName:  {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_FinishPasskeyRegistration_FullMethodName: {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_BeginPasskeyLogin_FullMethodName:         {Scopes: []string{ScopeGateway}},
+	sso.Auth_FinishPasskeyLogin_FullMethodName:        {Scopes: []string{ScopeGateway}},
+	sso.Auth_RequestLoginCode_FullMethodName:          {Scopes: []string{ScopeGateway}},
+	sso.Auth_LoginWithCode_FullMethodName:             {Scopes: []string{ScopeGateway}},
+	sso.Auth_TrustDevice_FullMethodName:               {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_ListTrustedDevices_FullMethodName:        {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_RevokeTrustedDevice_FullMethodName:       {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_SetPhone_FullMethodName:                  {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_VerifyPhone_FullMethodName:               {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_SendLoginSMS_FullMethodName:              {Scopes: []string{ScopeGateway}},
+	sso.Auth_VerifySMS_FullMethodName:                 {Scopes: []string{ScopeGateway}},
+	sso.Auth_RequestRecoverySMS_FullMethodName:        {Scopes: []string{ScopeGateway}},
+	sso.Auth_RecoverWithSMS_FullMethodName:            {Scopes: []string{ScopeGateway}},
+	// the access token is optional, it links the provider to the logged in user
+	sso.Auth_StartOAuth_FullMethodName:               {Scopes: []string{ScopeGateway}},
+	sso.Auth_CompleteOAuth_FullMethodName:            {Scopes: []string{ScopeGateway}},
+	sso.Auth_StartDeviceAuthorization_FullMethodName: {Scopes: []string{ScopeGateway}},
+	sso.Auth_LookupDevice_FullMethodName:             {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_ResolveDevice_FullMethodName:            {Scopes: []string{ScopeGateway}, UserToken: true},
+	sso.Auth_PollDeviceAuthorization_FullMethodName:  {Scopes: []string{ScopeGateway}},
+}
+
+// buildPolicies adds the configured callers, keyed by RPC name, to the policy table.
+// Every RPC of the service has to have a policy, so a new one can't be left open by mistake.
+func buildPolicies(callers map[string][]string) (map[string]MethodPolicy, error) {
+	const f = "auth.buildPolicies"
+
+	policies := maps.Clone(methodPolicies)
+
+	for _, method := range sso.Auth_ServiceDesc.Methods {
+		if _, ok := policies[fullMethod(method.MethodName)]; !ok {
+			return nil, fmt.Errorf("%s: no policy for %s", f, method.MethodName)
+		}
+	}
+
+	for name, allowed := range callers {
+		method := fullMethod(name)
+		policy, ok := policies[method]
+		if !ok {
+			return nil, fmt.Errorf("%s: callers set for unknown method %s", f, name)
+		}
+
+		policy.Callers = allowed
+		policies[method] = policy
+	}
+
+	return policies, nil
+}
+
+func fullMethod(name string) string {
+	return "/" + sso.Auth_ServiceDesc.ServiceName + "/" + name
+}
@@ -7,9 +7,11 @@ package mock_auth
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/kuromii5/miku-notes-auth/internal/models"
+	devicegrant "github.com/kuromii5/miku-notes-auth/internal/service/devicegrant"
 )
 
 // MockAuth is a mock of Auth interface.
@@ -35,6 +37,127 @@ func (m *MockAuth) EXPECT() *MockAuthMockRecorder {
 	return m.recorder
 }
 
+// BeginPasskeyLogin mocks base method.
+func (m *MockAuth) BeginPasskeyLogin(ctx context.Context, challengeToken string) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginPasskeyLogin", ctx, challengeToken)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// BeginPasskeyLogin indicates an expected call of BeginPasskeyLogin.
+func (mr *MockAuthMockRecorder) BeginPasskeyLogin(ctx, challengeToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginPasskeyLogin", reflect.TypeOf((*MockAuth)(nil).BeginPasskeyLogin), ctx, challengeToken)
+}
+
+// BeginPasskeyRegistration mocks base method.
+func (m *MockAuth) BeginPasskeyRegistration(ctx context.Context, accessToken string) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginPasskeyRegistration", ctx, accessToken)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// BeginPasskeyRegistration indicates an expected call of BeginPasskeyRegistration.
+func (mr *MockAuthMockRecorder) BeginPasskeyRegistration(ctx, accessToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginPasskeyRegistration", reflect.TypeOf((*MockAuth)(nil).BeginPasskeyRegistration), ctx, accessToken)
+}
+
+// CompleteOAuth mocks base method.
+func (m *MockAuth) CompleteOAuth(ctx context.Context, state, code, fingerprint, clientID string) (models.LoginResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteOAuth", ctx, state, code, fingerprint, clientID)
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompleteOAuth indicates an expected call of CompleteOAuth.
+func (mr *MockAuthMockRecorder) CompleteOAuth(ctx, state, code, fingerprint, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteOAuth", reflect.TypeOf((*MockAuth)(nil).CompleteOAuth), ctx, state, code, fingerprint, clientID)
+}
+
+// ConfirmTOTP mocks base method.
+func (m *MockAuth) ConfirmTOTP(ctx context.Context, accessToken, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTP", ctx, accessToken, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmTOTP indicates an expected call of ConfirmTOTP.
+func (mr *MockAuthMockRecorder) ConfirmTOTP(ctx, accessToken, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTP", reflect.TypeOf((*MockAuth)(nil).ConfirmTOTP), ctx, accessToken, code)
+}
+
+// EnrollTOTP mocks base method.
+func (m *MockAuth) EnrollTOTP(ctx context.Context, accessToken string) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnrollTOTP", ctx, accessToken)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// EnrollTOTP indicates an expected call of EnrollTOTP.
+func (mr *MockAuthMockRecorder) EnrollTOTP(ctx, accessToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollTOTP", reflect.TypeOf((*MockAuth)(nil).EnrollTOTP), ctx, accessToken)
+}
+
+// FinishPasskeyLogin mocks base method.
+func (m *MockAuth) FinishPasskeyLogin(ctx context.Context, sessionID string, credentialID, clientDataJSON, authenticatorData, signature []byte, fingerprint string) (models.LoginResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishPasskeyLogin", ctx, sessionID, credentialID, clientDataJSON, authenticatorData, signature, fingerprint)
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FinishPasskeyLogin indicates an expected call of FinishPasskeyLogin.
+func (mr *MockAuthMockRecorder) FinishPasskeyLogin(ctx, sessionID, credentialID, clientDataJSON, authenticatorData, signature, fingerprint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishPasskeyLogin", reflect.TypeOf((*MockAuth)(nil).FinishPasskeyLogin), ctx, sessionID, credentialID, clientDataJSON, authenticatorData, signature, fingerprint)
+}
+
+// FinishPasskeyRegistration mocks base method.
+func (m *MockAuth) FinishPasskeyRegistration(ctx context.Context, accessToken, sessionID string, clientDataJSON, attestationObject []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishPasskeyRegistration", ctx, accessToken, sessionID, clientDataJSON, attestationObject)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FinishPasskeyRegistration indicates an expected call of FinishPasskeyRegistration.
+func (mr *MockAuthMockRecorder) FinishPasskeyRegistration(ctx, accessToken, sessionID, clientDataJSON, attestationObject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishPasskeyRegistration", reflect.TypeOf((*MockAuth)(nil).FinishPasskeyRegistration), ctx, accessToken, sessionID, clientDataJSON, attestationObject)
+}
+
+// GenerateRecoveryCodes mocks base method.
+func (m *MockAuth) GenerateRecoveryCodes(ctx context.Context, accessToken string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GenerateRecoveryCodes", ctx, accessToken)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GenerateRecoveryCodes indicates an expected call of GenerateRecoveryCodes.
+func (mr *MockAuthMockRecorder) GenerateRecoveryCodes(ctx, accessToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateRecoveryCodes", reflect.TypeOf((*MockAuth)(nil).GenerateRecoveryCodes), ctx, accessToken)
+}
+
 // GetAccessToken mocks base method.
 func (m *MockAuth) GetAccessToken(ctx context.Context, refreshToken, fingerprint string) (string, error) {
 	m.ctrl.T.Helper()
@@ -50,19 +173,49 @@ func (mr *MockAuthMockRecorder) GetAccessToken(ctx, refreshToken, fingerprint in
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccessToken", reflect.TypeOf((*MockAuth)(nil).GetAccessToken), ctx, refreshToken, fingerprint)
 }
 
+// IssueServiceToken mocks base method.
+func (m *MockAuth) IssueServiceToken(ctx context.Context, clientID, clientSecret string, scopes []string) (models.ServiceToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IssueServiceToken", ctx, clientID, clientSecret, scopes)
+	ret0, _ := ret[0].(models.ServiceToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IssueServiceToken indicates an expected call of IssueServiceToken.
+func (mr *MockAuthMockRecorder) IssueServiceToken(ctx, clientID, clientSecret, scopes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IssueServiceToken", reflect.TypeOf((*MockAuth)(nil).IssueServiceToken), ctx, clientID, clientSecret, scopes)
+}
+
 // Login mocks base method.
-func (m *MockAuth) Login(ctx context.Context, email, password, fingerprint string) (models.TokenPair, error) {
+func (m *MockAuth) Login(ctx context.Context, email, password, fingerprint, clientID string) (models.LoginResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Login", ctx, email, password, fingerprint)
-	ret0, _ := ret[0].(models.TokenPair)
+	ret := m.ctrl.Call(m, "Login", ctx, email, password, fingerprint, clientID)
+	ret0, _ := ret[0].(models.LoginResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Login indicates an expected call of Login.
-func (mr *MockAuthMockRecorder) Login(ctx, email, password, fingerprint interface{}) *gomock.Call {
+func (mr *MockAuthMockRecorder) Login(ctx, email, password, fingerprint, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockAuth)(nil).Login), ctx, email, password, fingerprint, clientID)
+}
+
+// LoginWithCode mocks base method.
+func (m *MockAuth) LoginWithCode(ctx context.Context, email, code, linkToken, fingerprint, clientID string) (models.LoginResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginWithCode", ctx, email, code, linkToken, fingerprint, clientID)
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoginWithCode indicates an expected call of LoginWithCode.
+func (mr *MockAuthMockRecorder) LoginWithCode(ctx, email, code, linkToken, fingerprint, clientID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockAuth)(nil).Login), ctx, email, password, fingerprint)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginWithCode", reflect.TypeOf((*MockAuth)(nil).LoginWithCode), ctx, email, code, linkToken, fingerprint, clientID)
 }
 
 // Logout mocks base method.
@@ -79,19 +232,268 @@ func (mr *MockAuthMockRecorder) Logout(ctx, accessToken, fingerprint interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockAuth)(nil).Logout), ctx, accessToken, fingerprint)
 }
 
+// LookupDevice mocks base method.
+func (m *MockAuth) LookupDevice(ctx context.Context, accessToken, userCode string) (models.Client, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LookupDevice", ctx, accessToken, userCode)
+	ret0, _ := ret[0].(models.Client)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LookupDevice indicates an expected call of LookupDevice.
+func (mr *MockAuthMockRecorder) LookupDevice(ctx, accessToken, userCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LookupDevice", reflect.TypeOf((*MockAuth)(nil).LookupDevice), ctx, accessToken, userCode)
+}
+
+// PollDeviceAuthorization mocks base method.
+func (m *MockAuth) PollDeviceAuthorization(ctx context.Context, deviceCode, fingerprint string) (models.TokenPair, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PollDeviceAuthorization", ctx, deviceCode, fingerprint)
+	ret0, _ := ret[0].(models.TokenPair)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PollDeviceAuthorization indicates an expected call of PollDeviceAuthorization.
+func (mr *MockAuthMockRecorder) PollDeviceAuthorization(ctx, deviceCode, fingerprint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PollDeviceAuthorization", reflect.TypeOf((*MockAuth)(nil).PollDeviceAuthorization), ctx, deviceCode, fingerprint)
+}
+
+// RecoverAccount mocks base method.
+func (m *MockAuth) RecoverAccount(ctx context.Context, email, code, clientID string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecoverAccount", ctx, email, code, clientID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecoverAccount indicates an expected call of RecoverAccount.
+func (mr *MockAuthMockRecorder) RecoverAccount(ctx, email, code, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecoverAccount", reflect.TypeOf((*MockAuth)(nil).RecoverAccount), ctx, email, code, clientID)
+}
+
+// RecoverWithSMS mocks base method.
+func (m *MockAuth) RecoverWithSMS(ctx context.Context, email, code, clientID string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecoverWithSMS", ctx, email, code, clientID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecoverWithSMS indicates an expected call of RecoverWithSMS.
+func (mr *MockAuthMockRecorder) RecoverWithSMS(ctx, email, code, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecoverWithSMS", reflect.TypeOf((*MockAuth)(nil).RecoverWithSMS), ctx, email, code, clientID)
+}
+
 // Register mocks base method.
-func (m *MockAuth) Register(ctx context.Context, email, password string) (int32, error) {
+func (m *MockAuth) Register(ctx context.Context, email, password, clientID string) (int32, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Register", ctx, email, password)
+	ret := m.ctrl.Call(m, "Register", ctx, email, password, clientID)
 	ret0, _ := ret[0].(int32)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Register indicates an expected call of Register.
-func (mr *MockAuthMockRecorder) Register(ctx, email, password interface{}) *gomock.Call {
+func (mr *MockAuthMockRecorder) Register(ctx, email, password, clientID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockAuth)(nil).Register), ctx, email, password)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockAuth)(nil).Register), ctx, email, password, clientID)
+}
+
+// RequestLoginCode mocks base method.
+func (m *MockAuth) RequestLoginCode(ctx context.Context, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestLoginCode", ctx, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequestLoginCode indicates an expected call of RequestLoginCode.
+func (mr *MockAuthMockRecorder) RequestLoginCode(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestLoginCode", reflect.TypeOf((*MockAuth)(nil).RequestLoginCode), ctx, email)
+}
+
+// RequestRecoverySMS mocks base method.
+func (m *MockAuth) RequestRecoverySMS(ctx context.Context, email, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestRecoverySMS", ctx, email, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequestRecoverySMS indicates an expected call of RequestRecoverySMS.
+func (mr *MockAuthMockRecorder) RequestRecoverySMS(ctx, email, ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestRecoverySMS", reflect.TypeOf((*MockAuth)(nil).RequestRecoverySMS), ctx, email, ip)
+}
+
+// ResolveDevice mocks base method.
+func (m *MockAuth) ResolveDevice(ctx context.Context, accessToken, userCode string, approved bool) (models.Client, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveDevice", ctx, accessToken, userCode, approved)
+	ret0, _ := ret[0].(models.Client)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResolveDevice indicates an expected call of ResolveDevice.
+func (mr *MockAuthMockRecorder) ResolveDevice(ctx, accessToken, userCode, approved interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveDevice", reflect.TypeOf((*MockAuth)(nil).ResolveDevice), ctx, accessToken, userCode, approved)
+}
+
+// RevokeTrustedDevice mocks base method.
+func (m *MockAuth) RevokeTrustedDevice(ctx context.Context, accessToken string, deviceID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeTrustedDevice", ctx, accessToken, deviceID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeTrustedDevice indicates an expected call of RevokeTrustedDevice.
+func (mr *MockAuthMockRecorder) RevokeTrustedDevice(ctx, accessToken, deviceID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeTrustedDevice", reflect.TypeOf((*MockAuth)(nil).RevokeTrustedDevice), ctx, accessToken, deviceID)
+}
+
+// SendLoginSMS mocks base method.
+func (m *MockAuth) SendLoginSMS(ctx context.Context, challengeToken, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendLoginSMS", ctx, challengeToken, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendLoginSMS indicates an expected call of SendLoginSMS.
+func (mr *MockAuthMockRecorder) SendLoginSMS(ctx, challengeToken, ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendLoginSMS", reflect.TypeOf((*MockAuth)(nil).SendLoginSMS), ctx, challengeToken, ip)
+}
+
+// SetNewPassword mocks base method.
+func (m *MockAuth) SetNewPassword(ctx context.Context, restrictedToken, newPassword, fingerprint string) (models.TokenPair, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetNewPassword", ctx, restrictedToken, newPassword, fingerprint)
+	ret0, _ := ret[0].(models.TokenPair)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetNewPassword indicates an expected call of SetNewPassword.
+func (mr *MockAuthMockRecorder) SetNewPassword(ctx, restrictedToken, newPassword, fingerprint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNewPassword", reflect.TypeOf((*MockAuth)(nil).SetNewPassword), ctx, restrictedToken, newPassword, fingerprint)
+}
+
+// SetPhone mocks base method.
+func (m *MockAuth) SetPhone(ctx context.Context, accessToken, phone, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPhone", ctx, accessToken, phone, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPhone indicates an expected call of SetPhone.
+func (mr *MockAuthMockRecorder) SetPhone(ctx, accessToken, phone, ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPhone", reflect.TypeOf((*MockAuth)(nil).SetPhone), ctx, accessToken, phone, ip)
+}
+
+// SignUp mocks base method.
+func (m *MockAuth) SignUp(ctx context.Context, email, password, clientID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SignUp", ctx, email, password, clientID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SignUp indicates an expected call of SignUp.
+func (mr *MockAuthMockRecorder) SignUp(ctx, email, password, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignUp", reflect.TypeOf((*MockAuth)(nil).SignUp), ctx, email, password, clientID)
+}
+
+// StartDeviceAuthorization mocks base method.
+func (m *MockAuth) StartDeviceAuthorization(ctx context.Context, clientID string) (devicegrant.Authorization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartDeviceAuthorization", ctx, clientID)
+	ret0, _ := ret[0].(devicegrant.Authorization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StartDeviceAuthorization indicates an expected call of StartDeviceAuthorization.
+func (mr *MockAuthMockRecorder) StartDeviceAuthorization(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartDeviceAuthorization", reflect.TypeOf((*MockAuth)(nil).StartDeviceAuthorization), ctx, clientID)
+}
+
+// StartOAuth mocks base method.
+func (m *MockAuth) StartOAuth(ctx context.Context, provider, accessToken string) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartOAuth", ctx, provider, accessToken)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// StartOAuth indicates an expected call of StartOAuth.
+func (mr *MockAuthMockRecorder) StartOAuth(ctx, provider, accessToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartOAuth", reflect.TypeOf((*MockAuth)(nil).StartOAuth), ctx, provider, accessToken)
+}
+
+// TrustDevice mocks base method.
+func (m *MockAuth) TrustDevice(ctx context.Context, accessToken, fingerprint, name string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrustDevice", ctx, accessToken, fingerprint, name)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TrustDevice indicates an expected call of TrustDevice.
+func (mr *MockAuthMockRecorder) TrustDevice(ctx, accessToken, fingerprint, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrustDevice", reflect.TypeOf((*MockAuth)(nil).TrustDevice), ctx, accessToken, fingerprint, name)
+}
+
+// TrustedDevices mocks base method.
+func (m *MockAuth) TrustedDevices(ctx context.Context, accessToken string) ([]models.TrustedDevice, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrustedDevices", ctx, accessToken)
+	ret0, _ := ret[0].([]models.TrustedDevice)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TrustedDevices indicates an expected call of TrustedDevices.
+func (mr *MockAuthMockRecorder) TrustedDevices(ctx, accessToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrustedDevices", reflect.TypeOf((*MockAuth)(nil).TrustedDevices), ctx, accessToken)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockAuth) UpdatePassword(ctx context.Context, accessToken, oldPassword, newPassword string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, accessToken, oldPassword, newPassword)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockAuthMockRecorder) UpdatePassword(ctx, accessToken, oldPassword, newPassword interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockAuth)(nil).UpdatePassword), ctx, accessToken, oldPassword, newPassword)
 }
 
 // ValidateAccessToken mocks base method.
@@ -108,3 +510,62 @@ func (mr *MockAuthMockRecorder) ValidateAccessToken(ctx, token interface{}) *gom
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateAccessToken", reflect.TypeOf((*MockAuth)(nil).ValidateAccessToken), ctx, token)
 }
+
+// ValidateServiceToken mocks base method.
+func (m *MockAuth) ValidateServiceToken(ctx context.Context, token string) (models.ServiceCaller, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateServiceToken", ctx, token)
+	ret0, _ := ret[0].(models.ServiceCaller)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ValidateServiceToken indicates an expected call of ValidateServiceToken.
+func (mr *MockAuthMockRecorder) ValidateServiceToken(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateServiceToken", reflect.TypeOf((*MockAuth)(nil).ValidateServiceToken), ctx, token)
+}
+
+// VerifyMFA mocks base method.
+func (m *MockAuth) VerifyMFA(ctx context.Context, challengeToken, code, fingerprint string) (models.LoginResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyMFA", ctx, challengeToken, code, fingerprint)
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyMFA indicates an expected call of VerifyMFA.
+func (mr *MockAuthMockRecorder) VerifyMFA(ctx, challengeToken, code, fingerprint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyMFA", reflect.TypeOf((*MockAuth)(nil).VerifyMFA), ctx, challengeToken, code, fingerprint)
+}
+
+// VerifyPhone mocks base method.
+func (m *MockAuth) VerifyPhone(ctx context.Context, accessToken, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyPhone", ctx, accessToken, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyPhone indicates an expected call of VerifyPhone.
+func (mr *MockAuthMockRecorder) VerifyPhone(ctx, accessToken, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyPhone", reflect.TypeOf((*MockAuth)(nil).VerifyPhone), ctx, accessToken, code)
+}
+
+// VerifySMS mocks base method.
+func (m *MockAuth) VerifySMS(ctx context.Context, challengeToken, code, fingerprint string) (models.LoginResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifySMS", ctx, challengeToken, code, fingerprint)
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifySMS indicates an expected call of VerifySMS.
+func (mr *MockAuthMockRecorder) VerifySMS(ctx, challengeToken, code, fingerprint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifySMS", reflect.TypeOf((*MockAuth)(nil).VerifySMS), ctx, challengeToken, code, fingerprint)
+}
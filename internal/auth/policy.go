@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kuromii5/miku-notes-auth/internal/config"
+	"github.com/kuromii5/miku-notes-auth/pkg/strength"
+)
+
+// minLocalPartLength keeps short local parts like "me" from banning half of all passwords
+const minLocalPartLength = 3
+
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// PolicyError holds every rule the password breaks, so they can be shown together
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+type charClass struct {
+	name    string
+	message string
+	is      func(r rune) bool
+}
+
+var charClasses = map[string]charClass{
+	"lower":  {name: "lower", message: "password must contain a lowercase letter", is: unicode.IsLower},
+	"upper":  {name: "upper", message: "password must contain an uppercase letter", is: unicode.IsUpper},
+	"digit":  {name: "digit", message: "password must contain a digit", is: unicode.IsDigit},
+	"symbol": {name: "symbol", message: "password must contain a symbol", is: isSymbol},
+}
+
+type PasswordPolicy struct {
+	minLength   int
+	maxLength   int
+	minEntropy  float64
+	classes     []charClass
+	forbidEmail bool
+	denied      map[string]struct{}
+	estimator   *strength.Estimator
+}
+
+func NewPasswordPolicy(cfg config.PasswordPolicyConfig) (*PasswordPolicy, error) {
+	const f = "auth.NewPasswordPolicy"
+
+	policy := &PasswordPolicy{
+		minLength:   cfg.MinLength,
+		maxLength:   cfg.MaxLength,
+		minEntropy:  cfg.MinEntropy,
+		forbidEmail: cfg.ForbidEmail,
+		denied:      map[string]struct{}{},
+	}
+
+	for _, name := range cfg.RequiredClasses {
+		class, ok := charClasses[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown character class %q", f, name)
+		}
+
+		policy.classes = append(policy.classes, class)
+	}
+
+	denyList := cfg.DenyList
+	if cfg.DenyListFile != "" {
+		words, err := readDenyList(cfg.DenyListFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+
+		denyList = append(denyList, words...)
+	}
+
+	for _, word := range denyList {
+		policy.denied[strings.ToLower(word)] = struct{}{}
+	}
+
+	// denied words are also guessed first, so "mikunotes2024" is weak as well
+	policy.estimator = strength.New(denyList...)
+
+	return policy, nil
+}
+
+// Check returns *PolicyError with all violations or nil if the password is fine
+func (p *PasswordPolicy) Check(password, email string) error {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		violations = append(violations, Violation{
+			Rule:    "min_length",
+			Message: fmt.Sprintf("min password length is %d", p.minLength),
+		})
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		violations = append(violations, Violation{
+			Rule:    "max_length",
+			Message: fmt.Sprintf("max password length is %d", p.maxLength),
+		})
+	}
+
+	for _, class := range p.classes {
+		if !strings.ContainsFunc(password, class.is) {
+			violations = append(violations, Violation{Rule: "class_" + class.name, Message: class.message})
+		}
+	}
+
+	lower := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if p.forbidEmail && utf8.RuneCountInString(localPart) >= minLocalPartLength && strings.Contains(lower, localPart) {
+		violations = append(violations, Violation{
+			Rule:    "contains_email",
+			Message: "password must not contain your email",
+		})
+	}
+
+	if _, ok := p.denied[lower]; ok {
+		violations = append(violations, Violation{
+			Rule:    "deny_list",
+			Message: "this password is not allowed",
+		})
+	}
+
+	if p.minEntropy > 0 && p.estimator.Entropy(password, localPart) < p.minEntropy {
+		violations = append(violations, Violation{
+			Rule:    "min_entropy",
+			Message: "password is too easy to guess",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+func isSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+// readDenyList reads one word per line, empty lines and # comments are skipped
+func readDenyList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return words, nil
+}
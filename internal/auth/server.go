@@ -3,41 +3,107 @@ package auth
 import (
 	"context"
 	"errors"
+	"net"
+	"strings"
+	"time"
 
 	sso "github.com/kuromii5/miku-notes-auth/generated"
 	"github.com/kuromii5/miku-notes-auth/internal/models"
 	"github.com/kuromii5/miku-notes-auth/internal/repo/redis"
 	"github.com/kuromii5/miku-notes-auth/internal/service"
+	"github.com/kuromii5/miku-notes-auth/internal/service/devicegrant"
+	"github.com/kuromii5/miku-notes-auth/internal/service/logincode"
+	"github.com/kuromii5/miku-notes-auth/internal/service/mfa"
+	"github.com/kuromii5/miku-notes-auth/internal/service/passkey"
+	"github.com/kuromii5/miku-notes-auth/internal/service/smscode"
+	"github.com/kuromii5/miku-notes-auth/internal/service/social"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 type serverAPI struct {
 	sso.UnimplementedAuthServer
-	auth            Auth
-	connectionToken string
+	auth Auth
+	// scopes of the callers identified by their client certificate
+	identities map[string][]string
+	// who may call each RPC, keyed by the full method name
+	policies map[string]MethodPolicy
+
+	// hide whether an email is registered, Register answers the same for new and taken emails
+	antiEnumeration bool
 }
 
 //go:generate mockgen -source=server.go -destination=mock/server.go
 type Auth interface {
-	Register(ctx context.Context, email, password string) (int32, error)
-	Login(ctx context.Context, email, password, fingerprint string) (models.TokenPair, error)
+	Register(ctx context.Context, email, password, clientID string) (int32, error)
+	SignUp(ctx context.Context, email, password, clientID string) error
+	Login(ctx context.Context, email, password, fingerprint, clientID string) (models.LoginResult, error)
 	GetAccessToken(ctx context.Context, refreshToken, fingerprint string) (string, error)
 	ValidateAccessToken(ctx context.Context, token string) (int32, error)
 	Logout(ctx context.Context, accessToken, fingerprint string) error
+	UpdatePassword(ctx context.Context, accessToken, oldPassword, newPassword string) error
+	SetNewPassword(ctx context.Context, restrictedToken, newPassword, fingerprint string) (models.TokenPair, error)
+	EnrollTOTP(ctx context.Context, accessToken string) (string, string, error)
+	ConfirmTOTP(ctx context.Context, accessToken, code string) error
+	VerifyMFA(ctx context.Context, challengeToken, code, fingerprint string) (models.LoginResult, error)
+	GenerateRecoveryCodes(ctx context.Context, accessToken string) ([]string, error)
+	RecoverAccount(ctx context.Context, email, code, clientID string) (string, error)
+	BeginPasskeyRegistration(ctx context.Context, accessToken string) (string, string, error)
+	FinishPasskeyRegistration(ctx context.Context, accessToken, sessionID string, clientDataJSON, attestationObject []byte) error
+	BeginPasskeyLogin(ctx context.Context, challengeToken string) (string, string, error)
+	FinishPasskeyLogin(
+		ctx context.Context,
+		sessionID string,
+		credentialID, clientDataJSON, authenticatorData, signature []byte,
+		fingerprint string,
+	) (models.LoginResult, error)
+	RequestLoginCode(ctx context.Context, email string) error
+	LoginWithCode(ctx context.Context, email, code, linkToken, fingerprint, clientID string) (models.LoginResult, error)
+	TrustDevice(ctx context.Context, accessToken, fingerprint, name string) (time.Time, error)
+	TrustedDevices(ctx context.Context, accessToken string) ([]models.TrustedDevice, error)
+	RevokeTrustedDevice(ctx context.Context, accessToken string, deviceID int32) error
+	SetPhone(ctx context.Context, accessToken, phone, ip string) error
+	VerifyPhone(ctx context.Context, accessToken, code string) error
+	SendLoginSMS(ctx context.Context, challengeToken, ip string) error
+	VerifySMS(ctx context.Context, challengeToken, code, fingerprint string) (models.LoginResult, error)
+	RequestRecoverySMS(ctx context.Context, email, ip string) error
+	RecoverWithSMS(ctx context.Context, email, code, clientID string) (string, error)
+	StartOAuth(ctx context.Context, provider, accessToken string) (string, string, error)
+	CompleteOAuth(ctx context.Context, state, code, fingerprint, clientID string) (models.LoginResult, error)
+	StartDeviceAuthorization(ctx context.Context, clientID string) (devicegrant.Authorization, error)
+	LookupDevice(ctx context.Context, accessToken, userCode string) (models.Client, error)
+	ResolveDevice(ctx context.Context, accessToken, userCode string, approved bool) (models.Client, error)
+	PollDeviceAuthorization(ctx context.Context, deviceCode, fingerprint string) (models.TokenPair, error)
+	IssueServiceToken(ctx context.Context, clientID, clientSecret string, scopes []string) (models.ServiceToken, error)
+	ValidateServiceToken(ctx context.Context, token string) (models.ServiceCaller, error)
 }
 
-func RegisterServer(auth Auth, connectionToken string) *grpc.Server {
-	server := &serverAPI{auth: auth, connectionToken: connectionToken}
+func RegisterServer(
+	auth Auth,
+	identities map[string][]string,
+	callers map[string][]string,
+	antiEnumeration bool,
+	opts ...grpc.ServerOption,
+) (*grpc.Server, error) {
+	policies, err := buildPolicies(callers)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &serverAPI{auth: auth, identities: identities, policies: policies, antiEnumeration: antiEnumeration}
 
 	// Register the interceptor with the gRPC server
 	interceptor := grpc.UnaryInterceptor(server.validateBearerTokenInterceptor)
-	gRPC := grpc.NewServer(interceptor)
+	gRPC := grpc.NewServer(append(opts, interceptor)...)
 
 	sso.RegisterAuthServer(gRPC, server)
 
-	return gRPC
+	return gRPC, nil
 }
 
 func (s *serverAPI) Register(ctx context.Context, req *sso.RegisterRequest) (*sso.AuthResponse, error) {
@@ -46,25 +112,27 @@ func (s *serverAPI) Register(ctx context.Context, req *sso.RegisterRequest) (*ss
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	_, err = s.auth.Register(ctx, req.GetEmail(), req.GetPassword())
-	if err != nil {
-		if errors.Is(err, service.ErrUserExists) {
-			return nil, status.Error(codes.AlreadyExists, "user already exists")
+	if s.antiEnumeration {
+		// no tokens for anyone, the new account waits for the emailed
+		// confirmation and the owner of a taken email gets a notice instead
+		if err := s.auth.SignUp(ctx, req.GetEmail(), req.GetPassword(), req.GetClientId()); err != nil {
+			return nil, registerStatus(err)
 		}
 
-		return nil, status.Error(codes.Internal, "internal register error")
+		return &sso.AuthResponse{Message: checkEmailMessage}, nil
+	}
+
+	if _, err := s.auth.Register(ctx, req.GetEmail(), req.GetPassword(), req.GetClientId()); err != nil {
+		return nil, registerStatus(err)
 	}
 
 	// automatically log in after register
-	tokens, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), req.GetFingerprint())
+	result, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), req.GetFingerprint(), req.GetClientId())
 	if err != nil {
 		return nil, status.Error(codes.Internal, "internal login error")
 	}
 
-	return &sso.AuthResponse{
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-	}, nil
+	return loginResponse(result), nil
 }
 
 func (s *serverAPI) Login(ctx context.Context, req *sso.LoginRequest) (*sso.AuthResponse, error) {
@@ -74,27 +142,37 @@ func (s *serverAPI) Login(ctx context.Context, req *sso.LoginRequest) (*sso.Auth
 	}
 
 	// get the pair of tokens: access and refresh
-	tokens, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), req.GetFingerprint())
+	result, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), req.GetFingerprint(), req.GetClientId())
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidCreds) {
 			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
 		}
+		if st := clientStatus(err); st != nil {
+			return nil, st
+		}
+		if st := inactiveStatus(err); st != nil {
+			return nil, st
+		}
+		var lockedErr *service.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr)
+		}
 
 		return nil, status.Error(codes.Internal, "internal login error")
 	}
 
-	return &sso.AuthResponse{
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-	}, nil
+	return loginResponse(result), nil
 }
 
 func (s *serverAPI) GetAccessToken(ctx context.Context, req *sso.GetATRequest) (*sso.GetATResponse, error) {
 	accessToken, err := s.auth.GetAccessToken(ctx, req.GetRefreshToken(), req.GetFingerprint())
 	if err != nil {
-		if errors.Is(err, redis.ErrTokenNotFound) {
+		if errors.Is(err, redis.ErrTokenNotFound) || errors.Is(err, service.ErrInvalidToken) {
 			return nil, status.Error(codes.NotFound, "the refresh token does not exist")
 		}
+		if st := inactiveStatus(err); st != nil {
+			return nil, st
+		}
 
 		return nil, status.Error(codes.Internal, "failed to generate access token")
 	}
@@ -107,6 +185,10 @@ func (s *serverAPI) GetAccessToken(ctx context.Context, req *sso.GetATRequest) (
 func (s *serverAPI) ValidateAccessToken(ctx context.Context, req *sso.ValidateATRequest) (*sso.ValidateATResponse, error) {
 	userID, err := s.auth.ValidateAccessToken(ctx, req.GetAccessToken())
 	if err != nil {
+		if st := inactiveStatus(err); st != nil {
+			return nil, st
+		}
+
 		return nil, status.Error(codes.Unauthenticated, err.Error())
 	}
 
@@ -122,3 +204,929 @@ func (s *serverAPI) Logout(ctx context.Context, req *sso.LogoutRequest) (*sso.Lo
 
 	return &sso.LogoutResponse{}, nil
 }
+
+func (s *serverAPI) UpdatePassword(ctx context.Context, req *sso.UpdatePasswordRequest) (*sso.UpdatePasswordResponse, error) {
+	if err := validateUpdatePasswordRequest(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err := s.auth.UpdatePassword(ctx, req.GetAccessToken(), req.GetOldPassword(), req.GetNewPassword())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, service.ErrInvalidToken.Error())
+		}
+		if errors.Is(err, service.ErrInvalidCreds) {
+			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
+		}
+		if st := newPasswordStatus(err); st != nil {
+			return nil, st
+		}
+		if st := inactiveStatus(err); st != nil {
+			return nil, st
+		}
+		var lockedErr *service.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr)
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+
+		return nil, status.Error(codes.Internal, "failed to update password")
+	}
+
+	return &sso.UpdatePasswordResponse{}, nil
+}
+
+func (s *serverAPI) SetNewPassword(ctx context.Context, req *sso.SetNewPasswordRequest) (*sso.AuthResponse, error) {
+	if err := validateSetNewPasswordRequest(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	tokens, err := s.auth.SetNewPassword(ctx, req.GetRestrictedToken(), req.GetNewPassword(), req.GetFingerprint())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRestrictedToken) || errors.Is(err, service.ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired restricted token")
+		}
+		if st := newPasswordStatus(err); st != nil {
+			return nil, st
+		}
+		if st := inactiveStatus(err); st != nil {
+			return nil, st
+		}
+
+		return nil, status.Error(codes.Internal, "failed to set new password")
+	}
+
+	return &sso.AuthResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, req *sso.EnrollTOTPRequest) (*sso.EnrollTOTPResponse, error) {
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	secret, uri, err := s.auth.EnrollTOTP(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, mfaStatus(err, "failed to enroll totp")
+	}
+
+	return &sso.EnrollTOTPResponse{
+		Secret: secret,
+		Uri:    uri,
+	}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *sso.ConfirmTOTPRequest) (*sso.ConfirmTOTPResponse, error) {
+	if req.GetAccessToken() == "" || req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	if err := s.auth.ConfirmTOTP(ctx, req.GetAccessToken(), req.GetCode()); err != nil {
+		return nil, mfaStatus(err, "failed to confirm totp")
+	}
+
+	return &sso.ConfirmTOTPResponse{}, nil
+}
+
+func (s *serverAPI) VerifyMFA(ctx context.Context, req *sso.VerifyMFARequest) (*sso.AuthResponse, error) {
+	if req.GetChallengeToken() == "" || req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	result, err := s.auth.VerifyMFA(ctx, req.GetChallengeToken(), req.GetCode(), req.GetFingerprint())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCreds) {
+			return nil, status.Error(codes.InvalidArgument, mfa.ErrInvalidCode.Error())
+		}
+		var lockedErr *service.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr)
+		}
+
+		return nil, mfaStatus(err, "failed to verify second factor")
+	}
+
+	return loginResponse(result), nil
+}
+
+func (s *serverAPI) GenerateRecoveryCodes(ctx context.Context, req *sso.GenerateRecoveryCodesRequest) (*sso.GenerateRecoveryCodesResponse, error) {
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	recoveryCodes, err := s.auth.GenerateRecoveryCodes(ctx, req.GetAccessToken())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, service.ErrInvalidToken.Error())
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		if st := inactiveStatus(err); st != nil {
+			return nil, st
+		}
+
+		return nil, status.Error(codes.Internal, "failed to generate recovery codes")
+	}
+
+	return &sso.GenerateRecoveryCodesResponse{
+		Codes: recoveryCodes,
+	}, nil
+}
+
+func (s *serverAPI) RecoverAccount(ctx context.Context, req *sso.RecoverAccountRequest) (*sso.RecoverAccountResponse, error) {
+	if req.GetEmail() == "" || req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	restrictedToken, err := s.auth.RecoverAccount(ctx, req.GetEmail(), req.GetCode(), req.GetClientId())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCreds) {
+			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
+		}
+		if st := clientStatus(err); st != nil {
+			return nil, st
+		}
+		if st := inactiveStatus(err); st != nil {
+			return nil, st
+		}
+		var lockedErr *service.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr)
+		}
+
+		return nil, status.Error(codes.Internal, "failed to recover account")
+	}
+
+	return &sso.RecoverAccountResponse{
+		RestrictedToken: restrictedToken,
+	}, nil
+}
+
+func (s *serverAPI) BeginPasskeyRegistration(ctx context.Context, req *sso.BeginPasskeyRegistrationRequest) (*sso.BeginPasskeyResponse, error) {
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	sessionID, options, err := s.auth.BeginPasskeyRegistration(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, passkeyStatus(err, "failed to start passkey registration")
+	}
+
+	return &sso.BeginPasskeyResponse{
+		SessionId: sessionID,
+		Options:   options,
+	}, nil
+}
+
+func (s *serverAPI) FinishPasskeyRegistration(ctx context.Context, req *sso.FinishPasskeyRegistrationRequest) (*sso.FinishPasskeyRegistrationResponse, error) {
+	if req.GetAccessToken() == "" || req.GetSessionId() == "" ||
+		len(req.GetClientDataJson()) == 0 || len(req.GetAttestationObject()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	err := s.auth.FinishPasskeyRegistration(
+		ctx,
+		req.GetAccessToken(),
+		req.GetSessionId(),
+		req.GetClientDataJson(),
+		req.GetAttestationObject(),
+	)
+	if err != nil {
+		return nil, passkeyStatus(err, "failed to register passkey")
+	}
+
+	return &sso.FinishPasskeyRegistrationResponse{}, nil
+}
+
+func (s *serverAPI) BeginPasskeyLogin(ctx context.Context, req *sso.BeginPasskeyLoginRequest) (*sso.BeginPasskeyResponse, error) {
+	sessionID, options, err := s.auth.BeginPasskeyLogin(ctx, req.GetChallengeToken())
+	if err != nil {
+		return nil, passkeyStatus(err, "failed to start passkey login")
+	}
+
+	return &sso.BeginPasskeyResponse{
+		SessionId: sessionID,
+		Options:   options,
+	}, nil
+}
+
+func (s *serverAPI) FinishPasskeyLogin(ctx context.Context, req *sso.FinishPasskeyLoginRequest) (*sso.AuthResponse, error) {
+	if req.GetSessionId() == "" || len(req.GetCredentialId()) == 0 || len(req.GetClientDataJson()) == 0 ||
+		len(req.GetAuthenticatorData()) == 0 || len(req.GetSignature()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	result, err := s.auth.FinishPasskeyLogin(
+		ctx,
+		req.GetSessionId(),
+		req.GetCredentialId(),
+		req.GetClientDataJson(),
+		req.GetAuthenticatorData(),
+		req.GetSignature(),
+		req.GetFingerprint(),
+	)
+	if err != nil {
+		return nil, passkeyStatus(err, "failed to log in with passkey")
+	}
+
+	return loginResponse(result), nil
+}
+
+func (s *serverAPI) RequestLoginCode(ctx context.Context, req *sso.RequestLoginCodeRequest) (*sso.RequestLoginCodeResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	if err := s.auth.RequestLoginCode(ctx, req.GetEmail()); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmail):
+			return nil, status.Error(codes.InvalidArgument, service.ErrInvalidEmail.Error())
+		case errors.Is(err, logincode.ErrTooManyRequests):
+			return nil, status.Error(codes.ResourceExhausted, logincode.ErrTooManyRequests.Error())
+		case errors.Is(err, logincode.ErrNotConfigured):
+			return nil, status.Error(codes.FailedPrecondition, "login codes are not available")
+		}
+
+		return nil, status.Error(codes.Internal, "failed to send login code")
+	}
+
+	return &sso.RequestLoginCodeResponse{
+		Message: loginCodeMessage,
+	}, nil
+}
+
+func (s *serverAPI) LoginWithCode(ctx context.Context, req *sso.LoginWithCodeRequest) (*sso.AuthResponse, error) {
+	if req.GetLinkToken() == "" && (req.GetEmail() == "" || req.GetCode() == "") {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	result, err := s.auth.LoginWithCode(ctx, req.GetEmail(), req.GetCode(), req.GetLinkToken(), req.GetFingerprint(), req.GetClientId())
+	if err != nil {
+		if errors.Is(err, logincode.ErrInvalidCode) || errors.Is(err, service.ErrInvalidCreds) {
+			return nil, status.Error(codes.InvalidArgument, logincode.ErrInvalidCode.Error())
+		}
+		if st := clientStatus(err); st != nil {
+			return nil, st
+		}
+		if st := inactiveStatus(err); st != nil {
+			return nil, st
+		}
+		var lockedErr *service.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr)
+		}
+
+		return nil, status.Error(codes.Internal, "internal login error")
+	}
+
+	return loginResponse(result), nil
+}
+
+func (s *serverAPI) TrustDevice(ctx context.Context, req *sso.TrustDeviceRequest) (*sso.TrustDeviceResponse, error) {
+	if err := validateTrustDeviceRequest(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	until, err := s.auth.TrustDevice(ctx, req.GetAccessToken(), req.GetFingerprint(), req.GetName())
+	if err != nil {
+		return nil, deviceStatus(err, "failed to trust device")
+	}
+
+	return &sso.TrustDeviceResponse{
+		TrustedUntil: until.Unix(),
+	}, nil
+}
+
+func (s *serverAPI) ListTrustedDevices(ctx context.Context, req *sso.ListTrustedDevicesRequest) (*sso.ListTrustedDevicesResponse, error) {
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	devices, err := s.auth.TrustedDevices(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, deviceStatus(err, "failed to list trusted devices")
+	}
+
+	resp := &sso.ListTrustedDevicesResponse{
+		Devices: make([]*sso.TrustedDevice, 0, len(devices)),
+	}
+	for _, device := range devices {
+		info := &sso.TrustedDevice{
+			Id:           device.ID,
+			Name:         device.Name,
+			TrustedUntil: device.TrustedUntil.Unix(),
+			CreatedAt:    device.CreatedAt.Unix(),
+		}
+		if !device.LastSeenAt.IsZero() {
+			info.LastSeenAt = device.LastSeenAt.Unix()
+		}
+
+		resp.Devices = append(resp.Devices, info)
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeTrustedDevice(ctx context.Context, req *sso.RevokeTrustedDeviceRequest) (*sso.RevokeTrustedDeviceResponse, error) {
+	if req.GetAccessToken() == "" || req.GetDeviceId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	if err := s.auth.RevokeTrustedDevice(ctx, req.GetAccessToken(), req.GetDeviceId()); err != nil {
+		return nil, deviceStatus(err, "failed to revoke trusted device")
+	}
+
+	return &sso.RevokeTrustedDeviceResponse{}, nil
+}
+
+func (s *serverAPI) SetPhone(ctx context.Context, req *sso.SetPhoneRequest) (*sso.SetPhoneResponse, error) {
+	if req.GetAccessToken() == "" || req.GetPhone() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	if err := s.auth.SetPhone(ctx, req.GetAccessToken(), req.GetPhone(), clientIP(ctx)); err != nil {
+		return nil, smsStatus(err, "failed to send verification code")
+	}
+
+	return &sso.SetPhoneResponse{}, nil
+}
+
+func (s *serverAPI) VerifyPhone(ctx context.Context, req *sso.VerifyPhoneRequest) (*sso.VerifyPhoneResponse, error) {
+	if req.GetAccessToken() == "" || req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	if err := s.auth.VerifyPhone(ctx, req.GetAccessToken(), req.GetCode()); err != nil {
+		return nil, smsStatus(err, "failed to verify phone")
+	}
+
+	return &sso.VerifyPhoneResponse{}, nil
+}
+
+func (s *serverAPI) SendLoginSMS(ctx context.Context, req *sso.SendLoginSMSRequest) (*sso.SendLoginSMSResponse, error) {
+	if req.GetChallengeToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	if err := s.auth.SendLoginSMS(ctx, req.GetChallengeToken(), clientIP(ctx)); err != nil {
+		return nil, smsStatus(err, "failed to send login code")
+	}
+
+	return &sso.SendLoginSMSResponse{}, nil
+}
+
+func (s *serverAPI) VerifySMS(ctx context.Context, req *sso.VerifySMSRequest) (*sso.AuthResponse, error) {
+	if req.GetChallengeToken() == "" || req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	result, err := s.auth.VerifySMS(ctx, req.GetChallengeToken(), req.GetCode(), req.GetFingerprint())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCreds) {
+			return nil, status.Error(codes.InvalidArgument, smscode.ErrInvalidCode.Error())
+		}
+		var lockedErr *service.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr)
+		}
+
+		return nil, smsStatus(err, "failed to verify second factor")
+	}
+
+	return loginResponse(result), nil
+}
+
+func (s *serverAPI) RequestRecoverySMS(ctx context.Context, req *sso.RequestRecoverySMSRequest) (*sso.RequestRecoverySMSResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	if err := s.auth.RequestRecoverySMS(ctx, req.GetEmail(), clientIP(ctx)); err != nil {
+		if errors.Is(err, service.ErrInvalidEmail) {
+			return nil, status.Error(codes.InvalidArgument, service.ErrInvalidEmail.Error())
+		}
+
+		return nil, smsStatus(err, "failed to send recovery code")
+	}
+
+	return &sso.RequestRecoverySMSResponse{
+		Message: recoverySMSMessage,
+	}, nil
+}
+
+func (s *serverAPI) RecoverWithSMS(ctx context.Context, req *sso.RecoverWithSMSRequest) (*sso.RecoverAccountResponse, error) {
+	if req.GetEmail() == "" || req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	restrictedToken, err := s.auth.RecoverWithSMS(ctx, req.GetEmail(), req.GetCode(), req.GetClientId())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCreds) {
+			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
+		}
+		if errors.Is(err, service.ErrSMSRecoveryOff) {
+			return nil, status.Error(codes.FailedPrecondition, service.ErrSMSRecoveryOff.Error())
+		}
+		if st := clientStatus(err); st != nil {
+			return nil, st
+		}
+		if st := inactiveStatus(err); st != nil {
+			return nil, st
+		}
+		var lockedErr *service.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr)
+		}
+
+		return nil, status.Error(codes.Internal, "failed to recover account")
+	}
+
+	return &sso.RecoverAccountResponse{
+		RestrictedToken: restrictedToken,
+	}, nil
+}
+
+func (s *serverAPI) StartOAuth(ctx context.Context, req *sso.StartOAuthRequest) (*sso.StartOAuthResponse, error) {
+	if req.GetProvider() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	state, authURL, err := s.auth.StartOAuth(ctx, req.GetProvider(), req.GetAccessToken())
+	if err != nil {
+		return nil, oauthStatus(err, "failed to start oauth login")
+	}
+
+	return &sso.StartOAuthResponse{
+		State:            state,
+		AuthorizationUrl: authURL,
+	}, nil
+}
+
+func (s *serverAPI) CompleteOAuth(ctx context.Context, req *sso.CompleteOAuthRequest) (*sso.AuthResponse, error) {
+	if req.GetState() == "" || req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	result, err := s.auth.CompleteOAuth(ctx, req.GetState(), req.GetCode(), req.GetFingerprint(), req.GetClientId())
+	if err != nil {
+		return nil, oauthStatus(err, "failed to complete oauth login")
+	}
+
+	return loginResponse(result), nil
+}
+
+func (s *serverAPI) StartDeviceAuthorization(
+	ctx context.Context,
+	req *sso.StartDeviceAuthorizationRequest,
+) (*sso.DeviceAuthorizationResponse, error) {
+	auth, err := s.auth.StartDeviceAuthorization(ctx, req.GetClientId())
+	if err != nil {
+		if st := clientStatus(err); st != nil {
+			return nil, st
+		}
+
+		return nil, status.Error(codes.Internal, "failed to start device authorization")
+	}
+
+	return &sso.DeviceAuthorizationResponse{
+		DeviceCode:              auth.DeviceCode,
+		UserCode:                auth.UserCode,
+		VerificationUri:         auth.VerificationURI,
+		VerificationUriComplete: auth.VerificationURIComplete,
+		ExpiresIn:               int64(auth.ExpiresIn.Seconds()),
+		Interval:                int64(auth.Interval.Seconds()),
+	}, nil
+}
+
+func (s *serverAPI) LookupDevice(ctx context.Context, req *sso.LookupDeviceRequest) (*sso.LookupDeviceResponse, error) {
+	if req.GetAccessToken() == "" || req.GetUserCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	client, err := s.auth.LookupDevice(ctx, req.GetAccessToken(), req.GetUserCode())
+	if err != nil {
+		return nil, userCodeStatus(err, "failed to look up device code")
+	}
+
+	return &sso.LookupDeviceResponse{
+		ClientId:   client.ClientID,
+		ClientName: client.Name,
+	}, nil
+}
+
+func (s *serverAPI) ResolveDevice(ctx context.Context, req *sso.ResolveDeviceRequest) (*sso.ResolveDeviceResponse, error) {
+	if req.GetAccessToken() == "" || req.GetUserCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	client, err := s.auth.ResolveDevice(ctx, req.GetAccessToken(), req.GetUserCode(), req.GetApprove())
+	if err != nil {
+		return nil, userCodeStatus(err, "failed to resolve device code")
+	}
+
+	return &sso.ResolveDeviceResponse{
+		ClientId:   client.ClientID,
+		ClientName: client.Name,
+	}, nil
+}
+
+func (s *serverAPI) PollDeviceAuthorization(ctx context.Context, req *sso.PollDeviceAuthorizationRequest) (*sso.AuthResponse, error) {
+	if req.GetDeviceCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	tokens, err := s.auth.PollDeviceAuthorization(ctx, req.GetDeviceCode(), req.GetFingerprint())
+	if err != nil {
+		return nil, devicePollStatus(err)
+	}
+
+	return &sso.AuthResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+// IssueServiceToken is the client credentials grant for other services,
+// the only RPC that is called without a service token
+func (s *serverAPI) IssueServiceToken(ctx context.Context, req *sso.IssueServiceTokenRequest) (*sso.IssueServiceTokenResponse, error) {
+	if req.GetClientId() == "" || req.GetClientSecret() == "" {
+		return nil, status.Error(codes.InvalidArgument, ErrRequired.Error())
+	}
+
+	token, err := s.auth.IssueServiceToken(ctx, req.GetClientId(), req.GetClientSecret(), strings.Fields(req.GetScope()))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidClientCreds):
+			return nil, status.Error(codes.Unauthenticated, service.ErrInvalidClientCreds.Error())
+		case errors.Is(err, service.ErrScopeNotAllowed):
+			return nil, status.Error(codes.PermissionDenied, service.ErrScopeNotAllowed.Error())
+		}
+
+		return nil, status.Error(codes.Internal, "failed to issue service token")
+	}
+
+	return &sso.IssueServiceTokenResponse{
+		AccessToken: token.Token,
+		ExpiresIn:   int64(token.ExpiresIn.Seconds()),
+		Scope:       strings.Join(token.Scopes, " "),
+	}, nil
+}
+
+// devicePollStatus maps the errors of a device poll, the error info carries the RFC 8628 error code
+func devicePollStatus(err error) error {
+	var slowDownErr *devicegrant.SlowDownError
+	if errors.As(err, &slowDownErr) {
+		st, detailsErr := status.New(codes.ResourceExhausted, slowDownErr.Error()).WithDetails(
+			&errdetails.ErrorInfo{Reason: "slow_down", Domain: "miku-notes-auth"},
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(slowDownErr.Interval)},
+		)
+		if detailsErr != nil {
+			return status.Error(codes.ResourceExhausted, slowDownErr.Error())
+		}
+
+		return st.Err()
+	}
+
+	var (
+		code   codes.Code
+		reason string
+		msg    string
+	)
+	switch {
+	case errors.Is(err, devicegrant.ErrAuthorizationPending):
+		code, reason, msg = codes.FailedPrecondition, "authorization_pending", devicegrant.ErrAuthorizationPending.Error()
+	case errors.Is(err, devicegrant.ErrAccessDenied):
+		code, reason, msg = codes.PermissionDenied, "access_denied", devicegrant.ErrAccessDenied.Error()
+	case errors.Is(err, devicegrant.ErrExpiredToken), errors.Is(err, service.ErrUserNotFound):
+		code, reason, msg = codes.NotFound, "expired_token", devicegrant.ErrExpiredToken.Error()
+	default:
+		if st := inactiveStatus(err); st != nil {
+			return st
+		}
+		if st := clientStatus(err); st != nil {
+			return st
+		}
+
+		return status.Error(codes.Internal, "failed to poll device authorization")
+	}
+
+	st, detailsErr := status.New(code, msg).WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: "miku-notes-auth"})
+	if detailsErr != nil {
+		return status.Error(code, msg)
+	}
+
+	return st.Err()
+}
+
+// clientStatus maps the errors of the client id sent with a login, nil if it's another error
+func clientStatus(err error) error {
+	switch {
+	case errors.Is(err, service.ErrUnknownClient):
+		return status.Error(codes.InvalidArgument, service.ErrUnknownClient.Error())
+	case errors.Is(err, service.ErrClientNotAllowed):
+		return status.Error(codes.InvalidArgument, service.ErrClientNotAllowed.Error())
+	}
+
+	return nil
+}
+
+// userCodeStatus maps errors shared by the RPCs the web app calls with a device's user code
+func userCodeStatus(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, service.ErrInvalidToken.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, devicegrant.ErrInvalidUserCode):
+		return status.Error(codes.InvalidArgument, devicegrant.ErrInvalidUserCode.Error())
+	}
+
+	if st := inactiveStatus(err); st != nil {
+		return st
+	}
+	if st := clientStatus(err); st != nil {
+		return st
+	}
+
+	return status.Error(codes.Internal, msg)
+}
+
+// oauthStatus maps errors shared by the social login RPCs
+func oauthStatus(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, service.ErrInvalidToken.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, social.ErrUnknownProvider):
+		return status.Error(codes.InvalidArgument, social.ErrUnknownProvider.Error())
+	case errors.Is(err, social.ErrInvalidState):
+		return status.Error(codes.InvalidArgument, social.ErrInvalidState.Error())
+	case errors.Is(err, social.ErrProviderFailed):
+		return status.Error(codes.Unauthenticated, social.ErrProviderFailed.Error())
+	case errors.Is(err, service.ErrEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, service.ErrEmailNotVerified.Error())
+	case errors.Is(err, service.ErrInvalidEmail):
+		return status.Error(codes.InvalidArgument, service.ErrInvalidEmail.Error())
+	case errors.Is(err, service.ErrLinkRequired):
+		return status.Error(codes.AlreadyExists, service.ErrLinkRequired.Error())
+	case errors.Is(err, service.ErrIdentityTaken):
+		return status.Error(codes.AlreadyExists, service.ErrIdentityTaken.Error())
+	}
+
+	if st := clientStatus(err); st != nil {
+		return st
+	}
+	if st := inactiveStatus(err); st != nil {
+		return st
+	}
+
+	return status.Error(codes.Internal, msg)
+}
+
+// smsStatus maps errors shared by the sms RPCs
+func smsStatus(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, service.ErrInvalidToken.Error())
+	case errors.Is(err, service.ErrInvalidRestrictedToken):
+		return status.Error(codes.Unauthenticated, service.ErrInvalidRestrictedToken.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, service.ErrNoPhone):
+		return status.Error(codes.FailedPrecondition, service.ErrNoPhone.Error())
+	case errors.Is(err, smscode.ErrInvalidPhone):
+		return status.Error(codes.InvalidArgument, smscode.ErrInvalidPhone.Error())
+	case errors.Is(err, smscode.ErrInvalidCode):
+		return status.Error(codes.InvalidArgument, smscode.ErrInvalidCode.Error())
+	case errors.Is(err, smscode.ErrTooManyRequests):
+		return status.Error(codes.ResourceExhausted, smscode.ErrTooManyRequests.Error())
+	case errors.Is(err, smscode.ErrNotConfigured):
+		return status.Error(codes.FailedPrecondition, "sms is not available")
+	}
+
+	if st := inactiveStatus(err); st != nil {
+		return st
+	}
+
+	return status.Error(codes.Internal, msg)
+}
+
+// clientIPHeader carries the address of the end user, the gateway sets it for the requests it forwards
+const clientIPHeader = "x-client-ip"
+
+// clientIP is the address of the end user, empty when unknown. The gateway
+// forwards it in metadata, only callers with the gateway scope are trusted with it.
+// Direct callers are known by the address of the connected peer.
+func clientIP(ctx context.Context) string {
+	if caller, ok := CallerFromContext(ctx); ok && caller.HasScope(ScopeGateway) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(clientIPHeader); len(values) > 0 {
+				if ip := net.ParseIP(strings.TrimSpace(values[0])); ip != nil {
+					return ip.String()
+				}
+			}
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// deviceStatus maps errors shared by the trusted device RPCs
+func deviceStatus(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, service.ErrInvalidToken.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, service.ErrDeviceNotFound):
+		return status.Error(codes.NotFound, service.ErrDeviceNotFound.Error())
+	}
+
+	if st := inactiveStatus(err); st != nil {
+		return st
+	}
+
+	return status.Error(codes.Internal, msg)
+}
+
+// passkeyStatus maps errors shared by the passkey RPCs
+func passkeyStatus(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, service.ErrInvalidToken.Error())
+	case errors.Is(err, service.ErrInvalidRestrictedToken):
+		return status.Error(codes.Unauthenticated, service.ErrInvalidRestrictedToken.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, passkey.ErrInvalidCredential):
+		return status.Error(codes.InvalidArgument, passkey.ErrInvalidCredential.Error())
+	case errors.Is(err, passkey.ErrSessionNotFound):
+		return status.Error(codes.InvalidArgument, passkey.ErrSessionNotFound.Error())
+	case errors.Is(err, passkey.ErrAlreadyRegistered):
+		return status.Error(codes.AlreadyExists, passkey.ErrAlreadyRegistered.Error())
+	case errors.Is(err, passkey.ErrNotConfigured):
+		return status.Error(codes.FailedPrecondition, "passkeys are not available")
+	}
+
+	if st := inactiveStatus(err); st != nil {
+		return st
+	}
+
+	return status.Error(codes.Internal, msg)
+}
+
+// mfaStatus maps errors shared by the second factor RPCs
+func mfaStatus(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrInvalidRestrictedToken):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, mfa.ErrInvalidCode):
+		return status.Error(codes.InvalidArgument, mfa.ErrInvalidCode.Error())
+	case errors.Is(err, mfa.ErrAlreadyEnrolled):
+		return status.Error(codes.AlreadyExists, mfa.ErrAlreadyEnrolled.Error())
+	case errors.Is(err, mfa.ErrNotEnrolled):
+		return status.Error(codes.FailedPrecondition, mfa.ErrNotEnrolled.Error())
+	case errors.Is(err, mfa.ErrEnrollmentClosed):
+		return status.Error(codes.FailedPrecondition, "two-factor authentication is not available")
+	}
+
+	if st := inactiveStatus(err); st != nil {
+		return st
+	}
+
+	return status.Error(codes.Internal, msg)
+}
+
+// loginResponse carries either the tokens or the restricted token with its reason
+func loginResponse(result models.LoginResult) *sso.AuthResponse {
+	if result.RestrictedToken != "" {
+		return &sso.AuthResponse{
+			RestrictedToken: result.RestrictedToken,
+			Reason:          result.Reason,
+		}
+	}
+
+	return &sso.AuthResponse{
+		AccessToken:   result.Tokens.AccessToken,
+		RefreshToken:  result.Tokens.RefreshToken,
+		TrustedDevice: result.TrustedDevice,
+	}
+}
+
+// newPasswordStatus explains why a new password was rejected, nil for other errors
+func newPasswordStatus(err error) error {
+	var policyErr *PolicyError
+	if errors.As(err, &policyErr) {
+		return policyStatus(policyErr)
+	}
+	if errors.Is(err, service.ErrBreachedPass) {
+		return status.Error(codes.FailedPrecondition, ErrBreachedPassword.Error())
+	}
+	if errors.Is(err, service.ErrPasswordReuse) {
+		return status.Error(codes.FailedPrecondition, ErrPasswordReused.Error())
+	}
+
+	return nil
+}
+
+// lockedStatus tells the client when it may try to log in again
+func lockedStatus(err *service.LockedError) error {
+	st := status.New(codes.ResourceExhausted, err.Error())
+
+	detailed, detailsErr := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(err.RetryAfter),
+	})
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// registerStatus maps the errors of Register and SignUp
+func registerStatus(err error) error {
+	if errors.Is(err, service.ErrUserExists) {
+		return status.Error(codes.AlreadyExists, "user already exists")
+	}
+	if errors.Is(err, service.ErrInvalidEmail) {
+		return status.Error(codes.InvalidArgument, ErrInvalidEmail.Error())
+	}
+	if st := clientStatus(err); st != nil {
+		return st
+	}
+	if st := newPasswordStatus(err); st != nil {
+		return st
+	}
+
+	return status.Error(codes.Internal, "internal register error")
+}
+
+// inactiveStatus returns PermissionDenied for disabled, suspended and unconfirmed users, nil otherwise
+func inactiveStatus(err error) error {
+	if errors.Is(err, service.ErrUserDisabled) {
+		return status.Error(codes.PermissionDenied, "user is disabled")
+	}
+	if errors.Is(err, service.ErrUnverified) {
+		return status.Error(codes.PermissionDenied, "email is not confirmed, log in with the emailed code or link")
+	}
+
+	var suspendedErr *service.SuspendedError
+	if !errors.As(err, &suspendedErr) {
+		return nil
+	}
+
+	msg := "user is suspended: " + suspendedErr.Reason
+	metadata := map[string]string{"reason": suspendedErr.Reason}
+	if !suspendedErr.Until.IsZero() {
+		metadata["until"] = suspendedErr.Until.UTC().Format(time.RFC3339)
+	}
+
+	st, detailsErr := status.New(codes.PermissionDenied, msg).WithDetails(&errdetails.ErrorInfo{
+		Reason:   "USER_SUSPENDED",
+		Domain:   "miku-notes-auth",
+		Metadata: metadata,
+	})
+	if detailsErr != nil {
+		return status.Error(codes.PermissionDenied, msg)
+	}
+
+	return st.Err()
+}
+
+// policyStatus lists every violated password rule as a field violation
+func policyStatus(err *PolicyError) error {
+	st := status.New(codes.InvalidArgument, err.Error())
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(err.Violations))
+	for _, v := range err.Violations {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "password",
+			Description: v.Message,
+		})
+	}
+
+	detailed, detailsErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
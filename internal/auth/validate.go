@@ -8,15 +8,26 @@ import (
 )
 
 var (
-	ErrInvalidEmail  = errors.New("invalid email address")
-	ErrShortPassword = errors.New("min password length is 8")
-	ErrLongPassword  = errors.New("max password length is 64")
-	ErrRequired      = errors.New("this field is required")
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrRequired     = errors.New("this field is required")
+
+	ErrBreachedPassword = errors.New("this password has appeared in a data breach and can't be used, please choose a different one")
+	ErrPasswordReused   = errors.New("this password was used recently, please choose a different one")
 )
 
+// checkEmailMessage is the only Register answer in anti-enumeration mode
+const checkEmailMessage = "check your email to finish signing up"
+
+// loginCodeMessage doesn't tell whether the email is registered
+const loginCodeMessage = "if the email is registered, a login code was sent to it"
+
+// recoverySMSMessage doesn't tell whether the email is registered or has a phone
+const recoverySMSMessage = "if the account has a verified phone, a recovery code was sent to it"
+
+// password rules live in PasswordPolicy
 type RegisterRequest struct {
 	Email    string `validate:"required,email,max=254"`
-	Password string `validate:"required,min=8,max=64"`
+	Password string `validate:"required"`
 }
 
 func validateRegisterRequest(req *sso.RegisterRequest) error {
@@ -38,11 +49,6 @@ func validateRegisterRequest(req *sso.RegisterRequest) error {
 					return ErrRequired
 
 				case "Password":
-					if ve.Tag() == "min" {
-						return ErrShortPassword
-					} else if ve.Tag() == "max" {
-						return ErrLongPassword
-					}
 					return ErrRequired
 
 				default:
@@ -76,3 +82,77 @@ func validateLoginRequest(req *sso.LoginRequest) error {
 
 	return nil
 }
+
+type UpdatePasswordRequest struct {
+	AccessToken string `validate:"required"`
+	OldPassword string `validate:"required"`
+	NewPassword string `validate:"required"`
+}
+
+func validateUpdatePasswordRequest(req *sso.UpdatePasswordRequest) error {
+	validate := validator.New()
+
+	v := UpdatePasswordRequest{
+		AccessToken: req.GetAccessToken(),
+		OldPassword: req.GetOldPassword(),
+		NewPassword: req.GetNewPassword(),
+	}
+
+	if err := validate.Struct(v); err != nil {
+		return ErrRequired
+	}
+
+	return nil
+}
+
+type SetNewPasswordRequest struct {
+	RestrictedToken string `validate:"required"`
+	NewPassword     string `validate:"required"`
+}
+
+func validateSetNewPasswordRequest(req *sso.SetNewPasswordRequest) error {
+	validate := validator.New()
+
+	v := SetNewPasswordRequest{
+		RestrictedToken: req.GetRestrictedToken(),
+		NewPassword:     req.GetNewPassword(),
+	}
+
+	if err := validate.Struct(v); err != nil {
+		return ErrRequired
+	}
+
+	return nil
+}
+
+var ErrDeviceNameTooLong = errors.New("device name must be at most 255 characters")
+
+type TrustDeviceRequest struct {
+	AccessToken string `validate:"required"`
+	Fingerprint string `validate:"required"`
+	Name        string `validate:"max=255"`
+}
+
+func validateTrustDeviceRequest(req *sso.TrustDeviceRequest) error {
+	validate := validator.New()
+
+	v := TrustDeviceRequest{
+		AccessToken: req.GetAccessToken(),
+		Fingerprint: req.GetFingerprint(),
+		Name:        req.GetName(),
+	}
+
+	if err := validate.Struct(v); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			for _, ve := range validationErrors {
+				if ve.Field() == "Name" {
+					return ErrDeviceNameTooLong
+				}
+			}
+		}
+
+		return ErrRequired
+	}
+
+	return nil
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -17,6 +19,24 @@ type Config struct {
 	Postgres PostgresConfig `yaml:"postgres"`
 	GRPC     GrpcConfig     `yaml:"grpc"`
 	Tokens   TokensConfig   `yaml:"tokens"`
+	Lockout  LockoutConfig  `yaml:"lockout"`
+	Email    EmailConfig    `yaml:"email"`
+	Hasher   HasherConfig   `yaml:"hasher"`
+	Breach   BreachConfig   `yaml:"breached_passwords"`
+
+	PasswordPolicy PasswordPolicyConfig `yaml:"password_policy"`
+	MFA            MFAConfig            `yaml:"mfa"`
+	WebAuthn       WebAuthnConfig       `yaml:"webauthn"`
+	Mail           MailConfig           `yaml:"mail"`
+	LoginCode      LoginCodeConfig      `yaml:"login_code"`
+	TrustedDevices TrustedDevicesConfig `yaml:"trusted_devices"`
+	SMS            SMSConfig            `yaml:"sms"`
+	OAuth          OAuthConfig          `yaml:"oauth"`
+	OIDC           OIDCConfig           `yaml:"oidc"`
+	DeviceGrant    DeviceGrantConfig    `yaml:"device_grant"`
+
+	// Register answers "check your email" for new and taken emails alike
+	AntiEnumeration bool `yaml:"anti_enumeration" env:"ANTI_ENUMERATION" env-default:"false"`
 }
 
 type PostgresConfig struct {
@@ -33,11 +53,168 @@ type TokensConfig struct {
 	RefreshTTL time.Duration `yaml:"refresh_ttl" env:"TOKENS_REFRESH_TTL"`
 	RedisAddr  string        `yaml:"redis_addr" env:"TOKENS_REDIS_ADDR"`
 	Secret     string        `yaml:"secret" env:"TOKENS_SECRET"`
+	// lifetime of the tokens services get for their client credentials
+	ServiceTTL time.Duration `yaml:"service_ttl" env:"TOKENS_SERVICE_TTL" env-default:"15m"`
+}
+
+type LockoutConfig struct {
+	MaxAttempts int           `yaml:"max_attempts" env:"LOCKOUT_MAX_ATTEMPTS" env-default:"5"`
+	Window      time.Duration `yaml:"window" env:"LOCKOUT_WINDOW" env-default:"15m"`
+	BaseDelay   time.Duration `yaml:"base_delay" env:"LOCKOUT_BASE_DELAY" env-default:"1m"`
+	MaxDelay    time.Duration `yaml:"max_delay" env:"LOCKOUT_MAX_DELAY" env-default:"24h"`
+}
+
+type EmailConfig struct {
+	// reduce addresses of known providers to their mailbox, e.g. drop gmail dots and plus-tags
+	ProviderRules bool `yaml:"provider_rules" env:"EMAIL_PROVIDER_RULES" env-default:"false"`
+}
+
+type HasherConfig struct {
+	Algorithm         string `yaml:"algorithm" env:"HASHER_ALGORITHM" env-default:"argon2id"`
+	Argon2Memory      uint32 `yaml:"argon2_memory" env:"HASHER_ARGON2_MEMORY" env-default:"65536"` // KiB
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" env:"HASHER_ARGON2_ITERATIONS" env-default:"3"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" env:"HASHER_ARGON2_PARALLELISM" env-default:"2"`
+	BcryptCost        int    `yaml:"bcrypt_cost" env:"HASHER_BCRYPT_COST" env-default:"10"`
+	// "version:base64 key" entries, also read from the file with one entry per line.
+	// Passwords aren't peppered when there are none.
+	Peppers       []string `yaml:"peppers" env:"HASHER_PEPPERS" env-separator:","`
+	PepperFile    string   `yaml:"pepper_file" env:"HASHER_PEPPER_FILE"`
+	PepperVersion int      `yaml:"pepper_version" env:"HASHER_PEPPER_VERSION"` // 0 picks the newest
+}
+
+type BreachConfig struct {
+	// directory with HIBP-style range files, the check is off when empty
+	Dir      string `yaml:"dir" env:"BREACHED_PASSWORDS_DIR"`
+	MinCount int    `yaml:"min_count" env:"BREACHED_PASSWORDS_MIN_COUNT" env-default:"1"`
+}
+
+type PasswordPolicyConfig struct {
+	MinLength  int     `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	MaxLength  int     `yaml:"max_length" env:"PASSWORD_MAX_LENGTH" env-default:"64"`
+	MinEntropy float64 `yaml:"min_entropy" env:"PASSWORD_MIN_ENTROPY" env-default:"20"` // bits, 0 turns the check off
+	// any of "lower", "upper", "digit", "symbol"
+	RequiredClasses []string `yaml:"required_classes" env:"PASSWORD_REQUIRED_CLASSES" env-separator:","`
+	ForbidEmail     bool     `yaml:"forbid_email" env:"PASSWORD_FORBID_EMAIL" env-default:"true"`
+	DenyList        []string `yaml:"deny_list" env:"PASSWORD_DENY_LIST" env-separator:","`
+	DenyListFile    string   `yaml:"deny_list_file" env:"PASSWORD_DENY_LIST_FILE"`
+	// how many previous passwords can't be reused, 0 only forbids the current one
+	HistorySize int `yaml:"history_size" env:"PASSWORD_HISTORY_SIZE" env-default:"5"`
+	// passwords older than this have to be changed at login, 0 means they never expire
+	MaxAge time.Duration `yaml:"max_age" env:"PASSWORD_MAX_AGE" env-default:"0"`
+}
+
+type MFAConfig struct {
+	Issuer string `yaml:"issuer" env:"MFA_ISSUER" env-default:"miku-notes"` // shown in authenticator apps
+	// base64 AES-256 key for TOTP secrets, nobody can enroll without it
+	EncryptionKey string `yaml:"encryption_key" env:"MFA_ENCRYPTION_KEY"`
+	Skew          int    `yaml:"skew" env:"MFA_SKEW" env-default:"1"` // 30s steps accepted around the current one
+}
+
+type WebAuthnConfig struct {
+	// domain passkeys are bound to, passkeys are off when empty
+	RPID   string `yaml:"rp_id" env:"WEBAUTHN_RP_ID"`
+	RPName string `yaml:"rp_name" env:"WEBAUTHN_RP_NAME" env-default:"miku-notes"`
+	// exact origins of the pages that call navigator.credentials
+	Origins []string `yaml:"origins" env:"WEBAUTHN_ORIGINS" env-separator:","`
+}
+
+type MailConfig struct {
+	// messages are sent through the SMTP server when the host is set,
+	// otherwise written to the outbox directory, mail is off when both are empty
+	SMTPHost     string `yaml:"smtp_host" env:"MAIL_SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"MAIL_SMTP_PORT" env-default:"587"`
+	SMTPUsername string `yaml:"smtp_username" env:"MAIL_SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"MAIL_SMTP_PASSWORD"`
+	OutboxDir    string `yaml:"outbox_dir" env:"MAIL_OUTBOX_DIR"`
+	From         string `yaml:"from" env:"MAIL_FROM" env-default:"miku-notes <no-reply@localhost>"`
+}
+
+type LoginCodeConfig struct {
+	TTL         time.Duration `yaml:"ttl" env:"LOGIN_CODE_TTL" env-default:"10m"`
+	MaxAttempts int           `yaml:"max_attempts" env:"LOGIN_CODE_MAX_ATTEMPTS" env-default:"5"` // wrong guesses before the code is burnt
+	Cooldown    time.Duration `yaml:"cooldown" env:"LOGIN_CODE_COOLDOWN" env-default:"1m"`        // between two codes for one email
+	// page of the magic link, it gets the token as the "token" query parameter
+	LinkURL string `yaml:"link_url" env:"LOGIN_CODE_LINK_URL" env-default:"http://localhost:3000/login/link"`
+}
+
+type DeviceGrantConfig struct {
+	TTL      time.Duration `yaml:"ttl" env:"DEVICE_GRANT_TTL" env-default:"10m"`
+	Interval time.Duration `yaml:"interval" env:"DEVICE_GRANT_INTERVAL" env-default:"5s"` // devices poll at most this often
+	// page of the web app where users enter the code, it gets the code as the "user_code" query parameter
+	VerificationURL string `yaml:"verification_url" env:"DEVICE_GRANT_VERIFICATION_URL" env-default:"http://localhost:3000/device"`
+}
+
+type TrustedDevicesConfig struct {
+	TrustDays int `yaml:"trust_days" env:"TRUSTED_DEVICES_TRUST_DAYS" env-default:"30"` // how long a device stays trusted
+}
+
+type SMSConfig struct {
+	// endpoint messages are posted to as JSON, sms is off when empty
+	ProviderURL   string        `yaml:"provider_url" env:"SMS_PROVIDER_URL"`
+	ProviderToken string        `yaml:"provider_token" env:"SMS_PROVIDER_TOKEN"` // sent as a bearer token
+	From          string        `yaml:"from" env:"SMS_FROM"`
+	Timeout       time.Duration `yaml:"timeout" env:"SMS_TIMEOUT" env-default:"10s"`
+	TTL           time.Duration `yaml:"ttl" env:"SMS_CODE_TTL" env-default:"5m"`
+	MaxAttempts   int           `yaml:"max_attempts" env:"SMS_CODE_MAX_ATTEMPTS" env-default:"5"`
+	// messages allowed to one number and to one client address in the window, 0 turns a limit off
+	PerNumberLimit int           `yaml:"per_number_limit" env:"SMS_PER_NUMBER_LIMIT" env-default:"5"`
+	PerIPLimit     int           `yaml:"per_ip_limit" env:"SMS_PER_IP_LIMIT" env-default:"20"`
+	LimitWindow    time.Duration `yaml:"limit_window" env:"SMS_LIMIT_WINDOW" env-default:"1h"`
+}
+
+// OAuthConfig is read from the yaml file only, providers are keyed by the name clients use
+type OAuthConfig struct {
+	Providers map[string]OAuthProviderConfig `yaml:"providers"`
+	Timeout   time.Duration                  `yaml:"timeout" env-default:"10s"`
+}
+
+type OAuthProviderConfig struct {
+	// OpenID Connect providers only need the issuer, the endpoints are discovered
+	Issuer string `yaml:"issuer"`
+	// plain OAuth2 providers, like GitHub, need the endpoints instead
+	AuthURL     string `yaml:"auth_url"`
+	TokenURL    string `yaml:"token_url"`
+	UserInfoURL string `yaml:"userinfo_url"`
+
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"` // frontend page the provider sends the code to
+	Scopes       []string `yaml:"scopes"`
+	// the user info endpoint only shows emails the provider has verified
+	EmailsVerified bool `yaml:"emails_verified"`
+}
+
+// OIDCConfig is read from the yaml file only, the provider is off without an issuer
+type OIDCConfig struct {
+	Issuer         string        `yaml:"issuer"` // public url of the http server
+	Port           int           `yaml:"port" env-default:"8080"`
+	SigningKeyFile string        `yaml:"signing_key_file"`            // PEM RSA private key the id tokens are signed with
+	LoginTTL       time.Duration `yaml:"login_ttl" env-default:"10m"` // time the user has on the login pages
+	CodeTTL        time.Duration `yaml:"code_ttl" env-default:"1m"`
+	IDTokenTTL     time.Duration `yaml:"id_token_ttl" env-default:"1h"`
 }
 
 type GrpcConfig struct {
-	Port            int    `yaml:"port" env:"GRPC_PORT"`
-	ConnectionToken string `yaml:"connection_token" env:"GRPC_CONNECTION_TOKEN"`
+	Port                 int           `yaml:"port" env:"GRPC_PORT"`
+	AdminPort            int           `yaml:"admin_port" env:"GRPC_ADMIN_PORT"`
+	AdminConnectionToken string        `yaml:"admin_connection_token" env:"GRPC_ADMIN_CONNECTION_TOKEN"`
+	TLS                  GrpcTLSConfig `yaml:"tls"`
+	// client ids or certificate identities allowed to call an RPC, keyed by its name,
+	// RPCs missing here can be called by any service with the scopes
+	Callers map[string][]string `yaml:"callers"`
+}
+
+// GrpcTLSConfig turns on TLS for both servers when the certificate is set,
+// and mTLS when the client CA bundle is set too
+type GrpcTLSConfig struct {
+	CertFile          string        `yaml:"cert_file" env:"GRPC_TLS_CERT_FILE"`
+	KeyFile           string        `yaml:"key_file" env:"GRPC_TLS_KEY_FILE"`
+	ClientCAFile      string        `yaml:"client_ca_file" env:"GRPC_TLS_CLIENT_CA_FILE"`
+	RequireClientCert bool          `yaml:"require_client_cert" env:"GRPC_TLS_REQUIRE_CLIENT_CERT"`
+	ReloadInterval    time.Duration `yaml:"reload_interval" env:"GRPC_TLS_RELOAD_INTERVAL" env-default:"1m"`
+	// scopes of the callers identified by the SPIFFE ID or DNS name of their certificate,
+	// they don't need a service token
+	Identities map[string][]string `yaml:"identities"`
 }
 
 func MustLoad() *Config {
@@ -117,3 +294,43 @@ func (pc PostgresConfig) ConnString() string {
 	return fmt.Sprintf("user=%s password=%s host=%s port=%d dbname=%s sslmode=%s",
 		pc.User, pc.Password, pc.Host, pc.Port, pc.DBName, pc.SSLMode)
 }
+
+// LogValue hides the secrets, the whole config is logged at startup
+func (c Config) LogValue() slog.Value {
+	// same fields without this method, so the value isn't resolved again
+	type plain Config
+
+	c.Postgres.Password = redact(c.Postgres.Password)
+	c.Tokens.Secret = redact(c.Tokens.Secret)
+	c.GRPC.AdminConnectionToken = redact(c.GRPC.AdminConnectionToken)
+	c.MFA.EncryptionKey = redact(c.MFA.EncryptionKey)
+	c.Mail.SMTPPassword = redact(c.Mail.SMTPPassword)
+	c.SMS.ProviderToken = redact(c.SMS.ProviderToken)
+
+	// the slice and the map are shared with the config, so they are copied
+	peppers := make([]string, 0, len(c.Hasher.Peppers))
+	for _, pepper := range c.Hasher.Peppers {
+		// the version is no secret and tells which keys are loaded
+		version, key, _ := strings.Cut(pepper, ":")
+		peppers = append(peppers, version+":"+redact(key))
+	}
+	c.Hasher.Peppers = peppers
+
+	providers := make(map[string]OAuthProviderConfig, len(c.OAuth.Providers))
+	for name, provider := range c.OAuth.Providers {
+		provider.ClientSecret = redact(provider.ClientSecret)
+		providers[name] = provider
+	}
+	c.OAuth.Providers = providers
+
+	return slog.AnyValue(plain(c))
+}
+
+// redact keeps only whether the secret is set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return "[REDACTED]"
+}
@@ -0,0 +1,33 @@
+package grpcauth
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// BearerToken returns the token of the authorization header,
+// the errors are ready to be returned by an interceptor
+func BearerToken(ctx context.Context) (string, error) {
+	// Extract metadata from incoming context
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "missing metadata")
+	}
+
+	// Get the authorization tokens from metadata
+	tokens := md.Get("authorization")
+	if len(tokens) == 0 {
+		return "", status.Error(codes.Unauthenticated, "missing authorization token")
+	}
+
+	token, found := strings.CutPrefix(tokens[0], "Bearer ")
+	if !found || token == "" {
+		return "", status.Error(codes.Unauthenticated, "invalid authorization token")
+	}
+
+	return token, nil
+}
@@ -1,16 +1,171 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"time"
+)
+
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusDisabled  = "disabled"
+	// signed up while anti-enumeration is on and hasn't confirmed the email yet
+	UserStatusUnverified = "unverified"
+)
 
 type User struct {
 	ID           int32
 	Email        string
 	PasswordHash []byte
+	Status       string
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+
+	// set only for suspended users, zero SuspendedUntil means indefinitely
+	SuspensionReason string
+	SuspendedUntil   time.Time
+
+	PasswordChangedAt  time.Time
+	MustChangePassword bool  // set by admins, cleared by the next password change
+	PasswordVersion    int32 // counts password changes, restricted tokens are bound to it
+
+	// E.164, empty until the user verified a number. A verified phone is a second factor.
+	Phone string
 }
 
 type TokenPair struct {
 	AccessToken  string
 	RefreshToken string
 }
+
+// reasons for a restricted login
+const (
+	ReasonPasswordExpired        = "password_expired"
+	ReasonPasswordChangeRequired = "password_change_required"
+	ReasonMFARequired            = "mfa_required"
+)
+
+// LoginResult holds either a token pair or, when the user has to do something
+// before getting one, a restricted token and the reason for it
+type LoginResult struct {
+	Tokens TokenPair
+
+	RestrictedToken string
+	Reason          string
+
+	// the login came from a device the user marked as trusted
+	TrustedDevice bool
+}
+
+// UserFilter describes a paginated admin search over users.
+// Empty fields are not applied.
+type UserFilter struct {
+	ID          int32
+	EmailPrefix string
+	AfterID     int32
+	Limit       int
+}
+
+// Session is a single refresh token issued to a user's device
+type Session struct {
+	Fingerprint string
+	ExpiresIn   time.Duration
+}
+
+// TOTP is a user's authenticator app enrollment
+type TOTP struct {
+	UserID          int32
+	EncryptedSecret []byte
+	Confirmed       bool
+}
+
+// RecoveryCode is a hashed single-use code for getting back into the account
+type RecoveryCode struct {
+	ID   int32
+	Hash []byte
+}
+
+// WebAuthnCredential is a registered passkey or security key
+type WebAuthnCredential struct {
+	ID           int32
+	UserID       int32
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+}
+
+// TrustedDevice is a login fingerprint the user marked as their own
+type TrustedDevice struct {
+	ID           int32
+	Name         string
+	TrustedUntil time.Time
+	LastSeenAt   time.Time // zero until the first login after trusting
+	CreatedAt    time.Time
+}
+
+// Identity links a user to their account at an OAuth2 or OpenID Connect provider
+type Identity struct {
+	UserID   int32
+	Provider string
+	Subject  string // the user's id at the provider
+	Email    string
+}
+
+// grant types a client can be allowed to use
+const (
+	GrantPassword          = "password" // Login and Register of the first-party apps
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantClientCredentials = "client_credentials" // other services calling the RPCs
+)
+
+// DefaultGrantTypes are the grants of callers that don't send a client id,
+// the first-party apps logging users in. Other grants need a registered client.
+var DefaultGrantTypes = []string{GrantPassword, GrantRefreshToken}
+
+// Client is an app that gets tokens for users. The zero Client stands for
+// callers that don't send a client id: they use the default grants and the configured lifetimes.
+type Client struct {
+	ClientID     string
+	Name         string
+	SecretHash   []byte // nil for public clients
+	GrantTypes   []string
+	RedirectURIs []string
+	Scopes       []string      // what the client may request, nothing when empty
+	AccessTTL    time.Duration // zero keeps the configured lifetime
+	RefreshTTL   time.Duration
+}
+
+// Allows reports whether the client can use the grant type
+func (c Client) Allows(grantType string) bool {
+	if c.ClientID == "" {
+		return slices.Contains(DefaultGrantTypes, grantType)
+	}
+
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// ServiceCaller is a service that calls the RPCs with a service token or a client certificate
+type ServiceCaller struct {
+	ClientID string // the identity of the certificate for callers without a token
+	Scopes   []string
+	Identity string // SPIFFE ID or DNS name of the client certificate, empty without mTLS
+}
+
+func (c ServiceCaller) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ServiceToken is what a service gets for its client credentials
+type ServiceToken struct {
+	Token     string
+	Scopes    []string
+	ExpiresIn time.Duration
+}
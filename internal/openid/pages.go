@@ -0,0 +1,77 @@
+package openid
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// stepLogin is the first page, the later ones are the service steps
+const stepLogin = "login"
+
+type pageData struct {
+	RequestID  string
+	Step       string
+	ClientName string
+	MFAMethod  string
+	Email      bool // the client asked for the email address
+	Error      string
+}
+
+// every step posts the request id back, it's the only state of the pages
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Miku Notes</title>
+<style>
+body { font-family: sans-serif; max-width: 22rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; margin-top: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Miku Notes</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if eq .Step "login"}}
+<p>Log in to continue to {{.ClientName}}.</p>
+<form method="post" action="/authorize/login">
+<input type="hidden" name="request_id" value="{{.RequestID}}">
+<label>Email <input type="email" name="email" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<button type="submit">Log in</button>
+</form>
+<form method="post" action="/authorize/consent">
+<input type="hidden" name="request_id" value="{{.RequestID}}">
+<button type="submit" name="decision" value="deny">Cancel</button>
+</form>
+{{else if eq .Step "mfa"}}
+<p>{{if eq .MFAMethod "sms"}}Enter the code we texted to your phone.{{else}}Enter the code from your authenticator app.{{end}}</p>
+<form method="post" action="/authorize/mfa">
+<input type="hidden" name="request_id" value="{{.RequestID}}">
+<label>Code <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code" required></label>
+<button type="submit">Verify</button>
+</form>
+{{else if eq .Step "consent"}}
+<p>{{.ClientName}} wants to know who you are{{if .Email}} and your email address{{end}}, and to use your Miku Notes account for you.</p>
+<form method="post" action="/authorize/consent">
+<input type="hidden" name="request_id" value="{{.RequestID}}">
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+func renderPage(w http.ResponseWriter, status int, data pageData) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	// the consent page can't be framed and clicked through by another site
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	h.Set("X-Frame-Options", "DENY")
+
+	w.WriteHeader(status)
+	_ = page.Execute(w, data)
+}
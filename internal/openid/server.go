@@ -0,0 +1,338 @@
+package openid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/service"
+	"github.com/kuromii5/miku-notes-auth/internal/service/issuer"
+	"github.com/kuromii5/miku-notes-auth/internal/service/smscode"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+type serverAPI struct {
+	log      *slog.Logger
+	provider Provider
+}
+
+//go:generate mockgen -source=server.go -destination=mock/server.go
+type Provider interface {
+	Discovery() map[string]any
+	JWKS() map[string]any
+	Authorize(ctx context.Context, responseType, codeChallengeMethod string, auth issuer.Authorization) (string, error)
+	Authorization(ctx context.Context, id string) (issuer.Authorization, models.Client, error)
+	LoginPassword(ctx context.Context, id, email, password, ip string) (string, error)
+	LoginMFA(ctx context.Context, id, code string) error
+	Consent(ctx context.Context, id string, approved bool) (string, error)
+	Exchange(ctx context.Context, clientID, clientSecret, code, redirectURI, codeVerifier string) (issuer.Tokens, error)
+	Refresh(ctx context.Context, clientID, clientSecret, refreshToken string) (issuer.Tokens, error)
+	UserInfo(ctx context.Context, accessToken string) (map[string]any, error)
+}
+
+// NewHandler serves the OpenID Connect endpoints and the login pages
+func NewHandler(log *slog.Logger, provider Provider) http.Handler {
+	s := &serverAPI{log: log, provider: provider}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("GET /authorize", s.authorize)
+	mux.HandleFunc("POST /authorize/login", s.login)
+	mux.HandleFunc("POST /authorize/mfa", s.mfa)
+	mux.HandleFunc("POST /authorize/consent", s.consent)
+	mux.HandleFunc("POST /token", s.token)
+	mux.HandleFunc("GET /userinfo", s.userInfo)
+	mux.HandleFunc("POST /userinfo", s.userInfo)
+
+	return mux
+}
+
+func (s *serverAPI) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.provider.Discovery())
+}
+
+func (s *serverAPI) jwks(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.provider.JWKS())
+}
+
+// authorize checks the request of the client and shows the login page
+func (s *serverAPI) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	auth := issuer.Authorization{
+		ClientID:      query.Get("client_id"),
+		RedirectURI:   query.Get("redirect_uri"),
+		Scope:         query.Get("scope"),
+		State:         query.Get("state"),
+		Nonce:         query.Get("nonce"),
+		CodeChallenge: query.Get("code_challenge"),
+	}
+
+	id, err := s.provider.Authorize(r.Context(), query.Get("response_type"), query.Get("code_challenge_method"), auth)
+	if err != nil {
+		switch {
+		// nobody to send the error to, or nowhere safe to send it
+		case errors.Is(err, issuer.ErrUnknownClient):
+			renderPage(w, http.StatusBadRequest, pageData{Error: issuer.ErrUnknownClient.Error()})
+		case errors.Is(err, issuer.ErrInvalidRedirect):
+			renderPage(w, http.StatusBadRequest, pageData{Error: issuer.ErrInvalidRedirect.Error()})
+		case errors.Is(err, issuer.ErrUnsupportedResponseType):
+			redirectError(w, r, auth, "unsupported_response_type", issuer.ErrUnsupportedResponseType.Error())
+		case errors.Is(err, issuer.ErrPKCERequired):
+			redirectError(w, r, auth, "invalid_request", issuer.ErrPKCERequired.Error())
+		case errors.Is(err, issuer.ErrUnauthorizedClient):
+			redirectError(w, r, auth, "unauthorized_client", issuer.ErrUnauthorizedClient.Error())
+		default:
+			redirectError(w, r, auth, "server_error", "failed to start the login")
+		}
+
+		return
+	}
+
+	s.show(w, r, id, stepLogin, "")
+}
+
+func (s *serverAPI) login(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("request_id")
+
+	step, err := s.provider.LoginPassword(r.Context(), id, r.PostFormValue("email"), r.PostFormValue("password"), clientIP(r))
+	if err != nil {
+		s.showError(w, r, id, stepLogin, err)
+		return
+	}
+
+	s.show(w, r, id, step, "")
+}
+
+func (s *serverAPI) mfa(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("request_id")
+
+	if err := s.provider.LoginMFA(r.Context(), id, r.PostFormValue("code")); err != nil {
+		s.showError(w, r, id, service.StepMFA, err)
+		return
+	}
+
+	s.show(w, r, id, service.StepConsent, "")
+}
+
+// consent sends the user back to the client with a code or the access_denied error
+func (s *serverAPI) consent(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("request_id")
+	approved := r.PostFormValue("decision") == "allow"
+
+	redirect, err := s.provider.Consent(r.Context(), id, approved)
+	if err != nil {
+		s.showError(w, r, id, service.StepConsent, err)
+		return
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// token answers the authorization code and refresh token grants
+func (s *serverAPI) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "malformed form")
+		return
+	}
+
+	clientID, clientSecret, basic := clientCredentials(r)
+	if clientID == "" {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "client_id is required")
+		return
+	}
+
+	var (
+		tokens issuer.Tokens
+		err    error
+	)
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, verifier := r.PostForm.Get("code"), r.PostForm.Get("code_verifier")
+		if code == "" || verifier == "" {
+			tokenError(w, http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+			return
+		}
+
+		tokens, err = s.provider.Exchange(r.Context(), clientID, clientSecret, code, r.PostForm.Get("redirect_uri"), verifier)
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		if refreshToken == "" {
+			tokenError(w, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+			return
+		}
+
+		tokens, err = s.provider.Refresh(r.Context(), clientID, clientSecret, refreshToken)
+	default:
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "only authorization_code and refresh_token are supported")
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, issuer.ErrInvalidClient):
+			if basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+			}
+			tokenError(w, http.StatusUnauthorized, "invalid_client", issuer.ErrInvalidClient.Error())
+		case errors.Is(err, issuer.ErrUnauthorizedClient):
+			tokenError(w, http.StatusBadRequest, "unauthorized_client", issuer.ErrUnauthorizedClient.Error())
+		case errors.Is(err, issuer.ErrInvalidGrant):
+			tokenError(w, http.StatusBadRequest, "invalid_grant", issuer.ErrInvalidGrant.Error())
+		default:
+			s.log.Error("failed to issue tokens", l.Err(err), slog.String("client_id", clientID))
+			tokenError(w, http.StatusInternalServerError, "server_error", "failed to issue tokens")
+		}
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        tokens.Scope,
+	})
+}
+
+func (s *serverAPI) userInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := s.provider.UserInfo(r.Context(), accessToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrUserNotFound) ||
+			errors.Is(err, service.ErrUserDisabled) || errors.Is(err, service.ErrUserSuspended) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo", error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		s.log.Error("failed to get user info", l.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, claims)
+}
+
+// show renders the page of the step for the authorization request
+func (s *serverAPI) show(w http.ResponseWriter, r *http.Request, id, step, message string) {
+	auth, client, err := s.provider.Authorization(r.Context(), id)
+	if err != nil {
+		s.showError(w, r, "", step, err)
+		return
+	}
+
+	status := http.StatusOK
+	if message != "" {
+		status = http.StatusBadRequest
+	}
+
+	renderPage(w, status, pageData{
+		RequestID:  id,
+		Step:       step,
+		ClientName: client.Name,
+		MFAMethod:  auth.MFAMethod,
+		Email:      auth.HasScope(issuer.ScopeEmail),
+		Error:      message,
+	})
+}
+
+// showError explains on the page why the step failed, the user can try it again
+func (s *serverAPI) showError(w http.ResponseWriter, r *http.Request, id, step string, err error) {
+	var lockedErr *service.LockedError
+
+	switch {
+	case errors.Is(err, issuer.ErrAuthorizationNotFound), errors.Is(err, issuer.ErrUnknownClient):
+		renderPage(w, http.StatusBadRequest, pageData{Error: "the login has expired, go back to the app and try again"})
+	case errors.Is(err, service.ErrInvalidCreds) && step == service.StepMFA:
+		s.show(w, r, id, step, "wrong code")
+	case errors.Is(err, service.ErrInvalidCreds):
+		s.show(w, r, id, step, "wrong email or password")
+	case errors.As(err, &lockedErr):
+		s.show(w, r, id, stepLogin, fmt.Sprintf("too many failed attempts, try again in %s", lockedErr.RetryAfter.Round(time.Second)))
+	case errors.Is(err, service.ErrUserDisabled), errors.Is(err, service.ErrUserSuspended), errors.Is(err, service.ErrUserNotFound):
+		s.show(w, r, id, stepLogin, "the account can't be used to log in")
+	case errors.Is(err, service.ErrSecondFactorUnavailable):
+		s.show(w, r, id, stepLogin, service.ErrSecondFactorUnavailable.Error()+", log in to Miku Notes first")
+	case errors.Is(err, service.ErrPasswordChangeRequired):
+		s.show(w, r, id, stepLogin, service.ErrPasswordChangeRequired.Error()+", log in to Miku Notes first")
+	case errors.Is(err, smscode.ErrTooManyRequests), errors.Is(err, smscode.ErrNotConfigured):
+		s.show(w, r, id, stepLogin, "the code can't be texted right now, try again later")
+	default:
+		s.log.Error("authorization page failed", l.Err(err), slog.String("step", step))
+		renderPage(w, http.StatusInternalServerError, pageData{Error: "something went wrong, try again later"})
+	}
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// clientCredentials reads the client from basic auth or, failing that, from the form
+func clientCredentials(r *http.Request) (string, string, bool) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		// both parts are form encoded before they are joined (RFC 6749 2.3.1)
+		id, errID := url.QueryUnescape(id)
+		secret, errSecret := url.QueryUnescape(secret)
+		if errID != nil || errSecret != nil {
+			return "", "", true
+		}
+
+		return id, secret, true
+	}
+
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), false
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, auth issuer.Authorization, code, description string) {
+	http.Redirect(w, r, issuer.ErrorRedirect(auth.RedirectURI, auth.State, code, description), http.StatusFound)
+}
+
+func tokenError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
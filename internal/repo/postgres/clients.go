@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/lib/pq"
+)
+
+var ErrClientNotFound = errors.New("client not found")
+
+func (d *DB) Client(ctx context.Context, clientID string) (models.Client, error) {
+	const f = "postgres.Client"
+
+	query := `SELECT client_id, name, secret_hash, grant_types, redirect_uris, scopes, access_ttl_seconds, refresh_ttl_seconds
+		FROM clients WHERE client_id = $1`
+
+	var (
+		client                models.Client
+		accessTTL, refreshTTL sql.NullInt64
+	)
+	err := d.db.QueryRowContext(ctx, query, clientID).Scan(
+		&client.ClientID,
+		&client.Name,
+		&client.SecretHash,
+		pq.Array(&client.GrantTypes),
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.Scopes),
+		&accessTTL,
+		&refreshTTL,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Client{}, fmt.Errorf("%s:%w", f, ErrClientNotFound)
+		}
+
+		return models.Client{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	client.AccessTTL = time.Duration(accessTTL.Int64) * time.Second
+	client.RefreshTTL = time.Duration(refreshTTL.Int64) * time.Second
+
+	return client, nil
+}
+
+// SaveClient registers the client or replaces the one with the same client id
+func (d *DB) SaveClient(ctx context.Context, client models.Client) error {
+	const f = "postgres.SaveClient"
+
+	query := `INSERT INTO clients
+		(client_id, name, secret_hash, grant_types, redirect_uris, scopes, access_ttl_seconds, refresh_ttl_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (client_id) DO UPDATE SET
+			name = EXCLUDED.name,
+			secret_hash = EXCLUDED.secret_hash,
+			grant_types = EXCLUDED.grant_types,
+			redirect_uris = EXCLUDED.redirect_uris,
+			scopes = EXCLUDED.scopes,
+			access_ttl_seconds = EXCLUDED.access_ttl_seconds,
+			refresh_ttl_seconds = EXCLUDED.refresh_ttl_seconds,
+			updated_at = NOW()`
+
+	_, err := d.db.ExecContext(ctx, query,
+		client.ClientID,
+		client.Name,
+		client.SecretHash,
+		pq.Array(client.GrantTypes),
+		pq.Array(client.RedirectURIs),
+		pq.Array(client.Scopes),
+		ttlSeconds(client.AccessTTL),
+		ttlSeconds(client.RefreshTTL),
+	)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// ttlSeconds stores a zero lifetime as NULL, the configured one is used then
+func ttlSeconds(ttl time.Duration) sql.NullInt64 {
+	if ttl <= 0 {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: int64(ttl / time.Second), Valid: true}
+}
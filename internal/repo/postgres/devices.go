@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+)
+
+var ErrDeviceNotFound = errors.New("trusted device not found")
+
+// TrustDevice marks the fingerprint as trusted until the given time,
+// trusting it again extends the time and renames the device
+func (d *DB) TrustDevice(ctx context.Context, userID int32, fingerprintHash []byte, name string, until time.Time) error {
+	const f = "postgres.TrustDevice"
+
+	query := `INSERT INTO trusted_devices (user_id, fingerprint_hash, name, trusted_until) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, fingerprint_hash) DO UPDATE SET name = $3, trusted_until = $4`
+
+	if _, err := d.db.ExecContext(ctx, query, userID, fingerprintHash, name, until.UTC()); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// TrustedDevices returns the devices whose trust hasn't expired, newest first
+func (d *DB) TrustedDevices(ctx context.Context, userID int32) ([]models.TrustedDevice, error) {
+	const f = "postgres.TrustedDevices"
+
+	query := `SELECT id, name, trusted_until, last_seen_at, created_at FROM trusted_devices
+		WHERE user_id = $1 AND trusted_until > NOW() ORDER BY id DESC`
+
+	rows, err := d.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+	defer rows.Close()
+
+	var devices []models.TrustedDevice
+	for rows.Next() {
+		var (
+			device     models.TrustedDevice
+			lastSeenAt sql.NullTime
+		)
+		if err := rows.Scan(&device.ID, &device.Name, &device.TrustedUntil, &lastSeenAt, &device.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+		device.LastSeenAt = lastSeenAt.Time
+
+		devices = append(devices, device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return devices, nil
+}
+
+// TouchTrustedDevice records a login from the fingerprint and reports whether it's still trusted
+func (d *DB) TouchTrustedDevice(ctx context.Context, userID int32, fingerprintHash []byte) (bool, error) {
+	const f = "postgres.TouchTrustedDevice"
+
+	query := `UPDATE trusted_devices SET last_seen_at = NOW()
+		WHERE user_id = $1 AND fingerprint_hash = $2 AND trusted_until > NOW()`
+
+	res, err := d.db.ExecContext(ctx, query, userID, fingerprintHash)
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return n > 0, nil
+}
+
+// RevokeTrustedDevice removes a device, only its owner can do that
+func (d *DB) RevokeTrustedDevice(ctx context.Context, userID, deviceID int32) error {
+	const f = "postgres.RevokeTrustedDevice"
+
+	res, err := d.db.ExecContext(ctx, "DELETE FROM trusted_devices WHERE id = $1 AND user_id = $2", deviceID, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s:%w", f, ErrDeviceNotFound)
+	}
+
+	return nil
+}
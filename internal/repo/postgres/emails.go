@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+)
+
+// UserEmails returns the stored email of every user by user id
+func (d *DB) UserEmails(ctx context.Context) (map[int32]string, error) {
+	const f = "postgres.UserEmails"
+
+	rows, err := d.db.QueryContext(ctx, "SELECT id, email FROM users")
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+	defer rows.Close()
+
+	emails := make(map[int32]string)
+	for rows.Next() {
+		var (
+			id    int32
+			email string
+		)
+		if err := rows.Scan(&id, &email); err != nil {
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+		emails[id] = email
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return emails, nil
+}
+
+// UpdateEmails replaces the emails of the users in a single transaction
+func (d *DB) UpdateEmails(ctx context.Context, emails map[int32]string) error {
+	const f = "postgres.UpdateEmails"
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "UPDATE users SET email = $1, updated_at = NOW() WHERE id = $2")
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	defer stmt.Close()
+
+	for id, email := range emails {
+		if _, err := stmt.ExecContext(ctx, email, id); err != nil {
+			return fmt.Errorf("%s: failed to update user %d: %w", f, id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrIdentityExists   = errors.New("identity is already linked")
+	ErrIdentityNotFound = errors.New("identity not found")
+)
+
+// SaveIdentity links a provider account to an existing user
+func (d *DB) SaveIdentity(ctx context.Context, identity models.Identity) error {
+	const f = "postgres.SaveIdentity"
+
+	query := "INSERT INTO identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)"
+
+	_, err := d.db.ExecContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // Unique violation
+			return fmt.Errorf("%s:%w", f, ErrIdentityExists)
+		}
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// SaveUserWithIdentity creates a user that signed up through a provider.
+// Both rows are inserted together, so a failed link doesn't leave a user behind.
+func (d *DB) SaveUserWithIdentity(ctx context.Context, email string, passwordHash []byte, identity models.Identity) (int32, error) {
+	const f = "postgres.SaveUserWithIdentity"
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+	defer tx.Rollback()
+
+	var userID int32
+	err = tx.QueryRowContext(ctx, "INSERT INTO users (email, pass_hash) VALUES ($1, $2) RETURNING id", email, passwordHash).Scan(&userID)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // Unique violation
+			return 0, fmt.Errorf("%s:%w", f, ErrUserExists)
+		}
+
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	query := "INSERT INTO identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)"
+	if _, err := tx.ExecContext(ctx, query, userID, identity.Provider, identity.Subject, identity.Email); err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // Unique violation
+			return 0, fmt.Errorf("%s:%w", f, ErrIdentityExists)
+		}
+
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return userID, nil
+}
+
+// IdentityUser returns the user the provider account is linked to
+func (d *DB) IdentityUser(ctx context.Context, provider, subject string) (int32, error) {
+	const f = "postgres.IdentityUser"
+
+	var userID int32
+	err := d.db.QueryRowContext(ctx, "SELECT user_id FROM identities WHERE provider = $1 AND subject = $2", provider, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s:%w", f, ErrIdentityNotFound)
+		}
+
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return userID, nil
+}
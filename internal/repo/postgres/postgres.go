@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/kuromii5/miku-notes-auth/internal/models"
 	"github.com/lib/pq"
@@ -30,13 +32,17 @@ func New(connString string) (*DB, error) {
 	return &DB{db: db}, nil
 }
 
-func (d *DB) SaveUser(ctx context.Context, email string, passwordHash []byte) (int32, error) {
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+func (d *DB) SaveUser(ctx context.Context, email string, passwordHash []byte, status string) (int32, error) {
 	const f = "postgres.SaveUser"
 
-	query := "INSERT INTO users (email, pass_hash) VALUES ($1, $2) RETURNING id"
+	query := "INSERT INTO users (email, pass_hash, status) VALUES ($1, $2, $3) RETURNING id"
 
 	var userID int32
-	err := d.db.QueryRowContext(ctx, query, email, passwordHash).Scan(&userID)
+	err := d.db.QueryRowContext(ctx, query, email, passwordHash, status).Scan(&userID)
 	if err != nil {
 		var pgErr *pq.Error
 		if errors.As(err, &pgErr) {
@@ -51,14 +57,160 @@ func (d *DB) SaveUser(ctx context.Context, email string, passwordHash []byte) (i
 	return userID, nil
 }
 
+// ImportUsers inserts users in a single transaction, skipping emails that are already taken.
+// It returns how many users were actually inserted.
+func (d *DB) ImportUsers(ctx context.Context, users []models.User) (int, error) {
+	const f = "postgres.ImportUsers"
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO users (email, pass_hash, created_at, updated_at)
+		VALUES ($1, $2, COALESCE($3, NOW()), NOW())
+		ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+	defer stmt.Close()
+
+	var imported int
+	for _, user := range users {
+		createdAt := sql.NullTime{Time: user.CreatedAt.UTC(), Valid: !user.CreatedAt.IsZero()}
+
+		res, err := stmt.ExecContext(ctx, user.Email, user.PasswordHash, createdAt)
+		if err != nil {
+			return 0, fmt.Errorf("%s: failed to insert %s: %w", f, user.Email, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("%s:%w", f, err)
+		}
+		imported += int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return imported, nil
+}
+
+func (d *DB) UpdatePasswordHash(ctx context.Context, userID int32, passwordHash []byte) error {
+	const f = "postgres.UpdatePasswordHash"
+
+	query := "UPDATE users SET pass_hash = $1, updated_at = NOW() WHERE id = $2"
+
+	res, err := d.db.ExecContext(ctx, query, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return checkAffected(f, res)
+}
+
+// UpdatePassword replaces the user's password hash and moves the old one to the history,
+// keeping only the newest historySize entries
+func (d *DB) UpdatePassword(ctx context.Context, userID int32, passwordHash []byte, historySize int) error {
+	const f = "postgres.UpdatePassword"
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	defer tx.Rollback()
+
+	// lock the row so concurrent updates don't lose a history entry
+	var oldHash []byte
+	err = tx.QueryRowContext(ctx, "SELECT pass_hash FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&oldHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s:%w", f, ErrUserNotFound)
+		}
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if historySize > 0 {
+		query := "INSERT INTO password_history (user_id, pass_hash) VALUES ($1, $2)"
+		if _, err := tx.ExecContext(ctx, query, userID, oldHash); err != nil {
+			return fmt.Errorf("%s:%w", f, err)
+		}
+	}
+
+	// a new password starts a new expiry period, fulfils an admin's change request
+	// and invalidates the restricted tokens issued for the old one
+	query := `UPDATE users SET pass_hash = $1, password_changed_at = NOW(), must_change_password = FALSE,
+		password_version = password_version + 1, updated_at = NOW() WHERE id = $2`
+	if _, err := tx.ExecContext(ctx, query, passwordHash, userID); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	query = `DELETE FROM password_history WHERE user_id = $1 AND id NOT IN (
+		SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2)`
+	if _, err := tx.ExecContext(ctx, query, userID, historySize); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// SetPhone saves a phone number the user has just verified
+func (d *DB) SetPhone(ctx context.Context, userID int32, phone string) error {
+	const f = "postgres.SetPhone"
+
+	query := "UPDATE users SET phone = $1, phone_verified_at = NOW(), updated_at = NOW() WHERE id = $2"
+
+	res, err := d.db.ExecContext(ctx, query, phone, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return checkAffected(f, res)
+}
+
+// PasswordHistory returns up to limit previous password hashes, newest first
+func (d *DB) PasswordHistory(ctx context.Context, userID int32, limit int) ([][]byte, error) {
+	const f = "postgres.PasswordHistory"
+
+	query := "SELECT pass_hash FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2"
+
+	rows, err := d.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+	defer rows.Close()
+
+	var hashes [][]byte
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return hashes, nil
+}
+
 func (d *DB) User(ctx context.Context, email string) (models.User, error) {
 	const f = "postgres.User"
 
-	query := "SELECT id, email, pass_hash, created_at, updated_at FROM users WHERE email = $1"
+	// matches the unique functional index, so legacy mixed case emails are found too
+	query := "SELECT " + userColumns + " FROM users WHERE lower(email) = lower($1)"
 
-	var user models.User
-	err := d.db.QueryRowContext(ctx, query, email).
-		Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(d.db.QueryRowContext(ctx, query, email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, fmt.Errorf("%s:%w", f, ErrUserNotFound)
@@ -69,3 +221,167 @@ func (d *DB) User(ctx context.Context, email string) (models.User, error) {
 
 	return user, nil
 }
+
+func (d *DB) UserByID(ctx context.Context, userID int32) (models.User, error) {
+	const f = "postgres.UserByID"
+
+	query := "SELECT " + userColumns + " FROM users WHERE id = $1"
+
+	user, err := scanUser(d.db.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s:%w", f, ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return user, nil
+}
+
+func (d *DB) SearchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	const f = "postgres.SearchUsers"
+
+	// keyset pagination ordered by id, every filter is optional
+	query := `SELECT ` + userColumns + ` FROM users
+		WHERE ($1 = 0 OR id = $1)
+		AND ($2 = '' OR lower(email) LIKE lower($2) || '%')
+		AND id > $3
+		ORDER BY id
+		LIMIT $4`
+
+	rows, err := d.db.QueryContext(ctx, query, filter.ID, escapeLike(filter.EmailPrefix), filter.AfterID, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return users, nil
+}
+
+func (d *DB) SetUserStatus(ctx context.Context, userID int32, status string) error {
+	const f = "postgres.SetUserStatus"
+
+	// leaving suspension also clears its reason and end time
+	query := `UPDATE users SET status = $1, suspension_reason = '', suspended_until = NULL, updated_at = NOW()
+		WHERE id = $2`
+
+	res, err := d.db.ExecContext(ctx, query, status, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return checkAffected(f, res)
+}
+
+// SuspendUser suspends the user until the given time, zero time means indefinitely
+func (d *DB) SuspendUser(ctx context.Context, userID int32, reason string, until time.Time) error {
+	const f = "postgres.SuspendUser"
+
+	query := `UPDATE users SET status = $1, suspension_reason = $2, suspended_until = $3, updated_at = NOW()
+		WHERE id = $4`
+
+	res, err := d.db.ExecContext(ctx, query, models.UserStatusSuspended, reason, sql.NullTime{Time: until.UTC(), Valid: !until.IsZero()}, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return checkAffected(f, res)
+}
+
+func (d *DB) SetMustChangePassword(ctx context.Context, userID int32, mustChange bool) error {
+	const f = "postgres.SetMustChangePassword"
+
+	query := "UPDATE users SET must_change_password = $1, updated_at = NOW() WHERE id = $2"
+
+	res, err := d.db.ExecContext(ctx, query, mustChange, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return checkAffected(f, res)
+}
+
+func (d *DB) DeleteUser(ctx context.Context, userID int32) error {
+	const f = "postgres.DeleteUser"
+
+	query := "DELETE FROM users WHERE id = $1"
+
+	res, err := d.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return checkAffected(f, res)
+}
+
+const userColumns = `id, email, pass_hash, status, suspension_reason, suspended_until, created_at, updated_at,
+	password_changed_at, must_change_password, password_version, phone`
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser reads a row selected with userColumns
+func scanUser(row scanner) (models.User, error) {
+	var (
+		user           models.User
+		suspendedUntil sql.NullTime
+		phone          sql.NullString
+	)
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Status,
+		&user.SuspensionReason,
+		&suspendedUntil,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.PasswordChangedAt,
+		&user.MustChangePassword,
+		&user.PasswordVersion,
+		&phone,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user.SuspendedUntil = suspendedUntil.Time
+	user.Phone = phone.String
+
+	return user, nil
+}
+
+// checkAffected reports ErrUserNotFound if the statement didn't touch any row
+func checkAffected(f string, res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s:%w", f, ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+)
+
+// ReplaceRecoveryCodes drops every old code of the user, used or not, and saves the new set
+func (d *DB) ReplaceRecoveryCodes(ctx context.Context, userID int32, hashes [][]byte) error {
+	const f = "postgres.ReplaceRecoveryCodes"
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)")
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	defer stmt.Close()
+
+	for _, hash := range hashes {
+		if _, err := stmt.ExecContext(ctx, userID, hash); err != nil {
+			return fmt.Errorf("%s:%w", f, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// RecoveryCodes returns the codes that weren't used yet
+func (d *DB) RecoveryCodes(ctx context.Context, userID int32) ([]models.RecoveryCode, error) {
+	const f = "postgres.RecoveryCodes"
+
+	query := "SELECT id, code_hash FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL ORDER BY id"
+
+	rows, err := d.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+	defer rows.Close()
+
+	var codes []models.RecoveryCode
+	for rows.Next() {
+		var code models.RecoveryCode
+		if err := rows.Scan(&code.ID, &code.Hash); err != nil {
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode marks the code as used, false means it was used
+// concurrently or the set was regenerated in the meantime
+func (d *DB) UseRecoveryCode(ctx context.Context, codeID int32) (bool, error) {
+	const f = "postgres.UseRecoveryCode"
+
+	query := "UPDATE recovery_codes SET used_at = NOW() WHERE id = $1 AND used_at IS NULL"
+
+	res, err := d.db.ExecContext(ctx, query, codeID)
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return n > 0, nil
+}
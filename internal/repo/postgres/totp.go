@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+)
+
+var ErrTOTPNotFound = errors.New("totp is not enrolled")
+
+// SaveTOTP starts a new enrollment, replacing an unconfirmed one
+func (d *DB) SaveTOTP(ctx context.Context, userID int32, encryptedSecret []byte) error {
+	const f = "postgres.SaveTOTP"
+
+	query := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = $2, confirmed_at = NULL, last_used_step = 0, created_at = NOW()`
+
+	if _, err := d.db.ExecContext(ctx, query, userID, encryptedSecret); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+func (d *DB) TOTP(ctx context.Context, userID int32) (models.TOTP, error) {
+	const f = "postgres.TOTP"
+
+	query := "SELECT user_id, secret, confirmed_at IS NOT NULL FROM user_totp WHERE user_id = $1"
+
+	var totp models.TOTP
+	err := d.db.QueryRowContext(ctx, query, userID).Scan(&totp.UserID, &totp.EncryptedSecret, &totp.Confirmed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTP{}, fmt.Errorf("%s:%w", f, ErrTOTPNotFound)
+		}
+
+		return models.TOTP{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return totp, nil
+}
+
+func (d *DB) ConfirmTOTP(ctx context.Context, userID int32) error {
+	const f = "postgres.ConfirmTOTP"
+
+	query := "UPDATE user_totp SET confirmed_at = NOW() WHERE user_id = $1"
+
+	res, err := d.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s:%w", f, ErrTOTPNotFound)
+	}
+
+	return nil
+}
+
+// UseTOTPStep marks the time step as used and reports false if it
+// or a later one was used already, so every code works only once
+func (d *DB) UseTOTPStep(ctx context.Context, userID int32, step int64) (bool, error) {
+	const f = "postgres.UseTOTPStep"
+
+	query := "UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2"
+
+	res, err := d.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return n > 0, nil
+}
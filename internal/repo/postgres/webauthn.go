@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrCredentialExists   = errors.New("webauthn credential already exists")
+	ErrCredentialNotFound = errors.New("webauthn credential not found")
+)
+
+func (d *DB) SaveWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error {
+	const f = "postgres.SaveWebAuthnCredential"
+
+	query := "INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count) VALUES ($1, $2, $3, $4)"
+
+	_, err := d.db.ExecContext(ctx, query, credential.UserID, credential.CredentialID, credential.PublicKey, int64(credential.SignCount))
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // Unique violation
+			return fmt.Errorf("%s:%w", f, ErrCredentialExists)
+		}
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+func (d *DB) WebAuthnCredentials(ctx context.Context, userID int32) ([]models.WebAuthnCredential, error) {
+	const f = "postgres.WebAuthnCredentials"
+
+	query := "SELECT " + credentialColumns + " FROM webauthn_credentials WHERE user_id = $1 ORDER BY id"
+
+	rows, err := d.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+	defer rows.Close()
+
+	var credentials []models.WebAuthnCredential
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+
+		credentials = append(credentials, credential)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return credentials, nil
+}
+
+func (d *DB) WebAuthnCredential(ctx context.Context, credentialID []byte) (models.WebAuthnCredential, error) {
+	const f = "postgres.WebAuthnCredential"
+
+	query := "SELECT " + credentialColumns + " FROM webauthn_credentials WHERE credential_id = $1"
+
+	credential, err := scanCredential(d.db.QueryRowContext(ctx, query, credentialID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebAuthnCredential{}, fmt.Errorf("%s:%w", f, ErrCredentialNotFound)
+		}
+
+		return models.WebAuthnCredential{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return credential, nil
+}
+
+// UseWebAuthnCredential stores the new signature counter. It reports false when the
+// counter didn't grow, which means the credential was cloned or the assertion replayed.
+// Authenticators that don't count always send zero and are let through.
+func (d *DB) UseWebAuthnCredential(ctx context.Context, id int32, signCount uint32) (bool, error) {
+	const f = "postgres.UseWebAuthnCredential"
+
+	query := `UPDATE webauthn_credentials SET sign_count = $1, last_used_at = NOW()
+		WHERE id = $2 AND (sign_count < $1 OR (sign_count = 0 AND $1 = 0))`
+
+	res, err := d.db.ExecContext(ctx, query, int64(signCount), id)
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return n > 0, nil
+}
+
+const credentialColumns = "id, user_id, credential_id, public_key, sign_count"
+
+func scanCredential(row scanner) (models.WebAuthnCredential, error) {
+	var (
+		credential models.WebAuthnCredential
+		signCount  int64
+	)
+
+	err := row.Scan(&credential.ID, &credential.UserID, &credential.CredentialID, &credential.PublicKey, &signCount)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	credential.SignCount = uint32(signCount)
+
+	return credential, nil
+}
@@ -0,0 +1,168 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrDeviceCodeNotFound = errors.New("device code not found")
+
+// states of a device code, a resolved one is polled once and deleted
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeSlowDown = "slow_down" // only returned by PollDeviceCode
+)
+
+func deviceCodeKey(deviceCodeHash string) string { return fmt.Sprintf("devicecode:%s", deviceCodeHash) }
+func deviceUserCodeKey(userCode string) string   { return fmt.Sprintf("devicecode:user:%s", userCode) }
+
+// returns 0 when the user code is taken by another pending device
+var saveDeviceCode = redis.NewScript(`
+if redis.call('SET', KEYS[2], ARGV[1], 'NX', 'PX', ARGV[4]) == false then return 0 end
+redis.call('HSET', KEYS[1], 'client', ARGV[2], 'user_code', ARGV[3], 'status', 'pending', 'interval', ARGV[5], 'next_poll', 0)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+// resolves a pending code once, the user code stops working right away.
+// Returns false for unknown codes and the client id otherwise.
+var resolveDeviceCode = redis.NewScript(`
+local hash = redis.call('GET', KEYS[1])
+if not hash then return false end
+local key = 'devicecode:' .. hash
+local client = redis.call('HGET', key, 'client')
+redis.call('DEL', KEYS[1])
+if not client then return false end
+redis.call('HSET', key, 'status', ARGV[1], 'user_id', ARGV[2])
+return client
+`)
+
+// returns the client id of a pending code, false for unknown codes
+var lookupDeviceCode = redis.NewScript(`
+local hash = redis.call('GET', KEYS[1])
+if not hash then return false end
+return redis.call('HGET', 'devicecode:' .. hash, 'client')
+`)
+
+// a poll before next_poll adds 5 seconds to the interval, like RFC 8628 asks
+// the device to do. Resolved codes are deleted by the poll that reads them.
+var pollDeviceCode = redis.NewScript(`
+local code = redis.call('HMGET', KEYS[1], 'status', 'interval', 'next_poll', 'user_id', 'client')
+if not code[1] then return false end
+local now = tonumber(ARGV[1])
+local interval = tonumber(code[2])
+if now < tonumber(code[3]) then
+	interval = interval + 5000
+	redis.call('HSET', KEYS[1], 'interval', interval, 'next_poll', now + interval)
+	return {'slow_down', tostring(interval), '', ''}
+end
+if code[1] == 'pending' then
+	redis.call('HSET', KEYS[1], 'next_poll', now + interval)
+	return {'pending', tostring(interval), '', ''}
+end
+redis.call('DEL', KEYS[1])
+return {code[1], tostring(interval), code[4] or '', code[5] or ''}
+`)
+
+// DevicePoll is what a device learns from one poll
+type DevicePoll struct {
+	Status   string
+	Interval time.Duration // the device has to wait this long before the next poll
+	UserID   int32
+	ClientID string
+}
+
+// SaveDeviceCode reports false when the user code is already in use
+func (t *TokenStorage) SaveDeviceCode(ctx context.Context, deviceCodeHash, userCode, clientID string, interval, ttl time.Duration) (bool, error) {
+	const f = "redis.SaveDeviceCode"
+
+	keys := []string{deviceCodeKey(deviceCodeHash), deviceUserCodeKey(userCode)}
+	saved, err := saveDeviceCode.Run(ctx, t.client, keys, deviceCodeHash, clientID, userCode, ttl.Milliseconds(), interval.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return saved == 1, nil
+}
+
+// ResolveDeviceCode records the decision of the user and returns the client id of the code
+func (t *TokenStorage) ResolveDeviceCode(ctx context.Context, userCode string, userID int32, approved bool) (string, error) {
+	const f = "redis.ResolveDeviceCode"
+
+	status := DeviceCodeDenied
+	if approved {
+		status = DeviceCodeApproved
+	}
+
+	clientID, err := resolveDeviceCode.Run(ctx, t.client, []string{deviceUserCodeKey(userCode)}, status, userID).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", fmt.Errorf("%s:%w", f, ErrDeviceCodeNotFound)
+		}
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return clientID, nil
+}
+
+// DeviceCodeClient returns the client id of a pending code without resolving it
+func (t *TokenStorage) DeviceCodeClient(ctx context.Context, userCode string) (string, error) {
+	const f = "redis.DeviceCodeClient"
+
+	clientID, err := lookupDeviceCode.Run(ctx, t.client, []string{deviceUserCodeKey(userCode)}).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", fmt.Errorf("%s:%w", f, ErrDeviceCodeNotFound)
+		}
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return clientID, nil
+}
+
+// PollDeviceCode returns the state of the code and counts the poll
+func (t *TokenStorage) PollDeviceCode(ctx context.Context, deviceCodeHash string, now time.Time) (DevicePoll, error) {
+	const f = "redis.PollDeviceCode"
+
+	res, err := pollDeviceCode.Run(ctx, t.client, []string{deviceCodeKey(deviceCodeHash)}, now.UnixMilli()).StringSlice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return DevicePoll{}, fmt.Errorf("%s:%w", f, ErrDeviceCodeNotFound)
+		}
+
+		return DevicePoll{}, fmt.Errorf("%s:%w", f, err)
+	}
+	if len(res) != 4 {
+		return DevicePoll{}, fmt.Errorf("%s: unexpected reply %v", f, res)
+	}
+
+	interval, err := strconv.ParseInt(res[1], 10, 64)
+	if err != nil {
+		return DevicePoll{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	poll := DevicePoll{
+		Status:   res[0],
+		Interval: time.Duration(interval) * time.Millisecond,
+		ClientID: res[3],
+	}
+
+	if res[2] != "" {
+		userID, err := strconv.ParseInt(res[2], 10, 32)
+		if err != nil {
+			return DevicePoll{}, fmt.Errorf("%s:%w", f, err)
+		}
+		poll.UserID = int32(userID)
+	}
+
+	return poll, nil
+}
@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func attemptsKey(key string) string { return fmt.Sprintf("lockout:%s:attempts", key) }
+func lockKey(key string) string     { return fmt.Sprintf("lockout:%s:lock", key) }
+
+func (t *TokenStorage) LockTTL(ctx context.Context, key string) (time.Duration, error) {
+	const f = "redis.LockTTL"
+
+	ttl, err := t.client.PTTL(ctx, lockKey(key)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// negative ttl means the key doesn't exist
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+func (t *TokenStorage) AddFailedAttempt(ctx context.Context, key string, window time.Duration) (int64, error) {
+	const f = "redis.AddFailedAttempt"
+
+	// the window starts with the first failed attempt
+	var incr *redis.IntCmd
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, attemptsKey(key))
+		pipe.ExpireNX(ctx, attemptsKey(key), window)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return incr.Val(), nil
+}
+
+func (t *TokenStorage) Lock(ctx context.Context, key string, lockFor, window time.Duration) error {
+	const f = "redis.Lock"
+
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, lockKey(key), 1, lockFor)
+		pipe.Expire(ctx, attemptsKey(key), window)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+func (t *TokenStorage) ResetAttempts(ctx context.Context, key string) error {
+	const f = "redis.ResetAttempts"
+
+	if err := t.client.Del(ctx, attemptsKey(key), lockKey(key)).Err(); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
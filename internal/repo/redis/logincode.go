@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrLoginCodeNotFound = errors.New("login code not found")
+
+func loginCodeKey(email string) string     { return fmt.Sprintf("logincode:%s", email) }
+func loginLinkKey(linkHash string) string  { return fmt.Sprintf("loginlink:%s", linkHash) }
+func loginCooldownKey(email string) string { return fmt.Sprintf("logincode:%s:cooldown", email) }
+
+// a new code replaces the pending one together with its link
+var saveLoginCode = redis.NewScript(`
+local old = redis.call('HGET', KEYS[1], 'link')
+if old then redis.call('DEL', 'loginlink:' .. old) end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'code', ARGV[1], 'link', ARGV[2], 'attempts', 0)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[4])
+return 1
+`)
+
+// returns -1 when there's no code, 1 when it matched and was consumed
+// and 0 for a wrong guess, which burns the code after the last attempt
+var useLoginCode = redis.NewScript(`
+local stored = redis.call('HMGET', KEYS[1], 'code', 'link')
+if not stored[1] then return -1 end
+if stored[1] == ARGV[1] then
+	redis.call('DEL', KEYS[1], 'loginlink:' .. stored[2])
+	return 1
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if attempts >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1], 'loginlink:' .. stored[2])
+end
+return 0
+`)
+
+// returns the email of the link and consumes its code, false when the link is unknown
+var useLoginLink = redis.NewScript(`
+local email = redis.call('GET', KEYS[1])
+if not email then return false end
+redis.call('DEL', KEYS[1], 'logincode:' .. email)
+return email
+`)
+
+// SaveLoginCode stores the hashes of a new code and its magic link for the email
+func (t *TokenStorage) SaveLoginCode(ctx context.Context, email, codeHash, linkHash string, ttl time.Duration) error {
+	const f = "redis.SaveLoginCode"
+
+	keys := []string{loginCodeKey(email), loginLinkKey(linkHash)}
+	err := saveLoginCode.Run(ctx, t.client, keys, codeHash, linkHash, email, ttl.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// UseLoginCode consumes the code if the hash matches and counts the attempt otherwise
+func (t *TokenStorage) UseLoginCode(ctx context.Context, email, codeHash string, maxAttempts int) (bool, error) {
+	const f = "redis.UseLoginCode"
+
+	res, err := useLoginCode.Run(ctx, t.client, []string{loginCodeKey(email)}, codeHash, maxAttempts).Int()
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+	if res < 0 {
+		return false, fmt.Errorf("%s:%w", f, ErrLoginCodeNotFound)
+	}
+
+	return res == 1, nil
+}
+
+// UseLoginLink consumes the link with its code and returns the email it was sent to
+func (t *TokenStorage) UseLoginLink(ctx context.Context, linkHash string) (string, error) {
+	const f = "redis.UseLoginLink"
+
+	email, err := useLoginLink.Run(ctx, t.client, []string{loginLinkKey(linkHash)}).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", fmt.Errorf("%s:%w", f, ErrLoginCodeNotFound)
+		}
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return email, nil
+}
+
+// StartLoginCodeCooldown reports false when a code was already requested for the email recently
+func (t *TokenStorage) StartLoginCodeCooldown(ctx context.Context, email string, cooldown time.Duration) (bool, error) {
+	const f = "redis.StartLoginCodeCooldown"
+
+	started, err := t.client.SetNX(ctx, loginCooldownKey(email), 1, cooldown).Result()
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return started, nil
+}
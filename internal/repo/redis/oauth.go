@@ -0,0 +1,40 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrOAuthStateNotFound = errors.New("oauth state not found")
+
+func oauthStateKey(state string) string { return fmt.Sprintf("oauth:%s", state) }
+
+func (t *TokenStorage) SaveOAuthState(ctx context.Context, state string, data []byte, ttl time.Duration) error {
+	const f = "redis.SaveOAuthState"
+
+	if err := t.client.Set(ctx, oauthStateKey(state), data, ttl).Err(); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// TakeOAuthState returns the login data and deletes it, so every state is used once
+func (t *TokenStorage) TakeOAuthState(ctx context.Context, state string) ([]byte, error) {
+	const f = "redis.TakeOAuthState"
+
+	data, err := t.client.GetDel(ctx, oauthStateKey(state)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%s:%w", f, ErrOAuthStateNotFound)
+		}
+
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return data, nil
+}
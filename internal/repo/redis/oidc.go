@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrAuthorizationNotFound = errors.New("authorization request not found")
+	ErrAuthCodeNotFound      = errors.New("authorization code not found")
+)
+
+func authorizationKey(id string) string { return fmt.Sprintf("oidc:authorization:%s", id) }
+func authCodeKey(code string) string    { return fmt.Sprintf("oidc:code:%s", code) }
+
+func (t *TokenStorage) SaveAuthorization(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	const f = "redis.SaveAuthorization"
+
+	if err := t.client.Set(ctx, authorizationKey(id), data, ttl).Err(); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+func (t *TokenStorage) Authorization(ctx context.Context, id string) ([]byte, error) {
+	const f = "redis.Authorization"
+
+	data, err := t.client.Get(ctx, authorizationKey(id)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%s:%w", f, ErrAuthorizationNotFound)
+		}
+
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return data, nil
+}
+
+// UpdateAuthorization keeps the expiry of the request, an expired one isn't brought back
+func (t *TokenStorage) UpdateAuthorization(ctx context.Context, id string, data []byte) error {
+	const f = "redis.UpdateAuthorization"
+
+	err := t.client.SetArgs(ctx, authorizationKey(id), data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return fmt.Errorf("%s:%w", f, ErrAuthorizationNotFound)
+		}
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+func (t *TokenStorage) DeleteAuthorization(ctx context.Context, id string) error {
+	const f = "redis.DeleteAuthorization"
+
+	if err := t.client.Del(ctx, authorizationKey(id)).Err(); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+func (t *TokenStorage) SaveAuthCode(ctx context.Context, code string, data []byte, ttl time.Duration) error {
+	const f = "redis.SaveAuthCode"
+
+	if err := t.client.Set(ctx, authCodeKey(code), data, ttl).Err(); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// TakeAuthCode returns the grant and deletes it, so every code is redeemed once
+func (t *TokenStorage) TakeAuthCode(ctx context.Context, code string) ([]byte, error) {
+	const f = "redis.TakeAuthCode"
+
+	data, err := t.client.GetDel(ctx, authCodeKey(code)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%s:%w", f, ErrAuthCodeNotFound)
+		}
+
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return data, nil
+}
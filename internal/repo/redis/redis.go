@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/kuromii5/miku-notes-auth/internal/models"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -31,42 +33,60 @@ func New(addr string) *TokenStorage {
 	return &TokenStorage{client: rdb}
 }
 
-func (t *TokenStorage) Set(ctx context.Context, userID int32, fingerprint, token string, expires time.Duration) error {
+// Set stores "user_id:client_id" under the token, tokens of callers without a client id keep only the user id.
+// Tokens of third-party clients keep the granted scope too, as "user_id;scope:client_id".
+func (t *TokenStorage) Set(ctx context.Context, userID int32, fingerprint, clientID, scope, token string, expires time.Duration) error {
 	const f = "redis.Set"
 
+	value := strconv.Itoa(int(userID))
+	if scope != "" {
+		value += ";" + scope
+	}
+	if clientID != "" {
+		value += ":" + clientID
+	}
+
 	key := fmt.Sprintf("%s:%s", token, fingerprint)
-	if err := t.client.Set(ctx, key, userID, expires).Err(); err != nil {
+	if err := t.client.Set(ctx, key, value, expires).Err(); err != nil {
 		return fmt.Errorf("%s:%w", f, err)
 	}
 
-	// Add the token to the user's set of tokens
+	// Add the token to the user's set of tokens. The set lives as long as its longest token,
+	// a client with a short refresh ttl mustn't cut the sessions of the others out of it.
+	// GT treats a set without a ttl as never expiring, so a new set gets one with NX first.
 	userTokensKey := fmt.Sprintf("%d:tokens", userID)
-	if err := t.client.SAdd(ctx, userTokensKey, key).Err(); err != nil {
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, userTokensKey, key)
+		pipe.ExpireNX(ctx, userTokensKey, expires)
+		pipe.ExpireGT(ctx, userTokensKey, expires)
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("%s: failed to add token to user set: %w", f, err)
 	}
 
-	// Optionally, set the expiration for the user tokens set to match the token expiration
-	if err := t.client.Expire(ctx, userTokensKey, expires).Err(); err != nil {
-		return fmt.Errorf("%s: failed to set expiration for user tokens set: %w", f, err)
-	}
-
 	return nil
 }
 
-func (t *TokenStorage) UserID(ctx context.Context, token, fingerprint string) (string, error) {
+// UserID returns the user, the client the token was issued to and the scope granted to it
+func (t *TokenStorage) UserID(ctx context.Context, token, fingerprint string) (string, string, string, error) {
 	const f = "redis.UserID"
 
 	key := fmt.Sprintf("%s:%s", token, fingerprint)
-	userIdStr, err := t.client.Get(ctx, key).Result()
+	value, err := t.client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return "", fmt.Errorf("%s:%w", f, ErrTokenNotFound)
+			return "", "", "", fmt.Errorf("%s:%w", f, ErrTokenNotFound)
 		}
 
-		return "", fmt.Errorf("%s:%w", f, err)
+		return "", "", "", fmt.Errorf("%s:%w", f, err)
 	}
 
-	return userIdStr, nil
+	// scopes never have a colon, client ids may
+	user, clientID, _ := strings.Cut(value, ":")
+	userIdStr, scope, _ := strings.Cut(user, ";")
+
+	return userIdStr, clientID, scope, nil
 }
 
 func (t *TokenStorage) Delete(ctx context.Context, userID int32, fingerprint string) error {
@@ -96,3 +116,55 @@ func (t *TokenStorage) Delete(ctx context.Context, userID int32, fingerprint str
 
 	return nil
 }
+
+func (t *TokenStorage) Sessions(ctx context.Context, userID int32) ([]models.Session, error) {
+	const f = "redis.Sessions"
+
+	userTokensKey := fmt.Sprintf("%d:tokens", userID)
+	tokens, err := t.client.SMembers(ctx, userTokensKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to get tokens for user: %w", f, err)
+	}
+
+	var sessions []models.Session
+	for _, token := range tokens {
+		ttl, err := t.client.TTL(ctx, token).Result()
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to get token ttl: %w", f, err)
+		}
+
+		// the token has already expired, clean it up from the user's set
+		if ttl < 0 {
+			if err := t.client.SRem(ctx, userTokensKey, token).Err(); err != nil {
+				return nil, fmt.Errorf("%s: failed to remove token from user set: %w", f, err)
+			}
+			continue
+		}
+
+		// key is "token:fingerprint", the token itself is never exposed
+		_, fingerprint, _ := strings.Cut(token, ":")
+		sessions = append(sessions, models.Session{
+			Fingerprint: fingerprint,
+			ExpiresIn:   ttl,
+		})
+	}
+
+	return sessions, nil
+}
+
+func (t *TokenStorage) DeleteAll(ctx context.Context, userID int32) error {
+	const f = "redis.DeleteAll"
+
+	userTokensKey := fmt.Sprintf("%d:tokens", userID)
+	tokens, err := t.client.SMembers(ctx, userTokensKey).Result()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get tokens for user: %w", f, err)
+	}
+
+	keys := append(tokens, userTokensKey)
+	if err := t.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("%s: failed to delete tokens: %w", f, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrSMSCodeNotFound = errors.New("sms code not found")
+
+func smsCodeKey(key string) string  { return fmt.Sprintf("smscode:%s", key) }
+func smsLimitKey(key string) string { return fmt.Sprintf("smslimit:%s", key) }
+
+// returns the phone the code was sent to when it matched and was consumed,
+// 0 for a wrong guess, which burns the code after the last attempt, and -1 when there's no code
+var useSMSCode = redis.NewScript(`
+local stored = redis.call('HMGET', KEYS[1], 'code', 'phone')
+if not stored[1] then return -1 end
+if stored[1] == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return stored[2]
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if attempts >= tonumber(ARGV[2]) then redis.call('DEL', KEYS[1]) end
+return 0
+`)
+
+// the window starts with the first send, so counters can't be kept alive forever
+var countSMSSend = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n
+`)
+
+// SaveSMSCode stores the hash of a new code with the phone it was sent to, replacing the pending one
+func (t *TokenStorage) SaveSMSCode(ctx context.Context, key, codeHash, phone string, ttl time.Duration) error {
+	const f = "redis.SaveSMSCode"
+
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, smsCodeKey(key))
+		pipe.HSet(ctx, smsCodeKey(key), "code", codeHash, "phone", phone, "attempts", 0)
+		pipe.PExpire(ctx, smsCodeKey(key), ttl)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// UseSMSCode consumes the code if the hash matches and returns the phone it was sent to,
+// a wrong hash is counted as an attempt and gives false
+func (t *TokenStorage) UseSMSCode(ctx context.Context, key, codeHash string, maxAttempts int) (string, bool, error) {
+	const f = "redis.UseSMSCode"
+
+	res, err := useSMSCode.Run(ctx, t.client, []string{smsCodeKey(key)}, codeHash, maxAttempts).Result()
+	if err != nil {
+		return "", false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	switch res := res.(type) {
+	case string:
+		return res, true, nil
+	case int64:
+		if res < 0 {
+			return "", false, fmt.Errorf("%s:%w", f, ErrSMSCodeNotFound)
+		}
+
+		return "", false, nil
+	default:
+		return "", false, fmt.Errorf("%s:unexpected script result %T", f, res)
+	}
+}
+
+// CountSMSSend counts a message sent under the key and returns how many were sent in the window
+func (t *TokenStorage) CountSMSSend(ctx context.Context, key string, window time.Duration) (int64, error) {
+	const f = "redis.CountSMSSend"
+
+	n, err := countSMSSend.Run(ctx, t.client, []string{smsLimitKey(key)}, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,40 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrSessionNotFound = errors.New("webauthn session not found")
+
+func webAuthnKey(sessionID string) string { return fmt.Sprintf("webauthn:%s", sessionID) }
+
+func (t *TokenStorage) SaveWebAuthnSession(ctx context.Context, sessionID string, session []byte, ttl time.Duration) error {
+	const f = "redis.SaveWebAuthnSession"
+
+	if err := t.client.Set(ctx, webAuthnKey(sessionID), session, ttl).Err(); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// TakeWebAuthnSession returns the session and deletes it, so every challenge is answered once
+func (t *TokenStorage) TakeWebAuthnSession(ctx context.Context, sessionID string) ([]byte, error) {
+	const f = "redis.TakeWebAuthnSession"
+
+	session, err := t.client.GetDel(ctx, webAuthnKey(sessionID)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%s:%w", f, ErrSessionNotFound)
+		}
+
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return session, nil
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/internal/service/lockout"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+type Admin struct {
+	log            *slog.Logger
+	userManager    UserManager
+	sessionManager SessionManager
+	limiter        *lockout.Limiter
+}
+
+//go:generate mockgen -source=admin.go -destination=mock/admin.go
+type UserManager interface {
+	UserByID(ctx context.Context, userID int32) (models.User, error)
+	SearchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error)
+	SetUserStatus(ctx context.Context, userID int32, status string) error
+	SuspendUser(ctx context.Context, userID int32, reason string, until time.Time) error
+	SetMustChangePassword(ctx context.Context, userID int32, mustChange bool) error
+	DeleteUser(ctx context.Context, userID int32) error
+}
+type SessionManager interface {
+	Sessions(ctx context.Context, userID int32) ([]models.Session, error)
+	DeleteAll(ctx context.Context, userID int32) error
+}
+
+func NewAdmin(
+	log *slog.Logger,
+	userManager UserManager,
+	sessionManager SessionManager,
+	limiter *lockout.Limiter,
+) *Admin {
+	return &Admin{
+		log:            log,
+		userManager:    userManager,
+		sessionManager: sessionManager,
+		limiter:        limiter,
+	}
+}
+
+// SearchUsers returns a page of users matching the filter ordered by id
+func (a *Admin) SearchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	const f = "admin.SearchUsers"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("searching users")
+
+	users, err := a.userManager.SearchUsers(ctx, filter)
+	if err != nil {
+		log.Error("failed to search users", l.Err(err))
+
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("users found", slog.Int("count", len(users)))
+
+	return users, nil
+}
+
+func (a *Admin) UserSessions(ctx context.Context, userID int32) ([]models.Session, error) {
+	const f = "admin.UserSessions"
+
+	log := a.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+	log.Info("getting user sessions")
+
+	if _, err := a.user(ctx, userID); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	sessions, err := a.sessionManager.Sessions(ctx, userID)
+	if err != nil {
+		log.Error("failed to get sessions", l.Err(err))
+
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return sessions, nil
+}
+
+func (a *Admin) ForceLogout(ctx context.Context, userID int32) error {
+	const f = "admin.ForceLogout"
+
+	log := a.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+	log.Info("force logging out user")
+
+	if _, err := a.user(ctx, userID); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.sessionManager.DeleteAll(ctx, userID); err != nil {
+		log.Error("failed to delete sessions", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("user logged out from all devices")
+
+	return nil
+}
+
+// DisableUser blocks the account from logging in and revokes all of its sessions
+func (a *Admin) DisableUser(ctx context.Context, userID int32) error {
+	const f = "admin.DisableUser"
+
+	log := a.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+	log.Info("disabling user")
+
+	if err := a.setStatus(ctx, userID, models.UserStatusDisabled); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.sessionManager.DeleteAll(ctx, userID); err != nil {
+		log.Error("failed to delete sessions", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("user disabled")
+
+	return nil
+}
+
+// SuspendUser suspends the user until the given time (zero means indefinitely)
+// and revokes all of its sessions right away
+func (a *Admin) SuspendUser(ctx context.Context, userID int32, reason string, until time.Time) error {
+	const f = "admin.SuspendUser"
+
+	log := a.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+	log.Info("suspending user", slog.String("reason", reason), slog.Time("until", until))
+
+	if err := a.userManager.SuspendUser(ctx, userID, reason, until); err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			log.Warn("user not found", l.Err(err))
+
+			return fmt.Errorf("%s:%w", f, ErrUserNotFound)
+		}
+
+		log.Error("failed to suspend user", l.Err(err))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.sessionManager.DeleteAll(ctx, userID); err != nil {
+		log.Error("failed to delete sessions", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("user suspended")
+
+	return nil
+}
+
+// EnableUser makes the user active again, lifting both disable and suspension
+func (a *Admin) EnableUser(ctx context.Context, userID int32) error {
+	const f = "admin.EnableUser"
+
+	log := a.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+	log.Info("enabling user")
+
+	if err := a.setStatus(ctx, userID, models.UserStatusActive); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("user enabled")
+
+	return nil
+}
+
+// UnlockUser lifts the failed login lockout before it expires
+func (a *Admin) UnlockUser(ctx context.Context, userID int32) error {
+	const f = "admin.UnlockUser"
+
+	log := a.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+	log.Info("unlocking user")
+
+	user, err := a.user(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.limiter.Reset(ctx, user.Email); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("user unlocked")
+
+	return nil
+}
+
+// RequirePasswordChange makes the user replace the password at the next login
+// and revokes all of its sessions, so that happens right away
+func (a *Admin) RequirePasswordChange(ctx context.Context, userID int32) error {
+	const f = "admin.RequirePasswordChange"
+
+	log := a.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+	log.Info("requiring password change")
+
+	if err := a.userManager.SetMustChangePassword(ctx, userID, true); err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			log.Warn("user not found", l.Err(err))
+
+			return fmt.Errorf("%s:%w", f, ErrUserNotFound)
+		}
+
+		log.Error("failed to set must change password", l.Err(err))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.sessionManager.DeleteAll(ctx, userID); err != nil {
+		log.Error("failed to delete sessions", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("password change required")
+
+	return nil
+}
+
+func (a *Admin) DeleteUser(ctx context.Context, userID int32) error {
+	const f = "admin.DeleteUser"
+
+	log := a.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+	log.Info("deleting user")
+
+	// revoke sessions first so a failed delete never leaves live tokens behind
+	if err := a.sessionManager.DeleteAll(ctx, userID); err != nil {
+		log.Error("failed to delete sessions", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.userManager.DeleteUser(ctx, userID); err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			log.Warn("user not found", l.Err(err))
+
+			return fmt.Errorf("%s:%w", f, ErrUserNotFound)
+		}
+
+		log.Error("failed to delete user", l.Err(err))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("user deleted")
+
+	return nil
+}
+
+func (a *Admin) user(ctx context.Context, userID int32) (models.User, error) {
+	user, err := a.userManager.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			a.log.Warn("user not found", l.Err(err))
+
+			return models.User{}, ErrUserNotFound
+		}
+
+		a.log.Error("failed to get user", l.Err(err))
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (a *Admin) setStatus(ctx context.Context, userID int32, status string) error {
+	if err := a.userManager.SetUserStatus(ctx, userID, status); err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			a.log.Warn("user not found", l.Err(err))
+
+			return ErrUserNotFound
+		}
+
+		a.log.Error("failed to set user status", l.Err(err), slog.String("status", status))
+		return err
+	}
+
+	return nil
+}
@@ -2,66 +2,234 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/kuromii5/miku-notes-auth/internal/models"
 	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/internal/service/devicegrant"
+	"github.com/kuromii5/miku-notes-auth/internal/service/lockout"
+	"github.com/kuromii5/miku-notes-auth/internal/service/logincode"
+	"github.com/kuromii5/miku-notes-auth/internal/service/mfa"
+	"github.com/kuromii5/miku-notes-auth/internal/service/passkey"
+	"github.com/kuromii5/miku-notes-auth/internal/service/smscode"
+	"github.com/kuromii5/miku-notes-auth/internal/service/social"
 	"github.com/kuromii5/miku-notes-auth/internal/service/tokens"
+	"github.com/kuromii5/miku-notes-auth/pkg/email"
 	"github.com/kuromii5/miku-notes-auth/pkg/hasher"
 	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
 )
 
 var (
-	ErrInvalidCreds = errors.New("invalid credentials")
-	ErrUserExists   = errors.New("user already exists")
-	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidCreds  = errors.New("invalid credentials")
+	ErrUserExists    = errors.New("user already exists")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrUserDisabled  = errors.New("user is disabled")
+	ErrUserLocked    = errors.New("too many failed login attempts")
+	ErrUserSuspended = errors.New("user is suspended")
+	ErrUnverified    = errors.New("email address is not confirmed yet")
+	ErrInvalidEmail  = errors.New("invalid email address")
+	ErrBreachedPass  = errors.New("password has appeared in a data breach")
+	ErrPasswordReuse = errors.New("password was used recently")
+
+	ErrInvalidToken           = errors.New("invalid or expired access token")
+	ErrInvalidRestrictedToken = errors.New("invalid or expired restricted token")
+
+	ErrDeviceNotFound = errors.New("trusted device not found")
+
+	ErrNoPhone        = errors.New("no verified phone number")
+	ErrSMSRecoveryOff = errors.New("sms recovery is off while an authenticator app or passkey is enrolled, use a recovery code")
+
+	ErrEmailNotVerified = errors.New("identity provider didn't verify the email")
+	ErrLinkRequired     = errors.New("email is already registered, log in and link the provider")
+	ErrIdentityTaken    = errors.New("provider account or provider is already linked")
+
+	ErrUnknownClient    = errors.New("unknown client")
+	ErrClientNotAllowed = errors.New("client is not allowed to use this grant type")
 )
 
+// SuspendedError is returned for users suspended by moderators
+type SuspendedError struct {
+	Reason string
+	Until  time.Time // zero means indefinitely
+}
+
+func (e *SuspendedError) Error() string { return ErrUserSuspended.Error() }
+
+func (e *SuspendedError) Is(target error) bool { return target == ErrUserSuspended }
+
+// LockedError is returned by Login while the account is locked out
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string { return ErrUserLocked.Error() }
+
+func (e *LockedError) Is(target error) bool { return target == ErrUserLocked }
+
 type Auth struct {
-	log          *slog.Logger
-	userSaver    UserSaver
-	userProvider UserProvider
-	tokenManager *tokens.TokenManager
+	log           *slog.Logger
+	userSaver     UserSaver
+	userProvider  UserProvider
+	recoveryCodes RecoveryCodeStorage
+	devices       DeviceStorage
+	identities    IdentityStorage
+	clients       ClientProvider
+	tokenManager  *tokens.TokenManager
+	limiter       *lockout.Limiter
+	mfa           *mfa.Manager
+	passkeys      *passkey.Manager
+	loginCodes    *logincode.Manager
+	smsCodes      *smscode.Manager
+	social        *social.Manager
+	deviceGrants  *devicegrant.Manager
+	normalizer    *email.Normalizer
+	hasher        *hasher.Hasher
+	policy        PasswordPolicy
+
+	// how many previous passwords are remembered to prevent reuse
+	historySize int
+	// passwords older than this have to be changed at login, 0 means never
+	maxPasswordAge time.Duration
+
+	// how long a device marked as trusted stays trusted
+	deviceTrustTTL time.Duration
+
+	// compared against for unknown emails, so they take as long as wrong passwords
+	dummyHash []byte
+
+	// nil when the breached passwords dataset isn't mounted
+	breachChecker BreachChecker
 }
 
 //go:generate mockgen -source=auth.go -destination=mock/auth.go
 type UserSaver interface {
-	SaveUser(ctx context.Context, email string, hash []byte) (int32, error)
+	SaveUser(ctx context.Context, email string, hash []byte, status string) (int32, error)
+	SetUserStatus(ctx context.Context, userID int32, status string) error
+	UpdatePasswordHash(ctx context.Context, userID int32, hash []byte) error
+	UpdatePassword(ctx context.Context, userID int32, hash []byte, historySize int) error
+	SetPhone(ctx context.Context, userID int32, phone string) error
 }
 type UserProvider interface {
 	User(ctx context.Context, email string) (models.User, error)
+	UserByID(ctx context.Context, userID int32) (models.User, error)
+	PasswordHistory(ctx context.Context, userID int32, limit int) ([][]byte, error)
+}
+type RecoveryCodeStorage interface {
+	ReplaceRecoveryCodes(ctx context.Context, userID int32, hashes [][]byte) error
+	RecoveryCodes(ctx context.Context, userID int32) ([]models.RecoveryCode, error)
+	UseRecoveryCode(ctx context.Context, codeID int32) (bool, error)
+}
+type DeviceStorage interface {
+	TrustDevice(ctx context.Context, userID int32, fingerprintHash []byte, name string, until time.Time) error
+	TrustedDevices(ctx context.Context, userID int32) ([]models.TrustedDevice, error)
+	TouchTrustedDevice(ctx context.Context, userID int32, fingerprintHash []byte) (bool, error)
+	RevokeTrustedDevice(ctx context.Context, userID, deviceID int32) error
+}
+type IdentityStorage interface {
+	SaveIdentity(ctx context.Context, identity models.Identity) error
+	SaveUserWithIdentity(ctx context.Context, email string, hash []byte, identity models.Identity) (int32, error)
+	IdentityUser(ctx context.Context, provider, subject string) (int32, error)
+}
+type ClientProvider interface {
+	Client(ctx context.Context, clientID string) (models.Client, error)
+}
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+type PasswordPolicy interface {
+	Check(password, email string) error
 }
 
 func New(
 	log *slog.Logger,
 	userSaver UserSaver,
 	userProvider UserProvider,
+	recoveryCodes RecoveryCodeStorage,
+	devices DeviceStorage,
+	identities IdentityStorage,
+	clients ClientProvider,
 	tokenManager *tokens.TokenManager,
+	limiter *lockout.Limiter,
+	mfa *mfa.Manager,
+	passkeys *passkey.Manager,
+	loginCodes *logincode.Manager,
+	smsCodes *smscode.Manager,
+	social *social.Manager,
+	deviceGrants *devicegrant.Manager,
+	normalizer *email.Normalizer,
+	hasher *hasher.Hasher,
+	policy PasswordPolicy,
+	historySize int,
+	maxPasswordAge time.Duration,
+	deviceTrustTTL time.Duration,
+	breachChecker BreachChecker,
 ) *Auth {
+	// made with the same algorithm and pepper as real hashes to cost the same
+	dummy := make([]byte, 32)
+	if _, err := rand.Read(dummy); err != nil {
+		panic(fmt.Sprintf("failed to generate dummy password: %v", err))
+	}
+	dummyHash, err := hasher.HashPassword(hex.EncodeToString(dummy))
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate dummy password hash: %v", err))
+	}
+
 	return &Auth{
-		log:          log,
-		userSaver:    userSaver,
-		userProvider: userProvider,
-		tokenManager: tokenManager,
+		log:            log,
+		userSaver:      userSaver,
+		userProvider:   userProvider,
+		recoveryCodes:  recoveryCodes,
+		devices:        devices,
+		identities:     identities,
+		clients:        clients,
+		tokenManager:   tokenManager,
+		limiter:        limiter,
+		mfa:            mfa,
+		passkeys:       passkeys,
+		loginCodes:     loginCodes,
+		smsCodes:       smsCodes,
+		social:         social,
+		deviceGrants:   deviceGrants,
+		normalizer:     normalizer,
+		hasher:         hasher,
+		policy:         policy,
+		historySize:    historySize,
+		maxPasswordAge: maxPasswordAge,
+		deviceTrustTTL: deviceTrustTTL,
+		breachChecker:  breachChecker,
+		dummyHash:      dummyHash,
 	}
 }
 
-func (a *Auth) Register(ctx context.Context, email, password string) (int32, error) {
+func (a *Auth) Register(ctx context.Context, emailAddr, password, clientID string) (int32, error) {
 	const f = "auth.Register"
 
 	log := a.log.With(slog.String("func", f))
-	log.Info("registering new user")
+	log.Info("registering new user", slog.String("client_id", clientID))
+
+	if _, err := a.client(ctx, clientID, models.GrantPassword); err != nil {
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
 
-	hash, err := hasher.HashPassword(password)
+	// one mailbox can own only one account, whatever way its address is spelled
+	emailAddr, err := a.normalizer.Normalize(emailAddr)
 	if err != nil {
-		log.Error("failed to generate password", l.Err(err))
+		log.Warn("failed to normalize email", l.Err(err))
+
+		return 0, fmt.Errorf("%s:%w", f, ErrInvalidEmail)
+	}
 
+	hash, err := a.hashNewPassword(password, emailAddr)
+	if err != nil {
 		return 0, fmt.Errorf("%s:%w", f, err)
 	}
 
-	id, err := a.userSaver.SaveUser(ctx, email, hash)
+	id, err := a.userSaver.SaveUser(ctx, emailAddr, hash, models.UserStatusActive)
 	if err != nil {
 		if errors.Is(err, postgres.ErrUserExists) {
 			a.log.Warn("user already exists", l.Err(err))
@@ -78,56 +246,556 @@ func (a *Auth) Register(ctx context.Context, email, password string) (int32, err
 	return id, nil
 }
 
-func (a *Auth) Login(ctx context.Context, email, password, fingerprint string) (models.TokenPair, error) {
+// SignUp is Register for the anti-enumeration mode: the new account can't log in
+// until the email is confirmed, and the owner of a taken email is told about the attempt.
+// Both cases look the same to the caller.
+func (a *Auth) SignUp(ctx context.Context, emailAddr, password, clientID string) error {
+	const f = "auth.SignUp"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("signing up new user", slog.String("client_id", clientID))
+
+	if _, err := a.client(ctx, clientID, models.GrantPassword); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	emailAddr, err := a.normalizer.Normalize(emailAddr)
+	if err != nil {
+		log.Warn("failed to normalize email", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidEmail)
+	}
+
+	// hashed for taken emails too, so both cases cost the same
+	hash, err := a.hashNewPassword(password, emailAddr)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	_, err = a.userSaver.SaveUser(ctx, emailAddr, hash, models.UserStatusUnverified)
+	exists := errors.Is(err, postgres.ErrUserExists)
+	if err != nil && !exists {
+		log.Error("failed to save user", l.Err(err))
+
+		return fmt.Errorf("%s:%v", f, err)
+	}
+
+	// keeps the form from flooding somebody's mailbox
+	if err := a.loginCodes.Reserve(ctx, emailAddr); err != nil {
+		if errors.Is(err, logincode.ErrTooManyRequests) {
+			log.Info("sign up email was sent too recently")
+
+			return nil
+		}
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if !exists {
+		if err := a.loginCodes.SendVerification(ctx, emailAddr); err != nil {
+			return fmt.Errorf("%s:%w", f, err)
+		}
+
+		log.Info("signed up new user, confirmation email sent")
+
+		return nil
+	}
+
+	user, err := a.userProvider.User(ctx, emailAddr)
+	if err != nil {
+		log.Error("failed to get user", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if user.Status != models.UserStatusUnverified {
+		if err := a.loginCodes.SendAccountExists(ctx, emailAddr); err != nil {
+			return fmt.Errorf("%s:%w", f, err)
+		}
+
+		log.Info("sign up with a taken email, the owner was notified", slog.Int("user_id", int(user.ID)))
+
+		return nil
+	}
+
+	// signing up again is the way to get a lost confirmation email. The latest
+	// password wins, whoever signed up first with somebody else's email
+	// doesn't keep the account once its owner confirms it.
+	if err := a.userSaver.UpdatePasswordHash(ctx, user.ID, hash); err != nil {
+		log.Error("failed to replace password of unconfirmed user", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if err := a.loginCodes.SendVerification(ctx, emailAddr); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("confirmation email sent again", slog.Int("user_id", int(user.ID)))
+
+	return nil
+}
+
+// hashNewPassword checks the password of a new account against the policy and hashes it
+func (a *Auth) hashNewPassword(password, emailAddr string) ([]byte, error) {
+	if err := a.checkNewPassword(password, emailAddr); err != nil {
+		a.log.Warn("password rejected", l.Err(err))
+
+		return nil, err
+	}
+
+	hash, err := a.hasher.HashPassword(password)
+	if err != nil {
+		a.log.Error("failed to generate password", l.Err(err))
+
+		return nil, err
+	}
+
+	return hash, nil
+}
+
+func (a *Auth) Login(ctx context.Context, emailAddr, password, fingerprint, clientID string) (models.LoginResult, error) {
 	const f = "auth.Login"
 
 	log := a.log.With(slog.String("func", f))
-	log.Info("trying to log in user")
+	log.Info("trying to log in user", slog.String("client_id", clientID))
+
+	client, err := a.client(ctx, clientID, models.GrantPassword)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	user, err := a.checkPassword(ctx, emailAddr, password)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	result, err := a.completeLogin(ctx, user, fingerprint, client, false)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("user logged in successfully", slog.String("reason", result.Reason))
+
+	return result, nil
+}
+
+// client returns the registered client if it may use the grant type.
+// Callers without a client id get the zero Client and the configured lifetimes.
+func (a *Auth) client(ctx context.Context, clientID, grantType string) (models.Client, error) {
+	if clientID == "" {
+		if !(models.Client{}).Allows(grantType) {
+			a.log.Warn("grant type needs a registered client", slog.String("grant_type", grantType))
+
+			return models.Client{}, ErrClientNotAllowed
+		}
+
+		return models.Client{}, nil
+	}
+
+	client, err := a.clients.Client(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrClientNotFound) {
+			a.log.Warn("unknown client", slog.String("client_id", clientID))
+
+			return models.Client{}, ErrUnknownClient
+		}
+
+		a.log.Error("failed to get client", l.Err(err))
+		return models.Client{}, err
+	}
+
+	if !client.Allows(grantType) {
+		a.log.Warn("grant type not allowed for client", slog.String("client_id", clientID), slog.String("grant_type", grantType))
+
+		return models.Client{}, ErrClientNotAllowed
+	}
+
+	return client, nil
+}
+
+// checkPassword is the first login step: it returns the active user the password belongs to
+func (a *Auth) checkPassword(ctx context.Context, emailAddr, password string) (models.User, error) {
+	log := a.log.With(slog.String("func", "auth.checkPassword"))
+
+	emailAddr, err := a.normalizer.Normalize(emailAddr)
+	if err != nil {
+		log.Warn("failed to normalize email", l.Err(err))
+
+		return models.User{}, ErrInvalidCreds
+	}
+
+	// don't even look at the password while the account is locked
+	retryAfter, err := a.limiter.Check(ctx, emailAddr)
+	if err != nil {
+		return models.User{}, err
+	}
+	if retryAfter > 0 {
+		log.Warn("account is locked", slog.Duration("retry_after", retryAfter))
+
+		return models.User{}, &LockedError{RetryAfter: retryAfter}
+	}
 
 	// get the user from db
-	user, err := a.userProvider.User(ctx, email)
+	user, err := a.userProvider.User(ctx, emailAddr)
 	if err != nil {
 		if errors.Is(err, postgres.ErrUserNotFound) {
 			a.log.Warn("user not found", l.Err(err))
 
-			return models.TokenPair{}, fmt.Errorf("%s:%w", f, ErrInvalidCreds)
+			// spend the same time as a wrong password does, the result doesn't matter
+			_ = a.hasher.CheckPassword(password, a.dummyHash)
+
+			return models.User{}, a.failLogin(ctx, emailAddr)
 		}
 
 		a.log.Error("failed to get user", l.Err(err))
-		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+		return models.User{}, err
 	}
 
 	// check password
-	if err := hasher.CheckPassword(password, user.PasswordHash); err != nil {
+	if err := a.hasher.CheckPassword(password, user.PasswordHash); err != nil {
 		a.log.Warn("invalid credentials", l.Err(err))
 
-		return models.TokenPair{}, fmt.Errorf("%s:%w", f, ErrInvalidCreds)
+		return models.User{}, a.failLogin(ctx, emailAddr)
 	}
 
+	// the plain password is only known here, so hashes made with an old
+	// algorithm, parameters or pepper are upgraded on a successful login
+	if a.hasher.NeedsRehash(user.PasswordHash) {
+		a.rehash(ctx, user.ID, password)
+	}
+
+	if err := a.limiter.Reset(ctx, emailAddr); err != nil {
+		return models.User{}, err
+	}
+
+	// check that the account wasn't disabled or suspended
+	if err := checkStatus(user); err != nil {
+		a.log.Warn("user is not active", l.Err(err), slog.Int("user_id", int(user.ID)))
+
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// completeLogin runs the steps left after the password was checked: the second factor
+// unless it's already passed, then a password change if one is due, then the tokens
+func (a *Auth) completeLogin(ctx context.Context, user models.User, fingerprint string, client models.Client, mfaPassed bool) (models.LoginResult, error) {
+	if !mfaPassed {
+		enabled, err := a.secondFactorEnabled(ctx, user)
+		if err != nil {
+			return models.LoginResult{}, err
+		}
+
+		if enabled {
+			return a.restrictedLogin(ctx, user, tokens.PurposeMFA, models.ReasonMFARequired, client)
+		}
+	}
+
+	// an expired or admin-reset password can only be replaced, not used
+	if reason := a.passwordChangeReason(user); reason != "" {
+		return a.restrictedLogin(ctx, user, tokens.PurposePasswordChange, reason, client)
+	}
+
+	pair, err := a.issueTokens(ctx, user.ID, fingerprint, client)
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	return models.LoginResult{Tokens: pair, TrustedDevice: a.deviceTrusted(ctx, user.ID, fingerprint)}, nil
+}
+
+// secondFactorEnabled reports whether the user has an authenticator app, a passkey or a verified phone
+func (a *Auth) secondFactorEnabled(ctx context.Context, user models.User) (bool, error) {
+	if user.Phone != "" {
+		return true, nil
+	}
+
+	return a.strongFactorEnabled(ctx, user.ID)
+}
+
+// strongFactorEnabled reports whether the user has an authenticator app or a passkey,
+// factors a texted code mustn't be able to skip
+func (a *Auth) strongFactorEnabled(ctx context.Context, userID int32) (bool, error) {
+	enabled, err := a.mfa.Enabled(ctx, userID)
+	if err != nil || enabled {
+		return enabled, err
+	}
+
+	return a.passkeys.Enabled(ctx, userID)
+}
+
+// restrictedLogin remembers the client in the token, the next step issues tokens for it
+func (a *Auth) restrictedLogin(ctx context.Context, user models.User, purpose, reason string, client models.Client) (models.LoginResult, error) {
+	token, err := a.tokenManager.NewRestrictedToken(ctx, user, purpose, client.ClientID)
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	a.log.Info("login restricted", slog.String("reason", reason), slog.Int("user_id", int(user.ID)))
+
+	return models.LoginResult{RestrictedToken: token, Reason: reason}, nil
+}
+
+// issueTokens creates a new session for the device. Clients that
+// can't use refresh tokens get only an access token.
+func (a *Auth) issueTokens(ctx context.Context, userID int32, fingerprint string, client models.Client) (models.TokenPair, error) {
 	// generate new access token
-	accessToken, err := a.tokenManager.NewAccessToken(ctx, user.ID)
+	accessToken, err := a.tokenManager.NewAccessToken(ctx, userID, client)
 	if err != nil {
 		a.log.Error("failed to generate jwt access token", l.Err(err))
 
-		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+		return models.TokenPair{}, err
+	}
+
+	if !client.Allows(models.GrantRefreshToken) {
+		return models.TokenPair{AccessToken: accessToken}, nil
 	}
 
 	// generate new refresh token
-	refreshToken, err := a.tokenManager.NewRefreshToken(ctx, user.ID, fingerprint)
+	refreshToken, err := a.tokenManager.NewRefreshToken(ctx, userID, fingerprint, client, "")
 	if err != nil {
 		a.log.Error("failed to generate refresh token", l.Err(err))
 
-		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+		return models.TokenPair{}, err
 	}
 
-	log.Info("user logged in successfully")
-
 	return models.TokenPair{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 	}, nil
 }
 
+// passwordChangeReason is empty when the password can still be used
+func (a *Auth) passwordChangeReason(user models.User) string {
+	if user.MustChangePassword {
+		return models.ReasonPasswordChangeRequired
+	}
+	if a.maxPasswordAge > 0 && time.Since(user.PasswordChangedAt) > a.maxPasswordAge {
+		return models.ReasonPasswordExpired
+	}
+
+	return ""
+}
+
+// SetNewPassword finishes a restricted login: the new password replaces
+// the expired one and the user gets a normal token pair
+func (a *Auth) SetNewPassword(ctx context.Context, restrictedToken, newPassword, fingerprint string) (models.TokenPair, error) {
+	const f = "auth.SetNewPassword"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("setting new password")
+
+	restricted, err := a.tokenManager.ValidateRestrictedToken(ctx, restrictedToken, tokens.PurposePasswordChange)
+	if err != nil {
+		log.Warn("failed to validate restricted token", l.Err(err))
+
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, ErrInvalidRestrictedToken)
+	}
+	userID := restricted.UserID
+
+	client, err := a.client(ctx, restricted.ClientID, models.GrantPassword)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	user, err := a.activeUser(ctx, userID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// the token is good for one change only
+	if restricted.PasswordVersion != user.PasswordVersion {
+		log.Warn("restricted token issued before the last password change", slog.Int("user_id", int(userID)))
+
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, ErrInvalidRestrictedToken)
+	}
+
+	if err := a.setPassword(ctx, user, newPassword); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// the password may have been changed because it leaked, so sessions
+	// started with the old one end, the new pair is the only one left
+	if err := a.tokenManager.DeleteAll(ctx, userID); err != nil {
+		log.Error("failed to delete sessions", l.Err(err))
+
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	pair, err := a.issueTokens(ctx, userID, fingerprint, client)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("new password set", slog.Int("user_id", int(userID)))
+
+	return pair, nil
+}
+
+// failLogin records a failed attempt for the email and returns the error for the caller.
+// Unknown emails are counted too, so lockout doesn't tell which accounts exist.
+func (a *Auth) failLogin(ctx context.Context, emailAddr string) error {
+	lockFor, err := a.limiter.Fail(ctx, emailAddr)
+	if err != nil {
+		return err
+	}
+	if lockFor > 0 {
+		return &LockedError{RetryAfter: lockFor}
+	}
+
+	return ErrInvalidCreds
+}
+
+// UpdatePassword changes the password of the access token owner.
+// The old password is required and wrong guesses count towards the lockout.
+func (a *Auth) UpdatePassword(ctx context.Context, accessToken, oldPassword, newPassword string) error {
+	const f = "auth.UpdatePassword"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("updating user password")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	user, err := a.activeUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	retryAfter, err := a.limiter.Check(ctx, user.Email)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if retryAfter > 0 {
+		log.Warn("account is locked", slog.Duration("retry_after", retryAfter))
+
+		return fmt.Errorf("%s:%w", f, &LockedError{RetryAfter: retryAfter})
+	}
+
+	if err := a.hasher.CheckPassword(oldPassword, user.PasswordHash); err != nil {
+		log.Warn("invalid credentials", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, a.failLogin(ctx, user.Email))
+	}
+
+	if err := a.limiter.Reset(ctx, user.Email); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.setPassword(ctx, user, newPassword); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("password updated", slog.Int("user_id", int(userID)))
+
+	return nil
+}
+
+// setPassword checks the new password against the policy and the history and saves it
+func (a *Auth) setPassword(ctx context.Context, user models.User, password string) error {
+	log := a.log.With(slog.String("func", "auth.setPassword"), slog.Int("user_id", int(user.ID)))
+
+	if err := a.checkNewPassword(password, user.Email); err != nil {
+		log.Warn("password rejected", l.Err(err))
+
+		return err
+	}
+
+	if err := a.checkReuse(ctx, user, password); err != nil {
+		log.Warn("password rejected", l.Err(err))
+
+		return err
+	}
+
+	hash, err := a.hasher.HashPassword(password)
+	if err != nil {
+		log.Error("failed to generate password", l.Err(err))
+
+		return err
+	}
+
+	if err := a.userSaver.UpdatePassword(ctx, user.ID, hash, a.historySize); err != nil {
+		log.Error("failed to save password", l.Err(err))
+
+		return err
+	}
+
+	return nil
+}
+
+// checkReuse rejects the current password and the ones kept in the history.
+// Each hash carries its own algorithm and salt, so they are checked one by one.
+func (a *Auth) checkReuse(ctx context.Context, user models.User, password string) error {
+	hashes := [][]byte{user.PasswordHash}
+
+	if a.historySize > 0 {
+		history, err := a.userProvider.PasswordHistory(ctx, user.ID, a.historySize)
+		if err != nil {
+			return err
+		}
+
+		hashes = append(hashes, history...)
+	}
+
+	for _, hash := range hashes {
+		err := a.hasher.CheckPassword(password, hash)
+		if err == nil {
+			return ErrPasswordReuse
+		}
+		if !errors.Is(err, hasher.ErrMismatchedPassword) {
+			// a hash we can't read anymore can't be compared, so it doesn't block the password
+			a.log.Warn("failed to check old password hash", l.Err(err), slog.Int("user_id", int(user.ID)))
+		}
+	}
+
+	return nil
+}
+
+// checkNewPassword must be called on every path that sets a password
+func (a *Auth) checkNewPassword(password, emailAddr string) error {
+	if err := a.policy.Check(password, emailAddr); err != nil {
+		return err
+	}
+
+	if a.breachChecker == nil {
+		return nil
+	}
+
+	breached, err := a.breachChecker.Breached(password)
+	if err != nil {
+		return err
+	}
+	if breached {
+		return ErrBreachedPass
+	}
+
+	return nil
+}
+
+// rehash replaces the user's password hash with a fresh one.
+// Failures are only logged, the old hash keeps working.
+func (a *Auth) rehash(ctx context.Context, userID int32, password string) {
+	log := a.log.With(slog.String("func", "auth.rehash"), slog.Int("user_id", int(userID)))
+
+	hash, err := a.hasher.HashPassword(password)
+	if err != nil {
+		log.Error("failed to rehash password", l.Err(err))
+		return
+	}
+
+	if err := a.userSaver.UpdatePasswordHash(ctx, userID, hash); err != nil {
+		log.Error("failed to save rehashed password", l.Err(err))
+		return
+	}
+
+	log.Info("password rehashed")
+}
+
 func (a *Auth) GetAccessToken(ctx context.Context, refreshToken, fingerprint string) (string, error) {
 	const f = "service.GetAccessToken"
 
@@ -135,15 +803,35 @@ func (a *Auth) GetAccessToken(ctx context.Context, refreshToken, fingerprint str
 	log.Info("attempting to generate new access token using refresh token")
 
 	// Validate the refresh token
-	userID, err := a.tokenManager.ValidateRefreshToken(ctx, refreshToken, fingerprint)
+	refresh, err := a.tokenManager.ValidateRefreshToken(ctx, refreshToken, fingerprint)
 	if err != nil {
 		log.Error("failed to validate refresh token", l.Err(err))
 
 		return "", fmt.Errorf("%s:%w", f, err)
 	}
 
+	// sessions of third-party clients are refreshed at the token endpoint of the provider
+	if refresh.ClientID != "" && fingerprint == clientFingerprint(refresh.ClientID) {
+		log.Warn("refresh token of a third-party client", slog.String("client_id", refresh.ClientID))
+
+		return "", fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+	userID := refresh.UserID
+
+	// the new token gets the lifetime of the client the session belongs to
+	client, err := a.client(ctx, refresh.ClientID, models.GrantRefreshToken)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.checkUserStatus(ctx, userID); err != nil {
+		log.Warn("user is not active", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
 	// Generate the access token
-	accessToken, err := a.tokenManager.NewAccessToken(ctx, userID)
+	accessToken, err := a.tokenManager.NewAccessToken(ctx, userID, client)
 	if err != nil {
 		log.Error("failed to create access token", l.Err(err))
 
@@ -169,6 +857,13 @@ func (a *Auth) ValidateAccessToken(ctx context.Context, token string) (int32, er
 		return 0, fmt.Errorf("%s:%w", f, err)
 	}
 
+	// access tokens outlive suspensions, so status is checked on every validation
+	if err := a.checkUserStatus(ctx, userID); err != nil {
+		log.Warn("user is not active", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
 	log.Info("access token validated successfully", slog.Int("user_id", int(userID)))
 
 	return userID, nil
@@ -198,3 +893,56 @@ func (a *Auth) Logout(ctx context.Context, accessToken, fingerprint string) erro
 
 	return nil
 }
+
+// activeUser loads the user and refuses disabled and suspended ones
+func (a *Auth) activeUser(ctx context.Context, userID int32) (models.User, error) {
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			return models.User{}, ErrUserNotFound
+		}
+
+		a.log.Error("failed to get user", l.Err(err), slog.Int("user_id", int(userID)))
+		return models.User{}, err
+	}
+
+	if err := checkStatus(user); err != nil {
+		a.log.Warn("user is not active", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (a *Auth) checkUserStatus(ctx context.Context, userID int32) error {
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+
+		return err
+	}
+
+	return checkStatus(user)
+}
+
+// checkStatus refuses disabled and currently suspended users.
+// Suspensions past their end time are treated as active.
+func checkStatus(user models.User) error {
+	switch user.Status {
+	case models.UserStatusDisabled:
+		return ErrUserDisabled
+	case models.UserStatusUnverified:
+		return ErrUnverified
+	case models.UserStatusSuspended:
+		if !user.SuspendedUntil.IsZero() && time.Now().After(user.SuspendedUntil) {
+			return nil
+		}
+
+		return &SuspendedError{Reason: user.SuspensionReason, Until: user.SuspendedUntil}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/service/devicegrant"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+// StartDeviceAuthorization gives a device without a browser, like the CLI, the codes
+// of the device authorization grant. The user approves the code in the web app.
+func (a *Auth) StartDeviceAuthorization(ctx context.Context, clientID string) (devicegrant.Authorization, error) {
+	const f = "auth.StartDeviceAuthorization"
+
+	log := a.log.With(slog.String("func", f), slog.String("client_id", clientID))
+	log.Info("starting device authorization")
+
+	if _, err := a.client(ctx, clientID, models.GrantDeviceCode); err != nil {
+		return devicegrant.Authorization{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	auth, err := a.deviceGrants.Start(ctx, clientID)
+	if err != nil {
+		return devicegrant.Authorization{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return auth, nil
+}
+
+// LookupDevice returns the client of the code shown by a device, so the web app
+// can ask the logged in user whether to allow it. The code stays pending.
+func (a *Auth) LookupDevice(ctx context.Context, accessToken, userCode string) (models.Client, error) {
+	const f = "auth.LookupDevice"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("looking up device code")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return models.Client{}, fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return models.Client{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	clientID, err := a.deviceGrants.Lookup(ctx, userCode)
+	if err != nil {
+		log.Warn("failed to look up device code", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return models.Client{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	client, err := a.client(ctx, clientID, models.GrantDeviceCode)
+	if err != nil {
+		return models.Client{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return client, nil
+}
+
+// ResolveDevice is called by the web app when the logged in user approves or denies
+// the code shown by a device, after LookupDevice showed whose it is.
+// It returns the client the device belongs to.
+func (a *Auth) ResolveDevice(ctx context.Context, accessToken, userCode string, approved bool) (models.Client, error) {
+	const f = "auth.ResolveDevice"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("resolving device code", slog.Bool("approved", approved))
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return models.Client{}, fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return models.Client{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	clientID, err := a.deviceGrants.Resolve(ctx, userCode, userID, approved)
+	if err != nil {
+		log.Warn("failed to resolve device code", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return models.Client{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	client, err := a.client(ctx, clientID, models.GrantDeviceCode)
+	if err != nil {
+		return models.Client{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("device code resolved", slog.Int("user_id", int(userID)), slog.String("client_id", clientID))
+
+	return client, nil
+}
+
+// PollDeviceAuthorization returns the tokens once the user approved the device.
+// The device gets its own session under its fingerprint, like any other login.
+func (a *Auth) PollDeviceAuthorization(ctx context.Context, deviceCode, fingerprint string) (models.TokenPair, error) {
+	const f = "auth.PollDeviceAuthorization"
+
+	log := a.log.With(slog.String("func", f))
+
+	userID, clientID, err := a.deviceGrants.Poll(ctx, deviceCode)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// the client or the user may have changed since the approval
+	client, err := a.client(ctx, clientID, models.GrantDeviceCode)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		log.Warn("user of the device code is not active", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	pair, err := a.issueTokens(ctx, userID, fingerprint, client)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("device logged in", slog.Int("user_id", int(userID)), slog.String("client_id", clientID))
+
+	return pair, nil
+}
@@ -0,0 +1,242 @@
+package devicegrant
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/repo/redis"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+// user codes are typed on another device, so they skip vowels, which keeps
+// words out of them, and letters that look like digits
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+	saveAttempts     = 3
+)
+
+var (
+	ErrInvalidUserCode      = errors.New("invalid or expired user code")
+	ErrAuthorizationPending = errors.New("the user hasn't approved the device yet")
+	ErrAccessDenied         = errors.New("the user denied the device")
+	ErrExpiredToken         = errors.New("device code is invalid or expired")
+)
+
+// SlowDownError is returned when the device polls more often than it was told to
+type SlowDownError struct {
+	Interval time.Duration // the new interval the device has to keep
+}
+
+func (e *SlowDownError) Error() string { return "device polls too often" }
+
+// Authorization is what the device shows the user and polls with, as in RFC 8628
+type Authorization struct {
+	DeviceCode              string
+	UserCode                string // formatted as XXXX-XXXX
+	VerificationURI         string
+	VerificationURIComplete string // the verification uri with the user code
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// Manager runs the OAuth 2.0 device authorization grant: the device gets a code
+// to show the user, the user approves it in the web app, and the device polls until then.
+// Device codes are stored hashed, user codes are useless once resolved.
+type Manager struct {
+	log *slog.Logger
+
+	ttl      time.Duration
+	interval time.Duration
+	// page of the web app the user enters the code on
+	verificationURL string
+
+	storage Storage
+}
+
+//go:generate mockgen -source=devicegrant.go -destination=mock/devicegrant.go
+type Storage interface {
+	SaveDeviceCode(ctx context.Context, deviceCodeHash, userCode, clientID string, interval, ttl time.Duration) (bool, error)
+	DeviceCodeClient(ctx context.Context, userCode string) (string, error)
+	ResolveDeviceCode(ctx context.Context, userCode string, userID int32, approved bool) (string, error)
+	PollDeviceCode(ctx context.Context, deviceCodeHash string, now time.Time) (redis.DevicePoll, error)
+}
+
+func New(log *slog.Logger, ttl, interval time.Duration, verificationURL string, storage Storage) *Manager {
+	return &Manager{
+		log:             log,
+		ttl:             ttl,
+		interval:        max(interval, time.Second),
+		verificationURL: verificationURL,
+		storage:         storage,
+	}
+}
+
+// Start issues the codes for a device of the client
+func (m *Manager) Start(ctx context.Context, clientID string) (Authorization, error) {
+	const f = "devicegrant.Start"
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Authorization{}, fmt.Errorf("%s:%w", f, err)
+	}
+	deviceCode := base64.RawURLEncoding.EncodeToString(b)
+
+	// a clash with a pending user code is unlikely, but the code would approve another device
+	for range saveAttempts {
+		userCode, err := newUserCode()
+		if err != nil {
+			return Authorization{}, fmt.Errorf("%s:%w", f, err)
+		}
+
+		saved, err := m.storage.SaveDeviceCode(ctx, hashCode(deviceCode), userCode, clientID, m.interval, m.ttl)
+		if err != nil {
+			m.log.Error("failed to save device code", l.Err(err), slog.String("func", f))
+
+			return Authorization{}, fmt.Errorf("%s:%w", f, err)
+		}
+		if !saved {
+			continue
+		}
+
+		return Authorization{
+			DeviceCode:              deviceCode,
+			UserCode:                formatUserCode(userCode),
+			VerificationURI:         m.verificationURL,
+			VerificationURIComplete: m.completeURL(userCode),
+			ExpiresIn:               m.ttl,
+			Interval:                m.interval,
+		}, nil
+	}
+
+	return Authorization{}, fmt.Errorf("%s: no free user code", f)
+}
+
+// Lookup returns the client id of a pending code, the code keeps waiting for Resolve
+func (m *Manager) Lookup(ctx context.Context, userCode string) (string, error) {
+	const f = "devicegrant.Lookup"
+
+	code := normalizeUserCode(userCode)
+	if len(code) != userCodeLength {
+		return "", fmt.Errorf("%s:%w", f, ErrInvalidUserCode)
+	}
+
+	clientID, err := m.storage.DeviceCodeClient(ctx, code)
+	if err != nil {
+		if errors.Is(err, redis.ErrDeviceCodeNotFound) {
+			return "", fmt.Errorf("%s:%w", f, ErrInvalidUserCode)
+		}
+
+		m.log.Error("failed to look up device code", l.Err(err), slog.String("func", f))
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return clientID, nil
+}
+
+// Resolve records whether the user approved the device and returns the client id of the code
+func (m *Manager) Resolve(ctx context.Context, userCode string, userID int32, approved bool) (string, error) {
+	const f = "devicegrant.Resolve"
+
+	code := normalizeUserCode(userCode)
+	if len(code) != userCodeLength {
+		return "", fmt.Errorf("%s:%w", f, ErrInvalidUserCode)
+	}
+
+	clientID, err := m.storage.ResolveDeviceCode(ctx, code, userID, approved)
+	if err != nil {
+		if errors.Is(err, redis.ErrDeviceCodeNotFound) {
+			return "", fmt.Errorf("%s:%w", f, ErrInvalidUserCode)
+		}
+
+		m.log.Error("failed to resolve device code", l.Err(err), slog.String("func", f))
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return clientID, nil
+}
+
+// Poll returns the user who approved the device and the client id of the code.
+// Until then it returns ErrAuthorizationPending or a *SlowDownError.
+func (m *Manager) Poll(ctx context.Context, deviceCode string) (int32, string, error) {
+	const f = "devicegrant.Poll"
+
+	poll, err := m.storage.PollDeviceCode(ctx, hashCode(deviceCode), time.Now())
+	if err != nil {
+		if errors.Is(err, redis.ErrDeviceCodeNotFound) {
+			return 0, "", fmt.Errorf("%s:%w", f, ErrExpiredToken)
+		}
+
+		m.log.Error("failed to poll device code", l.Err(err), slog.String("func", f))
+		return 0, "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	switch poll.Status {
+	case redis.DeviceCodeApproved:
+		return poll.UserID, poll.ClientID, nil
+	case redis.DeviceCodeDenied:
+		return 0, "", fmt.Errorf("%s:%w", f, ErrAccessDenied)
+	case redis.DeviceCodeSlowDown:
+		return 0, "", fmt.Errorf("%s:%w", f, &SlowDownError{Interval: poll.Interval})
+	default:
+		return 0, "", fmt.Errorf("%s:%w", f, ErrAuthorizationPending)
+	}
+}
+
+func (m *Manager) completeURL(userCode string) string {
+	u, err := url.Parse(m.verificationURL)
+	if err != nil {
+		return m.verificationURL
+	}
+
+	query := u.Query()
+	query.Set("user_code", formatUserCode(userCode))
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func newUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// normalizeUserCode takes the code the way users type it: any case, with or without the dash
+func normalizeUserCode(userCode string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(userCode) {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func formatUserCode(userCode string) string {
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+func hashCode(deviceCode string) string {
+	sum := sha256.Sum256([]byte(deviceCode))
+
+	return hex.EncodeToString(sum[:])
+}
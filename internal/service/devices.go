@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+// TrustDevice marks the fingerprint of the access token owner's current device as trusted
+// and returns when the trust expires
+func (a *Auth) TrustDevice(ctx context.Context, accessToken, fingerprint, name string) (time.Time, error) {
+	const f = "auth.TrustDevice"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("trusting device")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return time.Time{}, fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return time.Time{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	until := time.Now().Add(a.deviceTrustTTL)
+	if err := a.devices.TrustDevice(ctx, userID, fingerprintHash(fingerprint), name, until); err != nil {
+		log.Error("failed to trust device", l.Err(err))
+
+		return time.Time{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("device trusted", slog.Int("user_id", int(userID)), slog.Time("until", until))
+
+	return until, nil
+}
+
+// TrustedDevices lists the access token owner's devices that are still trusted
+func (a *Auth) TrustedDevices(ctx context.Context, accessToken string) ([]models.TrustedDevice, error) {
+	const f = "auth.TrustedDevices"
+
+	log := a.log.With(slog.String("func", f))
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return nil, fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	devices, err := a.devices.TrustedDevices(ctx, userID)
+	if err != nil {
+		log.Error("failed to get trusted devices", l.Err(err))
+
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return devices, nil
+}
+
+// RevokeTrustedDevice stops trusting one of the access token owner's devices
+func (a *Auth) RevokeTrustedDevice(ctx context.Context, accessToken string, deviceID int32) error {
+	const f = "auth.RevokeTrustedDevice"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("revoking trusted device")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.devices.RevokeTrustedDevice(ctx, userID, deviceID); err != nil {
+		if errors.Is(err, postgres.ErrDeviceNotFound) {
+			return fmt.Errorf("%s:%w", f, ErrDeviceNotFound)
+		}
+
+		log.Error("failed to revoke trusted device", l.Err(err))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("trusted device revoked", slog.Int("user_id", int(userID)), slog.Int("device_id", int(deviceID)))
+
+	return nil
+}
+
+// deviceTrusted reports whether the login comes from a trusted device.
+// It's only reported to the caller: the fingerprint is sent by the client,
+// so it's not a secret strong enough to skip the second factor.
+func (a *Auth) deviceTrusted(ctx context.Context, userID int32, fingerprint string) bool {
+	if fingerprint == "" {
+		return false
+	}
+
+	trusted, err := a.devices.TouchTrustedDevice(ctx, userID, fingerprintHash(fingerprint))
+	if err != nil {
+		// the login itself doesn't depend on it
+		a.log.Error("failed to check trusted device", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return false
+	}
+
+	return trusted
+}
+
+func fingerprintHash(fingerprint string) []byte {
+	sum := sha256.Sum256([]byte(fingerprint))
+
+	return sum[:]
+}
@@ -0,0 +1,496 @@
+package issuer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/redis"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+	"github.com/kuromii5/miku-notes-auth/pkg/oidc"
+)
+
+var (
+	ErrUnknownClient           = errors.New("unknown client")
+	ErrInvalidRedirect         = errors.New("redirect uri isn't registered for the client")
+	ErrUnauthorizedClient      = errors.New("client is not allowed to use this grant type")
+	ErrUnsupportedResponseType = errors.New("only the code response type is supported")
+	ErrPKCERequired            = errors.New("code challenge with the S256 method is required")
+	ErrAuthorizationNotFound   = errors.New("authorization request is expired or unknown")
+	ErrInvalidClient           = errors.New("client authentication failed")
+	ErrInvalidGrant            = errors.New("authorization code is invalid, expired or was issued to another client")
+)
+
+// scopes the provider knows, others are dropped from requests
+const (
+	ScopeOpenID = "openid"
+	ScopeEmail  = "email"
+)
+
+// how the user proves the second factor on the login page
+const (
+	MFAMethodTOTP = "totp"
+	MFAMethodSMS  = "sms"
+)
+
+// Authorization is a request of a client that waits while the user logs in and
+// consents, after the consent the same data is kept under the authorization code
+type Authorization struct {
+	ClientID      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"`
+	State         string `json:"state"`
+	Nonce         string `json:"nonce"`
+	CodeChallenge string `json:"code_challenge"`
+
+	// filled in as the user goes through the pages
+	UserID        int32  `json:"user_id,omitempty"`
+	MFAMethod     string `json:"mfa_method,omitempty"`
+	Authenticated bool   `json:"authenticated,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+}
+
+// HasScope reports whether the scope was requested and granted
+func (a Authorization) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(a.Scope), scope)
+}
+
+// Tokens is the answer of the token endpoint
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string // only for the openid scope
+	Scope        string
+	ExpiresIn    time.Duration
+}
+
+type Manager struct {
+	log *slog.Logger
+
+	issuer     string
+	key        *rsa.PrivateKey
+	keyID      string
+	clients    ClientProvider
+	loginTTL   time.Duration
+	codeTTL    time.Duration
+	idTokenTTL time.Duration
+
+	storage Storage
+}
+
+//go:generate mockgen -source=issuer.go -destination=mock/issuer.go
+type Storage interface {
+	SaveAuthorization(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	Authorization(ctx context.Context, id string) ([]byte, error)
+	UpdateAuthorization(ctx context.Context, id string, data []byte) error
+	DeleteAuthorization(ctx context.Context, id string) error
+	SaveAuthCode(ctx context.Context, code string, data []byte, ttl time.Duration) error
+	TakeAuthCode(ctx context.Context, code string) ([]byte, error)
+}
+type ClientProvider interface {
+	Client(ctx context.Context, clientID string) (models.Client, error)
+}
+
+func New(
+	log *slog.Logger,
+	issuer string,
+	key *rsa.PrivateKey,
+	clients ClientProvider,
+	loginTTL, codeTTL, idTokenTTL time.Duration,
+	storage Storage,
+) *Manager {
+	// clients find the key of a token by its id, derived from the key so it changes with it
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode signing key: %v", err))
+	}
+	sum := sha256.Sum256(der)
+
+	return &Manager{
+		log:        log,
+		issuer:     strings.TrimSuffix(issuer, "/"),
+		key:        key,
+		keyID:      base64.RawURLEncoding.EncodeToString(sum[:12]),
+		clients:    clients,
+		loginTTL:   loginTTL,
+		codeTTL:    codeTTL,
+		idTokenTTL: idTokenTTL,
+		storage:    storage,
+	}
+}
+
+// Client returns the registered client, clients are managed in the clients table
+func (m *Manager) Client(ctx context.Context, clientID string) (models.Client, error) {
+	client, err := m.clients.Client(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrClientNotFound) {
+			return models.Client{}, ErrUnknownClient
+		}
+
+		m.log.Error("failed to get client", l.Err(err), slog.String("client_id", clientID))
+		return models.Client{}, err
+	}
+
+	return client, nil
+}
+
+// AuthenticateClient checks the secret of a confidential client and that it may
+// use the grant type. Public clients, like the browser extension and the CLI, have to send none.
+func (m *Manager) AuthenticateClient(ctx context.Context, clientID, secret, grantType string) (models.Client, error) {
+	client, err := m.Client(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, ErrUnknownClient) {
+			return models.Client{}, ErrInvalidClient
+		}
+
+		return models.Client{}, err
+	}
+
+	if !CheckSecret(client, secret) {
+		return models.Client{}, ErrInvalidClient
+	}
+
+	if !client.Allows(grantType) {
+		return models.Client{}, ErrUnauthorizedClient
+	}
+
+	return client, nil
+}
+
+// CheckSecret compares the secret in constant time, public clients match only an empty one
+func CheckSecret(client models.Client, secret string) bool {
+	var given []byte
+	if secret != "" {
+		given = HashSecret(secret)
+	}
+
+	return subtle.ConstantTimeCompare(client.SecretHash, given) == 1
+}
+
+// HashSecret is how client secrets are stored. They are random, so a fast hash is enough.
+func HashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+
+	return sum[:]
+}
+
+// CheckRedirect makes sure the user can be sent back to the client. Until it
+// passes, errors are shown to the user instead of being sent to the redirect uri.
+func (m *Manager) CheckRedirect(ctx context.Context, clientID, redirectURI string) (models.Client, error) {
+	client, err := m.Client(ctx, clientID)
+	if err != nil {
+		return models.Client{}, err
+	}
+
+	// exact match only, a prefix would let an attacker pick the path
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return models.Client{}, ErrInvalidRedirect
+	}
+
+	return client, nil
+}
+
+// Start saves the authorization request until the user finishes the login pages
+func (m *Manager) Start(ctx context.Context, responseType, codeChallengeMethod string, auth Authorization) (string, error) {
+	const f = "issuer.Start"
+
+	client, err := m.CheckRedirect(ctx, auth.ClientID, auth.RedirectURI)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+	if !client.Allows(models.GrantAuthorizationCode) {
+		return "", fmt.Errorf("%s:%w", f, ErrUnauthorizedClient)
+	}
+	if responseType != "code" {
+		return "", fmt.Errorf("%s:%w", f, ErrUnsupportedResponseType)
+	}
+	if codeChallengeMethod != "S256" || auth.CodeChallenge == "" {
+		return "", fmt.Errorf("%s:%w", f, ErrPKCERequired)
+	}
+
+	auth.Scope = supportedScope(auth.Scope, client.Scopes)
+	auth.UserID, auth.MFAMethod, auth.Authenticated, auth.AuthTime = 0, "", false, 0
+
+	id, err := randomString()
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := m.save(ctx, id, auth); err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return id, nil
+}
+
+// Authorization returns the request the login pages work on
+func (m *Manager) Authorization(ctx context.Context, id string) (Authorization, error) {
+	const f = "issuer.Authorization"
+
+	data, err := m.storage.Authorization(ctx, id)
+	if err != nil {
+		if errors.Is(err, redis.ErrAuthorizationNotFound) {
+			return Authorization{}, fmt.Errorf("%s:%w", f, ErrAuthorizationNotFound)
+		}
+
+		m.log.Error("failed to get authorization request", l.Err(err), slog.String("func", f))
+		return Authorization{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	var auth Authorization
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return Authorization{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return auth, nil
+}
+
+// Update saves the progress of the user on the login pages
+func (m *Manager) Update(ctx context.Context, id string, auth Authorization) error {
+	const f = "issuer.Update"
+
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := m.storage.UpdateAuthorization(ctx, id, data); err != nil {
+		if errors.Is(err, redis.ErrAuthorizationNotFound) {
+			return fmt.Errorf("%s:%w", f, ErrAuthorizationNotFound)
+		}
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// Finish ends the request. An approved one returns the redirect with a new
+// authorization code, a denied one the redirect with the access_denied error.
+func (m *Manager) Finish(ctx context.Context, id string, approved bool) (string, error) {
+	const f = "issuer.Finish"
+
+	auth, err := m.Authorization(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	// nothing to approve before the user has logged in
+	if approved && !auth.Authenticated {
+		return "", fmt.Errorf("%s:%w", f, ErrAuthorizationNotFound)
+	}
+
+	// the request is used once, whatever the user decided
+	if err := m.storage.DeleteAuthorization(ctx, id); err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if !approved {
+		return ErrorRedirect(auth.RedirectURI, auth.State, "access_denied", "the user denied the request"), nil
+	}
+
+	code, err := randomString()
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+	if err := m.storage.SaveAuthCode(ctx, code, data, m.codeTTL); err != nil {
+		m.log.Error("failed to save authorization code", l.Err(err), slog.String("func", f))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return redirectWith(auth.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {auth.State},
+		"iss":   {m.issuer},
+	}), nil
+}
+
+// Redeem exchanges the code for the authorization it was issued for. The
+// code is burnt by the first try, even when the client or verifier is wrong.
+func (m *Manager) Redeem(ctx context.Context, client models.Client, code, redirectURI, codeVerifier string) (Authorization, error) {
+	const f = "issuer.Redeem"
+
+	data, err := m.storage.TakeAuthCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, redis.ErrAuthCodeNotFound) {
+			return Authorization{}, fmt.Errorf("%s:%w", f, ErrInvalidGrant)
+		}
+
+		return Authorization{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	var auth Authorization
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return Authorization{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	challenge := oidc.CodeChallenge(codeVerifier)
+	if auth.ClientID != client.ClientID || auth.RedirectURI != redirectURI ||
+		subtle.ConstantTimeCompare([]byte(challenge), []byte(auth.CodeChallenge)) != 1 {
+		m.log.Warn("authorization code doesn't match the token request", slog.String("client_id", client.ClientID))
+
+		return Authorization{}, fmt.Errorf("%s:%w", f, ErrInvalidGrant)
+	}
+
+	return auth, nil
+}
+
+// IDToken tells the client who logged in
+func (m *Manager) IDToken(auth Authorization, email string) (string, error) {
+	const f = "issuer.IDToken"
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       m.issuer,
+		"sub":       fmt.Sprintf("%d", auth.UserID),
+		"aud":       auth.ClientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(m.idTokenTTL).Unix(),
+		"auth_time": auth.AuthTime,
+	}
+	if auth.Nonce != "" {
+		claims["nonce"] = auth.Nonce
+	}
+	if auth.HasScope(ScopeEmail) {
+		claims["email"] = email
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.keyID
+
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		m.log.Error("failed to sign id token", l.Err(err), slog.String("func", f))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return signed, nil
+}
+
+// Discovery is the OpenID Connect discovery document
+func (m *Manager) Discovery() map[string]any {
+	return map[string]any{
+		"issuer":                                m.issuer,
+		"authorization_endpoint":                m.issuer + "/authorize",
+		"token_endpoint":                        m.issuer + "/token",
+		"userinfo_endpoint":                     m.issuer + "/userinfo",
+		"jwks_uri":                              m.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{ScopeOpenID, ScopeEmail},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"iss", "sub", "aud", "iat", "exp", "auth_time", "nonce", "email"},
+	}
+}
+
+// JWKS publishes the public key the id tokens are signed with
+func (m *Manager) JWKS() map[string]any {
+	return map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": m.keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	}
+}
+
+// ErrorRedirect sends the OAuth error back to the client
+func ErrorRedirect(redirectURI, state, code, description string) string {
+	values := url.Values{
+		"error":             {code},
+		"error_description": {description},
+	}
+	if state != "" {
+		values.Set("state", state)
+	}
+
+	return redirectWith(redirectURI, values)
+}
+
+func (m *Manager) save(ctx context.Context, id string, auth Authorization) error {
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+
+	if err := m.storage.SaveAuthorization(ctx, id, data, m.loginTTL); err != nil {
+		m.log.Error("failed to save authorization request", l.Err(err))
+
+		return err
+	}
+
+	return nil
+}
+
+// redirectWith keeps the query the client registered the redirect uri with
+func redirectWith(redirectURI string, values url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for k, v := range values {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// supportedScope drops the scopes the provider doesn't know and the ones
+// the client isn't allowed, clients without a scope list get none
+func supportedScope(scope string, allowed []string) string {
+	var granted []string
+	for _, s := range strings.Fields(scope) {
+		if s != ScopeOpenID && s != ScopeEmail {
+			continue
+		}
+		if !slices.Contains(allowed, s) {
+			continue
+		}
+		if !slices.Contains(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+
+	return strings.Join(granted, " ")
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,119 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+// Limiter tracks failed login attempts per account. Once an account reaches
+// maxAttempts failures inside the window it gets locked, and every further
+// failure doubles the lock duration up to maxDelay.
+type Limiter struct {
+	log *slog.Logger
+
+	maxAttempts int64
+	window      time.Duration
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+
+	attemptStorage AttemptStorage
+}
+
+//go:generate mockgen -source=lockout.go -destination=mock/lockout.go
+type AttemptStorage interface {
+	// LockTTL returns remaining lock time, zero if the account isn't locked
+	LockTTL(ctx context.Context, key string) (time.Duration, error)
+	AddFailedAttempt(ctx context.Context, key string, window time.Duration) (int64, error)
+	Lock(ctx context.Context, key string, lockFor, window time.Duration) error
+	ResetAttempts(ctx context.Context, key string) error
+}
+
+func New(
+	log *slog.Logger,
+	maxAttempts int,
+	window, baseDelay, maxDelay time.Duration,
+	attemptStorage AttemptStorage,
+) *Limiter {
+	return &Limiter{
+		log:            log,
+		maxAttempts:    int64(maxAttempts),
+		window:         window,
+		baseDelay:      baseDelay,
+		maxDelay:       maxDelay,
+		attemptStorage: attemptStorage,
+	}
+}
+
+// Check returns how long the account stays locked, zero if it's not
+func (lm *Limiter) Check(ctx context.Context, key string) (time.Duration, error) {
+	const f = "lockout.Check"
+
+	retryAfter, err := lm.attemptStorage.LockTTL(ctx, key)
+	if err != nil {
+		lm.log.Error("failed to get account lock", l.Err(err), slog.String("func", f))
+
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return retryAfter, nil
+}
+
+// Fail records a failed attempt and returns the lock duration
+// if this attempt got the account locked
+func (lm *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	const f = "lockout.Fail"
+
+	log := lm.log.With(slog.String("func", f))
+
+	attempts, err := lm.attemptStorage.AddFailedAttempt(ctx, key, lm.window)
+	if err != nil {
+		log.Error("failed to save failed attempt", l.Err(err))
+
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	if attempts < lm.maxAttempts {
+		return 0, nil
+	}
+
+	lockFor := lm.delay(attempts - lm.maxAttempts)
+
+	// keep counting attempts while locked, so the next failure after
+	// the lock has expired backs off even further
+	if err := lm.attemptStorage.Lock(ctx, key, lockFor, lm.window+lockFor); err != nil {
+		log.Error("failed to lock account", l.Err(err))
+
+		return 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Warn("account locked", slog.Int64("attempts", attempts), slog.Duration("lock_for", lockFor))
+
+	return lockFor, nil
+}
+
+// Reset forgets all failed attempts and unlocks the account
+func (lm *Limiter) Reset(ctx context.Context, key string) error {
+	const f = "lockout.Reset"
+
+	if err := lm.attemptStorage.ResetAttempts(ctx, key); err != nil {
+		lm.log.Error("failed to reset attempts", l.Err(err), slog.String("func", f))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// delay is baseDelay * 2^over capped at maxDelay
+func (lm *Limiter) delay(over int64) time.Duration {
+	d := lm.baseDelay
+	for i := int64(0); i < over && d < lm.maxDelay; i++ {
+		d *= 2
+	}
+
+	return min(d, lm.maxDelay)
+}
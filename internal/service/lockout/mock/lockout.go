@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: lockout.go
+
+// Package mock_lockout is a generated GoMock package.
+package mock_lockout
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockAttemptStorage is a mock of AttemptStorage interface.
+type MockAttemptStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockAttemptStorageMockRecorder
+}
+
+// MockAttemptStorageMockRecorder is the mock recorder for MockAttemptStorage.
+type MockAttemptStorageMockRecorder struct {
+	mock *MockAttemptStorage
+}
+
+// NewMockAttemptStorage creates a new mock instance.
+func NewMockAttemptStorage(ctrl *gomock.Controller) *MockAttemptStorage {
+	mock := &MockAttemptStorage{ctrl: ctrl}
+	mock.recorder = &MockAttemptStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAttemptStorage) EXPECT() *MockAttemptStorageMockRecorder {
+	return m.recorder
+}
+
+// AddFailedAttempt mocks base method.
+func (m *MockAttemptStorage) AddFailedAttempt(ctx context.Context, key string, window time.Duration) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddFailedAttempt", ctx, key, window)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddFailedAttempt indicates an expected call of AddFailedAttempt.
+func (mr *MockAttemptStorageMockRecorder) AddFailedAttempt(ctx, key, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddFailedAttempt", reflect.TypeOf((*MockAttemptStorage)(nil).AddFailedAttempt), ctx, key, window)
+}
+
+// Lock mocks base method.
+func (m *MockAttemptStorage) Lock(ctx context.Context, key string, lockFor, window time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lock", ctx, key, lockFor, window)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Lock indicates an expected call of Lock.
+func (mr *MockAttemptStorageMockRecorder) Lock(ctx, key, lockFor, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*MockAttemptStorage)(nil).Lock), ctx, key, lockFor, window)
+}
+
+// LockTTL mocks base method.
+func (m *MockAttemptStorage) LockTTL(ctx context.Context, key string) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockTTL", ctx, key)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LockTTL indicates an expected call of LockTTL.
+func (mr *MockAttemptStorageMockRecorder) LockTTL(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockTTL", reflect.TypeOf((*MockAttemptStorage)(nil).LockTTL), ctx, key)
+}
+
+// ResetAttempts mocks base method.
+func (m *MockAttemptStorage) ResetAttempts(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetAttempts", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetAttempts indicates an expected call of ResetAttempts.
+func (mr *MockAttemptStorageMockRecorder) ResetAttempts(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetAttempts", reflect.TypeOf((*MockAttemptStorage)(nil).ResetAttempts), ctx, key)
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/internal/service/logincode"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+// RequestLoginCode emails a one-time code and a magic link to the user.
+// Unknown and inactive emails get the same answer but no email. Unconfirmed
+// accounts get the code too, logging in with it confirms the email.
+func (a *Auth) RequestLoginCode(ctx context.Context, emailAddr string) error {
+	const f = "auth.RequestLoginCode"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("requesting login code")
+
+	emailAddr, err := a.normalizer.Normalize(emailAddr)
+	if err != nil {
+		log.Warn("failed to normalize email", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidEmail)
+	}
+
+	if err := a.loginCodes.Reserve(ctx, emailAddr); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	user, err := a.userProvider.User(ctx, emailAddr)
+	if err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			log.Info("login code requested for unknown email")
+
+			return nil
+		}
+
+		log.Error("failed to get user", l.Err(err))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := checkStatus(user); err != nil && !errors.Is(err, ErrUnverified) {
+		log.Info("login code requested for inactive user", l.Err(err), slog.Int("user_id", int(user.ID)))
+
+		return nil
+	}
+
+	if err := a.loginCodes.Send(ctx, user.Email); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("login code sent", slog.Int("user_id", int(user.ID)))
+
+	return nil
+}
+
+// LoginWithCode logs in with the emailed code, or with the magic link token
+// alone. The code replaces the password, a second factor is still asked for.
+func (a *Auth) LoginWithCode(ctx context.Context, emailAddr, code, linkToken, fingerprint, clientID string) (models.LoginResult, error) {
+	const f = "auth.LoginWithCode"
+
+	log := a.log.With(slog.String("func", f), slog.String("client_id", clientID))
+	log.Info("logging in with code")
+
+	client, err := a.client(ctx, clientID, models.GrantPassword)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	if linkToken != "" {
+		linkEmail, err := a.loginCodes.VerifyLink(ctx, linkToken)
+		if err != nil {
+			log.Warn("invalid login link", l.Err(err))
+
+			return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+		}
+
+		result, err := a.codeLogin(ctx, linkEmail, fingerprint, client)
+		if err != nil {
+			return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+		}
+
+		return result, nil
+	}
+
+	emailAddr, err = a.normalizer.Normalize(emailAddr)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, ErrInvalidCreds)
+	}
+
+	// six digits are guessable, so wrong codes share the lockout with passwords
+	retryAfter, err := a.limiter.Check(ctx, emailAddr)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+	if retryAfter > 0 {
+		log.Warn("account is locked", slog.Duration("retry_after", retryAfter))
+
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, &LockedError{RetryAfter: retryAfter})
+	}
+
+	if err := a.loginCodes.Verify(ctx, emailAddr, code); err != nil {
+		if errors.Is(err, logincode.ErrInvalidCode) {
+			log.Warn("invalid login code")
+
+			return models.LoginResult{}, fmt.Errorf("%s:%w", f, a.failLogin(ctx, emailAddr))
+		}
+
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.limiter.Reset(ctx, emailAddr); err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	result, err := a.codeLogin(ctx, emailAddr, fingerprint, client)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return result, nil
+}
+
+// codeLogin finishes the login of the email a code or a link was sent to
+func (a *Auth) codeLogin(ctx context.Context, emailAddr, fingerprint string, client models.Client) (models.LoginResult, error) {
+	user, err := a.userProvider.User(ctx, emailAddr)
+	if err != nil {
+		// deleted after the code was sent
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			return models.LoginResult{}, ErrInvalidCreds
+		}
+
+		a.log.Error("failed to get user", l.Err(err))
+		return models.LoginResult{}, err
+	}
+
+	if err := checkStatus(user); err != nil {
+		if !errors.Is(err, ErrUnverified) {
+			a.log.Warn("user is not active", l.Err(err), slog.Int("user_id", int(user.ID)))
+
+			return models.LoginResult{}, err
+		}
+
+		// the code reached the mailbox, so the email is confirmed
+		if err := a.userSaver.SetUserStatus(ctx, user.ID, models.UserStatusActive); err != nil {
+			a.log.Error("failed to confirm email", l.Err(err), slog.Int("user_id", int(user.ID)))
+
+			return models.LoginResult{}, err
+		}
+		user.Status = models.UserStatusActive
+
+		a.log.Info("email confirmed", slog.Int("user_id", int(user.ID)))
+	}
+
+	result, err := a.completeLogin(ctx, user, fingerprint, client, false)
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	a.log.Info("logged in with login code", slog.Int("user_id", int(user.ID)))
+
+	return result, nil
+}
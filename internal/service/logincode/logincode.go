@@ -0,0 +1,262 @@
+package logincode
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/repo/redis"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+const codeDigits = 6
+
+var (
+	ErrNotConfigured   = errors.New("login codes are not configured")
+	ErrTooManyRequests = errors.New("login code was requested too recently")
+	ErrInvalidCode     = errors.New("invalid or expired login code")
+)
+
+// Manager emails one-time login codes with a magic link and checks them.
+// Only keyed hashes are stored, so a redis dump doesn't let anyone in.
+type Manager struct {
+	log *slog.Logger
+
+	// keys the code hashes, six digits are too few for a plain hash
+	key []byte
+
+	ttl         time.Duration
+	maxAttempts int
+	cooldown    time.Duration
+	// page the magic link points to, the token is added as the "token" parameter
+	linkURL string
+
+	storage Storage
+	// nil when mail isn't configured: nobody can request a code
+	mailer Mailer
+}
+
+//go:generate mockgen -source=logincode.go -destination=mock/logincode.go
+type Storage interface {
+	SaveLoginCode(ctx context.Context, email, codeHash, linkHash string, ttl time.Duration) error
+	UseLoginCode(ctx context.Context, email, codeHash string, maxAttempts int) (bool, error)
+	UseLoginLink(ctx context.Context, linkHash string) (string, error)
+	StartLoginCodeCooldown(ctx context.Context, email string, cooldown time.Duration) (bool, error)
+}
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+func New(
+	log *slog.Logger,
+	key []byte,
+	ttl time.Duration,
+	maxAttempts int,
+	cooldown time.Duration,
+	linkURL string,
+	storage Storage,
+	mailer Mailer,
+) *Manager {
+	return &Manager{
+		log:         log,
+		key:         key,
+		ttl:         ttl,
+		maxAttempts: max(maxAttempts, 1),
+		cooldown:    cooldown,
+		linkURL:     linkURL,
+		storage:     storage,
+		mailer:      mailer,
+	}
+}
+
+// Reserve starts the resend cooldown of the email. It's called for unknown
+// emails too, so the answer doesn't tell whether an account exists.
+func (m *Manager) Reserve(ctx context.Context, email string) error {
+	const f = "logincode.Reserve"
+
+	if m.mailer == nil {
+		return fmt.Errorf("%s:%w", f, ErrNotConfigured)
+	}
+
+	started, err := m.storage.StartLoginCodeCooldown(ctx, email, m.cooldown)
+	if err != nil {
+		m.log.Error("failed to start login code cooldown", l.Err(err), slog.String("func", f))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if !started {
+		return fmt.Errorf("%s:%w", f, ErrTooManyRequests)
+	}
+
+	return nil
+}
+
+// Send emails a new code and magic link, the previous ones stop working
+func (m *Manager) Send(ctx context.Context, email string) error {
+	const f = "logincode.Send"
+
+	err := m.send(ctx, email, "Your login code",
+		"Your login code is %s.\n\nOr open this link to log in:\n%s\n\n"+
+			"The code and the link work once and expire in %s. If you didn't try to log in, ignore this email.\n")
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// SendVerification emails a code and a magic link to a new account,
+// logging in with either of them confirms that the address is the user's
+func (m *Manager) SendVerification(ctx context.Context, email string) error {
+	const f = "logincode.SendVerification"
+
+	err := m.send(ctx, email, "Confirm your email",
+		"Your confirmation code is %s.\n\nOr open this link to confirm your email and log in:\n%s\n\n"+
+			"The code and the link work once and expire in %s. If you didn't sign up, ignore this email.\n")
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// SendAccountExists tells the owner of the email that somebody tried to sign up with it
+func (m *Manager) SendAccountExists(ctx context.Context, email string) error {
+	const f = "logincode.SendAccountExists"
+
+	if m.mailer == nil {
+		return fmt.Errorf("%s:%w", f, ErrNotConfigured)
+	}
+
+	body := "Somebody tried to sign up with this email, but you already have an account.\n\n" +
+		"Log in with your password or a login code, or recover the account if you forgot the password. " +
+		"If it wasn't you, ignore this email.\n"
+
+	if err := m.mailer.Send(ctx, email, "You already have an account", body); err != nil {
+		m.log.Error("failed to send account exists email", l.Err(err), slog.String("func", f))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// send saves a new code and link token and emails them, the body gets the
+// code, the link and the ttl in this order
+func (m *Manager) send(ctx context.Context, email, subject, body string) error {
+	if m.mailer == nil {
+		return ErrNotConfigured
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	linkToken := base64.RawURLEncoding.EncodeToString(token)
+
+	if err := m.storage.SaveLoginCode(ctx, email, m.codeHash(email, code), linkHash(linkToken), m.ttl); err != nil {
+		m.log.Error("failed to save login code", l.Err(err))
+
+		return err
+	}
+
+	if err := m.mailer.Send(ctx, email, subject, fmt.Sprintf(body, code, m.link(linkToken), m.ttl)); err != nil {
+		m.log.Error("failed to send login code", l.Err(err))
+
+		return err
+	}
+
+	return nil
+}
+
+// Verify consumes the code sent to the email, a code is burnt after maxAttempts wrong guesses
+func (m *Manager) Verify(ctx context.Context, email, code string) error {
+	const f = "logincode.Verify"
+
+	if len(code) != codeDigits {
+		return fmt.Errorf("%s:%w", f, ErrInvalidCode)
+	}
+
+	ok, err := m.storage.UseLoginCode(ctx, email, m.codeHash(email, code), m.maxAttempts)
+	if err != nil {
+		if errors.Is(err, redis.ErrLoginCodeNotFound) {
+			return fmt.Errorf("%s:%w", f, ErrInvalidCode)
+		}
+
+		m.log.Error("failed to use login code", l.Err(err), slog.String("func", f))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if !ok {
+		return fmt.Errorf("%s:%w", f, ErrInvalidCode)
+	}
+
+	return nil
+}
+
+// VerifyLink consumes the magic link token and returns the email it was sent to
+func (m *Manager) VerifyLink(ctx context.Context, linkToken string) (string, error) {
+	const f = "logincode.VerifyLink"
+
+	email, err := m.storage.UseLoginLink(ctx, linkHash(linkToken))
+	if err != nil {
+		if errors.Is(err, redis.ErrLoginCodeNotFound) {
+			return "", fmt.Errorf("%s:%w", f, ErrInvalidCode)
+		}
+
+		m.log.Error("failed to use login link", l.Err(err), slog.String("func", f))
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return email, nil
+}
+
+// codeHash binds the code to the email it was sent to
+func (m *Manager) codeHash(email, code string) string {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte("login-code\x00" + email + "\x00" + code))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (m *Manager) link(linkToken string) string {
+	u, err := url.Parse(m.linkURL)
+	if err != nil {
+		return m.linkURL + "?token=" + linkToken
+	}
+
+	query := u.Query()
+	query.Set("token", linkToken)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// link tokens are random 32 bytes, a plain hash is enough for them
+func linkHash(linkToken string) string {
+	sum := sha256.Sum256([]byte(linkToken))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", codeDigits, n.Int64()), nil
+}
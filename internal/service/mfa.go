@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/service/mfa"
+	"github.com/kuromii5/miku-notes-auth/internal/service/tokens"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+// EnrollTOTP starts TOTP enrollment for the access token owner and returns
+// the secret with the otpauth URI to show as a QR code
+func (a *Auth) EnrollTOTP(ctx context.Context, accessToken string) (string, string, error) {
+	const f = "auth.EnrollTOTP"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("enrolling totp")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return "", "", fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	user, err := a.activeUser(ctx, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	secret, uri, err := a.mfa.Enroll(ctx, user.ID, user.Email)
+	if err != nil {
+		log.Warn("failed to enroll totp", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("totp enrollment started", slog.Int("user_id", int(userID)))
+
+	return secret, uri, nil
+}
+
+// ConfirmTOTP turns the second factor on once the app produced a valid code
+func (a *Auth) ConfirmTOTP(ctx context.Context, accessToken, code string) error {
+	const f = "auth.ConfirmTOTP"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("confirming totp")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.mfa.Confirm(ctx, userID, code); err != nil {
+		log.Warn("failed to confirm totp", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("totp enabled", slog.Int("user_id", int(userID)))
+
+	return nil
+}
+
+// VerifyMFA is the second login step: the challenge token from Login
+// and a TOTP code are exchanged for the login result
+func (a *Auth) VerifyMFA(ctx context.Context, challengeToken, code, fingerprint string) (models.LoginResult, error) {
+	const f = "auth.VerifyMFA"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("verifying second factor")
+
+	restricted, err := a.tokenManager.ValidateRestrictedToken(ctx, challengeToken, tokens.PurposeMFA)
+	if err != nil {
+		log.Warn("failed to validate challenge token", l.Err(err))
+
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, ErrInvalidRestrictedToken)
+	}
+	userID := restricted.UserID
+
+	client, err := a.client(ctx, restricted.ClientID, models.GrantPassword)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	user, err := a.activeUser(ctx, userID)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// codes are short, so guesses count towards the same lockout as passwords
+	retryAfter, err := a.limiter.Check(ctx, user.Email)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+	if retryAfter > 0 {
+		log.Warn("account is locked", slog.Duration("retry_after", retryAfter))
+
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, &LockedError{RetryAfter: retryAfter})
+	}
+
+	if err := a.mfa.Verify(ctx, userID, code); err != nil {
+		if errors.Is(err, mfa.ErrInvalidCode) {
+			log.Warn("invalid totp code", slog.Int("user_id", int(userID)))
+
+			return models.LoginResult{}, fmt.Errorf("%s:%w", f, a.failLogin(ctx, user.Email))
+		}
+
+		log.Error("failed to verify totp code", l.Err(err), slog.Int("user_id", int(userID)))
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.limiter.Reset(ctx, user.Email); err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	result, err := a.completeLogin(ctx, user, fingerprint, client, true)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("second factor verified", slog.Int("user_id", int(userID)))
+
+	return result, nil
+}
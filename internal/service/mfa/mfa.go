@@ -0,0 +1,210 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+	"github.com/kuromii5/miku-notes-auth/pkg/secretbox"
+	"github.com/kuromii5/miku-notes-auth/pkg/totp"
+)
+
+var (
+	ErrNotEnrolled      = errors.New("totp is not enrolled")
+	ErrAlreadyEnrolled  = errors.New("totp is already enrolled")
+	ErrInvalidCode      = errors.New("invalid totp code")
+	ErrEnrollmentClosed = errors.New("totp enrollment is not configured")
+)
+
+// Manager enrolls users into TOTP and checks their codes.
+// Secrets are stored encrypted, bound to the user id.
+type Manager struct {
+	log    *slog.Logger
+	issuer string
+	skew   int
+
+	// nil when no encryption key is configured: nobody can enroll
+	// and enrolled users can't pass the second step
+	box *secretbox.Box
+
+	storage Storage
+}
+
+//go:generate mockgen -source=mfa.go -destination=mock/mfa.go
+type Storage interface {
+	SaveTOTP(ctx context.Context, userID int32, encryptedSecret []byte) error
+	TOTP(ctx context.Context, userID int32) (models.TOTP, error)
+	ConfirmTOTP(ctx context.Context, userID int32) error
+	UseTOTPStep(ctx context.Context, userID int32, step int64) (bool, error)
+}
+
+func New(log *slog.Logger, issuer string, skew int, box *secretbox.Box, storage Storage) *Manager {
+	return &Manager{
+		log:     log,
+		issuer:  issuer,
+		skew:    skew,
+		box:     box,
+		storage: storage,
+	}
+}
+
+// Enroll creates a new secret and returns it with the otpauth URI for a QR code.
+// The enrollment works only after Confirm.
+func (m *Manager) Enroll(ctx context.Context, userID int32, account string) (string, string, error) {
+	const f = "mfa.Enroll"
+
+	log := m.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+
+	if m.box == nil {
+		return "", "", fmt.Errorf("%s:%w", f, ErrEnrollmentClosed)
+	}
+
+	enabled, err := m.Enabled(ctx, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+	if enabled {
+		return "", "", fmt.Errorf("%s:%w", f, ErrAlreadyEnrolled)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Error("failed to generate totp secret", l.Err(err))
+
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	sealed, err := m.box.Seal([]byte(secret), userAD(userID))
+	if err != nil {
+		log.Error("failed to encrypt totp secret", l.Err(err))
+
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := m.storage.SaveTOTP(ctx, userID, sealed); err != nil {
+		log.Error("failed to save totp secret", l.Err(err))
+
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return secret, totp.URI(m.issuer, account, secret), nil
+}
+
+// Confirm finishes the enrollment with the first code from the app
+func (m *Manager) Confirm(ctx context.Context, userID int32, code string) error {
+	const f = "mfa.Confirm"
+
+	enrollment, err := m.enrollment(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if enrollment.Confirmed {
+		return fmt.Errorf("%s:%w", f, ErrAlreadyEnrolled)
+	}
+
+	if err := m.check(ctx, enrollment, code); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := m.storage.ConfirmTOTP(ctx, userID); err != nil {
+		m.log.Error("failed to confirm totp", l.Err(err), slog.String("func", f))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// Enabled reports whether the user has a confirmed enrollment.
+// It doesn't need the encryption key, so a missing key can't turn the second factor off.
+func (m *Manager) Enabled(ctx context.Context, userID int32) (bool, error) {
+	const f = "mfa.Enabled"
+
+	enrollment, err := m.storage.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrTOTPNotFound) {
+			return false, nil
+		}
+
+		m.log.Error("failed to get totp", l.Err(err), slog.String("func", f))
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return enrollment.Confirmed, nil
+}
+
+// Verify checks a code of a confirmed enrollment, every code is accepted once
+func (m *Manager) Verify(ctx context.Context, userID int32, code string) error {
+	const f = "mfa.Verify"
+
+	enrollment, err := m.enrollment(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if !enrollment.Confirmed {
+		return fmt.Errorf("%s:%w", f, ErrNotEnrolled)
+	}
+
+	if err := m.check(ctx, enrollment, code); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+func (m *Manager) enrollment(ctx context.Context, userID int32) (models.TOTP, error) {
+	enrollment, err := m.storage.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrTOTPNotFound) {
+			return models.TOTP{}, ErrNotEnrolled
+		}
+
+		m.log.Error("failed to get totp", l.Err(err), slog.Int("user_id", int(userID)))
+		return models.TOTP{}, err
+	}
+
+	return enrollment, nil
+}
+
+func (m *Manager) check(ctx context.Context, enrollment models.TOTP, code string) error {
+	if m.box == nil {
+		return ErrEnrollmentClosed
+	}
+
+	secret, err := m.box.Open(enrollment.EncryptedSecret, userAD(enrollment.UserID))
+	if err != nil {
+		m.log.Error("failed to decrypt totp secret", l.Err(err), slog.Int("user_id", int(enrollment.UserID)))
+
+		return err
+	}
+
+	step, ok, err := totp.Validate(string(secret), code, time.Now(), m.skew)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCode
+	}
+
+	// a code seen by a shoulder surfer or a phishing proxy can't be replayed
+	fresh, err := m.storage.UseTOTPStep(ctx, enrollment.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidCode
+	}
+
+	return nil
+}
+
+// userAD binds the sealed secret to its row
+func userAD(userID int32) []byte {
+	return []byte(strconv.Itoa(int(userID)))
+}
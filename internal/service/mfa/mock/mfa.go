@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: mfa.go
+
+// Package mock_mfa is a generated GoMock package.
+package mock_mfa
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/kuromii5/miku-notes-auth/internal/models"
+)
+
+// MockStorage is a mock of Storage interface.
+type MockStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockStorageMockRecorder
+}
+
+// MockStorageMockRecorder is the mock recorder for MockStorage.
+type MockStorageMockRecorder struct {
+	mock *MockStorage
+}
+
+// NewMockStorage creates a new mock instance.
+func NewMockStorage(ctrl *gomock.Controller) *MockStorage {
+	mock := &MockStorage{ctrl: ctrl}
+	mock.recorder = &MockStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
+	return m.recorder
+}
+
+// ConfirmTOTP mocks base method.
+func (m *MockStorage) ConfirmTOTP(ctx context.Context, userID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTP", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmTOTP indicates an expected call of ConfirmTOTP.
+func (mr *MockStorageMockRecorder) ConfirmTOTP(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTP", reflect.TypeOf((*MockStorage)(nil).ConfirmTOTP), ctx, userID)
+}
+
+// SaveTOTP mocks base method.
+func (m *MockStorage) SaveTOTP(ctx context.Context, userID int32, encryptedSecret []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTOTP", ctx, userID, encryptedSecret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTOTP indicates an expected call of SaveTOTP.
+func (mr *MockStorageMockRecorder) SaveTOTP(ctx, userID, encryptedSecret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTOTP", reflect.TypeOf((*MockStorage)(nil).SaveTOTP), ctx, userID, encryptedSecret)
+}
+
+// TOTP mocks base method.
+func (m *MockStorage) TOTP(ctx context.Context, userID int32) (models.TOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TOTP", ctx, userID)
+	ret0, _ := ret[0].(models.TOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TOTP indicates an expected call of TOTP.
+func (mr *MockStorageMockRecorder) TOTP(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TOTP", reflect.TypeOf((*MockStorage)(nil).TOTP), ctx, userID)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockStorage) UseTOTPStep(ctx context.Context, userID int32, step int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", ctx, userID, step)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockStorageMockRecorder) UseTOTPStep(ctx, userID, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockStorage)(nil).UseTOTPStep), ctx, userID, step)
+}
@@ -0,0 +1,175 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: admin.go
+
+// Package mock_service is a generated GoMock package.
+package mock_service
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/kuromii5/miku-notes-auth/internal/models"
+)
+
+// MockUserManager is a mock of UserManager interface.
+type MockUserManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserManagerMockRecorder
+}
+
+// MockUserManagerMockRecorder is the mock recorder for MockUserManager.
+type MockUserManagerMockRecorder struct {
+	mock *MockUserManager
+}
+
+// NewMockUserManager creates a new mock instance.
+func NewMockUserManager(ctrl *gomock.Controller) *MockUserManager {
+	mock := &MockUserManager{ctrl: ctrl}
+	mock.recorder = &MockUserManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserManager) EXPECT() *MockUserManagerMockRecorder {
+	return m.recorder
+}
+
+// DeleteUser mocks base method.
+func (m *MockUserManager) DeleteUser(ctx context.Context, userID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserManagerMockRecorder) DeleteUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserManager)(nil).DeleteUser), ctx, userID)
+}
+
+// SearchUsers mocks base method.
+func (m *MockUserManager) SearchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", ctx, filter)
+	ret0, _ := ret[0].([]models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockUserManagerMockRecorder) SearchUsers(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockUserManager)(nil).SearchUsers), ctx, filter)
+}
+
+// SetMustChangePassword mocks base method.
+func (m *MockUserManager) SetMustChangePassword(ctx context.Context, userID int32, mustChange bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMustChangePassword", ctx, userID, mustChange)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMustChangePassword indicates an expected call of SetMustChangePassword.
+func (mr *MockUserManagerMockRecorder) SetMustChangePassword(ctx, userID, mustChange interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMustChangePassword", reflect.TypeOf((*MockUserManager)(nil).SetMustChangePassword), ctx, userID, mustChange)
+}
+
+// SetUserStatus mocks base method.
+func (m *MockUserManager) SetUserStatus(ctx context.Context, userID int32, status string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserStatus", ctx, userID, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserStatus indicates an expected call of SetUserStatus.
+func (mr *MockUserManagerMockRecorder) SetUserStatus(ctx, userID, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserStatus", reflect.TypeOf((*MockUserManager)(nil).SetUserStatus), ctx, userID, status)
+}
+
+// SuspendUser mocks base method.
+func (m *MockUserManager) SuspendUser(ctx context.Context, userID int32, reason string, until time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SuspendUser", ctx, userID, reason, until)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SuspendUser indicates an expected call of SuspendUser.
+func (mr *MockUserManagerMockRecorder) SuspendUser(ctx, userID, reason, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SuspendUser", reflect.TypeOf((*MockUserManager)(nil).SuspendUser), ctx, userID, reason, until)
+}
+
+// UserByID mocks base method.
+func (m *MockUserManager) UserByID(ctx context.Context, userID int32) (models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserByID", ctx, userID)
+	ret0, _ := ret[0].(models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserByID indicates an expected call of UserByID.
+func (mr *MockUserManagerMockRecorder) UserByID(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserByID", reflect.TypeOf((*MockUserManager)(nil).UserByID), ctx, userID)
+}
+
+// MockSessionManager is a mock of SessionManager interface.
+type MockSessionManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockSessionManagerMockRecorder
+}
+
+// MockSessionManagerMockRecorder is the mock recorder for MockSessionManager.
+type MockSessionManagerMockRecorder struct {
+	mock *MockSessionManager
+}
+
+// NewMockSessionManager creates a new mock instance.
+func NewMockSessionManager(ctrl *gomock.Controller) *MockSessionManager {
+	mock := &MockSessionManager{ctrl: ctrl}
+	mock.recorder = &MockSessionManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSessionManager) EXPECT() *MockSessionManagerMockRecorder {
+	return m.recorder
+}
+
+// DeleteAll mocks base method.
+func (m *MockSessionManager) DeleteAll(ctx context.Context, userID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAll", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAll indicates an expected call of DeleteAll.
+func (mr *MockSessionManagerMockRecorder) DeleteAll(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAll", reflect.TypeOf((*MockSessionManager)(nil).DeleteAll), ctx, userID)
+}
+
+// Sessions mocks base method.
+func (m *MockSessionManager) Sessions(ctx context.Context, userID int32) ([]models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sessions", ctx, userID)
+	ret0, _ := ret[0].([]models.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Sessions indicates an expected call of Sessions.
+func (mr *MockSessionManagerMockRecorder) Sessions(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sessions", reflect.TypeOf((*MockSessionManager)(nil).Sessions), ctx, userID)
+}
@@ -7,6 +7,7 @@ package mock_service
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/kuromii5/miku-notes-auth/internal/models"
@@ -36,18 +37,74 @@ func (m *MockUserSaver) EXPECT() *MockUserSaverMockRecorder {
 }
 
 // SaveUser mocks base method.
-func (m *MockUserSaver) SaveUser(ctx context.Context, email string, hash []byte) (int32, error) {
+func (m *MockUserSaver) SaveUser(ctx context.Context, email string, hash []byte, status string) (int32, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveUser", ctx, email, hash)
+	ret := m.ctrl.Call(m, "SaveUser", ctx, email, hash, status)
 	ret0, _ := ret[0].(int32)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SaveUser indicates an expected call of SaveUser.
-func (mr *MockUserSaverMockRecorder) SaveUser(ctx, email, hash interface{}) *gomock.Call {
+func (mr *MockUserSaverMockRecorder) SaveUser(ctx, email, hash, status interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUser", reflect.TypeOf((*MockUserSaver)(nil).SaveUser), ctx, email, hash)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUser", reflect.TypeOf((*MockUserSaver)(nil).SaveUser), ctx, email, hash, status)
+}
+
+// SetPhone mocks base method.
+func (m *MockUserSaver) SetPhone(ctx context.Context, userID int32, phone string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPhone", ctx, userID, phone)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPhone indicates an expected call of SetPhone.
+func (mr *MockUserSaverMockRecorder) SetPhone(ctx, userID, phone interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPhone", reflect.TypeOf((*MockUserSaver)(nil).SetPhone), ctx, userID, phone)
+}
+
+// SetUserStatus mocks base method.
+func (m *MockUserSaver) SetUserStatus(ctx context.Context, userID int32, status string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserStatus", ctx, userID, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserStatus indicates an expected call of SetUserStatus.
+func (mr *MockUserSaverMockRecorder) SetUserStatus(ctx, userID, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserStatus", reflect.TypeOf((*MockUserSaver)(nil).SetUserStatus), ctx, userID, status)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockUserSaver) UpdatePassword(ctx context.Context, userID int32, hash []byte, historySize int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, userID, hash, historySize)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockUserSaverMockRecorder) UpdatePassword(ctx, userID, hash, historySize interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockUserSaver)(nil).UpdatePassword), ctx, userID, hash, historySize)
+}
+
+// UpdatePasswordHash mocks base method.
+func (m *MockUserSaver) UpdatePasswordHash(ctx context.Context, userID int32, hash []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePasswordHash", ctx, userID, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePasswordHash indicates an expected call of UpdatePasswordHash.
+func (mr *MockUserSaverMockRecorder) UpdatePasswordHash(ctx, userID, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePasswordHash", reflect.TypeOf((*MockUserSaver)(nil).UpdatePasswordHash), ctx, userID, hash)
 }
 
 // MockUserProvider is a mock of UserProvider interface.
@@ -73,6 +130,21 @@ func (m *MockUserProvider) EXPECT() *MockUserProviderMockRecorder {
 	return m.recorder
 }
 
+// PasswordHistory mocks base method.
+func (m *MockUserProvider) PasswordHistory(ctx context.Context, userID int32, limit int) ([][]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PasswordHistory", ctx, userID, limit)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PasswordHistory indicates an expected call of PasswordHistory.
+func (mr *MockUserProviderMockRecorder) PasswordHistory(ctx, userID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PasswordHistory", reflect.TypeOf((*MockUserProvider)(nil).PasswordHistory), ctx, userID, limit)
+}
+
 // User mocks base method.
 func (m *MockUserProvider) User(ctx context.Context, email string) (models.User, error) {
 	m.ctrl.T.Helper()
@@ -87,3 +159,346 @@ func (mr *MockUserProviderMockRecorder) User(ctx, email interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "User", reflect.TypeOf((*MockUserProvider)(nil).User), ctx, email)
 }
+
+// UserByID mocks base method.
+func (m *MockUserProvider) UserByID(ctx context.Context, userID int32) (models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserByID", ctx, userID)
+	ret0, _ := ret[0].(models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserByID indicates an expected call of UserByID.
+func (mr *MockUserProviderMockRecorder) UserByID(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserByID", reflect.TypeOf((*MockUserProvider)(nil).UserByID), ctx, userID)
+}
+
+// MockRecoveryCodeStorage is a mock of RecoveryCodeStorage interface.
+type MockRecoveryCodeStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockRecoveryCodeStorageMockRecorder
+}
+
+// MockRecoveryCodeStorageMockRecorder is the mock recorder for MockRecoveryCodeStorage.
+type MockRecoveryCodeStorageMockRecorder struct {
+	mock *MockRecoveryCodeStorage
+}
+
+// NewMockRecoveryCodeStorage creates a new mock instance.
+func NewMockRecoveryCodeStorage(ctrl *gomock.Controller) *MockRecoveryCodeStorage {
+	mock := &MockRecoveryCodeStorage{ctrl: ctrl}
+	mock.recorder = &MockRecoveryCodeStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRecoveryCodeStorage) EXPECT() *MockRecoveryCodeStorageMockRecorder {
+	return m.recorder
+}
+
+// RecoveryCodes mocks base method.
+func (m *MockRecoveryCodeStorage) RecoveryCodes(ctx context.Context, userID int32) ([]models.RecoveryCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecoveryCodes", ctx, userID)
+	ret0, _ := ret[0].([]models.RecoveryCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecoveryCodes indicates an expected call of RecoveryCodes.
+func (mr *MockRecoveryCodeStorageMockRecorder) RecoveryCodes(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecoveryCodes", reflect.TypeOf((*MockRecoveryCodeStorage)(nil).RecoveryCodes), ctx, userID)
+}
+
+// ReplaceRecoveryCodes mocks base method.
+func (m *MockRecoveryCodeStorage) ReplaceRecoveryCodes(ctx context.Context, userID int32, hashes [][]byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceRecoveryCodes", ctx, userID, hashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceRecoveryCodes indicates an expected call of ReplaceRecoveryCodes.
+func (mr *MockRecoveryCodeStorageMockRecorder) ReplaceRecoveryCodes(ctx, userID, hashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceRecoveryCodes", reflect.TypeOf((*MockRecoveryCodeStorage)(nil).ReplaceRecoveryCodes), ctx, userID, hashes)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockRecoveryCodeStorage) UseRecoveryCode(ctx context.Context, codeID int32) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, codeID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockRecoveryCodeStorageMockRecorder) UseRecoveryCode(ctx, codeID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockRecoveryCodeStorage)(nil).UseRecoveryCode), ctx, codeID)
+}
+
+// MockDeviceStorage is a mock of DeviceStorage interface.
+type MockDeviceStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeviceStorageMockRecorder
+}
+
+// MockDeviceStorageMockRecorder is the mock recorder for MockDeviceStorage.
+type MockDeviceStorageMockRecorder struct {
+	mock *MockDeviceStorage
+}
+
+// NewMockDeviceStorage creates a new mock instance.
+func NewMockDeviceStorage(ctrl *gomock.Controller) *MockDeviceStorage {
+	mock := &MockDeviceStorage{ctrl: ctrl}
+	mock.recorder = &MockDeviceStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeviceStorage) EXPECT() *MockDeviceStorageMockRecorder {
+	return m.recorder
+}
+
+// RevokeTrustedDevice mocks base method.
+func (m *MockDeviceStorage) RevokeTrustedDevice(ctx context.Context, userID, deviceID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeTrustedDevice", ctx, userID, deviceID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeTrustedDevice indicates an expected call of RevokeTrustedDevice.
+func (mr *MockDeviceStorageMockRecorder) RevokeTrustedDevice(ctx, userID, deviceID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeTrustedDevice", reflect.TypeOf((*MockDeviceStorage)(nil).RevokeTrustedDevice), ctx, userID, deviceID)
+}
+
+// TouchTrustedDevice mocks base method.
+func (m *MockDeviceStorage) TouchTrustedDevice(ctx context.Context, userID int32, fingerprintHash []byte) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchTrustedDevice", ctx, userID, fingerprintHash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TouchTrustedDevice indicates an expected call of TouchTrustedDevice.
+func (mr *MockDeviceStorageMockRecorder) TouchTrustedDevice(ctx, userID, fingerprintHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchTrustedDevice", reflect.TypeOf((*MockDeviceStorage)(nil).TouchTrustedDevice), ctx, userID, fingerprintHash)
+}
+
+// TrustDevice mocks base method.
+func (m *MockDeviceStorage) TrustDevice(ctx context.Context, userID int32, fingerprintHash []byte, name string, until time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrustDevice", ctx, userID, fingerprintHash, name, until)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TrustDevice indicates an expected call of TrustDevice.
+func (mr *MockDeviceStorageMockRecorder) TrustDevice(ctx, userID, fingerprintHash, name, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrustDevice", reflect.TypeOf((*MockDeviceStorage)(nil).TrustDevice), ctx, userID, fingerprintHash, name, until)
+}
+
+// TrustedDevices mocks base method.
+func (m *MockDeviceStorage) TrustedDevices(ctx context.Context, userID int32) ([]models.TrustedDevice, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrustedDevices", ctx, userID)
+	ret0, _ := ret[0].([]models.TrustedDevice)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TrustedDevices indicates an expected call of TrustedDevices.
+func (mr *MockDeviceStorageMockRecorder) TrustedDevices(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrustedDevices", reflect.TypeOf((*MockDeviceStorage)(nil).TrustedDevices), ctx, userID)
+}
+
+// MockIdentityStorage is a mock of IdentityStorage interface.
+type MockIdentityStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdentityStorageMockRecorder
+}
+
+// MockIdentityStorageMockRecorder is the mock recorder for MockIdentityStorage.
+type MockIdentityStorageMockRecorder struct {
+	mock *MockIdentityStorage
+}
+
+// NewMockIdentityStorage creates a new mock instance.
+func NewMockIdentityStorage(ctrl *gomock.Controller) *MockIdentityStorage {
+	mock := &MockIdentityStorage{ctrl: ctrl}
+	mock.recorder = &MockIdentityStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdentityStorage) EXPECT() *MockIdentityStorageMockRecorder {
+	return m.recorder
+}
+
+// IdentityUser mocks base method.
+func (m *MockIdentityStorage) IdentityUser(ctx context.Context, provider, subject string) (int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IdentityUser", ctx, provider, subject)
+	ret0, _ := ret[0].(int32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IdentityUser indicates an expected call of IdentityUser.
+func (mr *MockIdentityStorageMockRecorder) IdentityUser(ctx, provider, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IdentityUser", reflect.TypeOf((*MockIdentityStorage)(nil).IdentityUser), ctx, provider, subject)
+}
+
+// SaveIdentity mocks base method.
+func (m *MockIdentityStorage) SaveIdentity(ctx context.Context, identity models.Identity) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIdentity", ctx, identity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIdentity indicates an expected call of SaveIdentity.
+func (mr *MockIdentityStorageMockRecorder) SaveIdentity(ctx, identity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIdentity", reflect.TypeOf((*MockIdentityStorage)(nil).SaveIdentity), ctx, identity)
+}
+
+// SaveUserWithIdentity mocks base method.
+func (m *MockIdentityStorage) SaveUserWithIdentity(ctx context.Context, email string, hash []byte, identity models.Identity) (int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveUserWithIdentity", ctx, email, hash, identity)
+	ret0, _ := ret[0].(int32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveUserWithIdentity indicates an expected call of SaveUserWithIdentity.
+func (mr *MockIdentityStorageMockRecorder) SaveUserWithIdentity(ctx, email, hash, identity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUserWithIdentity", reflect.TypeOf((*MockIdentityStorage)(nil).SaveUserWithIdentity), ctx, email, hash, identity)
+}
+
+// MockClientProvider is a mock of ClientProvider interface.
+type MockClientProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockClientProviderMockRecorder
+}
+
+// MockClientProviderMockRecorder is the mock recorder for MockClientProvider.
+type MockClientProviderMockRecorder struct {
+	mock *MockClientProvider
+}
+
+// NewMockClientProvider creates a new mock instance.
+func NewMockClientProvider(ctrl *gomock.Controller) *MockClientProvider {
+	mock := &MockClientProvider{ctrl: ctrl}
+	mock.recorder = &MockClientProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClientProvider) EXPECT() *MockClientProviderMockRecorder {
+	return m.recorder
+}
+
+// Client mocks base method.
+func (m *MockClientProvider) Client(ctx context.Context, clientID string) (models.Client, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Client", ctx, clientID)
+	ret0, _ := ret[0].(models.Client)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Client indicates an expected call of Client.
+func (mr *MockClientProviderMockRecorder) Client(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Client", reflect.TypeOf((*MockClientProvider)(nil).Client), ctx, clientID)
+}
+
+// MockBreachChecker is a mock of BreachChecker interface.
+type MockBreachChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockBreachCheckerMockRecorder
+}
+
+// MockBreachCheckerMockRecorder is the mock recorder for MockBreachChecker.
+type MockBreachCheckerMockRecorder struct {
+	mock *MockBreachChecker
+}
+
+// NewMockBreachChecker creates a new mock instance.
+func NewMockBreachChecker(ctrl *gomock.Controller) *MockBreachChecker {
+	mock := &MockBreachChecker{ctrl: ctrl}
+	mock.recorder = &MockBreachCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBreachChecker) EXPECT() *MockBreachCheckerMockRecorder {
+	return m.recorder
+}
+
+// Breached mocks base method.
+func (m *MockBreachChecker) Breached(password string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Breached", password)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Breached indicates an expected call of Breached.
+func (mr *MockBreachCheckerMockRecorder) Breached(password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Breached", reflect.TypeOf((*MockBreachChecker)(nil).Breached), password)
+}
+
+// MockPasswordPolicy is a mock of PasswordPolicy interface.
+type MockPasswordPolicy struct {
+	ctrl     *gomock.Controller
+	recorder *MockPasswordPolicyMockRecorder
+}
+
+// MockPasswordPolicyMockRecorder is the mock recorder for MockPasswordPolicy.
+type MockPasswordPolicyMockRecorder struct {
+	mock *MockPasswordPolicy
+}
+
+// NewMockPasswordPolicy creates a new mock instance.
+func NewMockPasswordPolicy(ctrl *gomock.Controller) *MockPasswordPolicy {
+	mock := &MockPasswordPolicy{ctrl: ctrl}
+	mock.recorder = &MockPasswordPolicyMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPasswordPolicy) EXPECT() *MockPasswordPolicyMockRecorder {
+	return m.recorder
+}
+
+// Check mocks base method.
+func (m *MockPasswordPolicy) Check(password, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Check", password, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Check indicates an expected call of Check.
+func (mr *MockPasswordPolicyMockRecorder) Check(password, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockPasswordPolicy)(nil).Check), password, email)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/service/tokens"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+// BeginPasskeyRegistration returns the session id and the JSON options
+// for navigator.credentials.create
+func (a *Auth) BeginPasskeyRegistration(ctx context.Context, accessToken string) (string, string, error) {
+	const f = "auth.BeginPasskeyRegistration"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("starting passkey registration")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return "", "", fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	user, err := a.activeUser(ctx, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	sessionID, options, err := a.passkeys.BeginRegistration(ctx, user.ID, user.Email)
+	if err != nil {
+		log.Warn("failed to start passkey registration", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return sessionID, string(options), nil
+}
+
+// FinishPasskeyRegistration saves the passkey created by the authenticator
+func (a *Auth) FinishPasskeyRegistration(
+	ctx context.Context,
+	accessToken, sessionID string,
+	clientDataJSON, attestationObject []byte,
+) error {
+	const f = "auth.FinishPasskeyRegistration"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("finishing passkey registration")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.passkeys.FinishRegistration(ctx, userID, sessionID, clientDataJSON, attestationObject); err != nil {
+		log.Warn("failed to register passkey", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("passkey registered", slog.Int("user_id", int(userID)))
+
+	return nil
+}
+
+// BeginPasskeyLogin starts a passwordless login, or the second login step
+// when the challenge token from Login is given
+func (a *Auth) BeginPasskeyLogin(ctx context.Context, challengeToken string) (string, string, error) {
+	const f = "auth.BeginPasskeyLogin"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("starting passkey login")
+
+	if challengeToken == "" {
+		sessionID, options, err := a.passkeys.BeginLogin(ctx)
+		if err != nil {
+			return "", "", fmt.Errorf("%s:%w", f, err)
+		}
+
+		return sessionID, string(options), nil
+	}
+
+	restricted, err := a.tokenManager.ValidateRestrictedToken(ctx, challengeToken, tokens.PurposeMFA)
+	if err != nil {
+		log.Warn("failed to validate challenge token", l.Err(err))
+
+		return "", "", fmt.Errorf("%s:%w", f, ErrInvalidRestrictedToken)
+	}
+	userID := restricted.UserID
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	sessionID, options, err := a.passkeys.BeginSecondFactor(ctx, userID, restricted.ClientID)
+	if err != nil {
+		log.Warn("failed to start passkey second factor", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return sessionID, string(options), nil
+}
+
+// FinishPasskeyLogin checks the assertion and logs the passkey owner in.
+// A passkey is a factor on its own, so no other second factor is asked for.
+func (a *Auth) FinishPasskeyLogin(
+	ctx context.Context,
+	sessionID string,
+	credentialID, clientDataJSON, authenticatorData, signature []byte,
+	fingerprint string,
+) (models.LoginResult, error) {
+	const f = "auth.FinishPasskeyLogin"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("finishing passkey login")
+
+	userID, clientID, err := a.passkeys.FinishLogin(ctx, sessionID, credentialID, clientDataJSON, authenticatorData, signature)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// a second factor session keeps the client of the challenge token
+	client, err := a.client(ctx, clientID, models.GrantPassword)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	user, err := a.activeUser(ctx, userID)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	result, err := a.completeLogin(ctx, user, fingerprint, client, true)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("logged in with passkey", slog.Int("user_id", int(userID)))
+
+	return result, nil
+}
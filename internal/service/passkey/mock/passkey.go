@@ -0,0 +1,148 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: passkey.go
+
+// Package mock_passkey is a generated GoMock package.
+package mock_passkey
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/kuromii5/miku-notes-auth/internal/models"
+)
+
+// MockStorage is a mock of Storage interface.
+type MockStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockStorageMockRecorder
+}
+
+// MockStorageMockRecorder is the mock recorder for MockStorage.
+type MockStorageMockRecorder struct {
+	mock *MockStorage
+}
+
+// NewMockStorage creates a new mock instance.
+func NewMockStorage(ctrl *gomock.Controller) *MockStorage {
+	mock := &MockStorage{ctrl: ctrl}
+	mock.recorder = &MockStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
+	return m.recorder
+}
+
+// SaveWebAuthnCredential mocks base method.
+func (m *MockStorage) SaveWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveWebAuthnCredential", ctx, credential)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveWebAuthnCredential indicates an expected call of SaveWebAuthnCredential.
+func (mr *MockStorageMockRecorder) SaveWebAuthnCredential(ctx, credential interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveWebAuthnCredential", reflect.TypeOf((*MockStorage)(nil).SaveWebAuthnCredential), ctx, credential)
+}
+
+// UseWebAuthnCredential mocks base method.
+func (m *MockStorage) UseWebAuthnCredential(ctx context.Context, id int32, signCount uint32) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseWebAuthnCredential", ctx, id, signCount)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseWebAuthnCredential indicates an expected call of UseWebAuthnCredential.
+func (mr *MockStorageMockRecorder) UseWebAuthnCredential(ctx, id, signCount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseWebAuthnCredential", reflect.TypeOf((*MockStorage)(nil).UseWebAuthnCredential), ctx, id, signCount)
+}
+
+// WebAuthnCredential mocks base method.
+func (m *MockStorage) WebAuthnCredential(ctx context.Context, credentialID []byte) (models.WebAuthnCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WebAuthnCredential", ctx, credentialID)
+	ret0, _ := ret[0].(models.WebAuthnCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WebAuthnCredential indicates an expected call of WebAuthnCredential.
+func (mr *MockStorageMockRecorder) WebAuthnCredential(ctx, credentialID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WebAuthnCredential", reflect.TypeOf((*MockStorage)(nil).WebAuthnCredential), ctx, credentialID)
+}
+
+// WebAuthnCredentials mocks base method.
+func (m *MockStorage) WebAuthnCredentials(ctx context.Context, userID int32) ([]models.WebAuthnCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WebAuthnCredentials", ctx, userID)
+	ret0, _ := ret[0].([]models.WebAuthnCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WebAuthnCredentials indicates an expected call of WebAuthnCredentials.
+func (mr *MockStorageMockRecorder) WebAuthnCredentials(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WebAuthnCredentials", reflect.TypeOf((*MockStorage)(nil).WebAuthnCredentials), ctx, userID)
+}
+
+// MockSessionStorage is a mock of SessionStorage interface.
+type MockSessionStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockSessionStorageMockRecorder
+}
+
+// MockSessionStorageMockRecorder is the mock recorder for MockSessionStorage.
+type MockSessionStorageMockRecorder struct {
+	mock *MockSessionStorage
+}
+
+// NewMockSessionStorage creates a new mock instance.
+func NewMockSessionStorage(ctrl *gomock.Controller) *MockSessionStorage {
+	mock := &MockSessionStorage{ctrl: ctrl}
+	mock.recorder = &MockSessionStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSessionStorage) EXPECT() *MockSessionStorageMockRecorder {
+	return m.recorder
+}
+
+// SaveWebAuthnSession mocks base method.
+func (m *MockSessionStorage) SaveWebAuthnSession(ctx context.Context, sessionID string, session []byte, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveWebAuthnSession", ctx, sessionID, session, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveWebAuthnSession indicates an expected call of SaveWebAuthnSession.
+func (mr *MockSessionStorageMockRecorder) SaveWebAuthnSession(ctx, sessionID, session, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveWebAuthnSession", reflect.TypeOf((*MockSessionStorage)(nil).SaveWebAuthnSession), ctx, sessionID, session, ttl)
+}
+
+// TakeWebAuthnSession mocks base method.
+func (m *MockSessionStorage) TakeWebAuthnSession(ctx context.Context, sessionID string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakeWebAuthnSession", ctx, sessionID)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TakeWebAuthnSession indicates an expected call of TakeWebAuthnSession.
+func (mr *MockSessionStorageMockRecorder) TakeWebAuthnSession(ctx, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakeWebAuthnSession", reflect.TypeOf((*MockSessionStorage)(nil).TakeWebAuthnSession), ctx, sessionID)
+}
@@ -0,0 +1,357 @@
+package passkey
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/redis"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+	"github.com/kuromii5/miku-notes-auth/pkg/webauthn"
+)
+
+var (
+	ErrNotConfigured     = errors.New("passkeys are not configured")
+	ErrSessionNotFound   = errors.New("passkey session is expired or unknown")
+	ErrInvalidCredential = errors.New("invalid passkey")
+	ErrAlreadyRegistered = errors.New("passkey is already registered")
+)
+
+// ceremonies a session can be started for
+const (
+	sessionRegistration = "registration"
+	// the passkey replaces the password, so the user has to be verified by the authenticator
+	sessionLogin = "login"
+	// the password was already checked, presence is enough
+	sessionSecondFactor = "second_factor"
+)
+
+// session is kept in redis between the begin and finish calls
+type session struct {
+	Kind      string `json:"kind"`
+	Challenge []byte `json:"challenge"`
+	// zero for first factor logins, where any user's passkey may answer
+	UserID int32 `json:"user_id"`
+	// the client of the login a second factor session continues
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// Manager registers passkeys and checks logins made with them
+type Manager struct {
+	log *slog.Logger
+
+	// nil when no relying party is configured: nobody can register or log in
+	// with a passkey, but users who have one still need a second factor
+	rp *webauthn.RelyingParty
+
+	storage  Storage
+	sessions SessionStorage
+}
+
+//go:generate mockgen -source=passkey.go -destination=mock/passkey.go
+type Storage interface {
+	SaveWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error
+	WebAuthnCredentials(ctx context.Context, userID int32) ([]models.WebAuthnCredential, error)
+	WebAuthnCredential(ctx context.Context, credentialID []byte) (models.WebAuthnCredential, error)
+	UseWebAuthnCredential(ctx context.Context, id int32, signCount uint32) (bool, error)
+}
+type SessionStorage interface {
+	SaveWebAuthnSession(ctx context.Context, sessionID string, session []byte, ttl time.Duration) error
+	TakeWebAuthnSession(ctx context.Context, sessionID string) ([]byte, error)
+}
+
+func New(log *slog.Logger, rp *webauthn.RelyingParty, storage Storage, sessions SessionStorage) *Manager {
+	return &Manager{
+		log:      log,
+		rp:       rp,
+		storage:  storage,
+		sessions: sessions,
+	}
+}
+
+// BeginRegistration returns the session id and the options for navigator.credentials.create
+func (m *Manager) BeginRegistration(ctx context.Context, userID int32, account string) (string, []byte, error) {
+	const f = "passkey.BeginRegistration"
+
+	if m.rp == nil {
+		return "", nil, fmt.Errorf("%s:%w", f, ErrNotConfigured)
+	}
+
+	credentials, err := m.storage.WebAuthnCredentials(ctx, userID)
+	if err != nil {
+		m.log.Error("failed to get passkeys", l.Err(err), slog.String("func", f))
+
+		return "", nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	exclude := make([][]byte, 0, len(credentials))
+	for _, c := range credentials {
+		exclude = append(exclude, c.CredentialID)
+	}
+
+	sessionID, challenge, err := m.begin(ctx, sessionRegistration, userID, "")
+	if err != nil {
+		return "", nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	user := webauthn.User{Handle: userHandle(userID), Name: account}
+	options, err := m.rp.CreationOptions(challenge, user, exclude)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return sessionID, options, nil
+}
+
+// FinishRegistration checks the authenticator response and saves the new passkey
+func (m *Manager) FinishRegistration(ctx context.Context, userID int32, sessionID string, clientDataJSON, attestationObject []byte) error {
+	const f = "passkey.FinishRegistration"
+
+	log := m.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+
+	s, err := m.take(ctx, sessionID, sessionRegistration)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if s.UserID != userID {
+		log.Warn("registration session belongs to another user")
+
+		return fmt.Errorf("%s:%w", f, ErrSessionNotFound)
+	}
+
+	credential, err := m.rp.VerifyRegistration(s.Challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		log.Warn("passkey registration rejected", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidCredential)
+	}
+
+	err = m.storage.SaveWebAuthnCredential(ctx, models.WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+	})
+	if err != nil {
+		if errors.Is(err, postgres.ErrCredentialExists) {
+			return fmt.Errorf("%s:%w", f, ErrAlreadyRegistered)
+		}
+
+		log.Error("failed to save passkey", l.Err(err))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// BeginLogin starts a passwordless login with any discoverable passkey.
+// No email is asked for, so the options can't tell whether an account exists.
+func (m *Manager) BeginLogin(ctx context.Context) (string, []byte, error) {
+	const f = "passkey.BeginLogin"
+
+	if m.rp == nil {
+		return "", nil, fmt.Errorf("%s:%w", f, ErrNotConfigured)
+	}
+
+	sessionID, challenge, err := m.begin(ctx, sessionLogin, 0, "")
+	if err != nil {
+		return "", nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	options, err := m.rp.RequestOptions(challenge, nil, true)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return sessionID, options, nil
+}
+
+// BeginSecondFactor starts a login step that accepts only the user's own passkeys,
+// the client of the login is returned again when the step is finished
+func (m *Manager) BeginSecondFactor(ctx context.Context, userID int32, clientID string) (string, []byte, error) {
+	const f = "passkey.BeginSecondFactor"
+
+	if m.rp == nil {
+		return "", nil, fmt.Errorf("%s:%w", f, ErrNotConfigured)
+	}
+
+	credentials, err := m.storage.WebAuthnCredentials(ctx, userID)
+	if err != nil {
+		m.log.Error("failed to get passkeys", l.Err(err), slog.String("func", f))
+
+		return "", nil, fmt.Errorf("%s:%w", f, err)
+	}
+	if len(credentials) == 0 {
+		return "", nil, fmt.Errorf("%s:%w", f, ErrInvalidCredential)
+	}
+
+	allow := make([][]byte, 0, len(credentials))
+	for _, c := range credentials {
+		allow = append(allow, c.CredentialID)
+	}
+
+	sessionID, challenge, err := m.begin(ctx, sessionSecondFactor, userID, clientID)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	options, err := m.rp.RequestOptions(challenge, allow, false)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return sessionID, options, nil
+}
+
+// FinishLogin checks the assertion of a login or second factor session
+// and returns the id of the passkey owner and the client the session was started for
+func (m *Manager) FinishLogin(
+	ctx context.Context,
+	sessionID string,
+	credentialID, clientDataJSON, authenticatorData, signature []byte,
+) (int32, string, error) {
+	const f = "passkey.FinishLogin"
+
+	log := m.log.With(slog.String("func", f))
+
+	s, err := m.take(ctx, sessionID, sessionLogin, sessionSecondFactor)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	credential, err := m.storage.WebAuthnCredential(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrCredentialNotFound) {
+			log.Warn("unknown passkey")
+
+			return 0, "", fmt.Errorf("%s:%w", f, ErrInvalidCredential)
+		}
+
+		log.Error("failed to get passkey", l.Err(err))
+		return 0, "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	log = log.With(slog.Int("user_id", int(credential.UserID)))
+
+	if s.UserID != 0 && s.UserID != credential.UserID {
+		log.Warn("passkey of another user used as second factor")
+
+		return 0, "", fmt.Errorf("%s:%w", f, ErrInvalidCredential)
+	}
+
+	assertion, err := m.rp.VerifyAssertion(
+		s.Challenge,
+		credential.PublicKey,
+		clientDataJSON,
+		authenticatorData,
+		signature,
+		s.Kind == sessionLogin,
+	)
+	if err != nil {
+		log.Warn("passkey assertion rejected", l.Err(err))
+
+		return 0, "", fmt.Errorf("%s:%w", f, ErrInvalidCredential)
+	}
+
+	fresh, err := m.storage.UseWebAuthnCredential(ctx, credential.ID, assertion.SignCount)
+	if err != nil {
+		log.Error("failed to update passkey", l.Err(err))
+
+		return 0, "", fmt.Errorf("%s:%w", f, err)
+	}
+	if !fresh {
+		log.Warn("passkey signature counter went back, it may be cloned",
+			slog.Int("credential", int(credential.ID)),
+			slog.Int64("stored_count", int64(credential.SignCount)),
+			slog.Int64("sign_count", int64(assertion.SignCount)),
+		)
+
+		return 0, "", fmt.Errorf("%s:%w", f, ErrInvalidCredential)
+	}
+
+	return credential.UserID, s.ClientID, nil
+}
+
+// Enabled reports whether the user has any passkey.
+// It works without the relying party, so removing the config can't turn the second factor off.
+func (m *Manager) Enabled(ctx context.Context, userID int32) (bool, error) {
+	const f = "passkey.Enabled"
+
+	credentials, err := m.storage.WebAuthnCredentials(ctx, userID)
+	if err != nil {
+		m.log.Error("failed to get passkeys", l.Err(err), slog.String("func", f))
+
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return len(credentials) > 0, nil
+}
+
+func (m *Manager) begin(ctx context.Context, kind string, userID int32, clientID string) (string, []byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", nil, err
+	}
+
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	sessionID := base64.RawURLEncoding.EncodeToString(id)
+
+	data, err := json.Marshal(session{Kind: kind, Challenge: challenge, UserID: userID, ClientID: clientID})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := m.sessions.SaveWebAuthnSession(ctx, sessionID, data, webauthn.Timeout); err != nil {
+		m.log.Error("failed to save passkey session", l.Err(err))
+
+		return "", nil, err
+	}
+
+	return sessionID, challenge, nil
+}
+
+// take returns the session once, a second finish call with it fails
+func (m *Manager) take(ctx context.Context, sessionID string, kinds ...string) (session, error) {
+	if m.rp == nil {
+		return session{}, ErrNotConfigured
+	}
+
+	data, err := m.sessions.TakeWebAuthnSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, redis.ErrSessionNotFound) {
+			return session{}, ErrSessionNotFound
+		}
+
+		m.log.Error("failed to get passkey session", l.Err(err))
+		return session{}, err
+	}
+
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return session{}, err
+	}
+
+	for _, kind := range kinds {
+		if s.Kind == kind {
+			return s, nil
+		}
+	}
+
+	return session{}, ErrSessionNotFound
+}
+
+// userHandle identifies the account to the authenticator without any personal data
+func userHandle(userID int32) []byte {
+	return []byte(strconv.Itoa(int(userID)))
+}
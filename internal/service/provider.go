@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/service/issuer"
+	"github.com/kuromii5/miku-notes-auth/internal/service/mfa"
+	"github.com/kuromii5/miku-notes-auth/internal/service/smscode"
+	"github.com/kuromii5/miku-notes-auth/internal/service/tokens"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+var (
+	ErrSecondFactorUnavailable = errors.New("second factor of the account can't be used on this page")
+	ErrPasswordChangeRequired  = errors.New("password has to be changed in the app first")
+)
+
+// steps of the login pages, each one is a page the user fills in
+const (
+	StepMFA     = "mfa"
+	StepConsent = "consent"
+)
+
+// Provider signs users in to third-party apps with OpenID Connect.
+// Users log in like they do with Auth, sessions are made by the TokenManager.
+type Provider struct {
+	log          *slog.Logger
+	auth         *Auth
+	tokenManager *tokens.TokenManager
+	issuer       *issuer.Manager
+}
+
+func NewProvider(log *slog.Logger, auth *Auth, tokenManager *tokens.TokenManager, issuer *issuer.Manager) *Provider {
+	return &Provider{
+		log:          log,
+		auth:         auth,
+		tokenManager: tokenManager,
+		issuer:       issuer,
+	}
+}
+
+func (p *Provider) Discovery() map[string]any { return p.issuer.Discovery() }
+
+func (p *Provider) JWKS() map[string]any { return p.issuer.JWKS() }
+
+// Authorize starts the login pages for the request of a client
+func (p *Provider) Authorize(ctx context.Context, responseType, codeChallengeMethod string, auth issuer.Authorization) (string, error) {
+	const f = "provider.Authorize"
+
+	log := p.log.With(slog.String("func", f), slog.String("client_id", auth.ClientID))
+	log.Info("authorization requested")
+
+	id, err := p.issuer.Start(ctx, responseType, codeChallengeMethod, auth)
+	if err != nil {
+		log.Warn("invalid authorization request", l.Err(err))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return id, nil
+}
+
+// Authorization returns the request with its client for the login pages
+func (p *Provider) Authorization(ctx context.Context, id string) (issuer.Authorization, models.Client, error) {
+	const f = "provider.Authorization"
+
+	auth, err := p.issuer.Authorization(ctx, id)
+	if err != nil {
+		return issuer.Authorization{}, models.Client{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// the client may have been removed in the meantime
+	client, err := p.issuer.Client(ctx, auth.ClientID)
+	if err != nil {
+		return issuer.Authorization{}, models.Client{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return auth, client, nil
+}
+
+// LoginPassword checks the password on the login page and returns the next step.
+// No session is made here, the client gets one for the authorization code.
+func (p *Provider) LoginPassword(ctx context.Context, id, emailAddr, password, ip string) (string, error) {
+	const f = "provider.LoginPassword"
+
+	log := p.log.With(slog.String("func", f))
+	log.Info("logging in on the authorization page")
+
+	auth, err := p.issuer.Authorization(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	user, err := p.auth.checkPassword(ctx, emailAddr, password)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	auth.UserID = user.ID
+	step := StepConsent
+
+	enabled, err := p.auth.secondFactorEnabled(ctx, user)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if enabled {
+		auth.MFAMethod, err = p.startSecondFactor(ctx, user, ip)
+		if err != nil {
+			return "", fmt.Errorf("%s:%w", f, err)
+		}
+
+		step = StepMFA
+	} else if err := p.authenticate(user, &auth); err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := p.issuer.Update(ctx, id, auth); err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("password checked", slog.Int("user_id", int(user.ID)), slog.String("next", step))
+
+	return step, nil
+}
+
+// LoginMFA checks the code of the second factor the login page asked for
+func (p *Provider) LoginMFA(ctx context.Context, id, code string) error {
+	const f = "provider.LoginMFA"
+
+	log := p.log.With(slog.String("func", f))
+	log.Info("verifying second factor on the authorization page")
+
+	auth, err := p.issuer.Authorization(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if auth.UserID == 0 || auth.MFAMethod == "" || auth.Authenticated {
+		return fmt.Errorf("%s:%w", f, issuer.ErrAuthorizationNotFound)
+	}
+
+	user, err := p.auth.activeUser(ctx, auth.UserID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	// guesses count towards the same lockout as the app logins
+	retryAfter, err := p.auth.limiter.Check(ctx, user.Email)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if retryAfter > 0 {
+		log.Warn("account is locked", slog.Duration("retry_after", retryAfter))
+
+		return fmt.Errorf("%s:%w", f, &LockedError{RetryAfter: retryAfter})
+	}
+
+	switch auth.MFAMethod {
+	case issuer.MFAMethodTOTP:
+		err = p.auth.mfa.Verify(ctx, user.ID, code)
+	case issuer.MFAMethodSMS:
+		err = p.auth.checkSMSCode(ctx, smscode.PurposeLogin, user, code)
+	}
+	if err != nil {
+		if errors.Is(err, mfa.ErrInvalidCode) || errors.Is(err, smscode.ErrInvalidCode) {
+			log.Warn("invalid second factor code", slog.Int("user_id", int(user.ID)))
+
+			return fmt.Errorf("%s:%w", f, p.auth.failLogin(ctx, user.Email))
+		}
+
+		log.Error("failed to verify second factor", l.Err(err), slog.Int("user_id", int(user.ID)))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := p.auth.limiter.Reset(ctx, user.Email); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := p.authenticate(user, &auth); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := p.issuer.Update(ctx, id, auth); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("second factor verified", slog.Int("user_id", int(user.ID)))
+
+	return nil
+}
+
+// Consent ends the login pages and returns where the user is sent back to the client
+func (p *Provider) Consent(ctx context.Context, id string, approved bool) (string, error) {
+	const f = "provider.Consent"
+
+	log := p.log.With(slog.String("func", f))
+
+	redirect, err := p.issuer.Finish(ctx, id, approved)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("authorization finished", slog.Bool("approved", approved))
+
+	return redirect, nil
+}
+
+// Exchange is the authorization code grant of the token endpoint
+func (p *Provider) Exchange(ctx context.Context, clientID, clientSecret, code, redirectURI, codeVerifier string) (issuer.Tokens, error) {
+	const f = "provider.Exchange"
+
+	log := p.log.With(slog.String("func", f), slog.String("client_id", clientID))
+	log.Info("exchanging authorization code")
+
+	client, err := p.issuer.AuthenticateClient(ctx, clientID, clientSecret, models.GrantAuthorizationCode)
+	if err != nil {
+		log.Warn("client authentication failed", l.Err(err))
+
+		return issuer.Tokens{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	auth, err := p.issuer.Redeem(ctx, client, code, redirectURI, codeVerifier)
+	if err != nil {
+		return issuer.Tokens{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// the user may have been disabled since the consent
+	user, err := p.auth.activeUser(ctx, auth.UserID)
+	if err != nil {
+		log.Warn("user of the authorization code is not active", l.Err(err))
+
+		return issuer.Tokens{}, fmt.Errorf("%s:%w", f, issuer.ErrInvalidGrant)
+	}
+
+	// the access token is the client's, it works only at the endpoints of the provider
+	accessToken, err := p.tokenManager.NewClientAccessToken(ctx, user.ID, client, auth.Scope)
+	if err != nil {
+		return issuer.Tokens{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	result := issuer.Tokens{
+		AccessToken: accessToken,
+		Scope:       auth.Scope,
+		ExpiresIn:   p.tokenManager.AccessTTL(client),
+	}
+
+	// every client gets its own session of the user, refreshed with the scope granted now
+	if client.Allows(models.GrantRefreshToken) {
+		result.RefreshToken, err = p.tokenManager.NewRefreshToken(ctx, user.ID, clientFingerprint(client.ClientID), client, auth.Scope)
+		if err != nil {
+			return issuer.Tokens{}, fmt.Errorf("%s:%w", f, err)
+		}
+	}
+
+	if auth.HasScope(issuer.ScopeOpenID) {
+		result.IDToken, err = p.issuer.IDToken(auth, user.Email)
+		if err != nil {
+			return issuer.Tokens{}, fmt.Errorf("%s:%w", f, err)
+		}
+	}
+
+	log.Info("authorization code exchanged", slog.Int("user_id", int(user.ID)))
+
+	return result, nil
+}
+
+// Refresh is the refresh token grant of the token endpoint, the refresh token stays the same
+func (p *Provider) Refresh(ctx context.Context, clientID, clientSecret, refreshToken string) (issuer.Tokens, error) {
+	const f = "provider.Refresh"
+
+	log := p.log.With(slog.String("func", f), slog.String("client_id", clientID))
+	log.Info("refreshing client tokens")
+
+	client, err := p.issuer.AuthenticateClient(ctx, clientID, clientSecret, models.GrantRefreshToken)
+	if err != nil {
+		log.Warn("client authentication failed", l.Err(err))
+
+		return issuer.Tokens{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// refresh tokens are bound to the client they were issued to
+	refresh, err := p.tokenManager.ValidateRefreshToken(ctx, refreshToken, clientFingerprint(client.ClientID))
+	if err != nil || refresh.ClientID != client.ClientID {
+		log.Warn("failed to validate refresh token", l.Err(err))
+
+		return issuer.Tokens{}, fmt.Errorf("%s:%w", f, issuer.ErrInvalidGrant)
+	}
+
+	if err := p.auth.checkUserStatus(ctx, refresh.UserID); err != nil {
+		log.Warn("user is not active", l.Err(err), slog.Int("user_id", int(refresh.UserID)))
+
+		return issuer.Tokens{}, fmt.Errorf("%s:%w", f, issuer.ErrInvalidGrant)
+	}
+
+	// the scope stays the one the user consented to
+	accessToken, err := p.tokenManager.NewClientAccessToken(ctx, refresh.UserID, client, refresh.Scope)
+	if err != nil {
+		return issuer.Tokens{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return issuer.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Scope:        refresh.Scope,
+		ExpiresIn:    p.tokenManager.AccessTTL(client),
+	}, nil
+}
+
+// UserInfo returns the claims about the user the access token of a client
+// belongs to, the email only when the user granted the client the email scope
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	const f = "provider.UserInfo"
+
+	// first-party access tokens don't work here, they weren't granted any scope
+	access, err := p.tokenManager.ValidateClientAccessToken(ctx, accessToken)
+	if err != nil {
+		p.log.Warn("invalid client access token", l.Err(err), slog.String("func", f))
+
+		return nil, fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	user, err := p.auth.activeUser(ctx, access.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	claims := map[string]any{"sub": fmt.Sprintf("%d", user.ID)}
+	if slices.Contains(strings.Fields(access.Scope), issuer.ScopeEmail) {
+		claims["email"] = user.Email
+	}
+
+	return claims, nil
+}
+
+// startSecondFactor picks what the login page asks for. Passkeys need the
+// app's script, so accounts with only a passkey can't log in here.
+func (p *Provider) startSecondFactor(ctx context.Context, user models.User, ip string) (string, error) {
+	enabled, err := p.auth.mfa.Enabled(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return issuer.MFAMethodTOTP, nil
+	}
+
+	if user.Phone == "" {
+		return "", ErrSecondFactorUnavailable
+	}
+
+	if err := p.auth.smsCodes.Send(ctx, smscode.PurposeLogin, user.ID, user.Phone, ip); err != nil {
+		return "", err
+	}
+
+	return issuer.MFAMethodSMS, nil
+}
+
+// authenticate marks the user as logged in, unless the password can't be used anymore
+func (p *Provider) authenticate(user models.User, auth *issuer.Authorization) error {
+	if reason := p.auth.passwordChangeReason(user); reason != "" {
+		p.log.Info("password has to be changed before authorizing", slog.String("reason", reason))
+
+		return ErrPasswordChangeRequired
+	}
+
+	auth.Authenticated = true
+	auth.AuthTime = time.Now().Unix()
+
+	return nil
+}
+
+// clientFingerprint stands for the device in the sessions of third-party clients
+func clientFingerprint(clientID string) string {
+	return "oidc:" + clientID
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/internal/service/tokens"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+const (
+	recoveryCodeCount = 10
+	// two groups of 5 characters, about 50 bits per code
+	recoveryCodeLength = 10
+	// no 0/o, 1/l/i to keep codes readable from paper
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// GenerateRecoveryCodes replaces the recovery codes of the access token owner.
+// The plain codes are returned only here, just their hashes are stored.
+func (a *Auth) GenerateRecoveryCodes(ctx context.Context, accessToken string) ([]string, error) {
+	const f = "auth.GenerateRecoveryCodes"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("generating recovery codes")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return nil, fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			log.Error("failed to generate recovery code", l.Err(err))
+
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+
+		hash, err := a.hasher.HashPassword(normalizeRecoveryCode(code))
+		if err != nil {
+			log.Error("failed to hash recovery code", l.Err(err))
+
+			return nil, fmt.Errorf("%s:%w", f, err)
+		}
+
+		codes = append(codes, code)
+		hashes = append(hashes, hash)
+	}
+
+	if err := a.recoveryCodes.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		log.Error("failed to save recovery codes", l.Err(err))
+
+		return nil, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("recovery codes regenerated, old ones are invalid", slog.Int("user_id", int(userID)))
+
+	return codes, nil
+}
+
+// RecoverAccount exchanges the email and an unused recovery code
+// for a restricted token that can only set a new password.
+// The client is checked like on login and SetNewPassword issues the tokens for it.
+func (a *Auth) RecoverAccount(ctx context.Context, emailAddr, code, clientID string) (string, error) {
+	const f = "auth.RecoverAccount"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("recovering account", slog.String("client_id", clientID))
+
+	client, err := a.client(ctx, clientID, models.GrantPassword)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	emailAddr, err = a.normalizer.Normalize(emailAddr)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, ErrInvalidCreds)
+	}
+
+	// codes are guessed the same way as passwords, so they share the lockout
+	retryAfter, err := a.limiter.Check(ctx, emailAddr)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+	if retryAfter > 0 {
+		log.Warn("account is locked", slog.Duration("retry_after", retryAfter))
+
+		return "", fmt.Errorf("%s:%w", f, &LockedError{RetryAfter: retryAfter})
+	}
+
+	code = normalizeRecoveryCode(code)
+
+	user, err := a.userProvider.User(ctx, emailAddr)
+	if err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			// the same hash checks as for an existing account
+			a.matchRecoveryCode(code, nil)
+
+			return "", fmt.Errorf("%s:%w", f, a.failLogin(ctx, emailAddr))
+		}
+
+		log.Error("failed to get user", l.Err(err))
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	log = log.With(slog.Int("user_id", int(user.ID)))
+
+	codes, err := a.recoveryCodes.RecoveryCodes(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get recovery codes", l.Err(err))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	matched, ok := a.matchRecoveryCode(code, codes)
+	if !ok {
+		log.Warn("invalid recovery code")
+
+		return "", fmt.Errorf("%s:%w", f, a.failLogin(ctx, emailAddr))
+	}
+
+	// two requests with the same code race here, only one marks it used
+	used, err := a.recoveryCodes.UseRecoveryCode(ctx, matched.ID)
+	if err != nil {
+		log.Error("failed to use recovery code", l.Err(err))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+	if !used {
+		log.Warn("recovery code was already used")
+
+		return "", fmt.Errorf("%s:%w", f, ErrInvalidCreds)
+	}
+
+	// every use is an audit event, the owner may not be the one who used it
+	log.Warn("recovery code used", slog.Int("code_id", int(matched.ID)), slog.Int("codes_left", len(codes)-1))
+
+	if err := a.limiter.Reset(ctx, emailAddr); err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		log.Warn("user is not active", l.Err(err))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	token, err := a.tokenManager.NewRestrictedToken(ctx, user, tokens.PurposePasswordChange, client.ClientID)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return token, nil
+}
+
+// matchRecoveryCode checks at least recoveryCodeCount hashes, padding with the dummy hash,
+// and never stops early, so the time tells neither that the account exists nor how many codes it has left
+func (a *Auth) matchRecoveryCode(code string, codes []models.RecoveryCode) (models.RecoveryCode, bool) {
+	var (
+		matched models.RecoveryCode
+		found   bool
+	)
+	for i := range max(recoveryCodeCount, len(codes)) {
+		if i >= len(codes) {
+			_ = a.hasher.CheckPassword(code, a.dummyHash)
+			continue
+		}
+
+		if a.hasher.CheckPassword(code, codes[i].Hash) == nil && !found {
+			matched, found = codes[i], true
+		}
+	}
+
+	// malformed codes cost the same and never match
+	if !found || len(code) != recoveryCodeLength {
+		return models.RecoveryCode{}, false
+	}
+
+	return matched, true
+}
+
+// newRecoveryCode looks like "k7pqr-x2mfa"
+func newRecoveryCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	var b strings.Builder
+	for i := range recoveryCodeLength {
+		if i == recoveryCodeLength/2 {
+			b.WriteByte('-')
+		}
+
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// normalizeRecoveryCode accepts codes typed with any case, spaces or dashes
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/internal/service/smscode"
+	"github.com/kuromii5/miku-notes-auth/internal/service/tokens"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+// SetPhone texts a verification code to the number. The number replaces
+// the user's phone only after VerifyPhone, until then the old one is used.
+func (a *Auth) SetPhone(ctx context.Context, accessToken, phone, ip string) error {
+	const f = "auth.SetPhone"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("setting phone")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	phone, err = smscode.NormalizePhone(phone)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.smsCodes.Send(ctx, smscode.PurposeVerify, userID, phone, ip); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("phone verification code sent", slog.Int("user_id", int(userID)))
+
+	return nil
+}
+
+// VerifyPhone saves the number the code was sent to, from then on it's a second factor
+func (a *Auth) VerifyPhone(ctx context.Context, accessToken, code string) error {
+	const f = "auth.VerifyPhone"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("verifying phone")
+
+	userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		log.Warn("failed to validate access token", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidToken)
+	}
+
+	if _, err := a.activeUser(ctx, userID); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	phone, err := a.smsCodes.Verify(ctx, smscode.PurposeVerify, userID, code)
+	if err != nil {
+		log.Warn("failed to verify phone", l.Err(err), slog.Int("user_id", int(userID)))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.userSaver.SetPhone(ctx, userID, phone); err != nil {
+		log.Error("failed to save phone", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("phone verified", slog.Int("user_id", int(userID)))
+
+	return nil
+}
+
+// SendLoginSMS texts a second factor code for the challenge token from Login
+func (a *Auth) SendLoginSMS(ctx context.Context, challengeToken, ip string) error {
+	const f = "auth.SendLoginSMS"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("sending login sms")
+
+	restricted, err := a.tokenManager.ValidateRestrictedToken(ctx, challengeToken, tokens.PurposeMFA)
+	if err != nil {
+		log.Warn("failed to validate challenge token", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, ErrInvalidRestrictedToken)
+	}
+
+	user, err := a.activeUser(ctx, restricted.UserID)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if user.Phone == "" {
+		return fmt.Errorf("%s:%w", f, ErrNoPhone)
+	}
+
+	if err := a.smsCodes.Send(ctx, smscode.PurposeLogin, user.ID, user.Phone, ip); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// VerifySMS is the second login step with a texted code instead of a TOTP one
+func (a *Auth) VerifySMS(ctx context.Context, challengeToken, code, fingerprint string) (models.LoginResult, error) {
+	const f = "auth.VerifySMS"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("verifying sms code")
+
+	restricted, err := a.tokenManager.ValidateRestrictedToken(ctx, challengeToken, tokens.PurposeMFA)
+	if err != nil {
+		log.Warn("failed to validate challenge token", l.Err(err))
+
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, ErrInvalidRestrictedToken)
+	}
+	userID := restricted.UserID
+
+	client, err := a.client(ctx, restricted.ClientID, models.GrantPassword)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	user, err := a.activeUser(ctx, userID)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	retryAfter, err := a.limiter.Check(ctx, user.Email)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+	if retryAfter > 0 {
+		log.Warn("account is locked", slog.Duration("retry_after", retryAfter))
+
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, &LockedError{RetryAfter: retryAfter})
+	}
+
+	if err := a.checkSMSCode(ctx, smscode.PurposeLogin, user, code); err != nil {
+		if errors.Is(err, smscode.ErrInvalidCode) {
+			log.Warn("invalid sms code", slog.Int("user_id", int(userID)))
+
+			return models.LoginResult{}, fmt.Errorf("%s:%w", f, a.failLogin(ctx, user.Email))
+		}
+
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.limiter.Reset(ctx, user.Email); err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	result, err := a.completeLogin(ctx, user, fingerprint, client, true)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("sms code verified", slog.Int("user_id", int(userID)))
+
+	return result, nil
+}
+
+// RequestRecoverySMS texts a recovery code to the verified phone of the account.
+// Unknown emails, accounts without a phone and accounts with an authenticator
+// app or a passkey get the same answer but no message.
+func (a *Auth) RequestRecoverySMS(ctx context.Context, emailAddr, ip string) error {
+	const f = "auth.RequestRecoverySMS"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("requesting recovery sms")
+
+	emailAddr, err := a.normalizer.Normalize(emailAddr)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, ErrInvalidEmail)
+	}
+
+	user, err := a.userProvider.User(ctx, emailAddr)
+	if err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			log.Info("recovery sms requested for unknown email")
+
+			return nil
+		}
+
+		log.Error("failed to get user", l.Err(err))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	if user.Phone == "" || checkStatus(user) != nil {
+		log.Info("recovery sms requested for user without phone or inactive", slog.Int("user_id", int(user.ID)))
+
+		return nil
+	}
+
+	strong, err := a.strongFactorEnabled(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to check second factors", l.Err(err))
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	if strong {
+		log.Info("recovery sms requested for user with a stronger factor", slog.Int("user_id", int(user.ID)))
+
+		return nil
+	}
+
+	if err := a.smsCodes.Send(ctx, smscode.PurposeRecovery, user.ID, user.Phone, ip); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("recovery sms sent", slog.Int("user_id", int(user.ID)))
+
+	return nil
+}
+
+// RecoverWithSMS exchanges a texted recovery code for a restricted token
+// that can only set a new password, like RecoverAccount does. The phone alone
+// can't replace an authenticator app or a passkey, such accounts need a recovery code.
+func (a *Auth) RecoverWithSMS(ctx context.Context, emailAddr, code, clientID string) (string, error) {
+	const f = "auth.RecoverWithSMS"
+
+	log := a.log.With(slog.String("func", f))
+	log.Info("recovering account with sms code", slog.String("client_id", clientID))
+
+	client, err := a.client(ctx, clientID, models.GrantPassword)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	emailAddr, err = a.normalizer.Normalize(emailAddr)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, ErrInvalidCreds)
+	}
+
+	retryAfter, err := a.limiter.Check(ctx, emailAddr)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+	if retryAfter > 0 {
+		log.Warn("account is locked", slog.Duration("retry_after", retryAfter))
+
+		return "", fmt.Errorf("%s:%w", f, &LockedError{RetryAfter: retryAfter})
+	}
+
+	user, err := a.userProvider.User(ctx, emailAddr)
+	if err != nil {
+		if errors.Is(err, postgres.ErrUserNotFound) {
+			return "", fmt.Errorf("%s:%w", f, a.failLogin(ctx, emailAddr))
+		}
+
+		log.Error("failed to get user", l.Err(err))
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.checkSMSCode(ctx, smscode.PurposeRecovery, user, code); err != nil {
+		if errors.Is(err, smscode.ErrInvalidCode) {
+			log.Warn("invalid recovery sms code", slog.Int("user_id", int(user.ID)))
+
+			return "", fmt.Errorf("%s:%w", f, a.failLogin(ctx, emailAddr))
+		}
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := a.limiter.Reset(ctx, emailAddr); err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		log.Warn("user is not active", l.Err(err))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	// a code sent before the factor was enrolled isn't enough either
+	strong, err := a.strongFactorEnabled(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to check second factors", l.Err(err))
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+	if strong {
+		log.Warn("sms recovery refused, stronger factor enrolled", slog.Int("user_id", int(user.ID)))
+
+		return "", fmt.Errorf("%s:%w", f, ErrSMSRecoveryOff)
+	}
+
+	// like recovery codes, every use is an audit event
+	log.Warn("account recovered with sms code", slog.Int("user_id", int(user.ID)))
+
+	token, err := a.tokenManager.NewRestrictedToken(ctx, user, tokens.PurposePasswordChange, client.ClientID)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return token, nil
+}
+
+// checkSMSCode consumes the code and makes sure it went to the phone the user still has
+func (a *Auth) checkSMSCode(ctx context.Context, purpose string, user models.User, code string) error {
+	phone, err := a.smsCodes.Verify(ctx, purpose, user.ID, code)
+	if err != nil {
+		return err
+	}
+	if user.Phone == "" || phone != user.Phone {
+		return smscode.ErrInvalidCode
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: smscode.go
+
+// Package mock_smscode is a generated GoMock package.
+package mock_smscode
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockStorage is a mock of Storage interface.
+type MockStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockStorageMockRecorder
+}
+
+// MockStorageMockRecorder is the mock recorder for MockStorage.
+type MockStorageMockRecorder struct {
+	mock *MockStorage
+}
+
+// NewMockStorage creates a new mock instance.
+func NewMockStorage(ctrl *gomock.Controller) *MockStorage {
+	mock := &MockStorage{ctrl: ctrl}
+	mock.recorder = &MockStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
+	return m.recorder
+}
+
+// CountSMSSend mocks base method.
+func (m *MockStorage) CountSMSSend(ctx context.Context, key string, window time.Duration) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountSMSSend", ctx, key, window)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountSMSSend indicates an expected call of CountSMSSend.
+func (mr *MockStorageMockRecorder) CountSMSSend(ctx, key, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountSMSSend", reflect.TypeOf((*MockStorage)(nil).CountSMSSend), ctx, key, window)
+}
+
+// SaveSMSCode mocks base method.
+func (m *MockStorage) SaveSMSCode(ctx context.Context, key, codeHash, phone string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSMSCode", ctx, key, codeHash, phone, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSMSCode indicates an expected call of SaveSMSCode.
+func (mr *MockStorageMockRecorder) SaveSMSCode(ctx, key, codeHash, phone, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSMSCode", reflect.TypeOf((*MockStorage)(nil).SaveSMSCode), ctx, key, codeHash, phone, ttl)
+}
+
+// UseSMSCode mocks base method.
+func (m *MockStorage) UseSMSCode(ctx context.Context, key, codeHash string, maxAttempts int) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseSMSCode", ctx, key, codeHash, maxAttempts)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// UseSMSCode indicates an expected call of UseSMSCode.
+func (mr *MockStorageMockRecorder) UseSMSCode(ctx, key, codeHash, maxAttempts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseSMSCode", reflect.TypeOf((*MockStorage)(nil).UseSMSCode), ctx, key, codeHash, maxAttempts)
+}
+
+// MockSMSSender is a mock of SMSSender interface.
+type MockSMSSender struct {
+	ctrl     *gomock.Controller
+	recorder *MockSMSSenderMockRecorder
+}
+
+// MockSMSSenderMockRecorder is the mock recorder for MockSMSSender.
+type MockSMSSenderMockRecorder struct {
+	mock *MockSMSSender
+}
+
+// NewMockSMSSender creates a new mock instance.
+func NewMockSMSSender(ctrl *gomock.Controller) *MockSMSSender {
+	mock := &MockSMSSender{ctrl: ctrl}
+	mock.recorder = &MockSMSSenderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSMSSender) EXPECT() *MockSMSSenderMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method.
+func (m *MockSMSSender) Send(ctx context.Context, to, text string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, to, text)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockSMSSenderMockRecorder) Send(ctx, to, text interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockSMSSender)(nil).Send), ctx, to, text)
+}
@@ -0,0 +1,230 @@
+package smscode
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/repo/redis"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+const codeDigits = 6
+
+// what a code is sent for, a code of one purpose can't be used for another
+const (
+	PurposeVerify   = "verify"
+	PurposeLogin    = "login"
+	PurposeRecovery = "recovery"
+)
+
+var (
+	ErrNotConfigured   = errors.New("sms is not configured")
+	ErrTooManyRequests = errors.New("too many sms were requested, try again later")
+	ErrInvalidCode     = errors.New("invalid or expired sms code")
+	ErrInvalidPhone    = errors.New("invalid phone number")
+)
+
+// Manager texts one-time codes and checks them. Every send counts towards
+// a limit per number and per client address, so the service can't be used
+// to pump messages to premium rate numbers.
+type Manager struct {
+	log *slog.Logger
+
+	// keys the code hashes, six digits are too few for a plain hash
+	key []byte
+
+	ttl         time.Duration
+	maxAttempts int
+
+	// messages allowed in the window, 0 turns the limit off
+	perNumber int
+	perIP     int
+	window    time.Duration
+
+	storage Storage
+	// nil when no provider is configured: nothing can be sent
+	sender SMSSender
+}
+
+//go:generate mockgen -source=smscode.go -destination=mock/smscode.go
+type Storage interface {
+	SaveSMSCode(ctx context.Context, key, codeHash, phone string, ttl time.Duration) error
+	UseSMSCode(ctx context.Context, key, codeHash string, maxAttempts int) (string, bool, error)
+	CountSMSSend(ctx context.Context, key string, window time.Duration) (int64, error)
+}
+type SMSSender interface {
+	Send(ctx context.Context, to, text string) error
+}
+
+func New(
+	log *slog.Logger,
+	key []byte,
+	ttl time.Duration,
+	maxAttempts int,
+	perNumber int,
+	perIP int,
+	window time.Duration,
+	storage Storage,
+	sender SMSSender,
+) *Manager {
+	return &Manager{
+		log:         log,
+		key:         key,
+		ttl:         ttl,
+		maxAttempts: max(maxAttempts, 1),
+		perNumber:   perNumber,
+		perIP:       perIP,
+		window:      window,
+		storage:     storage,
+		sender:      sender,
+	}
+}
+
+// Send texts a new code for the purpose to the phone, the previous code of
+// the user and purpose stops working. ip is the client address, empty when unknown.
+func (m *Manager) Send(ctx context.Context, purpose string, userID int32, phone, ip string) error {
+	const f = "smscode.Send"
+
+	log := m.log.With(slog.String("func", f), slog.Int("user_id", int(userID)))
+
+	if m.sender == nil {
+		return fmt.Errorf("%s:%w", f, ErrNotConfigured)
+	}
+
+	if err := m.allow(ctx, phone, ip); err != nil {
+		if errors.Is(err, ErrTooManyRequests) {
+			log.Warn("sms limit reached", slog.String("purpose", purpose), slog.String("ip", ip))
+		}
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	key := codeKey(purpose, userID)
+	if err := m.storage.SaveSMSCode(ctx, key, m.codeHash(key, code), phone, m.ttl); err != nil {
+		log.Error("failed to save sms code", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	text := fmt.Sprintf("Your miku-notes code is %s. It expires in %s, don't share it with anyone.", code, m.ttl)
+	if err := m.sender.Send(ctx, phone, text); err != nil {
+		log.Error("failed to send sms", l.Err(err))
+
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// Verify consumes the user's code for the purpose and returns the phone it
+// was sent to. A code is burnt after maxAttempts wrong guesses.
+func (m *Manager) Verify(ctx context.Context, purpose string, userID int32, code string) (string, error) {
+	const f = "smscode.Verify"
+
+	code = strings.TrimSpace(code)
+	if len(code) != codeDigits {
+		return "", fmt.Errorf("%s:%w", f, ErrInvalidCode)
+	}
+
+	key := codeKey(purpose, userID)
+	phone, ok, err := m.storage.UseSMSCode(ctx, key, m.codeHash(key, code), m.maxAttempts)
+	if err != nil {
+		if errors.Is(err, redis.ErrSMSCodeNotFound) {
+			return "", fmt.Errorf("%s:%w", f, ErrInvalidCode)
+		}
+
+		m.log.Error("failed to use sms code", l.Err(err), slog.String("func", f))
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("%s:%w", f, ErrInvalidCode)
+	}
+
+	return phone, nil
+}
+
+// allow counts the send against both limits, a refused send still counts
+func (m *Manager) allow(ctx context.Context, phone, ip string) error {
+	if m.perNumber > 0 {
+		n, err := m.storage.CountSMSSend(ctx, "phone:"+phone, m.window)
+		if err != nil {
+			return err
+		}
+		if n > int64(m.perNumber) {
+			return ErrTooManyRequests
+		}
+	}
+
+	if m.perIP > 0 && ip != "" {
+		n, err := m.storage.CountSMSSend(ctx, "ip:"+ip, m.window)
+		if err != nil {
+			return err
+		}
+		if n > int64(m.perIP) {
+			return ErrTooManyRequests
+		}
+	}
+
+	return nil
+}
+
+// codeHash binds the code to the user and purpose it was sent for
+func (m *Manager) codeHash(key, code string) string {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte("sms-code\x00" + key + "\x00" + code))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func codeKey(purpose string, userID int32) string {
+	return purpose + ":" + strconv.Itoa(int(userID))
+}
+
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", codeDigits, n.Int64()), nil
+}
+
+// NormalizePhone returns the number in E.164 form. Spaces, dashes, dots and
+// parentheses are dropped, the country code with a leading + is required.
+func NormalizePhone(phone string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	normalized := b.String()
+	// a country code never starts with 0, the whole number has at most 15 digits
+	if !strings.HasPrefix(normalized, "+") || len(normalized) < 9 || len(normalized) > 16 || normalized[1] == '0' {
+		return "", ErrInvalidPhone
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+	"github.com/kuromii5/miku-notes-auth/internal/service/social"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+// StartOAuth returns the state and the provider page the user is sent to.
+// With an access token the provider is linked to its owner instead of logging in.
+func (a *Auth) StartOAuth(ctx context.Context, provider, accessToken string) (string, string, error) {
+	const f = "auth.StartOAuth"
+
+	log := a.log.With(slog.String("func", f), slog.String("provider", provider))
+	log.Info("starting oauth login")
+
+	var linkUserID int32
+	if accessToken != "" {
+		userID, err := a.tokenManager.ValidateAccessToken(ctx, accessToken)
+		if err != nil {
+			log.Warn("failed to validate access token", l.Err(err))
+
+			return "", "", fmt.Errorf("%s:%w", f, ErrInvalidToken)
+		}
+
+		if _, err := a.activeUser(ctx, userID); err != nil {
+			return "", "", fmt.Errorf("%s:%w", f, err)
+		}
+
+		linkUserID = userID
+	}
+
+	state, authURL, err := a.social.Start(ctx, provider, linkUserID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return state, authURL, nil
+}
+
+// CompleteOAuth finishes the login with the code the provider sent back.
+// Unknown provider accounts sign up a new user, unless their email already
+// belongs to someone: that user has to log in and link the provider first.
+func (a *Auth) CompleteOAuth(ctx context.Context, state, code, fingerprint, clientID string) (models.LoginResult, error) {
+	const f = "auth.CompleteOAuth"
+
+	log := a.log.With(slog.String("func", f), slog.String("client_id", clientID))
+	log.Info("completing oauth login")
+
+	// checked before the state is used up, the app can retry with the right id
+	client, err := a.client(ctx, clientID, models.GrantPassword)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	identity, linkUserID, err := a.social.Complete(ctx, state, code)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log = log.With(slog.String("provider", identity.Provider))
+
+	if linkUserID != 0 {
+		result, err := a.linkIdentity(ctx, linkUserID, identity, fingerprint, client)
+		if err != nil {
+			return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+		}
+
+		return result, nil
+	}
+
+	userID, err := a.identities.IdentityUser(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		if !errors.Is(err, postgres.ErrIdentityNotFound) {
+			log.Error("failed to get identity", l.Err(err))
+
+			return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+		}
+
+		userID, err = a.signUpIdentity(ctx, identity)
+		if err != nil {
+			return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+		}
+	}
+
+	user, err := a.activeUser(ctx, userID)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// the provider replaces the password, a second factor is still asked for
+	result, err := a.completeLogin(ctx, user, fingerprint, client, false)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	log.Info("logged in with identity provider", slog.Int("user_id", int(userID)))
+
+	return result, nil
+}
+
+// signUpIdentity creates a user for a provider account seen for the first time
+func (a *Auth) signUpIdentity(ctx context.Context, identity social.Identity) (int32, error) {
+	log := a.log.With(slog.String("func", "auth.signUpIdentity"), slog.String("provider", identity.Provider))
+
+	// an unverified email could be anyone's
+	if identity.Email == "" || !identity.EmailVerified {
+		log.Warn("provider didn't verify the email")
+
+		return 0, ErrEmailNotVerified
+	}
+
+	emailAddr, err := a.normalizer.Normalize(identity.Email)
+	if err != nil {
+		log.Warn("failed to normalize email", l.Err(err))
+
+		return 0, ErrInvalidEmail
+	}
+
+	// nobody knows the password, the user logs in through the provider or with email codes
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return 0, err
+	}
+	hash, err := a.hasher.HashPassword(hex.EncodeToString(random))
+	if err != nil {
+		log.Error("failed to generate password", l.Err(err))
+
+		return 0, err
+	}
+
+	userID, err := a.identities.SaveUserWithIdentity(ctx, emailAddr, hash, models.Identity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrUserExists):
+			log.Warn("email of the provider account is already registered")
+
+			return 0, ErrLinkRequired
+		case errors.Is(err, postgres.ErrIdentityExists):
+			// a concurrent first login won the race, log in as that user
+			return a.identities.IdentityUser(ctx, identity.Provider, identity.Subject)
+		}
+
+		log.Error("failed to save user", l.Err(err))
+		return 0, err
+	}
+
+	log.Info("user signed up with identity provider", slog.Int("user_id", int(userID)))
+
+	return userID, nil
+}
+
+// linkIdentity adds the provider account to the user that started the link.
+// The user was already logged in, so the login is complete.
+func (a *Auth) linkIdentity(
+	ctx context.Context,
+	userID int32,
+	identity social.Identity,
+	fingerprint string,
+	client models.Client,
+) (models.LoginResult, error) {
+	log := a.log.With(slog.String("func", "auth.linkIdentity"), slog.Int("user_id", int(userID)))
+
+	user, err := a.activeUser(ctx, userID)
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	err = a.identities.SaveIdentity(ctx, models.Identity{
+		UserID:   userID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		if !errors.Is(err, postgres.ErrIdentityExists) {
+			log.Error("failed to save identity", l.Err(err))
+
+			return models.LoginResult{}, err
+		}
+
+		// linking the same account twice is fine. Someone else's account,
+		// or a second account of the same provider, can't be linked.
+		owner, err := a.identities.IdentityUser(ctx, identity.Provider, identity.Subject)
+		if err != nil && !errors.Is(err, postgres.ErrIdentityNotFound) {
+			return models.LoginResult{}, err
+		}
+		if owner != userID {
+			log.Warn("provider account can't be linked")
+
+			return models.LoginResult{}, ErrIdentityTaken
+		}
+	}
+
+	log.Info("identity provider linked", slog.String("provider", identity.Provider))
+
+	return a.completeLogin(ctx, user, fingerprint, client, true)
+}
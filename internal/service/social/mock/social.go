@@ -0,0 +1,134 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: social.go
+
+// Package mock_social is a generated GoMock package.
+package mock_social
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+	oidc "github.com/kuromii5/miku-notes-auth/pkg/oidc"
+)
+
+// MockProvider is a mock of Provider interface.
+type MockProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockProviderMockRecorder
+}
+
+// MockProviderMockRecorder is the mock recorder for MockProvider.
+type MockProviderMockRecorder struct {
+	mock *MockProvider
+}
+
+// NewMockProvider creates a new mock instance.
+func NewMockProvider(ctrl *gomock.Controller) *MockProvider {
+	mock := &MockProvider{ctrl: ctrl}
+	mock.recorder = &MockProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockProvider) EXPECT() *MockProviderMockRecorder {
+	return m.recorder
+}
+
+// AuthCodeURL mocks base method.
+func (m *MockProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuthCodeURL", ctx, state, nonce, codeChallenge)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AuthCodeURL indicates an expected call of AuthCodeURL.
+func (mr *MockProviderMockRecorder) AuthCodeURL(ctx, state, nonce, codeChallenge interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthCodeURL", reflect.TypeOf((*MockProvider)(nil).AuthCodeURL), ctx, state, nonce, codeChallenge)
+}
+
+// Exchange mocks base method.
+func (m *MockProvider) Exchange(ctx context.Context, code, codeVerifier string) (oidc.Token, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exchange", ctx, code, codeVerifier)
+	ret0, _ := ret[0].(oidc.Token)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Exchange indicates an expected call of Exchange.
+func (mr *MockProviderMockRecorder) Exchange(ctx, code, codeVerifier interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exchange", reflect.TypeOf((*MockProvider)(nil).Exchange), ctx, code, codeVerifier)
+}
+
+// Identify mocks base method.
+func (m *MockProvider) Identify(ctx context.Context, token oidc.Token, nonce string) (oidc.Claims, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Identify", ctx, token, nonce)
+	ret0, _ := ret[0].(oidc.Claims)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Identify indicates an expected call of Identify.
+func (mr *MockProviderMockRecorder) Identify(ctx, token, nonce interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Identify", reflect.TypeOf((*MockProvider)(nil).Identify), ctx, token, nonce)
+}
+
+// MockStateStorage is a mock of StateStorage interface.
+type MockStateStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockStateStorageMockRecorder
+}
+
+// MockStateStorageMockRecorder is the mock recorder for MockStateStorage.
+type MockStateStorageMockRecorder struct {
+	mock *MockStateStorage
+}
+
+// NewMockStateStorage creates a new mock instance.
+func NewMockStateStorage(ctrl *gomock.Controller) *MockStateStorage {
+	mock := &MockStateStorage{ctrl: ctrl}
+	mock.recorder = &MockStateStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStateStorage) EXPECT() *MockStateStorageMockRecorder {
+	return m.recorder
+}
+
+// SaveOAuthState mocks base method.
+func (m *MockStateStorage) SaveOAuthState(ctx context.Context, state string, data []byte, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOAuthState", ctx, state, data, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveOAuthState indicates an expected call of SaveOAuthState.
+func (mr *MockStateStorageMockRecorder) SaveOAuthState(ctx, state, data, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOAuthState", reflect.TypeOf((*MockStateStorage)(nil).SaveOAuthState), ctx, state, data, ttl)
+}
+
+// TakeOAuthState mocks base method.
+func (m *MockStateStorage) TakeOAuthState(ctx context.Context, state string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakeOAuthState", ctx, state)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TakeOAuthState indicates an expected call of TakeOAuthState.
+func (mr *MockStateStorageMockRecorder) TakeOAuthState(ctx, state interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakeOAuthState", reflect.TypeOf((*MockStateStorage)(nil).TakeOAuthState), ctx, state)
+}
@@ -0,0 +1,178 @@
+package social
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/internal/repo/redis"
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+	"github.com/kuromii5/miku-notes-auth/pkg/oidc"
+)
+
+// stateTTL is how long the user has to come back from the provider
+const stateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidState    = errors.New("oauth login is expired or unknown")
+	ErrProviderFailed  = errors.New("identity provider login failed")
+)
+
+// Identity is who the provider says logged in
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// login is kept in redis while the user is at the provider
+type login struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	// set when a logged in user links the provider instead of logging in
+	LinkUserID int32 `json:"link_user_id,omitempty"`
+}
+
+// Manager runs the authorization code flow with PKCE against the configured providers
+type Manager struct {
+	log       *slog.Logger
+	providers map[string]Provider
+	states    StateStorage
+}
+
+//go:generate mockgen -source=social.go -destination=mock/social.go
+type Provider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier string) (oidc.Token, error)
+	Identify(ctx context.Context, token oidc.Token, nonce string) (oidc.Claims, error)
+}
+type StateStorage interface {
+	SaveOAuthState(ctx context.Context, state string, data []byte, ttl time.Duration) error
+	TakeOAuthState(ctx context.Context, state string) ([]byte, error)
+}
+
+func New(log *slog.Logger, providers map[string]Provider, states StateStorage) *Manager {
+	return &Manager{
+		log:       log,
+		providers: providers,
+		states:    states,
+	}
+}
+
+// Start returns the state and the provider page to send the user to.
+// linkUserID is the logged in user linking the provider, zero for a login.
+func (m *Manager) Start(ctx context.Context, providerName string, linkUserID int32) (string, string, error) {
+	const f = "social.Start"
+
+	provider, ok := m.providers[providerName]
+	if !ok {
+		return "", "", fmt.Errorf("%s:%w", f, ErrUnknownProvider)
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		m.log.Error("failed to build authorization url", l.Err(err), slog.String("provider", providerName))
+
+		return "", "", fmt.Errorf("%s:%w", f, ErrProviderFailed)
+	}
+
+	data, err := json.Marshal(login{
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	if err := m.states.SaveOAuthState(ctx, state, data, stateTTL); err != nil {
+		m.log.Error("failed to save oauth state", l.Err(err), slog.String("func", f))
+
+		return "", "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return state, authURL, nil
+}
+
+// Complete exchanges the code the provider sent back with the state and
+// returns the identity with the user that started the link, if any
+func (m *Manager) Complete(ctx context.Context, state, code string) (Identity, int32, error) {
+	const f = "social.Complete"
+
+	log := m.log.With(slog.String("func", f))
+
+	data, err := m.states.TakeOAuthState(ctx, state)
+	if err != nil {
+		if errors.Is(err, redis.ErrOAuthStateNotFound) {
+			return Identity{}, 0, fmt.Errorf("%s:%w", f, ErrInvalidState)
+		}
+
+		log.Error("failed to get oauth state", l.Err(err))
+		return Identity{}, 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	var s login
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Identity{}, 0, fmt.Errorf("%s:%w", f, err)
+	}
+
+	// the provider may have been removed from the config in the meantime
+	provider, ok := m.providers[s.Provider]
+	if !ok {
+		return Identity{}, 0, fmt.Errorf("%s:%w", f, ErrUnknownProvider)
+	}
+
+	log = log.With(slog.String("provider", s.Provider))
+
+	token, err := provider.Exchange(ctx, code, s.CodeVerifier)
+	if err != nil {
+		log.Warn("failed to exchange authorization code", l.Err(err))
+
+		return Identity{}, 0, fmt.Errorf("%s:%w", f, ErrProviderFailed)
+	}
+
+	claims, err := provider.Identify(ctx, token, s.Nonce)
+	if err != nil {
+		log.Warn("failed to identify user", l.Err(err))
+
+		return Identity{}, 0, fmt.Errorf("%s:%w", f, ErrProviderFailed)
+	}
+
+	return Identity{
+		Provider:      s.Provider,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, s.LinkUserID, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -36,17 +36,17 @@ func (m *MockRefreshTokenSetter) EXPECT() *MockRefreshTokenSetterMockRecorder {
 }
 
 // Set mocks base method.
-func (m *MockRefreshTokenSetter) Set(ctx context.Context, userID int32, fingerprint, token string, expires time.Duration) error {
+func (m *MockRefreshTokenSetter) Set(ctx context.Context, userID int32, fingerprint, clientID, scope, token string, expires time.Duration) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Set", ctx, userID, fingerprint, token, expires)
+	ret := m.ctrl.Call(m, "Set", ctx, userID, fingerprint, clientID, scope, token, expires)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Set indicates an expected call of Set.
-func (mr *MockRefreshTokenSetterMockRecorder) Set(ctx, userID, fingerprint, token, expires interface{}) *gomock.Call {
+func (mr *MockRefreshTokenSetterMockRecorder) Set(ctx, userID, fingerprint, clientID, scope, token, expires interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockRefreshTokenSetter)(nil).Set), ctx, userID, fingerprint, token, expires)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockRefreshTokenSetter)(nil).Set), ctx, userID, fingerprint, clientID, scope, token, expires)
 }
 
 // MockRefreshTokenDeleter is a mock of RefreshTokenDeleter interface.
@@ -86,6 +86,20 @@ func (mr *MockRefreshTokenDeleterMockRecorder) Delete(ctx, userID, fingerprint i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRefreshTokenDeleter)(nil).Delete), ctx, userID, fingerprint)
 }
 
+// DeleteAll mocks base method.
+func (m *MockRefreshTokenDeleter) DeleteAll(ctx context.Context, userID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAll", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAll indicates an expected call of DeleteAll.
+func (mr *MockRefreshTokenDeleterMockRecorder) DeleteAll(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAll", reflect.TypeOf((*MockRefreshTokenDeleter)(nil).DeleteAll), ctx, userID)
+}
+
 // MockUserGetter is a mock of UserGetter interface.
 type MockUserGetter struct {
 	ctrl     *gomock.Controller
@@ -110,12 +124,14 @@ func (m *MockUserGetter) EXPECT() *MockUserGetterMockRecorder {
 }
 
 // UserID mocks base method.
-func (m *MockUserGetter) UserID(ctx context.Context, token, fingerprint string) (string, error) {
+func (m *MockUserGetter) UserID(ctx context.Context, token, fingerprint string) (string, string, string, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "UserID", ctx, token, fingerprint)
 	ret0, _ := ret[0].(string)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(string)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
 }
 
 // UserID indicates an expected call of UserID.
@@ -8,21 +8,41 @@ import (
 	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
 	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
 )
 
 var (
-	ErrExpiredToken = errors.New("token is expired")
+	ErrExpiredToken   = errors.New("token is expired")
+	ErrInvalidPurpose = errors.New("token was issued for another purpose")
 )
 
+// purposes of restricted tokens, each one is accepted by a single RPC only
+const (
+	PurposePasswordChange = "password_change"
+	PurposeMFA            = "mfa"
+)
+
+// purposeService is the audience of service tokens, so they never work as access tokens
+const purposeService = "service"
+
+// typeClientAccess is the type of the access tokens of third-party clients (RFC 9068).
+// Their audience is the client, which could be named like a purpose, the type tells them apart.
+const typeClientAccess = "at+jwt"
+
+// restrictedTTL is how long the user has to finish the restricted login
+const restrictedTTL = 10 * time.Minute
+
 type TokenManager struct {
 	log *slog.Logger
 
 	accessTTL  time.Duration
 	refreshTTL time.Duration
+	serviceTTL time.Duration
 	secret     string
 
 	refreshTokenSetter  RefreshTokenSetter
@@ -32,19 +52,20 @@ type TokenManager struct {
 
 //go:generate mockgen -source=tokens.go -destination=mock/tokens.go
 type RefreshTokenSetter interface {
-	Set(ctx context.Context, userID int32, fingerprint, token string, expires time.Duration) error
+	Set(ctx context.Context, userID int32, fingerprint, clientID, scope, token string, expires time.Duration) error
 }
 type RefreshTokenDeleter interface {
 	Delete(ctx context.Context, userID int32, fingerprint string) error
+	DeleteAll(ctx context.Context, userID int32) error
 }
 type UserGetter interface {
-	UserID(ctx context.Context, token, fingerprint string) (string, error)
+	UserID(ctx context.Context, token, fingerprint string) (string, string, string, error)
 }
 
 func New(
 	log *slog.Logger,
 	secret string,
-	accessTTL, refreshTTL time.Duration,
+	accessTTL, refreshTTL, serviceTTL time.Duration,
 	refreshTokenSetter RefreshTokenSetter,
 	refreshTokenDeleter RefreshTokenDeleter,
 	userGetter UserGetter,
@@ -53,6 +74,7 @@ func New(
 		log:                 log,
 		accessTTL:           accessTTL,
 		refreshTTL:          refreshTTL,
+		serviceTTL:          serviceTTL,
 		secret:              secret,
 		refreshTokenSetter:  refreshTokenSetter,
 		refreshTokenDeleter: refreshTokenDeleter,
@@ -60,13 +82,39 @@ func New(
 	}
 }
 
-func (t *TokenManager) NewAccessToken(_ context.Context, userID int32) (string, error) {
+// AccessTTL is how long access tokens of the client live, clients are told it with the tokens
+func (t *TokenManager) AccessTTL(client models.Client) time.Duration {
+	if client.AccessTTL > 0 {
+		return client.AccessTTL
+	}
+
+	return t.accessTTL
+}
+
+// ServiceTTL is how long service tokens of the client live
+func (t *TokenManager) ServiceTTL(client models.Client) time.Duration {
+	if client.AccessTTL > 0 {
+		return client.AccessTTL
+	}
+
+	return t.serviceTTL
+}
+
+func (t *TokenManager) refreshTTLFor(client models.Client) time.Duration {
+	if client.RefreshTTL > 0 {
+		return client.RefreshTTL
+	}
+
+	return t.refreshTTL
+}
+
+func (t *TokenManager) NewAccessToken(_ context.Context, userID int32, client models.Client) (string, error) {
 	const f = "tokens.NewAccessToken"
 
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
 		Subject:   fmt.Sprintf("%d", userID),
 		IssuedAt:  time.Now().Unix(),
-		ExpiresAt: time.Now().Add(t.accessTTL).Unix(),
+		ExpiresAt: time.Now().Add(t.AccessTTL(client)).Unix(),
 	})
 
 	token, err := jwtToken.SignedString([]byte(t.secret))
@@ -79,7 +127,9 @@ func (t *TokenManager) NewAccessToken(_ context.Context, userID int32) (string,
 	return token, nil
 }
 
-func (t *TokenManager) NewRefreshToken(ctx context.Context, userID int32, fingerprint string) (string, error) {
+// NewRefreshToken saves the token with the client it was issued to and the scope granted
+// to it, the scope is empty for first-party sessions
+func (t *TokenManager) NewRefreshToken(ctx context.Context, userID int32, fingerprint string, client models.Client, scope string) (string, error) {
 	const f = "tokens.NewRefreshToken"
 
 	log := t.log.With(slog.String("func", f))
@@ -97,7 +147,7 @@ func (t *TokenManager) NewRefreshToken(ctx context.Context, userID int32, finger
 	refreshToken := base64.URLEncoding.EncodeToString(b)
 
 	// save token
-	err = t.refreshTokenSetter.Set(ctx, userID, fingerprint, refreshToken, t.refreshTTL)
+	err = t.refreshTokenSetter.Set(ctx, userID, fingerprint, client.ClientID, scope, refreshToken, t.refreshTTLFor(client))
 	if err != nil {
 		log.Error("failed to save refresh token", l.Err(err))
 
@@ -109,17 +159,24 @@ func (t *TokenManager) NewRefreshToken(ctx context.Context, userID int32, finger
 	return refreshToken, nil
 }
 
-func (t *TokenManager) ValidateRefreshToken(ctx context.Context, token, fingerprint string) (int32, error) {
+// Refresh is what a valid refresh token tells about the session it belongs to
+type Refresh struct {
+	UserID   int32
+	ClientID string // empty for callers without a client id
+	Scope    string // granted to third-party clients only
+}
+
+func (t *TokenManager) ValidateRefreshToken(ctx context.Context, token, fingerprint string) (Refresh, error) {
 	const f = "tokens.ValidateRefreshToken"
 
 	log := t.log.With(slog.String("func", f))
 	log.Info("validating given refresh token", slog.String("refresh_token", token))
 
-	userIDStr, err := t.userGetter.UserID(ctx, token, fingerprint)
+	userIDStr, clientID, scope, err := t.userGetter.UserID(ctx, token, fingerprint)
 	if err != nil {
 		log.Error("failed to retrieve user ID for refresh token", l.Err(err))
 
-		return 0, fmt.Errorf("%s:%w", f, err)
+		return Refresh{}, fmt.Errorf("%s:%w", f, err)
 	}
 
 	// convert string to int32
@@ -127,12 +184,16 @@ func (t *TokenManager) ValidateRefreshToken(ctx context.Context, token, fingerpr
 	if err != nil {
 		log.Error("failed to parse user ID from string", l.Err(err))
 
-		return 0, fmt.Errorf("%s:%w", f, err)
+		return Refresh{}, fmt.Errorf("%s:%w", f, err)
 	}
 
-	log.Info("successfully validated refresh token", slog.Int("user_id", int(id)))
+	log.Info("successfully validated refresh token", slog.Int("user_id", int(id)), slog.String("client_id", clientID))
 
-	return int32(id), nil
+	return Refresh{
+		UserID:   int32(id),
+		ClientID: clientID,
+		Scope:    scope,
+	}, nil
 }
 
 func (t *TokenManager) ValidateAccessToken(ctx context.Context, token string) (int32, error) {
@@ -167,6 +228,14 @@ func (t *TokenManager) ValidateAccessToken(ctx context.Context, token string) (i
 		return 0, fmt.Errorf("%s:%w", f, err)
 	}
 
+	// restricted tokens and the tokens of third-party clients are signed
+	// with the same secret but never work as access tokens
+	if claims.Audience != "" || isClientAccess(accessToken) {
+		log.Warn("restricted token used as access token", slog.String("purpose", claims.Audience))
+
+		return 0, fmt.Errorf("%s:%w", f, ErrInvalidPurpose)
+	}
+
 	// convert string to int32
 	userID, err := strconv.ParseInt(claims.Subject, 10, 32)
 	if err != nil {
@@ -178,6 +247,224 @@ func (t *TokenManager) ValidateAccessToken(ctx context.Context, token string) (i
 	return int32(userID), nil
 }
 
+// ClientAccess is what a valid access token of a third-party client tells
+type ClientAccess struct {
+	UserID   int32
+	ClientID string
+	Scope    string
+}
+
+type clientAccessClaims struct {
+	jwt.StandardClaims
+	Scope string `json:"scope"`
+}
+
+// NewClientAccessToken issues an access token of a third-party client, it
+// works only at the provider's endpoints and carries the scope the user granted
+func (t *TokenManager) NewClientAccessToken(_ context.Context, userID int32, client models.Client, scope string) (string, error) {
+	const f = "tokens.NewClientAccessToken"
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, clientAccessClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   fmt.Sprintf("%d", userID),
+			Audience:  client.ClientID,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(t.AccessTTL(client)).Unix(),
+		},
+		Scope: scope,
+	})
+	jwtToken.Header["typ"] = typeClientAccess
+
+	token, err := jwtToken.SignedString([]byte(t.secret))
+	if err != nil {
+		t.log.Error("failed to sign client access token", l.Err(err), slog.String("client_id", client.ClientID))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return token, nil
+}
+
+func (t *TokenManager) ValidateClientAccessToken(_ context.Context, token string) (ClientAccess, error) {
+	const f = "tokens.ValidateClientAccessToken"
+
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(t.secret), nil
+	}
+
+	accessToken, err := jwt.ParseWithClaims(token, &clientAccessClaims{}, keyFunc)
+	if err != nil {
+		return ClientAccess{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	claims, ok := accessToken.Claims.(*clientAccessClaims)
+	if !ok || !accessToken.Valid {
+		return ClientAccess{}, fmt.Errorf("%s: invalid token claims", f)
+	}
+
+	// first-party, restricted and service tokens are signed with the same secret
+	if !isClientAccess(accessToken) || claims.Audience == "" {
+		return ClientAccess{}, fmt.Errorf("%s:%w", f, ErrInvalidPurpose)
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 32)
+	if err != nil {
+		return ClientAccess{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return ClientAccess{
+		UserID:   int32(userID),
+		ClientID: claims.Audience,
+		Scope:    claims.Scope,
+	}, nil
+}
+
+func isClientAccess(token *jwt.Token) bool {
+	return token.Header["typ"] == typeClientAccess
+}
+
+// Restricted is what a valid restricted token tells about the login it continues
+type Restricted struct {
+	UserID          int32
+	PasswordVersion int32  // the password version of the user when the token was issued
+	ClientID        string // empty for callers without a client id
+}
+
+type restrictedClaims struct {
+	jwt.StandardClaims
+	PasswordVersion int32  `json:"pwv"`
+	ClientID        string `json:"client_id,omitempty"`
+}
+
+// NewRestrictedToken issues a short-lived token that lets the user
+// do only the one thing the purpose names
+func (t *TokenManager) NewRestrictedToken(_ context.Context, user models.User, purpose, clientID string) (string, error) {
+	const f = "tokens.NewRestrictedToken"
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, restrictedClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   fmt.Sprintf("%d", user.ID),
+			Audience:  purpose,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(restrictedTTL).Unix(),
+		},
+		PasswordVersion: user.PasswordVersion,
+		ClientID:        clientID,
+	})
+
+	token, err := jwtToken.SignedString([]byte(t.secret))
+	if err != nil {
+		t.log.Error("failed to sign restricted token", l.Err(err), slog.Int("user_id", int(user.ID)))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return token, nil
+}
+
+func (t *TokenManager) ValidateRestrictedToken(_ context.Context, token, purpose string) (Restricted, error) {
+	const f = "tokens.ValidateRestrictedToken"
+
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(t.secret), nil
+	}
+
+	restricted, err := jwt.ParseWithClaims(token, &restrictedClaims{}, keyFunc)
+	if err != nil {
+		t.log.Warn("failed to parse restricted token", l.Err(err))
+
+		return Restricted{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	claims, ok := restricted.Claims.(*restrictedClaims)
+	if !ok || !restricted.Valid {
+		return Restricted{}, fmt.Errorf("%s: invalid token claims", f)
+	}
+
+	if claims.Audience != purpose || isClientAccess(restricted) {
+		t.log.Warn("restricted token used for another purpose", slog.String("purpose", claims.Audience))
+
+		return Restricted{}, fmt.Errorf("%s:%w", f, ErrInvalidPurpose)
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 32)
+	if err != nil {
+		return Restricted{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return Restricted{
+		UserID:          int32(userID),
+		PasswordVersion: claims.PasswordVersion,
+		ClientID:        claims.ClientID,
+	}, nil
+}
+
+type serviceClaims struct {
+	jwt.StandardClaims
+	Scope string `json:"scope"`
+}
+
+// NewServiceToken issues a short-lived token a service calls the RPCs with
+func (t *TokenManager) NewServiceToken(_ context.Context, client models.Client, scopes []string) (string, error) {
+	const f = "tokens.NewServiceToken"
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, serviceClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   client.ClientID,
+			Audience:  purposeService,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(t.ServiceTTL(client)).Unix(),
+		},
+		Scope: strings.Join(scopes, " "),
+	})
+
+	token, err := jwtToken.SignedString([]byte(t.secret))
+	if err != nil {
+		t.log.Error("failed to sign service token", l.Err(err), slog.String("client_id", client.ClientID))
+
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	return token, nil
+}
+
+func (t *TokenManager) ValidateServiceToken(_ context.Context, token string) (models.ServiceCaller, error) {
+	const f = "tokens.ValidateServiceToken"
+
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(t.secret), nil
+	}
+
+	serviceToken, err := jwt.ParseWithClaims(token, &serviceClaims{}, keyFunc)
+	if err != nil {
+		return models.ServiceCaller{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	claims, ok := serviceToken.Claims.(*serviceClaims)
+	if !ok || !serviceToken.Valid {
+		return models.ServiceCaller{}, fmt.Errorf("%s: invalid token claims", f)
+	}
+
+	// user and restricted tokens are signed with the same secret
+	if claims.Audience != purposeService || claims.Subject == "" || isClientAccess(serviceToken) {
+		return models.ServiceCaller{}, fmt.Errorf("%s:%w", f, ErrInvalidPurpose)
+	}
+
+	return models.ServiceCaller{
+		ClientID: claims.Subject,
+		Scopes:   strings.Fields(claims.Scope),
+	}, nil
+}
+
 func (t *TokenManager) Delete(ctx context.Context, userID int32, fingerprint string) error {
 	const f = "tokenManager.Delete"
 
@@ -186,3 +473,13 @@ func (t *TokenManager) Delete(ctx context.Context, userID int32, fingerprint str
 
 	return t.refreshTokenDeleter.Delete(ctx, userID, fingerprint)
 }
+
+// DeleteAll revokes every refresh token of the user
+func (t *TokenManager) DeleteAll(ctx context.Context, userID int32) error {
+	const f = "tokenManager.DeleteAll"
+
+	log := t.log.With(slog.String("func", f))
+	log.Info("Deleting all refresh tokens for user", slog.Int("user_id", int(userID)))
+
+	return t.refreshTokenDeleter.DeleteAll(ctx, userID)
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS trusted_devices (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    fingerprint_hash BYTEA NOT NULL, -- sha256 of the fingerprint sent on login
+    name VARCHAR(255) DEFAULT '' NOT NULL,
+    trusted_until TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    UNIQUE (user_id, fingerprint_hash)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified_at;
+ALTER TABLE users DROP COLUMN IF EXISTS phone;
\ No newline at end of file
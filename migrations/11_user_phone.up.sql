@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone VARCHAR(16); -- E.164, only stored once verified
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMP;
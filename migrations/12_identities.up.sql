@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL, -- the user's id at the provider
+    email VARCHAR(255) DEFAULT '' NOT NULL, -- as the provider reported it on linking
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
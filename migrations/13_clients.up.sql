@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS clients (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(255) DEFAULT '' NOT NULL, -- shown on the consent page
+    secret_hash BYTEA, -- sha256 of the generated secret, NULL for public clients
+    grant_types TEXT[] DEFAULT '{}' NOT NULL, -- "password", "authorization_code", "refresh_token"
+    redirect_uris TEXT[] DEFAULT '{}' NOT NULL,
+    scopes TEXT[] DEFAULT '{}' NOT NULL,
+    access_ttl_seconds INTEGER, -- NULL keeps the configured lifetime
+    refresh_ttl_seconds INTEGER,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_version INTEGER DEFAULT 0 NOT NULL;
\ No newline at end of file
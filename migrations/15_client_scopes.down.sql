@@ -0,0 +1 @@
+-- the scopes are kept, they are the ones the clients could request before
@@ -0,0 +1,2 @@
+-- an empty scope list used to let provider clients request every scope, now it allows none
+UPDATE clients SET scopes = '{openid,email}' WHERE scopes = '{}' AND 'authorization_code' = ANY(grant_types);
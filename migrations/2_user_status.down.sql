@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS index_email_pattern;
+ALTER TABLE users DROP COLUMN IF EXISTS status;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(16) DEFAULT 'active' NOT NULL;
+CREATE INDEX IF NOT EXISTS index_email_pattern ON users (email varchar_pattern_ops);
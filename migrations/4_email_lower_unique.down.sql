@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS index_email ON users (email);
+CREATE INDEX IF NOT EXISTS index_email_pattern ON users (email varchar_pattern_ops);
+DROP INDEX IF EXISTS index_email_lower_pattern;
+DROP INDEX IF EXISTS users_email_lower_key;
\ No newline at end of file
@@ -0,0 +1,27 @@
+-- cmd/emails normalizes the stored emails and reports the collisions before this runs,
+-- report every pair of accounts that still only differ in letter case,
+-- they have to be merged or renamed by hand before the constraint can be applied
+DO $$
+DECLARE
+    collisions TEXT;
+BEGIN
+    SELECT string_agg(format('%s (user ids: %s)', email, ids), E'\n')
+    INTO collisions
+    FROM (
+        SELECT lower(email) AS email, string_agg(id::TEXT, ', ' ORDER BY id) AS ids
+        FROM users
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) dups;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION E'case-insensitive email collisions found, run cmd/emails and resolve them before migrating:\n%', collisions;
+    END IF;
+END $$;
+
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
+CREATE INDEX IF NOT EXISTS index_email_lower_pattern ON users (lower(email) text_pattern_ops);
+DROP INDEX IF EXISTS index_email_pattern;
+DROP INDEX IF EXISTS index_email;
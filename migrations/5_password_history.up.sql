@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS password_history (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    pass_hash BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_password_history_user ON password_history (user_id, id DESC);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret BYTEA NOT NULL, -- encrypted, see pkg/secretbox
+    confirmed_at TIMESTAMP,
+    last_used_step BIGINT DEFAULT 0 NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
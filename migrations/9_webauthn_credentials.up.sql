@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL, -- COSE_Key
+    sign_count BIGINT DEFAULT 0 NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    last_used_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS index_webauthn_credentials_user ON webauthn_credentials (user_id);
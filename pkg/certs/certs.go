@@ -0,0 +1,189 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	l "github.com/kuromii5/miku-notes-auth/pkg/logger"
+)
+
+var ErrNoCACerts = errors.New("certs: no certificates in the CA bundle")
+
+// Reloader serves the server certificate and the client CA bundle from files
+// and picks up new ones when the files change, so certificates are rotated without a restart
+type Reloader struct {
+	log *slog.Logger
+
+	certFile     string
+	keyFile      string
+	clientCAFile string // empty when clients aren't verified
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTime  time.Time // latest modification time of the files
+
+	stop chan struct{}
+	once sync.Once
+}
+
+func New(log *slog.Logger, certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{
+		log:          log,
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		stop:         make(chan struct{}),
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Config returns the tls config of the server. With requireClientCert clients
+// without a certificate signed by the CA bundle are turned away, otherwise
+// their certificates are only verified when they send one.
+func (r *Reloader) Config(requireClientCert bool) *tls.Config {
+	clientAuth := tls.NoClientCert
+	if r.clientCAFile != "" {
+		clientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// every handshake gets the certificates loaded last
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   clientAuth,
+				ClientCAs:    r.clientCA,
+			}, nil
+		},
+	}
+}
+
+// Watch checks the files every interval and reloads them when they change.
+// A broken file is logged and the old certificates are kept.
+func (r *Reloader) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				modTime, err := r.latestModTime()
+				if err != nil {
+					r.log.Error("failed to stat certificates", l.Err(err))
+					continue
+				}
+
+				r.mu.RLock()
+				changed := !modTime.Equal(r.modTime)
+				r.mu.RUnlock()
+				if !changed {
+					continue
+				}
+
+				if err := r.load(); err != nil {
+					r.log.Error("failed to reload certificates", l.Err(err))
+					continue
+				}
+				r.log.Info("certificates reloaded")
+			}
+		}
+	}()
+}
+
+// Close stops watching the files
+func (r *Reloader) Close() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+func (r *Reloader) load() error {
+	// taken before reading, so a write during the load is picked up next time
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+
+	var clientCA *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("certs: %w", err)
+		}
+
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(pem) {
+			return ErrNoCACerts
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCA = clientCA
+	r.modTime = modTime
+
+	return nil
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("certs: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// Identity returns the identity of a client certificate: its SPIFFE ID,
+// or its first DNS name for certificates without one
+func Identity(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+
+	return ""
+}
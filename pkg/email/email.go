@@ -0,0 +1,85 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// provider describes how a mail provider routes addresses that look different
+type provider struct {
+	stripDots bool   // dots in the local part are ignored
+	tagSep    string // everything after this separator in the local part is ignored
+	domain    string // canonical domain if the provider has aliases
+}
+
+var providers = map[string]provider{
+	"gmail.com":      {stripDots: true, tagSep: "+", domain: "gmail.com"},
+	"googlemail.com": {stripDots: true, tagSep: "+", domain: "gmail.com"},
+	"outlook.com":    {tagSep: "+"},
+	"hotmail.com":    {tagSep: "+"},
+	"live.com":       {tagSep: "+"},
+	"icloud.com":     {tagSep: "+"},
+	"me.com":         {tagSep: "+"},
+	"proton.me":      {tagSep: "+"},
+	"protonmail.com": {tagSep: "+"},
+	"fastmail.com":   {tagSep: "+"},
+	"yahoo.com":      {tagSep: "-"},
+}
+
+type Normalizer struct {
+	providerRules bool
+}
+
+// New creates a normalizer. With providerRules enabled addresses are also
+// reduced to the mailbox they are delivered to, e.g. f.o.o+notes@gmail.com -> foo@gmail.com
+func New(providerRules bool) *Normalizer {
+	return &Normalizer{providerRules: providerRules}
+}
+
+// Normalize lowercases the address and converts IDN domains to punycode
+func (n *Normalizer) Normalize(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+
+	local := strings.ToLower(email[:at])
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(email[at+1:], "."))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	domain = strings.ToLower(domain)
+
+	if n.providerRules {
+		if p, ok := providers[domain]; ok {
+			local, domain = p.apply(local, domain)
+		}
+	}
+
+	if local == "" {
+		return "", ErrInvalidEmail
+	}
+
+	return local + "@" + domain, nil
+}
+
+func (p provider) apply(local, domain string) (string, string) {
+	if p.tagSep != "" {
+		local, _, _ = strings.Cut(local, p.tagSep)
+	}
+	if p.stripDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	if p.domain != "" {
+		domain = p.domain
+	}
+
+	return local, domain
+}
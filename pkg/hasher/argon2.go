@@ -0,0 +1,155 @@
+package hasher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2ID = "argon2id"
+
+var argon2Prefix = []byte("$" + argon2ID + "$")
+
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the second recommended option of RFC 9106
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Bounds for parameters read from stored hashes, anything outside of them is
+// either broken or makes a single verification cost too much
+const (
+	maxArgon2Memory      = 1024 * 1024 // 1 GiB
+	maxArgon2Iterations  = 16
+	maxArgon2Parallelism = 16
+	minArgon2SaltLength  = 8
+	maxArgon2SaltLength  = 64
+	minArgon2KeyLength   = 16
+	maxArgon2KeyLength   = 64
+)
+
+// Validate reports ErrInvalidHash if the parameters are out of the accepted bounds
+func (p Argon2Params) Validate() error {
+	switch {
+	case p.Iterations < 1 || p.Iterations > maxArgon2Iterations,
+		p.Parallelism < 1 || p.Parallelism > maxArgon2Parallelism,
+		p.Memory < 8*uint32(p.Parallelism) || p.Memory > maxArgon2Memory,
+		p.SaltLength < minArgon2SaltLength || p.SaltLength > maxArgon2SaltLength,
+		p.KeyLength < minArgon2KeyLength || p.KeyLength > maxArgon2KeyLength:
+		return ErrInvalidHash
+	}
+
+	return nil
+}
+
+// Argon2id stores hashes in PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type Argon2id struct {
+	params Argon2Params
+}
+
+func NewArgon2id(params Argon2Params) *Argon2id {
+	return &Argon2id{params: params}
+}
+
+func (a *Argon2id) Match(hash []byte) bool {
+	return bytes.HasPrefix(hash, argon2Prefix)
+}
+
+func (a *Argon2id) Hash(password []byte) ([]byte, error) {
+	salt := make([]byte, a.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	p := a.params
+	key := argon2.IDKey(password, salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return []byte(fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2ID,
+		argon2.Version,
+		p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+func (a *Argon2id) Verify(password, hash []byte) error {
+	p, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey(password, salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatchedPassword
+	}
+
+	return nil
+}
+
+func (a *Argon2id) Outdated(hash []byte) (bool, error) {
+	p, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return false, err
+	}
+
+	outdated := p.Memory != a.params.Memory ||
+		p.Iterations != a.params.Iterations ||
+		p.Parallelism != a.params.Parallelism ||
+		uint32(len(salt)) != a.params.SaltLength ||
+		uint32(len(key)) != a.params.KeyLength
+
+	return outdated, nil
+}
+
+func decodeArgon2(hash []byte) (Argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := bytes.Split(hash, []byte("$"))
+	if len(parts) != 6 || string(parts[1]) != argon2ID {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(string(parts[2]), "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var p Argon2Params
+	if _, err := fmt.Sscanf(string(parts[3]), "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(string(parts[4]))
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(string(parts[5]))
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	if err := p.Validate(); err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,71 @@
+package hasher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt uses modular crypt format hashes: $2a$10$<salt+key>.
+// It silently ignores password bytes past 72, so it's kept only to verify old hashes
+// and refuses to hash longer passwords.
+// maxBcryptCost keeps a single verification of a stored hash under a few seconds
+const maxBcryptCost = 16
+
+type Bcrypt struct {
+	cost int
+}
+
+func NewBcrypt(cost int) *Bcrypt {
+	return &Bcrypt{cost: cost}
+}
+
+func (b *Bcrypt) Match(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2a$")) ||
+		bytes.HasPrefix(hash, []byte("$2b$")) ||
+		bytes.HasPrefix(hash, []byte("$2y$"))
+}
+
+func (b *Bcrypt) Hash(password []byte) ([]byte, error) {
+	if b.cost > maxBcryptCost {
+		return nil, fmt.Errorf("bcrypt cost %d is above %d", b.cost, maxBcryptCost)
+	}
+
+	return bcrypt.GenerateFromPassword(password, b.cost)
+}
+
+func (b *Bcrypt) Verify(password, hash []byte) error {
+	if _, err := bcryptCost(hash); err != nil {
+		return err
+	}
+
+	err := bcrypt.CompareHashAndPassword(hash, password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatchedPassword
+	}
+
+	return err
+}
+
+func (b *Bcrypt) Outdated(hash []byte) (bool, error) {
+	cost, err := bcryptCost(hash)
+	if err != nil {
+		return false, err
+	}
+
+	return cost != b.cost, nil
+}
+
+func bcryptCost(hash []byte) (int, error) {
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return 0, err
+	}
+	if cost > maxBcryptCost {
+		return 0, ErrInvalidHash
+	}
+
+	return cost, nil
+}
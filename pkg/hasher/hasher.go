@@ -1,21 +1,151 @@
 package hasher
 
 import (
+	"errors"
 	"fmt"
+)
 
-	"golang.org/x/crypto/bcrypt"
+var (
+	ErrMismatchedPassword = errors.New("password doesn't match the hash")
+	ErrUnknownAlgorithm   = errors.New("hash was made with unknown algorithm")
+	ErrInvalidHash        = errors.New("hash is malformed")
 )
 
+// Algorithm is a single password hashing scheme
+type Algorithm interface {
+	// Match reports whether the encoded hash was made by this algorithm
+	Match(hash []byte) bool
+	Hash(password []byte) ([]byte, error)
+	Verify(password, hash []byte) error
+	// Outdated reports whether the hash was made with other parameters than the current ones
+	Outdated(hash []byte) (bool, error)
+}
+
+// Hasher hashes new passwords with the current algorithm and
+// still verifies hashes made by any of the older ones
+type Hasher struct {
+	current Algorithm
+	legacy  []Algorithm
+
+	// nil when passwords aren't peppered
+	peppers *Peppers
+}
+
+func New(current Algorithm, legacy ...Algorithm) *Hasher {
+	return NewPeppered(nil, current, legacy...)
+}
+
+// NewPeppered mixes the current pepper into every new hash.
+// Hashes made without a pepper or with an older one still verify.
+func NewPeppered(peppers *Peppers, current Algorithm, legacy ...Algorithm) *Hasher {
+	return &Hasher{
+		current: current,
+		legacy:  legacy,
+		peppers: peppers,
+	}
+}
+
 // convert password to hash string
-func HashPassword(password string) ([]byte, error) {
-	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (h *Hasher) HashPassword(password string) ([]byte, error) {
+	if h.peppers == nil {
+		hash, err := h.current.Hash([]byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password %w", err)
+		}
+		return hash, nil
+	}
+
+	peppered, err := h.peppers.apply(h.peppers.current, []byte(password))
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password %w", err)
 	}
-	return hashPassword, nil
+
+	hash, err := h.current.Hash(peppered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password %w", err)
+	}
+	return encodePeppered(h.peppers.current, hash), nil
 }
 
 // check password is valid or not
-func CheckPassword(password string, hashPassword []byte) error {
-	return bcrypt.CompareHashAndPassword(hashPassword, []byte(password))
+func (h *Hasher) CheckPassword(password string, hash []byte) error {
+	version, inner, err := splitPeppered(hash)
+	if err != nil {
+		return err
+	}
+
+	alg, err := h.algorithm(inner)
+	if err != nil {
+		return err
+	}
+
+	secret := []byte(password)
+	if version > 0 {
+		if h.peppers == nil {
+			return ErrUnknownPepper
+		}
+
+		if secret, err = h.peppers.apply(version, secret); err != nil {
+			return err
+		}
+	}
+
+	return alg.Verify(secret, inner)
+}
+
+// NeedsRehash reports whether the hash should be replaced with a fresh one
+// made by the current algorithm, parameters and pepper
+func (h *Hasher) NeedsRehash(hash []byte) bool {
+	version, inner, err := splitPeppered(hash)
+	if err != nil {
+		return true
+	}
+
+	// a rotated pepper is replaced the same way as an old algorithm
+	if h.peppers != nil && version != h.peppers.current {
+		return true
+	}
+
+	if !h.current.Match(inner) {
+		return true
+	}
+
+	outdated, err := h.current.Outdated(inner)
+
+	return err != nil || outdated
+}
+
+// Supports reports whether the hash can be verified by any known algorithm and pepper
+func (h *Hasher) Supports(hash []byte) bool {
+	version, inner, err := splitPeppered(hash)
+	if err != nil {
+		return false
+	}
+
+	if version > 0 {
+		if h.peppers == nil {
+			return false
+		}
+		if _, ok := h.peppers.keys[version]; !ok {
+			return false
+		}
+	}
+
+	_, err = h.algorithm(inner)
+
+	return err == nil
+}
+
+func (h *Hasher) algorithm(hash []byte) (Algorithm, error) {
+	if h.current.Match(hash) {
+		return h.current, nil
+	}
+
+	for _, alg := range h.legacy {
+		if alg.Match(hash) {
+			return alg, nil
+		}
+	}
+
+	return nil, ErrUnknownAlgorithm
 }
@@ -0,0 +1,197 @@
+package hasher_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kuromii5/miku-notes-auth/pkg/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cheap parameters, the tests check the formats and not the cost
+var testArgon2Params = hasher.Argon2Params{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestAlgorithms_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		alg    hasher.Algorithm
+		prefix string
+	}{
+		{name: "argon2id", alg: hasher.NewArgon2id(testArgon2Params), prefix: "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{name: "bcrypt", alg: hasher.NewBcrypt(4), prefix: "$2a$04$"},
+		{name: "sha256", alg: hasher.NewSaltedSHA256(), prefix: "$sha256$"},
+		{name: "pbkdf2-sha1", alg: hasher.NewPBKDF2("sha1", 1000), prefix: "$pbkdf2-sha1$i=1000$"},
+		{name: "pbkdf2-sha256", alg: hasher.NewPBKDF2("sha256", 1000), prefix: "$pbkdf2-sha256$i=1000$"},
+		{name: "pbkdf2-sha512", alg: hasher.NewPBKDF2("sha512", 1000), prefix: "$pbkdf2-sha512$i=1000$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			hash, err := tt.alg.Hash([]byte("Violet-Harbor-Lantern-41"))
+			require.NoError(t, err)
+			assert.True(t, bytes.HasPrefix(hash, []byte(tt.prefix)), "hash %s", hash)
+			assert.True(t, tt.alg.Match(hash))
+
+			assert.NoError(t, tt.alg.Verify([]byte("Violet-Harbor-Lantern-41"), hash))
+			assert.ErrorIs(t, tt.alg.Verify([]byte("violet-harbor-lantern-41"), hash), hasher.ErrMismatchedPassword)
+
+			// salts are random, so the same password never gives the same hash
+			other, err := tt.alg.Hash([]byte("Violet-Harbor-Lantern-41"))
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, other)
+		})
+	}
+}
+
+func TestAlgorithms_Match(t *testing.T) {
+	t.Parallel()
+
+	hashes := map[string][]byte{
+		"argon2id": []byte("$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5"),
+		"bcrypt":   []byte("$2b$04$abcdefghijklmnopqrstuu5s2v8.iXieOjg/.AySBTTZIIVFJeBui"),
+		"sha256":   []byte("$sha256$c2FsdA$ZGlnZXN0"),
+		"pbkdf2":   []byte("$pbkdf2-sha256$i=1000$c2FsdA$a2V5"),
+		"unknown":  []byte("5f4dcc3b5aa765d61d8327deb882cf99"),
+	}
+
+	algorithms := map[string]hasher.Algorithm{
+		"argon2id": hasher.NewArgon2id(testArgon2Params),
+		"bcrypt":   hasher.NewBcrypt(4),
+		"sha256":   hasher.NewSaltedSHA256(),
+		"pbkdf2":   hasher.NewPBKDF2("sha256", 1000),
+	}
+
+	// every hash is claimed by its own algorithm only
+	for hashName, hash := range hashes {
+		for algName, alg := range algorithms {
+			assert.Equal(t, hashName == algName, alg.Match(hash), "%s matching %s", algName, hashName)
+		}
+	}
+}
+
+func TestArgon2id_RejectsOutOfRangeParams(t *testing.T) {
+	t.Parallel()
+
+	salt := "c2FsdHNhbHRzYWx0c2FsdA"                     // 16 bytes
+	key := "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U" // 32 bytes
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "zero iterations", hash: "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key},
+		{name: "zero parallelism", hash: "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key},
+		{name: "too many iterations", hash: "$argon2id$v=19$m=1024,t=4294967295,p=1$" + salt + "$" + key},
+		{name: "too much parallelism", hash: "$argon2id$v=19$m=1024,t=1,p=255$" + salt + "$" + key},
+		{name: "too much memory", hash: "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key},
+		{name: "short salt", hash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$" + key},
+		{name: "short key", hash: "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$a2V5"},
+		{name: "empty key", hash: "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			alg := hasher.NewArgon2id(testArgon2Params)
+			assert.ErrorIs(t, alg.Verify([]byte("password"), []byte(tt.hash)), hasher.ErrInvalidHash)
+
+			_, err := alg.Outdated([]byte(tt.hash))
+			assert.ErrorIs(t, err, hasher.ErrInvalidHash)
+		})
+	}
+}
+
+func TestHasher_VerifiesLegacyHashes(t *testing.T) {
+	t.Parallel()
+
+	argon := hasher.NewArgon2id(testArgon2Params)
+	h := hasher.New(argon, hasher.NewBcrypt(4), hasher.NewSaltedSHA256(), hasher.NewPBKDF2("sha256", 1000))
+
+	legacy := []hasher.Algorithm{hasher.NewBcrypt(4), hasher.NewSaltedSHA256(), hasher.NewPBKDF2("sha1", 1000)}
+	for _, alg := range legacy {
+		hash, err := alg.Hash([]byte("Violet-Harbor-Lantern-41"))
+		require.NoError(t, err)
+
+		assert.True(t, h.Supports(hash), "%s", hash)
+		assert.NoError(t, h.CheckPassword("Violet-Harbor-Lantern-41", hash), "%s", hash)
+		assert.ErrorIs(t, h.CheckPassword("wrong password", hash), hasher.ErrMismatchedPassword, "%s", hash)
+	}
+
+	// a format no algorithm knows is refused, not treated as a mismatch
+	unknown := []byte("5f4dcc3b5aa765d61d8327deb882cf99")
+	assert.False(t, h.Supports(unknown))
+	assert.ErrorIs(t, h.CheckPassword("password", unknown), hasher.ErrUnknownAlgorithm)
+
+	// bcrypt isn't one of the algorithms of this hasher
+	onlyArgon := hasher.New(argon)
+	bcryptHash, err := hasher.NewBcrypt(4).Hash([]byte("password"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, onlyArgon.CheckPassword("password", bcryptHash), hasher.ErrUnknownAlgorithm)
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	t.Parallel()
+
+	argon := hasher.NewArgon2id(testArgon2Params)
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+
+	hash := func(alg hasher.Algorithm) []byte {
+		t.Helper()
+
+		hash, err := alg.Hash([]byte("password"))
+		require.NoError(t, err)
+
+		return hash
+	}
+
+	tests := []struct {
+		name    string
+		current hasher.Algorithm
+		hash    []byte
+		rehash  bool
+	}{
+		{name: "current algorithm and parameters", current: argon, hash: hash(argon), rehash: false},
+		{name: "older argon2id parameters", current: hasher.NewArgon2id(stronger), hash: hash(argon), rehash: true},
+		{name: "bcrypt with the current cost", current: hasher.NewBcrypt(4), hash: hash(hasher.NewBcrypt(4)), rehash: false},
+		{name: "bcrypt with another cost", current: hasher.NewBcrypt(5), hash: hash(hasher.NewBcrypt(4)), rehash: true},
+		{name: "bcrypt when argon2id is current", current: argon, hash: hash(hasher.NewBcrypt(4)), rehash: true},
+		{name: "argon2id when bcrypt is current", current: hasher.NewBcrypt(4), hash: hash(argon), rehash: true},
+		{name: "imported sha256", current: argon, hash: hash(hasher.NewSaltedSHA256()), rehash: true},
+		{name: "imported pbkdf2", current: argon, hash: hash(hasher.NewPBKDF2("sha512", 1000)), rehash: true},
+		{name: "malformed argon2id", current: argon, hash: []byte("$argon2id$v=19$broken"), rehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := hasher.New(tt.current, hasher.NewBcrypt(4), argon, hasher.NewSaltedSHA256(), hasher.NewPBKDF2("sha256", 1000))
+			assert.Equal(t, tt.rehash, h.NeedsRehash(tt.hash))
+		})
+	}
+}
+
+func TestHasher_HashPasswordUsesCurrent(t *testing.T) {
+	t.Parallel()
+
+	h := hasher.New(hasher.NewArgon2id(testArgon2Params), hasher.NewBcrypt(4))
+
+	hash, err := h.HashPassword("Violet-Harbor-Lantern-41")
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(hash, []byte("$argon2id$")))
+	assert.False(t, h.NeedsRehash(hash))
+	assert.NoError(t, h.CheckPassword("Violet-Harbor-Lantern-41", hash))
+}
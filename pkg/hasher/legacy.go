@@ -0,0 +1,191 @@
+package hasher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Legacy algorithms are only here to verify hashes imported from other apps,
+// such hashes are replaced with the current algorithm on the first login.
+
+const (
+	saltedSHA256ID = "sha256"
+	legacySaltSize = 16
+
+	// bounds for parameters of imported pbkdf2 hashes, a single verification
+	// with more work than this would stall the login handler
+	maxPBKDF2Iterations = 10_000_000
+	maxPBKDF2KeyLength  = 64
+)
+
+// SaltedSHA256 is a single round of sha256(salt || password):
+// $sha256$<salt>$<digest>
+type SaltedSHA256 struct{}
+
+func NewSaltedSHA256() *SaltedSHA256 {
+	return &SaltedSHA256{}
+}
+
+// EncodeSaltedSHA256 builds the tagged hash from a foreign salt and digest
+func EncodeSaltedSHA256(salt, digest []byte) []byte {
+	return []byte(fmt.Sprintf("$%s$%s$%s",
+		saltedSHA256ID,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(digest),
+	))
+}
+
+func (s *SaltedSHA256) Match(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$"+saltedSHA256ID+"$"))
+}
+
+func (s *SaltedSHA256) Hash(password []byte) ([]byte, error) {
+	salt := make([]byte, legacySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return EncodeSaltedSHA256(salt, saltedSum(salt, password)), nil
+}
+
+func (s *SaltedSHA256) Verify(password, hash []byte) error {
+	// "", "sha256", salt, digest
+	parts := bytes.Split(hash, []byte("$"))
+	if len(parts) != 4 {
+		return ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(string(parts[2]))
+	if err != nil {
+		return ErrInvalidHash
+	}
+	digest, err := base64.RawStdEncoding.DecodeString(string(parts[3]))
+	if err != nil {
+		return ErrInvalidHash
+	}
+
+	if subtle.ConstantTimeCompare(digest, saltedSum(salt, password)) != 1 {
+		return ErrMismatchedPassword
+	}
+
+	return nil
+}
+
+func (s *SaltedSHA256) Outdated([]byte) (bool, error) {
+	return true, nil
+}
+
+func saltedSum(salt, password []byte) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write(password)
+
+	return h.Sum(nil)
+}
+
+var pbkdf2Digests = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// PBKDF2 supports sha1, sha256 and sha512 digests:
+// $pbkdf2-<digest>$i=<iterations>$<salt>$<key>
+type PBKDF2 struct {
+	digest     string
+	iterations int
+}
+
+// NewPBKDF2 verifies hashes made with any digest, the digest and
+// iterations given here are used only to make new hashes
+func NewPBKDF2(digest string, iterations int) *PBKDF2 {
+	return &PBKDF2{digest: digest, iterations: iterations}
+}
+
+// EncodePBKDF2 builds the tagged hash from foreign parameters, salt and derived key
+func EncodePBKDF2(digest string, iterations int, salt, key []byte) ([]byte, error) {
+	if _, ok := pbkdf2Digests[digest]; !ok {
+		return nil, fmt.Errorf("%w: unsupported pbkdf2 digest %q", ErrUnknownAlgorithm, digest)
+	}
+	if iterations <= 0 || iterations > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("%w: pbkdf2 iterations must be between 1 and %d", ErrInvalidHash, maxPBKDF2Iterations)
+	}
+	if len(key) == 0 || len(key) > maxPBKDF2KeyLength {
+		return nil, fmt.Errorf("%w: pbkdf2 key must be up to %d bytes", ErrInvalidHash, maxPBKDF2KeyLength)
+	}
+
+	return []byte(fmt.Sprintf("$pbkdf2-%s$i=%d$%s$%s",
+		digest,
+		iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+func (p *PBKDF2) Match(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$pbkdf2-"))
+}
+
+func (p *PBKDF2) Hash(password []byte) ([]byte, error) {
+	newHash, ok := pbkdf2Digests[p.digest]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported pbkdf2 digest %q", ErrUnknownAlgorithm, p.digest)
+	}
+
+	salt := make([]byte, legacySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := pbkdf2.Key(password, salt, p.iterations, newHash().Size(), newHash)
+
+	return EncodePBKDF2(p.digest, p.iterations, salt, key)
+}
+
+func (p *PBKDF2) Verify(password, hash []byte) error {
+	// "", "pbkdf2-<digest>", "i=<iterations>", salt, key
+	parts := bytes.Split(hash, []byte("$"))
+	if len(parts) != 5 {
+		return ErrInvalidHash
+	}
+
+	newHash, ok := pbkdf2Digests[string(bytes.TrimPrefix(parts[1], []byte("pbkdf2-")))]
+	if !ok {
+		return ErrUnknownAlgorithm
+	}
+
+	iterations, err := strconv.Atoi(string(bytes.TrimPrefix(parts[2], []byte("i="))))
+	if err != nil || iterations <= 0 || iterations > maxPBKDF2Iterations {
+		return ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(string(parts[3]))
+	if err != nil {
+		return ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(string(parts[4]))
+	if err != nil || len(key) == 0 || len(key) > maxPBKDF2KeyLength {
+		return ErrInvalidHash
+	}
+
+	other := pbkdf2.Key(password, salt, iterations, len(key), newHash)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatchedPassword
+	}
+
+	return nil
+}
+
+func (p *PBKDF2) Outdated([]byte) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,97 @@
+package hasher_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/kuromii5/miku-notes-auth/pkg/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+
+	return b
+}
+
+func TestSaltedSHA256_KnownAnswers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		salt     string
+		password string
+		digest   string // sha256(salt || password)
+	}{
+		{salt: hex.EncodeToString([]byte("salt")), password: "password", digest: "13601bda4ea78e55a07b98866d2be6be0744e3866f13c00c811cab608a28f322"},
+		{salt: "00112233445566778899aabbccddeeff", password: "correct horse", digest: "45696a7b84e9eb106109744e5fbfb29e78e426967c48f3b00e9e90ea602e5e3d"},
+	}
+
+	alg := hasher.NewSaltedSHA256()
+	for _, tt := range tests {
+		hash := hasher.EncodeSaltedSHA256(mustHex(t, tt.salt), mustHex(t, tt.digest))
+
+		assert.True(t, alg.Match(hash))
+		assert.NoError(t, alg.Verify([]byte(tt.password), hash), "%s", hash)
+		assert.ErrorIs(t, alg.Verify([]byte(tt.password+"!"), hash), hasher.ErrMismatchedPassword)
+	}
+}
+
+// vectors of RFC 6070 for sha1, the same inputs for sha256 and sha512
+func TestPBKDF2_KnownAnswers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		digest     string
+		iterations int
+		key        string
+	}{
+		{digest: "sha1", iterations: 1, key: "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{digest: "sha1", iterations: 2, key: "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{digest: "sha1", iterations: 4096, key: "4b007901b765489abead49d926f721d065a429c1"},
+		{digest: "sha256", iterations: 1, key: "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{digest: "sha256", iterations: 4096, key: "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{digest: "sha512", iterations: 1, key: "867f70cf1ade02cff3752599a3a53dc4af34c7a669815ae5d513554e1c8cf252c02d470a285a0501bad999bfe943c08f050235d7d68b1da55e63f73b60a57fce"},
+		{digest: "sha512", iterations: 4096, key: "d197b1b33db0143e018b12f3d1d1479e6cdebdcc97c5c0f87f6902e072f457b5143f30602641b3d55cd335988cb36b84376060ecd532e039b742a239434af2d5"},
+	}
+
+	// the digest and iterations of the verifier only matter for new hashes
+	alg := hasher.NewPBKDF2("sha256", 1000)
+	for _, tt := range tests {
+		hash, err := hasher.EncodePBKDF2(tt.digest, tt.iterations, []byte("salt"), mustHex(t, tt.key))
+		require.NoError(t, err)
+
+		assert.True(t, alg.Match(hash))
+		assert.NoError(t, alg.Verify([]byte("password"), hash), "%s", hash)
+		assert.ErrorIs(t, alg.Verify([]byte("passwORD"), hash), hasher.ErrMismatchedPassword)
+	}
+}
+
+func TestLegacy_MalformedHashes(t *testing.T) {
+	t.Parallel()
+
+	_, err := hasher.EncodePBKDF2("md5", 1000, []byte("salt"), []byte("key"))
+	assert.ErrorIs(t, err, hasher.ErrUnknownAlgorithm)
+	_, err = hasher.EncodePBKDF2("sha256", 0, []byte("salt"), []byte("key"))
+	assert.ErrorIs(t, err, hasher.ErrInvalidHash)
+
+	pbkdf2 := hasher.NewPBKDF2("sha256", 1000)
+	for hash, want := range map[string]error{
+		"$pbkdf2-md5$i=1000$c2FsdA$a2V5": hasher.ErrUnknownAlgorithm,
+		"$pbkdf2-sha256$i=0$c2FsdA$a2V5": hasher.ErrInvalidHash,
+		"$pbkdf2-sha256$i=x$c2FsdA$a2V5": hasher.ErrInvalidHash,
+		"$pbkdf2-sha256$i=1000$c2FsdA":   hasher.ErrInvalidHash,
+		"$pbkdf2-sha256$i=1000$c2FsdA$":  hasher.ErrInvalidHash,
+		"$pbkdf2-sha256$i=1000$!!!$a2V5": hasher.ErrInvalidHash,
+	} {
+		assert.ErrorIs(t, pbkdf2.Verify([]byte("password"), []byte(hash)), want, hash)
+	}
+
+	sha := hasher.NewSaltedSHA256()
+	for _, hash := range []string{"$sha256$c2FsdA", "$sha256$!!!$ZGlnZXN0", "$sha256$c2FsdA$!!!"} {
+		assert.ErrorIs(t, sha.Verify([]byte("password"), []byte(hash)), hasher.ErrInvalidHash, hash)
+	}
+}
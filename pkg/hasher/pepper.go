@@ -0,0 +1,132 @@
+package hasher
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrUnknownPepper = errors.New("hash was made with unknown pepper version")
+
+// minPepperLength is the shortest accepted pepper key in bytes
+const minPepperLength = 32
+
+// peppered hashes wrap the inner hash with the pepper version:
+// $pepper$v=2$$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+var pepperPrefix = []byte("$pepper$v=")
+
+// Peppers hold the server-side HMAC keys by version. Only the current one is used
+// for new hashes, older ones are kept to verify hashes until users log in again.
+type Peppers struct {
+	current int
+	keys    map[int][]byte
+}
+
+// NewPeppers uses the given version for new hashes, 0 picks the newest one
+func NewPeppers(current int, keys map[int][]byte) (*Peppers, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no pepper keys")
+	}
+
+	var newest int
+	for version, key := range keys {
+		if version <= 0 {
+			return nil, fmt.Errorf("invalid pepper version %d", version)
+		}
+		if len(key) < minPepperLength {
+			return nil, fmt.Errorf("pepper %d is shorter than %d bytes", version, minPepperLength)
+		}
+
+		newest = max(newest, version)
+	}
+
+	if current == 0 {
+		current = newest
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("no key for current pepper version %d", current)
+	}
+
+	return &Peppers{current: current, keys: keys}, nil
+}
+
+// ParsePeppers reads "version:base64 key" entries, blank lines and # comments are skipped
+func ParsePeppers(entries []string) (map[int][]byte, error) {
+	keys := make(map[int][]byte, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		rawVersion, rawKey, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, errors.New("pepper must look like version:key")
+		}
+
+		version, err := strconv.Atoi(strings.TrimSpace(rawVersion))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pepper version %q", rawVersion)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rawKey))
+		if err != nil {
+			return nil, fmt.Errorf("pepper %d is not valid base64", version)
+		}
+
+		if _, ok := keys[version]; ok {
+			return nil, fmt.Errorf("pepper %d is defined twice", version)
+		}
+		keys[version] = key
+	}
+
+	return keys, nil
+}
+
+// apply mixes the pepper into the password. The MAC is base64 encoded,
+// so it has no zero bytes and fits into bcrypt's 72 bytes.
+func (p *Peppers) apply(version int, password []byte) ([]byte, error) {
+	key, ok := p.keys[version]
+	if !ok {
+		return nil, ErrUnknownPepper
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(password)
+	sum := mac.Sum(nil)
+
+	encoded := make([]byte, base64.RawStdEncoding.EncodedLen(len(sum)))
+	base64.RawStdEncoding.Encode(encoded, sum)
+
+	return encoded, nil
+}
+
+func encodePeppered(version int, inner []byte) []byte {
+	return append([]byte(fmt.Sprintf("%s%d$", pepperPrefix, version)), inner...)
+}
+
+// splitPeppered returns the pepper version and the inner hash,
+// version is 0 for hashes made without a pepper
+func splitPeppered(hash []byte) (int, []byte, error) {
+	if !bytes.HasPrefix(hash, pepperPrefix) {
+		return 0, hash, nil
+	}
+
+	rest := hash[len(pepperPrefix):]
+	end := bytes.IndexByte(rest, '$')
+	if end <= 0 {
+		return 0, nil, ErrInvalidHash
+	}
+
+	version, err := strconv.Atoi(string(rest[:end]))
+	if err != nil || version <= 0 {
+		return 0, nil, ErrInvalidHash
+	}
+
+	return version, rest[end+1:], nil
+}
@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP sends plain text messages through a mail server
+type SMTP struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP creates a sender, messages are sent without authentication when username is empty
+func NewSMTP(host string, port int, username, password, from string) *SMTP {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTP{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		host: host,
+		from: from,
+		auth: auth,
+	}
+}
+
+func (s *SMTP) Send(_ context.Context, to, subject, body string) error {
+	const f = "mail.Send"
+
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{to}, message(s.from, to, subject, body)); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+// Outbox writes messages to files instead of sending them, for development and tests.
+// Every message is a separate "<unix nano>-<recipient>.eml" file.
+type Outbox struct {
+	dir  string
+	from string
+}
+
+func NewOutbox(dir, from string) *Outbox {
+	return &Outbox{dir: dir, from: from}
+}
+
+func (o *Outbox) Send(_ context.Context, to, subject, body string) error {
+	const f = "mail.Outbox.Send"
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), filepath.Base(to))
+	if err := os.WriteFile(filepath.Join(o.dir, name), message(o.from, to, subject, body), 0o600); err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	return nil
+}
+
+func message(from, to, subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
@@ -0,0 +1,233 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// FakeProvider is an in-process OpenID Connect provider, for tests.
+// It approves every authorization request for the user named by the "sub", "email"
+// and "email_verified" parameters the test adds to the authorization url.
+type FakeProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	mux *http.ServeMux
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	keyID  string
+	keyN   int // how many keys the provider had, names the next one
+	grants map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	redirectURI   string
+	challenge     string
+	nonce         string
+	subject       string
+	email         string
+	emailVerified bool
+}
+
+func NewFakeProvider(issuer, clientID, clientSecret string) (*FakeProvider, error) {
+	p := &FakeProvider{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		mux:          http.NewServeMux(),
+		grants:       make(map[string]fakeGrant),
+	}
+
+	if err := p.RotateKey(); err != nil {
+		return nil, err
+	}
+
+	p.mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	p.mux.HandleFunc("/authorize", p.authorize)
+	p.mux.HandleFunc("/token", p.token)
+	p.mux.HandleFunc("/jwks", p.jwks)
+
+	return p, nil
+}
+
+// RotateKey replaces the signing key with one under a new key id,
+// the key set only has the new one from then on
+func (p *FakeProvider) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keyN++
+	p.key = key
+	p.keyID = fmt.Sprintf("test-key-%d", p.keyN)
+
+	return nil
+}
+
+// IDToken signs the claims with the current key. The issuer, the audience and
+// the lifetime are the provider's unless the claims have their own.
+func (p *FakeProvider) IDToken(claims map[string]any) (string, error) {
+	now := time.Now()
+	mapClaims := jwt.MapClaims{
+		"iss": p.Issuer,
+		"aud": p.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		mapClaims[k] = v
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, mapClaims)
+	token.Header["kid"] = p.keyID
+
+	return token.SignedString(p.key)
+}
+
+func (p *FakeProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+func (p *FakeProvider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                 p.Issuer,
+		"authorization_endpoint": p.Issuer + "/authorize",
+		"token_endpoint":         p.Issuer + "/token",
+		"jwks_uri":               p.Issuer + "/jwks",
+	})
+}
+
+// authorize skips the login page and sends the user back with a code right away
+func (p *FakeProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("response_type") != "code" || query.Get("client_id") != p.ClientID ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect uri", http.StatusBadRequest)
+		return
+	}
+
+	emailVerified, err := strconv.ParseBool(query.Get("email_verified"))
+	if err != nil {
+		emailVerified = true
+	}
+
+	code := fakeToken()
+
+	p.mu.Lock()
+	p.grants[code] = fakeGrant{
+		redirectURI:   query.Get("redirect_uri"),
+		challenge:     query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		subject:       query.Get("sub"),
+		email:         query.Get("email"),
+		emailVerified: emailVerified,
+	}
+	p.mu.Unlock()
+
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", query.Get("state"))
+	redirect.RawQuery = back.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *FakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if !ok || clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// codes work once
+	p.mu.Lock()
+	grant, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || grant.redirectURI != r.PostForm.Get("redirect_uri") ||
+		CodeChallenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := p.IDToken(map[string]any{
+		"sub":            grant.subject,
+		"email":          grant.email,
+		"email_verified": grant.emailVerified,
+		"nonce":          grant.nonce,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": fakeToken(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (p *FakeProvider) jwks(w http.ResponseWriter, _ *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func fakeToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
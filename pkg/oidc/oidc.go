@@ -0,0 +1,468 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrDiscovery      = errors.New("failed to discover provider endpoints")
+	ErrExchange       = errors.New("provider refused the authorization code")
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrUserInfo       = errors.New("failed to get user info")
+)
+
+// keys are fetched again for an unknown kid, but not more often than this
+const jwksRefreshInterval = time.Minute
+
+// Config describes one provider. OpenID Connect providers only need the issuer,
+// the endpoints are discovered. Plain OAuth2 providers, like GitHub, need the
+// endpoints and are identified through the user info endpoint instead of an id token.
+type Config struct {
+	Issuer string
+
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// the user info endpoint only returns emails the provider has verified
+	EmailsVerified bool
+}
+
+// Token is the answer of the token endpoint
+type Token struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+}
+
+// Claims identify the user at the provider
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu sync.Mutex
+	// discovered on first use
+	endpoints *discovery
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func New(cfg Config, timeout time.Duration) *Client {
+	return &Client{
+		cfg:  cfg,
+		http: &http.Client{Timeout: timeout},
+	}
+}
+
+// AuthCodeURL returns the page the user is sent to, the code challenge is the S256 one
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	const f = "oidc.AuthCodeURL"
+
+	endpoints, err := c.discover(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	u, err := url.Parse(endpoints.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", f, err)
+	}
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.cfg.ClientID)
+	query.Set("redirect_uri", c.cfg.RedirectURL)
+	query.Set("scope", strings.Join(c.scopes(), " "))
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	if c.cfg.Issuer != "" {
+		query.Set("nonce", nonce)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange trades the authorization code for tokens
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier string) (Token, error) {
+	const f = "oidc.Exchange"
+
+	endpoints, err := c.discover(ctx)
+	if err != nil {
+		return Token{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, fmt.Errorf("%s:%w", f, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	var token Token
+	if err := c.do(req, &token); err != nil {
+		return Token{}, fmt.Errorf("%s:%w: %v", f, ErrExchange, err)
+	}
+	if token.AccessToken == "" {
+		return Token{}, fmt.Errorf("%s:%w: no access token", f, ErrExchange)
+	}
+
+	return token, nil
+}
+
+// Identify returns who logged in: from the id token for OpenID Connect providers,
+// from the user info endpoint for plain OAuth2 ones
+func (c *Client) Identify(ctx context.Context, token Token, nonce string) (Claims, error) {
+	if c.cfg.Issuer != "" {
+		return c.VerifyIDToken(ctx, token.IDToken, nonce)
+	}
+
+	return c.UserInfo(ctx, token.AccessToken)
+}
+
+// VerifyIDToken checks the signature against the provider's keys and the claims
+// against the client: issuer, audience, expiry and the nonce of the login
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	const f = "oidc.VerifyIDToken"
+
+	if rawIDToken == "" {
+		return Claims{}, fmt.Errorf("%s:%w: no id token", f, ErrInvalidIDToken)
+	}
+
+	endpoints, err := c.discover(ctx)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%s:%w", f, err)
+	}
+
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		return c.key(ctx, endpoints.JWKSURI, kid)
+	}
+
+	parser := jwt.Parser{ValidMethods: []string{"RS256", "ES256"}}
+	token, err := parser.ParseWithClaims(rawIDToken, jwt.MapClaims{}, keyFunc)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%s:%w: %v", f, ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return Claims{}, fmt.Errorf("%s:%w", f, ErrInvalidIDToken)
+	}
+
+	now := time.Now().Unix()
+	switch {
+	case !claims.VerifyIssuer(endpoints.Issuer, true):
+		return Claims{}, fmt.Errorf("%s:%w: issuer mismatch", f, ErrInvalidIDToken)
+	case !claims.VerifyAudience(c.cfg.ClientID, true):
+		return Claims{}, fmt.Errorf("%s:%w: audience mismatch", f, ErrInvalidIDToken)
+	case !claims.VerifyExpiresAt(now, true):
+		return Claims{}, fmt.Errorf("%s:%w: expired", f, ErrInvalidIDToken)
+	}
+
+	// a token from another login can't be replayed into this one
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return Claims{}, fmt.Errorf("%s:%w: nonce mismatch", f, ErrInvalidIDToken)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return Claims{}, fmt.Errorf("%s:%w: no subject", f, ErrInvalidIDToken)
+	}
+
+	email, _ := claims["email"].(string)
+
+	return Claims{
+		Subject:       subject,
+		Email:         email,
+		EmailVerified: verified(claims["email_verified"]),
+	}, nil
+}
+
+// UserInfo identifies the user with the access token, "sub" is used as the subject
+// and the numeric "id" of GitHub-like providers when there's none
+func (c *Client) UserInfo(ctx context.Context, accessToken string) (Claims, error) {
+	const f = "oidc.UserInfo"
+
+	endpoints, err := c.discover(ctx)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%s:%w", f, err)
+	}
+	if endpoints.UserInfoEndpoint == "" {
+		return Claims{}, fmt.Errorf("%s:%w: no user info endpoint", f, ErrUserInfo)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoints.UserInfoEndpoint, nil)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%s:%w", f, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var info struct {
+		Sub           string      `json:"sub"`
+		ID            json.Number `json:"id"`
+		Email         string      `json:"email"`
+		EmailVerified any         `json:"email_verified"`
+	}
+	if err := c.do(req, &info); err != nil {
+		return Claims{}, fmt.Errorf("%s:%w: %v", f, ErrUserInfo, err)
+	}
+
+	subject := info.Sub
+	if subject == "" {
+		subject = info.ID.String()
+	}
+	if subject == "" {
+		return Claims{}, fmt.Errorf("%s:%w: no subject", f, ErrUserInfo)
+	}
+
+	return Claims{
+		Subject:       subject,
+		Email:         info.Email,
+		EmailVerified: info.Email != "" && (c.cfg.EmailsVerified || verified(info.EmailVerified)),
+	}, nil
+}
+
+// CodeChallenge is the S256 PKCE challenge of the verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (c *Client) scopes() []string {
+	if len(c.cfg.Scopes) > 0 {
+		return c.cfg.Scopes
+	}
+	if c.cfg.Issuer != "" {
+		return []string{"openid", "email"}
+	}
+
+	return nil
+}
+
+// discover returns the configured endpoints, or the discovered ones for an issuer
+func (c *Client) discover(ctx context.Context) (*discovery, error) {
+	if c.cfg.Issuer == "" {
+		return &discovery{
+			AuthorizationEndpoint: c.cfg.AuthURL,
+			TokenEndpoint:         c.cfg.TokenURL,
+			UserInfoEndpoint:      c.cfg.UserInfoURL,
+		}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.endpoints != nil {
+		return c.endpoints, nil
+	}
+
+	wellKnown := strings.TrimSuffix(c.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var d discovery
+	if err := c.do(req, &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	// the document must be about the configured issuer, or its tokens could be anyone's
+	if d.Issuer != c.cfg.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q doesn't match", ErrDiscovery, d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: endpoints are missing", ErrDiscovery)
+	}
+
+	if c.cfg.UserInfoURL != "" {
+		d.UserInfoEndpoint = c.cfg.UserInfoURL
+	}
+	c.endpoints = &d
+
+	return c.endpoints, nil
+}
+
+// key finds the signing key, keys are fetched again when the provider rotated them
+func (c *Client) key(ctx context.Context, jwksURI, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(c.keysAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := c.do(req, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			// one odd key doesn't make the others unusable
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	c.keys = keys
+	c.keysAt = time.Now()
+
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	return key, nil
+}
+
+func (c *Client) do(req *http.Request, v any) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("provider answered %s", resp.Status)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// verified reads email_verified, which some providers send as a string
+func verified(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+
+	return false
+}
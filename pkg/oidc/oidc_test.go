@@ -0,0 +1,157 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testClientID     = "notes"
+	testClientSecret = "notes-secret"
+	testRedirectURL  = "https://notes.example.com/oauth/callback"
+	testNonce        = "nonce-of-the-login"
+)
+
+// startProvider serves a fake provider and returns a client configured for it
+func startProvider(t *testing.T) (*FakeProvider, *Client) {
+	t.Helper()
+
+	provider, err := NewFakeProvider("", testClientID, testClientSecret)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(provider)
+	t.Cleanup(server.Close)
+	provider.Issuer = server.URL
+
+	client := New(Config{
+		Issuer:       server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, 5*time.Second)
+
+	return provider, client
+}
+
+func TestClient_LoginFlow(t *testing.T) {
+	_, client := startProvider(t)
+	ctx := context.Background()
+
+	verifier := "code-verifier-of-the-login-with-enough-characters"
+	authURL, err := client.AuthCodeURL(ctx, "state", testNonce, CodeChallenge(verifier))
+	require.NoError(t, err)
+
+	// the fake logs in the user named in the url
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	query := u.Query()
+	query.Set("sub", "user-1")
+	query.Set("email", "miku@example.com")
+	u.RawQuery = query.Encode()
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirects.Get(u.String())
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	back, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "state", back.Query().Get("state"))
+
+	token, err := client.Exchange(ctx, back.Query().Get("code"), verifier)
+	require.NoError(t, err)
+
+	claims, err := client.Identify(ctx, token, testNonce)
+	require.NoError(t, err)
+	assert.Equal(t, Claims{Subject: "user-1", Email: "miku@example.com", EmailVerified: true}, claims)
+
+	// the code works once
+	_, err = client.Exchange(ctx, back.Query().Get("code"), verifier)
+	require.ErrorIs(t, err, ErrExchange)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider, client := startProvider(t)
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		nonce  string
+		ok     bool
+	}{
+		{name: "valid", claims: map[string]any{"sub": "user-1", "nonce": testNonce}, nonce: testNonce, ok: true},
+		{name: "another issuer", claims: map[string]any{"sub": "user-1", "nonce": testNonce, "iss": "https://evil.example.com"}, nonce: testNonce},
+		{name: "another audience", claims: map[string]any{"sub": "user-1", "nonce": testNonce, "aud": "other-app"}, nonce: testNonce},
+		{
+			name:   "audience list with the client",
+			claims: map[string]any{"sub": "user-1", "nonce": testNonce, "aud": []string{"other-app", testClientID}},
+			nonce:  testNonce,
+			ok:     true,
+		},
+		{name: "nonce of another login", claims: map[string]any{"sub": "user-1", "nonce": "other-nonce"}, nonce: testNonce},
+		{name: "no nonce", claims: map[string]any{"sub": "user-1"}, nonce: ""},
+		{name: "expired", claims: map[string]any{"sub": "user-1", "nonce": testNonce, "exp": time.Now().Add(-time.Minute).Unix()}, nonce: testNonce},
+		{name: "no subject", claims: map[string]any{"nonce": testNonce}, nonce: testNonce},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idToken, err := provider.IDToken(tt.claims)
+			require.NoError(t, err)
+
+			claims, err := client.VerifyIDToken(context.Background(), idToken, tt.nonce)
+			if !tt.ok {
+				require.ErrorIs(t, err, ErrInvalidIDToken)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", claims.Subject)
+		})
+	}
+}
+
+func TestVerifyIDToken_UnknownKeyRefetch(t *testing.T) {
+	provider, client := startProvider(t)
+	ctx := context.Background()
+
+	verify := func() error {
+		idToken, err := provider.IDToken(map[string]any{"sub": "user-1", "nonce": testNonce})
+		require.NoError(t, err)
+
+		_, err = client.VerifyIDToken(ctx, idToken, testNonce)
+
+		return err
+	}
+
+	require.NoError(t, verify())
+
+	// right after a fetch an unknown key id doesn't hit the provider again
+	require.NoError(t, provider.RotateKey())
+	require.ErrorIs(t, verify(), ErrInvalidIDToken)
+
+	// later the keys are fetched again and the rotated key is found
+	client.mu.Lock()
+	client.keysAt = time.Now().Add(-jwksRefreshInterval)
+	client.mu.Unlock()
+	require.NoError(t, verify())
+}
+
+func TestDiscover_IssuerMismatch(t *testing.T) {
+	provider, client := startProvider(t)
+
+	// the document names another issuer than the configured one
+	provider.Issuer = "https://evil.example.com"
+
+	_, err := client.VerifyIDToken(context.Background(), "token", testNonce)
+	require.ErrorIs(t, err, ErrDiscovery)
+}
@@ -0,0 +1,79 @@
+package pwned
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const prefixLength = 5
+
+// Checker looks passwords up in a local copy of the Have I Been Pwned
+// range dataset: a directory with one file per 5 character SHA-1 prefix
+// (e.g. "21BD1" or "21BD1.txt"), each line being "<35 char suffix>:<count>".
+// Only the hash prefix selects a file, so it works with any subset of the dataset.
+type Checker struct {
+	dir      string
+	minCount int
+}
+
+// New creates a checker, passwords seen less than minCount times are considered safe
+func New(dir string, minCount int) *Checker {
+	return &Checker{dir: dir, minCount: max(minCount, 1)}
+}
+
+// Breached reports whether the password appears in the dataset at least minCount times
+func (c *Checker) Breached(password string) (bool, error) {
+	const f = "pwned.Breached"
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	file, err := c.open(prefix)
+	if err != nil {
+		// missing range means none of its passwords are known to be breached
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, countStr, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+
+		count, err := strconv.Atoi(countStr)
+		if err != nil {
+			return false, fmt.Errorf("%s: malformed count in range %s: %w", f, prefix, err)
+		}
+
+		return count >= c.minCount, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("%s:%w", f, err)
+	}
+
+	return false, nil
+}
+
+func (c *Checker) open(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(c.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Open(filepath.Join(c.dir, prefix+".txt"))
+	}
+
+	return file, err
+}
@@ -0,0 +1,69 @@
+package pwned_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kuromii5/miku-notes-auth/pkg/pwned"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testdata/ranges holds a few ranges of the dataset:
+//
+//	5BAA6     "password", seen 9545824 times, next to suffixes of other passwords
+//	7C4A8.txt "123456" with a lowercase suffix and a CRLF line ending
+//	34D7C     "rarely seen", seen once
+//	0A9EE     "broken count" with a count that isn't a number
+//	F3BBB     the range of "hunter2" without its suffix
+const ranges = "testdata/ranges"
+
+func TestChecker_Breached(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		password string
+		minCount int
+		want     bool
+	}{
+		{name: "file without extension", password: "password", minCount: 1, want: true},
+		{name: "txt file, case and CRLF", password: "123456", minCount: 1, want: true},
+		{name: "seen once", password: "rarely seen", minCount: 1, want: true},
+		{name: "below threshold", password: "rarely seen", minCount: 2, want: false},
+		{name: "at threshold", password: "password", minCount: 9545824, want: true},
+		{name: "above count", password: "password", minCount: 9545825, want: false},
+		{name: "zero threshold means once", password: "rarely seen", minCount: 0, want: true},
+		{name: "suffix missing in range", password: "hunter2", minCount: 1, want: false},
+		{name: "range missing", password: "correct horse battery staple", minCount: 1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			breached, err := pwned.New(ranges, tt.minCount).Breached(tt.password)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, breached)
+		})
+	}
+}
+
+func TestChecker_MalformedCount(t *testing.T) {
+	t.Parallel()
+
+	_, err := pwned.New(ranges, 1).Breached("broken count")
+	assert.ErrorContains(t, err, "malformed count in range 0A9EE")
+}
+
+func TestChecker_UnreadableRange(t *testing.T) {
+	t.Parallel()
+
+	// a directory in place of the range file can't be read
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "5BAA6"), 0o755))
+
+	_, err := pwned.New(dir, 1).Breached("password")
+	assert.Error(t, err)
+}
@@ -0,0 +1,63 @@
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// KeyLength is the AES-256 key length in bytes
+const KeyLength = 32
+
+var ErrDecrypt = errors.New("failed to decrypt secret")
+
+// Box encrypts small secrets before they are stored in the database.
+// Output is the random nonce followed by the AES-GCM sealed data.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func New(key []byte) (*Box, error) {
+	if len(key) != KeyLength {
+		return nil, fmt.Errorf("secretbox: key must be %d bytes, got %d", KeyLength, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts plaintext, additional data (e.g. the user id) has to
+// match on Open, so a sealed value can't be moved to another row
+func (b *Box) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return b.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func (b *Box) Open(sealed, additionalData []byte) ([]byte, error) {
+	size := b.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := b.aead.Open(nil, sealed[:size], sealed[size:], additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
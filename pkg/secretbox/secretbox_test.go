@@ -0,0 +1,79 @@
+package secretbox_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kuromii5/miku-notes-auth/pkg/secretbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBox(t *testing.T, fill byte) *secretbox.Box {
+	t.Helper()
+
+	box, err := secretbox.New(bytes.Repeat([]byte{fill}, secretbox.KeyLength))
+	require.NoError(t, err)
+
+	return box
+}
+
+func TestBox_SealOpen(t *testing.T) {
+	t.Parallel()
+
+	box := newBox(t, 1)
+	plaintext := []byte("JBSWY3DPEHPK3PXP")
+
+	sealed, err := box.Seal(plaintext, []byte("user:7"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), string(plaintext))
+
+	opened, err := box.Open(sealed, []byte("user:7"))
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, opened)
+
+	// a random nonce makes every seal different
+	again, err := box.Seal(plaintext, []byte("user:7"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+}
+
+func TestBox_OpenFails(t *testing.T) {
+	t.Parallel()
+
+	box := newBox(t, 1)
+	sealed, err := box.Seal([]byte("JBSWY3DPEHPK3PXP"), []byte("user:7"))
+	require.NoError(t, err)
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := []struct {
+		name           string
+		box            *secretbox.Box
+		sealed         []byte
+		additionalData []byte
+	}{
+		{name: "wrong additional data", box: box, sealed: sealed, additionalData: []byte("user:8")},
+		{name: "no additional data", box: box, sealed: sealed},
+		{name: "wrong key", box: newBox(t, 2), sealed: sealed, additionalData: []byte("user:7")},
+		{name: "tampered", box: box, sealed: tampered, additionalData: []byte("user:7")},
+		{name: "shorter than nonce", box: box, sealed: sealed[:4], additionalData: []byte("user:7")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := tt.box.Open(tt.sealed, tt.additionalData)
+			assert.ErrorIs(t, err, secretbox.ErrDecrypt)
+		})
+	}
+}
+
+func TestNew_KeyLength(t *testing.T) {
+	t.Parallel()
+
+	_, err := secretbox.New(make([]byte, 16))
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Message is the JSON body the HTTP sender posts to the provider
+type Message struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+// HTTP sends messages through a provider that accepts a Message as JSON,
+// most gateways can be put behind such an endpoint with a small adapter
+type HTTP struct {
+	url    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+// NewHTTP creates a sender, requests are sent without authorization when token is empty
+func NewHTTP(url, token, from string, timeout time.Duration) *HTTP {
+	return &HTTP{
+		url:    url,
+		token:  token,
+		from:   from,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (h *HTTP) Send(ctx context.Context, to, text string) error {
+	const f = "sms.Send"
+
+	body, err := json.Marshal(Message{From: h.from, To: to, Text: text})
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s:%w", f, err)
+	}
+	defer resp.Body.Close()
+
+	// drain a little so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s:provider answered %s", f, resp.Status)
+	}
+
+	return nil
+}
+
+// Memory keeps messages instead of sending them, for tests.
+// It also serves the HTTP sender's requests, so it can stand in for the provider.
+type Memory struct {
+	mu       sync.Mutex
+	messages map[string][]string
+}
+
+func NewMemory() *Memory {
+	return &Memory{messages: make(map[string][]string)}
+}
+
+func (m *Memory) Send(_ context.Context, to, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages[to] = append(m.messages[to], text)
+
+	return nil
+}
+
+// Messages returns the texts sent to the number, oldest first
+func (m *Memory) Messages(to string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.messages[to]...)
+}
+
+// Last returns the newest text sent to the number
+func (m *Memory) Last(to string) (string, bool) {
+	messages := m.Messages(to)
+	if len(messages) == 0 {
+		return "", false
+	}
+
+	return messages[len(messages)-1], true
+}
+
+func (m *Memory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var msg Message
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.To == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_ = m.Send(r.Context(), msg.To, msg.Text)
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,443 @@
+package strength
+
+import (
+	_ "embed"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Estimator works in the spirit of zxcvbn: the password is split into the cheapest
+// sequence of patterns an attacker would try first (dictionary words with case
+// and l33t variations, sequences, repeats, keyboard walks and years), and the
+// characters no pattern covers are brute forced. Strength is log2 of the guesses.
+
+//go:embed common.txt
+var commonList string
+
+const (
+	minPatternLength = 3
+	maxWordLength    = 32
+
+	// zxcvbn guesses every brute forced character out of 10
+	bruteforceBits = 3.321928094887362 // log2(10)
+
+	keyboardStarts = 47
+	keyboardDegree = 4.6
+)
+
+var common = ranked(strings.Fields(commonList))
+
+type Estimator struct {
+	dictionaries []map[string]int
+}
+
+// New creates an estimator that also knows the given words,
+// e.g. the deny-list or the product name
+func New(words ...string) *Estimator {
+	dictionaries := []map[string]int{common}
+	if len(words) > 0 {
+		dictionaries = append(dictionaries, ranked(words))
+	}
+
+	return &Estimator{dictionaries: dictionaries}
+}
+
+// Entropy estimates password strength in bits. User inputs such as
+// the email or name are treated as the most likely words.
+func (e *Estimator) Entropy(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return 0
+	}
+
+	dictionaries := e.dictionaries
+	if len(userInputs) > 0 {
+		dictionaries = append([]map[string]int{ranked(userInputs)}, dictionaries...)
+	}
+
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, dictionaries)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	byEnd := make([][]match, n+1)
+	for _, m := range matches {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+
+	// best[k] is the cheapest way to guess the first k characters
+	best := make([]float64, n+1)
+	for k := 1; k <= n; k++ {
+		best[k] = best[k-1] + bruteforceBits
+
+		for _, m := range byEnd[k] {
+			best[k] = min(best[k], best[m.i]+m.bits)
+		}
+	}
+
+	return best[n]
+}
+
+// match covers runes[i:j] and needs 2^bits guesses
+type match struct {
+	i, j int
+	bits float64
+}
+
+func ranked(words []string) map[string]int {
+	m := make(map[string]int, len(words))
+	for i, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if _, ok := m[w]; w != "" && !ok {
+			m[w] = i + 1
+		}
+	}
+
+	return m
+}
+
+var l33t = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g',
+	'1': 'i', '!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+func dictionaryMatches(runes []rune, dictionaries []map[string]int) []match {
+	n := len(runes)
+
+	lower := make([]rune, n)
+	unleet := make([]rune, n)
+	for k, r := range runes {
+		lower[k] = unicode.ToLower(r)
+		unleet[k] = lower[k]
+		if sub, ok := l33t[lower[k]]; ok {
+			unleet[k] = sub
+		}
+	}
+
+	var matches []match
+	for i := 0; i < n; i++ {
+		for j := i + minPatternLength; j <= min(n, i+maxWordLength); j++ {
+			for _, candidate := range []struct {
+				word     []rune
+				l33t     bool
+				reversed bool
+			}{
+				{word: lower[i:j]},
+				{word: reverse(lower[i:j]), reversed: true},
+				{word: unleet[i:j], l33t: true},
+			} {
+				rank, ok := lookup(dictionaries, string(candidate.word))
+				if !ok {
+					continue
+				}
+
+				bits := math.Log2(float64(rank)) + upperVariations(runes[i:j])
+				if candidate.l33t {
+					bits += l33tVariations(lower[i:j], unleet[i:j])
+				}
+				if candidate.reversed {
+					bits++
+				}
+
+				matches = append(matches, match{i: i, j: j, bits: bits})
+			}
+		}
+	}
+
+	return matches
+}
+
+func lookup(dictionaries []map[string]int, word string) (int, bool) {
+	for _, d := range dictionaries {
+		if rank, ok := d[word]; ok {
+			return rank, true
+		}
+	}
+
+	return 0, false
+}
+
+// upperVariations is log2 of the ways to capitalize the word the same way
+func upperVariations(word []rune) float64 {
+	var upper, lower int
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 0
+	case lower == 0:
+		return 1
+	case upper == 1 && (unicode.IsUpper(word[0]) || unicode.IsUpper(word[len(word)-1])):
+		return 1
+	}
+
+	var variations float64
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+
+	return math.Log2(variations)
+}
+
+// l33tVariations is log2 of the ways to substitute the same letters
+func l33tVariations(lower, unleet []rune) float64 {
+	subbed := map[rune]int{}
+	plain := map[rune]int{}
+	for k := range lower {
+		if lower[k] != unleet[k] {
+			subbed[unleet[k]]++
+		} else {
+			plain[lower[k]]++
+		}
+	}
+
+	var bits float64
+	for letter, s := range subbed {
+		u := plain[letter]
+		if u == 0 {
+			bits++
+			continue
+		}
+
+		var variations float64
+		for k := 1; k <= min(s, u); k++ {
+			variations += binomial(s+u, k)
+		}
+		bits += math.Log2(variations)
+	}
+
+	return bits
+}
+
+func sequenceMatches(runes []rune) []match {
+	n := len(runes)
+
+	var matches []match
+	for i := 0; i < n-1; {
+		delta := runes[i+1] - runes[i]
+		if (delta != 1 && delta != -1) || !sameClass(runes[i], runes[i+1]) {
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j+1 < n && runes[j+1]-runes[j] == delta && sameClass(runes[j], runes[j+1]) {
+			j++
+		}
+
+		if length := j - i + 1; length >= minPatternLength {
+			base := 26.0
+			switch {
+			case strings.ContainsRune("aAzZ019", runes[i]):
+				base = 4
+			case unicode.IsDigit(runes[i]):
+				base = 10
+			}
+
+			bits := math.Log2(base * float64(length))
+			if delta < 0 {
+				bits++
+			}
+
+			matches = append(matches, match{i: i, j: j + 1, bits: bits})
+		}
+
+		i = j
+	}
+
+	return matches
+}
+
+func sameClass(a, b rune) bool {
+	switch {
+	case a >= 'a' && a <= 'z':
+		return b >= 'a' && b <= 'z'
+	case a >= 'A' && a <= 'Z':
+		return b >= 'A' && b <= 'Z'
+	case a >= '0' && a <= '9':
+		return b >= '0' && b <= '9'
+	}
+
+	return false
+}
+
+func repeatMatches(runes []rune) []match {
+	n := len(runes)
+
+	var matches []match
+	for i := 0; i < n; i++ {
+		// repeated blocks, a single character is a block of length 1
+		for size := 1; i+2*size <= n; size++ {
+			count := 1
+			for i+(count+1)*size <= n && equal(runes[i:i+size], runes[i+count*size:i+(count+1)*size]) {
+				count++
+			}
+
+			if count < 2 || count*size < minPatternLength {
+				continue
+			}
+
+			blockBits := float64(size) * bruteforceBits
+			if size == 1 {
+				blockBits = math.Log2(cardinality(runes[i]))
+			}
+
+			matches = append(matches, match{i: i, j: i + count*size, bits: blockBits + math.Log2(float64(count))})
+		}
+	}
+
+	return matches
+}
+
+func cardinality(r rune) float64 {
+	switch {
+	case unicode.IsDigit(r):
+		return 10
+	case unicode.IsLetter(r):
+		return 26
+	default:
+		return 33
+	}
+}
+
+type key struct {
+	row     int
+	x       float64
+	shifted bool
+}
+
+// staggered qwerty layout, each row starts a bit to the right of the one above
+var keyboard = func() map[rune]key {
+	rows := []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+	shifted := []string{"~!@#$%^&*()_+", "QWERTYUIOP{}|", "ASDFGHJKL:\"", "ZXCVBNM<>?"}
+	offsets := []float64{0, 1.5, 1.75, 2.25}
+
+	keys := map[rune]key{}
+	for row := range rows {
+		for col, r := range rows[row] {
+			keys[r] = key{row: row, x: float64(col) + offsets[row]}
+		}
+		for col, r := range shifted[row] {
+			keys[r] = key{row: row, x: float64(col) + offsets[row], shifted: true}
+		}
+	}
+
+	return keys
+}()
+
+func keyboardMatches(runes []rune) []match {
+	n := len(runes)
+
+	var matches []match
+	for i := 0; i < n-1; {
+		j := i
+		turns, shifted := 0, 0
+		var direction [2]float64
+		for j+1 < n {
+			a, okA := keyboard[runes[j]]
+			b, okB := keyboard[runes[j+1]]
+			if !okA || !okB || !adjacent(a, b) {
+				break
+			}
+
+			d := [2]float64{float64(b.row - a.row), math.Copysign(1, b.x-a.x)}
+			if j > i && d != direction {
+				turns++
+			}
+			direction = d
+
+			if b.shifted {
+				shifted++
+			}
+			j++
+		}
+
+		if length := j - i + 1; length >= minPatternLength {
+			if keyboard[runes[i]].shifted {
+				shifted++
+			}
+
+			bits := math.Log2(keyboardStarts*float64(length)) + float64(turns)*math.Log2(keyboardDegree)
+			if shifted > 0 && shifted < length {
+				bits++
+			}
+
+			matches = append(matches, match{i: i, j: j + 1, bits: bits})
+		}
+
+		i = max(j, i+1)
+	}
+
+	return matches
+}
+
+func adjacent(a, b key) bool {
+	dx := math.Abs(a.x - b.x)
+
+	switch a.row - b.row {
+	case 0:
+		return dx == 1
+	case 1, -1:
+		return dx <= 0.75
+	}
+
+	return false
+}
+
+// years from 1900 to 2049 are guessed as a small range
+func yearMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i+4 <= len(runes); i++ {
+		year, err := strconv.Atoi(string(runes[i : i+4]))
+		if err != nil || year < 1900 || year > 2049 {
+			continue
+		}
+
+		matches = append(matches, match{i: i, j: i + 4, bits: math.Log2(150)})
+	}
+
+	return matches
+}
+
+func reverse(runes []rune) []rune {
+	reversed := make([]rune, len(runes))
+	for k, r := range runes {
+		reversed[len(runes)-1-k] = r
+	}
+
+	return reversed
+}
+
+func equal(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+
+	return result
+}
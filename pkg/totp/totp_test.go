@@ -0,0 +1,105 @@
+package totp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuromii5/miku-notes-auth/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the SHA-1 key of RFC 6238 appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode_RFC6238Vectors(t *testing.T) {
+	t.Parallel()
+
+	// the RFC lists eight digit codes, six digit ones are their last digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			t.Parallel()
+
+			code, err := totp.Code(rfcSecret, totp.Step(time.Unix(tt.unix, 0)))
+			require.NoError(t, err)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+}
+
+func TestCode_AcceptsSpacesAndLowerCase(t *testing.T) {
+	t.Parallel()
+
+	code, err := totp.Code(" "+strings.ToLower(rfcSecret)+" ", totp.Step(time.Unix(59, 0)))
+	require.NoError(t, err)
+	assert.Equal(t, "287082", code)
+}
+
+func TestCode_InvalidSecret(t *testing.T) {
+	t.Parallel()
+
+	for _, secret := range []string{"", "not base32!", "1"} {
+		_, err := totp.Code(secret, 1)
+		assert.ErrorIs(t, err, totp.ErrInvalidSecret, secret)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name string
+		code string
+		skew int
+		ok   bool
+		step int64
+	}{
+		{name: "current step", code: "050471", skew: 0, ok: true, step: totp.Step(now)},
+		{name: "previous step within skew", code: "081804", skew: 1, ok: true, step: totp.Step(now) - 1},
+		{name: "previous step without skew", code: "081804", skew: 0},
+		{name: "wrong code", code: "000000", skew: 1},
+		{name: "wrong length", code: "50471", skew: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			step, ok, err := totp.Validate(rfcSecret, tt.code, now, tt.skew)
+			require.NoError(t, err)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.step, step)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	t.Parallel()
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	_, err = totp.Code(secret, 1)
+	require.NoError(t, err)
+
+	other, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
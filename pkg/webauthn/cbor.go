@@ -0,0 +1,156 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxDepth is far more than attestation objects and COSE keys need
+const maxDepth = 16
+
+var errCBOR = errors.New("malformed cbor")
+
+// decodeCBOR reads a single data item and returns it with the bytes after it.
+// It supports the subset WebAuthn uses: integers as int64, byte and text strings,
+// arrays, maps, tags (skipped), booleans and null. Indefinite lengths and floats are rejected.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deep", errCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end", errCBOR)
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		}
+
+		return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+	}
+
+	arg, data, err := readArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(arg), data, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: string longer than data", errCBOR)
+		}
+		if major == 2 {
+			return data[:arg:arg], data[arg:], nil
+		}
+		return string(data[:arg]), data[arg:], nil
+	case 4:
+		// every item takes at least a byte, so this also bounds the allocation
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: array longer than data", errCBOR)
+		}
+
+		items := make([]any, 0, arg)
+		for range arg {
+			var item any
+			item, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case 5:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, fmt.Errorf("%w: map longer than data", errCBOR)
+		}
+
+		m := make(map[any]any, arg)
+		for range arg {
+			var key, value any
+			key, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key %T", errCBOR, key)
+			}
+
+			value, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, ok := m[key]; ok {
+				return nil, nil, fmt.Errorf("%w: duplicate map key %v", errCBOR, key)
+			}
+			m[key] = value
+		}
+		return m, data, nil
+	case 6:
+		// tags only annotate the next item, none of them matter here
+		return decodeItem(data, depth+1)
+	}
+
+	return nil, nil, fmt.Errorf("%w: unknown major type %d", errCBOR, major)
+}
+
+func readArgument(info byte, data []byte) (uint64, []byte, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, nil, fmt.Errorf("%w: unsupported length encoding %d", errCBOR, info)
+	}
+
+	if len(data) < size {
+		return 0, nil, fmt.Errorf("%w: unexpected end", errCBOR)
+	}
+
+	var arg uint64
+	switch size {
+	case 1:
+		arg = uint64(data[0])
+	case 2:
+		arg = uint64(binary.BigEndian.Uint16(data))
+	case 4:
+		arg = uint64(binary.BigEndian.Uint32(data))
+	case 8:
+		arg = binary.BigEndian.Uint64(data)
+	}
+
+	return arg, data[size:], nil
+}
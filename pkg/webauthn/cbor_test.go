@@ -0,0 +1,76 @@
+package webauthn
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data []byte
+		want any
+	}{
+		{name: "small int", data: []byte{0x17}, want: int64(23)},
+		{name: "one byte int", data: []byte{0x18, 0xff}, want: int64(255)},
+		{name: "negative int", data: []byte{0x26}, want: int64(-7)},
+		{name: "two byte negative int", data: []byte{0x39, 0x01, 0x00}, want: int64(-257)},
+		{name: "byte string", data: []byte{0x43, 1, 2, 3}, want: []byte{1, 2, 3}},
+		{name: "text string", data: []byte{0x64, 'n', 'o', 'n', 'e'}, want: "none"},
+		{name: "array", data: []byte{0x82, 0x01, 0x20}, want: []any{int64(1), int64(-1)}},
+		{name: "map", data: []byte{0xa2, 0x01, 0x02, 0x61, 'k', 0xf5}, want: map[any]any{int64(1): int64(2), "k": true}},
+		{name: "tag is skipped", data: []byte{0xc2, 0x41, 0x01}, want: []byte{1}},
+		{name: "false", data: []byte{0xf4}, want: false},
+		{name: "null", data: []byte{0xf6}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, rest, err := decodeCBOR(append(bytes.Clone(tt.data), 0xff))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, []byte{0xff}, rest, "bytes after the item are returned")
+		})
+	}
+}
+
+func TestDecodeCBOR_Malformed(t *testing.T) {
+	t.Parallel()
+
+	deep := bytes.Repeat([]byte{0x81}, maxDepth+2)
+	deep = append(deep, 0x01)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "truncated argument", data: []byte{0x19, 0x01}},
+		{name: "string longer than data", data: []byte{0x45, 1, 2}},
+		{name: "array longer than data", data: []byte{0x83, 0x01}},
+		{name: "map longer than data", data: []byte{0xa3, 0x01, 0x02}},
+		{name: "huge array length", data: []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "integer overflow", data: []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "indefinite length", data: []byte{0x9f, 0x01, 0xff}},
+		{name: "float", data: []byte{0xfa, 0, 0, 0, 0}},
+		{name: "duplicate map key", data: []byte{0xa2, 0x01, 0x02, 0x01, 0x03}},
+		{name: "array map key", data: []byte{0xa1, 0x80, 0x01}},
+		{name: "nested too deep", data: deep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := decodeCBOR(tt.data)
+			assert.ErrorIs(t, err, errCBOR)
+		})
+	}
+}
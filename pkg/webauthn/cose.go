@@ -0,0 +1,110 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms offered to authenticators, the most common first
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters, see RFC 9053
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrvOrN = -1
+	coseXOrE   = -2
+	coseY      = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// publicKey is a credential key that checks assertion signatures
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey reads a COSE_Key and returns the bytes after it
+func parsePublicKey(data []byte) (publicKey, []byte, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return publicKey{}, nil, err
+	}
+
+	m, ok := item.(map[any]any)
+	if !ok {
+		return publicKey{}, nil, fmt.Errorf("%w: public key is not a map", ErrUnsupportedKey)
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrvOrN)].(int64)
+		x, _ := m[int64(coseXOrE)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, nil, fmt.Errorf("%w: invalid P-256 key", ErrUnsupportedKey)
+		}
+
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return publicKey{}, nil, fmt.Errorf("%w: point is not on the curve", ErrUnsupportedKey)
+		}
+
+		return publicKey{alg: alg, key: key}, rest, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrvOrN)].(int64)
+		x, _ := m[int64(coseXOrE)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, nil, fmt.Errorf("%w: invalid Ed25519 key", ErrUnsupportedKey)
+		}
+
+		return publicKey{alg: alg, key: ed25519.PublicKey(x)}, rest, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseCrvOrN)].([]byte)
+		e, _ := m[int64(coseXOrE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return publicKey{}, nil, fmt.Errorf("%w: invalid RSA key", ErrUnsupportedKey)
+		}
+
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+
+		return publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, rest, nil
+	}
+
+	return publicKey{}, nil, fmt.Errorf("%w: kty %d alg %d", ErrUnsupportedKey, kty, alg)
+}
+
+func (k publicKey) verify(message, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, message, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	return false
+}
@@ -0,0 +1,322 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Timeout is how long the browser waits for the authenticator
+const Timeout = 5 * time.Minute
+
+const challengeLength = 32
+
+// authenticator data flags, see https://www.w3.org/TR/webauthn-2/#flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+var (
+	ErrMalformed         = errors.New("malformed webauthn response")
+	ErrTypeMismatch      = errors.New("client data has the wrong type")
+	ErrChallengeMismatch = errors.New("challenge doesn't match")
+	ErrOriginMismatch    = errors.New("origin is not allowed")
+	ErrRPIDMismatch      = errors.New("credential is scoped to another relying party")
+	ErrUserNotPresent    = errors.New("user wasn't present")
+	ErrUserNotVerified   = errors.New("user wasn't verified")
+	ErrUnsupportedKey    = errors.New("unsupported public key")
+	ErrInvalidSignature  = errors.New("invalid assertion signature")
+)
+
+var encoding = base64.RawURLEncoding
+
+// RelyingParty checks registrations and assertions made for one site.
+// Attestation statements aren't verified: any authenticator is welcome,
+// so "none" attestation is requested and the statement is ignored.
+type RelyingParty struct {
+	id      string
+	name    string
+	origins []string
+	idHash  [32]byte
+}
+
+// New takes the domain credentials are scoped to and the origins
+// allowed to use them, e.g. "example.com" and "https://app.example.com"
+func New(id, name string, origins []string) *RelyingParty {
+	return &RelyingParty{
+		id:      id,
+		name:    name,
+		origins: origins,
+		idHash:  sha256.Sum256([]byte(id)),
+	}
+}
+
+// User is the account a credential is created for
+type User struct {
+	// opaque id the authenticator returns with discoverable credentials
+	Handle []byte
+	Name   string
+}
+
+// Credential is a public key credential that passed registration
+type Credential struct {
+	ID []byte
+	// COSE_Key as sent by the authenticator
+	PublicKey    []byte
+	SignCount    uint32
+	UserVerified bool
+}
+
+// Assertion is the authenticator state reported with a login
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// NewChallenge returns random bytes for a single ceremony
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeLength)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// CreationOptions returns PublicKeyCredentialCreationOptionsJSON for navigator.credentials.create,
+// exclude lists credentials the user already has so they aren't registered twice
+func (rp *RelyingParty) CreationOptions(challenge []byte, user User, exclude [][]byte) ([]byte, error) {
+	type param struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	}
+
+	return json.Marshal(map[string]any{
+		"challenge": encoding.EncodeToString(challenge),
+		"rp":        map[string]string{"id": rp.id, "name": rp.name},
+		"user": map[string]string{
+			"id":          encoding.EncodeToString(user.Handle),
+			"name":        user.Name,
+			"displayName": user.Name,
+		},
+		"pubKeyCredParams": []param{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		"timeout":            Timeout.Milliseconds(),
+		"excludeCredentials": descriptors(exclude),
+		"authenticatorSelection": map[string]string{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+		"attestation": "none",
+	})
+}
+
+// RequestOptions returns PublicKeyCredentialRequestOptionsJSON for navigator.credentials.get.
+// An empty allow list lets the authenticator offer any discoverable credential.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow [][]byte, requireUV bool) ([]byte, error) {
+	userVerification := "discouraged"
+	if requireUV {
+		userVerification = "required"
+	}
+
+	return json.Marshal(map[string]any{
+		"challenge":        encoding.EncodeToString(challenge),
+		"rpId":             rp.id,
+		"timeout":          Timeout.Milliseconds(),
+		"allowCredentials": descriptors(allow),
+		"userVerification": userVerification,
+	})
+}
+
+func descriptors(ids [][]byte) []credentialDescriptor {
+	list := make([]credentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, credentialDescriptor{Type: "public-key", ID: encoding.EncodeToString(id)})
+	}
+
+	return list
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return Credential{}, fmt.Errorf("%w: attestation object: %v", ErrMalformed, err)
+	}
+
+	attestation, ok := item.(map[any]any)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: attestation object is not a map", ErrMalformed)
+	}
+
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: no authenticator data", ErrMalformed)
+	}
+
+	authData, err := rp.checkAuthenticatorData(rawAuthData, false)
+	if err != nil {
+		return Credential{}, err
+	}
+	if authData.flags&flagAttested == 0 {
+		return Credential{}, fmt.Errorf("%w: no attested credential", ErrMalformed)
+	}
+
+	return Credential{
+		ID:           authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get against
+// the stored COSE public key of the credential
+func (rp *RelyingParty) VerifyAssertion(
+	challenge, credentialKey, clientDataJSON, authenticatorData, signature []byte,
+	requireUV bool,
+) (Assertion, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return Assertion{}, err
+	}
+
+	authData, err := rp.checkAuthenticatorData(authenticatorData, requireUV)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	key, rest, err := parsePublicKey(credentialKey)
+	if err != nil {
+		return Assertion{}, err
+	}
+	if len(rest) != 0 {
+		return Assertion{}, fmt.Errorf("%w: trailing bytes after the key", ErrUnsupportedKey)
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	message := append(slices.Clip(authenticatorData), clientDataHash[:]...)
+
+	if !key.verify(message, signature) {
+		return Assertion{}, ErrInvalidSignature
+	}
+
+	return Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+func (rp *RelyingParty) checkClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrMalformed, err)
+	}
+
+	if clientData.Type != ceremony {
+		return ErrTypeMismatch
+	}
+
+	got, err := encoding.DecodeString(clientData.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+
+	// a phishing site gets a response for its own origin, which is refused here
+	if !slices.Contains(rp.origins, clientData.Origin) {
+		return fmt.Errorf("%w: %s", ErrOriginMismatch, clientData.Origin)
+	}
+
+	return nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func (rp *RelyingParty) checkAuthenticatorData(data []byte, requireUV bool) (authenticatorData, error) {
+	// rpIdHash, flags and the signature counter
+	if len(data) < 37 {
+		return authenticatorData{}, fmt.Errorf("%w: authenticator data is too short", ErrMalformed)
+	}
+
+	if !bytes.Equal(data[:32], rp.idHash[:]) {
+		return authenticatorData{}, ErrRPIDMismatch
+	}
+
+	authData := authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return authenticatorData{}, ErrUserNotPresent
+	}
+	if requireUV && authData.flags&flagUserVerified == 0 {
+		return authenticatorData{}, ErrUserNotVerified
+	}
+
+	rest := data[37:]
+	if authData.flags&flagAttested != 0 {
+		// aaguid and the credential id length
+		if len(rest) < 18 {
+			return authenticatorData{}, fmt.Errorf("%w: attested credential is too short", ErrMalformed)
+		}
+
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return authenticatorData{}, fmt.Errorf("%w: invalid credential id", ErrMalformed)
+		}
+		authData.credentialID = bytes.Clone(rest[:idLength])
+		rest = rest[idLength:]
+
+		_, afterKey, err := parsePublicKey(rest)
+		if err != nil {
+			return authenticatorData{}, err
+		}
+		authData.publicKey = bytes.Clone(rest[:len(rest)-len(afterKey)])
+		rest = afterKey
+	}
+
+	// extension outputs aren't used, they only have to be well formed
+	if authData.flags&flagExtensions != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return authenticatorData{}, fmt.Errorf("%w: extensions: %v", ErrMalformed, err)
+		}
+	}
+	if len(rest) != 0 {
+		return authenticatorData{}, fmt.Errorf("%w: trailing bytes in authenticator data", ErrMalformed)
+	}
+
+	return authData, nil
+}
@@ -0,0 +1,344 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://app.example.com"
+)
+
+// testAuthenticator plays an authenticator with a P-256 key, every
+// field can be spoiled by a test before a response is made
+type testAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	rpIDHash     [32]byte
+	origin       string
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return &testAuthenticator{
+		key:          key,
+		credentialID: []byte("credential-id"),
+		rpIDHash:     sha256.Sum256([]byte(testRPID)),
+		origin:       testOrigin,
+	}
+}
+
+func (a *testAuthenticator) coseKey() []byte {
+	return cborEncode(cborMap{
+		{1, 2},  // kty: EC2
+		{3, -7}, // alg: ES256
+		{-1, 1}, // crv: P-256
+		{-2, a.key.X.FillBytes(make([]byte, 32))},
+		{-3, a.key.Y.FillBytes(make([]byte, 32))},
+	})
+}
+
+func (a *testAuthenticator) clientData(t *testing.T, ceremony string, challenge []byte) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": encoding.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+	require.NoError(t, err)
+
+	return data
+}
+
+func (a *testAuthenticator) authData(flags byte, signCount uint32) []byte {
+	data := append([]byte{}, a.rpIDHash[:]...)
+	data = append(data, flags)
+
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+func (a *testAuthenticator) attestationObject(flags byte) []byte {
+	authData := a.authData(flags, 0)
+	if flags&flagAttested != 0 {
+		authData = append(authData, make([]byte, 16)...) // aaguid
+		authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+		authData = append(authData, a.credentialID...)
+		authData = append(authData, a.coseKey()...)
+	}
+
+	return cborEncode(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", authData},
+	})
+}
+
+func (a *testAuthenticator) sign(t *testing.T, authData, clientDataJSON []byte) []byte {
+	t.Helper()
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	return signature
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	t.Parallel()
+
+	rp := New(testRPID, "miku-notes", []string{testOrigin})
+	challenge := []byte("registration challenge")
+
+	a := newTestAuthenticator(t)
+	credential, err := rp.VerifyRegistration(
+		challenge,
+		a.clientData(t, "webauthn.create", challenge),
+		a.attestationObject(flagUserPresent|flagUserVerified|flagAttested),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, a.credentialID, credential.ID)
+	assert.Equal(t, a.coseKey(), credential.PublicKey)
+	assert.True(t, credential.UserVerified)
+}
+
+func TestVerifyRegistration_Rejects(t *testing.T) {
+	t.Parallel()
+
+	rp := New(testRPID, "miku-notes", []string{testOrigin})
+	challenge := []byte("registration challenge")
+	flags := byte(flagUserPresent | flagAttested)
+
+	tests := []struct {
+		name  string
+		spoil func(t *testing.T, a *testAuthenticator, clientData, attestation []byte) ([]byte, []byte)
+		err   error
+	}{
+		{
+			name: "assertion client data",
+			spoil: func(t *testing.T, a *testAuthenticator, _, attestation []byte) ([]byte, []byte) {
+				return a.clientData(t, "webauthn.get", challenge), attestation
+			},
+			err: ErrTypeMismatch,
+		},
+		{
+			name: "other challenge",
+			spoil: func(t *testing.T, a *testAuthenticator, _, attestation []byte) ([]byte, []byte) {
+				return a.clientData(t, "webauthn.create", []byte("other challenge")), attestation
+			},
+			err: ErrChallengeMismatch,
+		},
+		{
+			name: "wrong origin",
+			spoil: func(t *testing.T, a *testAuthenticator, _, attestation []byte) ([]byte, []byte) {
+				a.origin = "https://phishing.example.net"
+				return a.clientData(t, "webauthn.create", challenge), attestation
+			},
+			err: ErrOriginMismatch,
+		},
+		{
+			name: "other relying party",
+			spoil: func(_ *testing.T, a *testAuthenticator, clientData, _ []byte) ([]byte, []byte) {
+				a.rpIDHash = sha256.Sum256([]byte("example.net"))
+				return clientData, a.attestationObject(flags)
+			},
+			err: ErrRPIDMismatch,
+		},
+		{
+			name: "user not present",
+			spoil: func(_ *testing.T, a *testAuthenticator, clientData, _ []byte) ([]byte, []byte) {
+				return clientData, a.attestationObject(flagAttested)
+			},
+			err: ErrUserNotPresent,
+		},
+		{
+			name: "no attested credential",
+			spoil: func(_ *testing.T, a *testAuthenticator, clientData, _ []byte) ([]byte, []byte) {
+				return clientData, a.attestationObject(flagUserPresent)
+			},
+			err: ErrMalformed,
+		},
+		{
+			name: "malformed attestation object",
+			spoil: func(_ *testing.T, _ *testAuthenticator, clientData, attestation []byte) ([]byte, []byte) {
+				return clientData, attestation[:len(attestation)-10]
+			},
+			err: ErrMalformed,
+		},
+		{
+			name: "malformed client data",
+			spoil: func(_ *testing.T, _ *testAuthenticator, _, attestation []byte) ([]byte, []byte) {
+				return []byte(`{"type":`), attestation
+			},
+			err: ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			a := newTestAuthenticator(t)
+			clientData, attestation := tt.spoil(t, a, a.clientData(t, "webauthn.create", challenge), a.attestationObject(flags))
+
+			_, err := rp.VerifyRegistration(challenge, clientData, attestation)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	t.Parallel()
+
+	rp := New(testRPID, "miku-notes", []string{testOrigin})
+	challenge := []byte("login challenge")
+
+	tests := []struct {
+		name      string
+		flags     byte
+		requireUV bool
+		// changes the authenticator after the credential was registered
+		spoil func(t *testing.T, a *testAuthenticator)
+		err   error
+	}{
+		{name: "present user", flags: flagUserPresent},
+		{name: "verified user", flags: flagUserPresent | flagUserVerified, requireUV: true},
+		{name: "user not present", flags: flagUserVerified, err: ErrUserNotPresent},
+		{name: "user not verified", flags: flagUserPresent, requireUV: true, err: ErrUserNotVerified},
+		{
+			name:  "other relying party",
+			flags: flagUserPresent,
+			spoil: func(_ *testing.T, a *testAuthenticator) { a.rpIDHash = sha256.Sum256([]byte("example.net")) },
+			err:   ErrRPIDMismatch,
+		},
+		{
+			name:  "wrong origin",
+			flags: flagUserPresent,
+			spoil: func(_ *testing.T, a *testAuthenticator) { a.origin = "https://app.example.com.phishing.net" },
+			err:   ErrOriginMismatch,
+		},
+		{
+			name:  "other key",
+			flags: flagUserPresent,
+			spoil: func(t *testing.T, a *testAuthenticator) {
+				key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				require.NoError(t, err)
+				a.key = key
+			},
+			err: ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			a := newTestAuthenticator(t)
+			credentialKey := a.coseKey()
+			if tt.spoil != nil {
+				tt.spoil(t, a)
+			}
+
+			clientData := a.clientData(t, "webauthn.get", challenge)
+			authData := a.authData(tt.flags, 7)
+
+			assertion, err := rp.VerifyAssertion(challenge, credentialKey, clientData, authData, a.sign(t, authData, clientData), tt.requireUV)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, uint32(7), assertion.SignCount)
+			assert.Equal(t, tt.flags&flagUserVerified != 0, assertion.UserVerified)
+		})
+	}
+}
+
+func TestVerifyAssertion_SignedDataIsChecked(t *testing.T) {
+	t.Parallel()
+
+	rp := New(testRPID, "miku-notes", []string{testOrigin})
+	challenge := []byte("login challenge")
+
+	a := newTestAuthenticator(t)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	authData := a.authData(flagUserPresent, 7)
+	signature := a.sign(t, authData, clientData)
+
+	// a replayed assertion with the counter turned back doesn't match the signature,
+	// so a lower counter can only come from a cloned key
+	rolledBack := a.authData(flagUserPresent, 6)
+	_, err := rp.VerifyAssertion(challenge, a.coseKey(), clientData, rolledBack, signature, false)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// the counter is reported as signed, the caller compares it with the stored one
+	for _, count := range []uint32{8, 3} {
+		authData := a.authData(flagUserPresent, count)
+		assertion, err := rp.VerifyAssertion(challenge, a.coseKey(), clientData, authData, a.sign(t, authData, clientData), false)
+		require.NoError(t, err)
+		assert.Equal(t, count, assertion.SignCount)
+	}
+
+	// client data of another ceremony
+	other := a.clientData(t, "webauthn.get", []byte("other challenge"))
+	_, err = rp.VerifyAssertion(challenge, a.coseKey(), other, authData, a.sign(t, authData, other), false)
+	assert.ErrorIs(t, err, ErrChallengeMismatch)
+
+	// authenticator data cut short
+	_, err = rp.VerifyAssertion(challenge, a.coseKey(), clientData, authData[:36], signature, false)
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+// cborMap keeps the key order of the encoded map
+type cborMap [][2]any
+
+// cborEncode covers what the test authenticator sends
+func cborEncode(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		default:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		}
+	}
+
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case cborMap:
+		out := head(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, cborEncode(pair[0])...)
+			out = append(out, cborEncode(pair[1])...)
+		}
+		return out
+	}
+
+	panic(fmt.Sprintf("cborEncode: unsupported type %T", v))
+}
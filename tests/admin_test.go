@@ -0,0 +1,289 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdmin_DisableEnableUser(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+	adminCtx := st.AdminContext(ctx)
+
+	email := gofakeit.Email()
+	pass := gofakeit.Password(true, true, true, true, false, 8)
+	fingerprint := "fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	validateResp, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+	userID := validateResp.GetUserId()
+
+	// the user can be found by email prefix and has one session
+	searchResp, err := st.AdminClient.SearchUsers(adminCtx, &sso.SearchUsersRequest{
+		EmailPrefix: email,
+	})
+	require.NoError(err)
+	require.Len(searchResp.GetUsers(), 1)
+	assert.Equal(userID, searchResp.GetUsers()[0].GetId())
+	assert.Equal("active", searchResp.GetUsers()[0].GetStatus())
+
+	sessionsResp, err := st.AdminClient.GetUserSessions(adminCtx, &sso.GetUserSessionsRequest{UserId: userID})
+	require.NoError(err)
+	require.Len(sessionsResp.GetSessions(), 1)
+	assert.Equal(fingerprint, sessionsResp.GetSessions()[0].GetFingerprint())
+
+	// disabled user can't log in and loses every session
+	_, err = st.AdminClient.DisableUser(adminCtx, &sso.DisableUserRequest{UserId: userID})
+	require.NoError(err)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.GetAccessToken(ctx, &sso.GetATRequest{
+		RefreshToken: registerResp.GetRefreshToken(),
+		Fingerprint:  fingerprint,
+	})
+	require.Error(err)
+
+	// enabled user can log in again
+	_, err = st.AdminClient.EnableUser(adminCtx, &sso.EnableUserRequest{UserId: userID})
+	require.NoError(err)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+}
+
+func TestAdmin_DeleteUser(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	require := require.New(st.T)
+	adminCtx := st.AdminContext(ctx)
+
+	email := gofakeit.Email()
+	pass := gofakeit.Password(true, true, true, true, false, 8)
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	validateResp, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+
+	_, err = st.AdminClient.DeleteUser(adminCtx, &sso.DeleteUserRequest{UserId: validateResp.GetUserId()})
+	require.NoError(err)
+
+	// second delete reports that the user is gone
+	_, err = st.AdminClient.DeleteUser(adminCtx, &sso.DeleteUserRequest{UserId: validateResp.GetUserId()})
+	require.Error(err)
+	require.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestAdmin_WrongCredentials(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	require := require.New(st.T)
+
+	// the public service token is not accepted by the admin server
+	_, err := st.AdminClient.SearchUsers(ctx, &sso.SearchUsersRequest{})
+	require.Error(err)
+	require.Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func TestAdmin_SuspendUser(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+	adminCtx := st.AdminContext(ctx)
+
+	email := gofakeit.Email()
+	pass := gofakeit.Password(true, true, true, true, false, 8)
+	fingerprint := "fingerprint"
+	reason := "spamming shared notes"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	validateResp, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+	userID := validateResp.GetUserId()
+
+	_, err = st.AdminClient.SuspendUser(adminCtx, &sso.SuspendUserRequest{
+		UserId: userID,
+		Reason: reason,
+		Until:  time.Now().Add(time.Hour).Unix(),
+	})
+	require.NoError(err)
+
+	// still valid access token is refused with the reason
+	_, err = st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.Error(err)
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+	assert.ErrorContains(err, reason)
+
+	// sessions were revoked at the moment of suspension
+	_, err = st.AuthClient.GetAccessToken(ctx, &sso.GetATRequest{
+		RefreshToken: registerResp.GetRefreshToken(),
+		Fingerprint:  fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.NotFound, status.Code(err))
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+	assert.ErrorContains(err, reason)
+
+	// lifting the suspension lets the user back in
+	_, err = st.AdminClient.EnableUser(adminCtx, &sso.EnableUserRequest{UserId: userID})
+	require.NoError(err)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+}
+
+func TestAdmin_RequirePasswordChange(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+	adminCtx := st.AdminContext(ctx)
+
+	email := gofakeit.Email()
+	pass := "Violet-Harbor-Lantern-41"
+	newPass := "Quiet-Marble-Orchard-73"
+	fingerprint := "fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	validateResp, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+
+	_, err = st.AdminClient.RequirePasswordChange(adminCtx, &sso.RequirePasswordChangeRequest{
+		UserId: validateResp.GetUserId(),
+	})
+	require.NoError(err)
+
+	// login gives only a restricted token with the reason
+	loginResp, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	assert.Empty(loginResp.GetAccessToken())
+	assert.Empty(loginResp.GetRefreshToken())
+	assert.Equal("password_change_required", loginResp.GetReason())
+	restrictedToken := loginResp.GetRestrictedToken()
+	require.NotEmpty(restrictedToken)
+
+	// the restricted token isn't an access token
+	_, err = st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: restrictedToken})
+	require.Error(err)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	// the old password can't be kept
+	_, err = st.AuthClient.SetNewPassword(ctx, &sso.SetNewPasswordRequest{
+		RestrictedToken: restrictedToken,
+		NewPassword:     pass,
+		Fingerprint:     fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	// from another device than the one the user registered on
+	setResp, err := st.AuthClient.SetNewPassword(ctx, &sso.SetNewPasswordRequest{
+		RestrictedToken: restrictedToken,
+		NewPassword:     newPass,
+		Fingerprint:     "other-fingerprint",
+	})
+	require.NoError(err)
+	require.NotEmpty(setResp.GetAccessToken())
+
+	_, err = st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: setResp.GetAccessToken()})
+	require.NoError(err)
+
+	// sessions started with the old password are gone
+	_, err = st.AuthClient.GetAccessToken(ctx, &sso.GetATRequest{
+		RefreshToken: registerResp.GetRefreshToken(),
+		Fingerprint:  fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.NotFound, status.Code(err))
+
+	_, err = st.AuthClient.GetAccessToken(ctx, &sso.GetATRequest{
+		RefreshToken: setResp.GetRefreshToken(),
+		Fingerprint:  "other-fingerprint",
+	})
+	require.NoError(err)
+
+	// the restricted token is good for one change only, even within the same second
+	_, err = st.AuthClient.SetNewPassword(ctx, &sso.SetNewPasswordRequest{
+		RestrictedToken: restrictedToken,
+		NewPassword:     "Amber-Canyon-Whistle-58",
+		Fingerprint:     fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	// the flag is cleared, so the next login is a normal one
+	loginResp, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    newPass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	assert.NotEmpty(loginResp.GetAccessToken())
+	assert.Empty(loginResp.GetReason())
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/golang-jwt/jwt/v5"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClients_OwnAccessTTL(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	client, _ := st.RegisterClient(ctx, models.Client{
+		ClientID:   "cli",
+		GrantTypes: []string{models.GrantPassword, models.GrantRefreshToken},
+		AccessTTL:  2 * time.Minute,
+	}, true)
+
+	email, pass := gofakeit.Email(), "Violet-Harbor-Lantern-41"
+	resp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: "fingerprint",
+		ClientId:    client.ClientID,
+	})
+	require.NoError(err)
+	assert.NotEmpty(resp.GetRefreshToken())
+
+	issuedAt := time.Now()
+	resp, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: "fingerprint",
+		ClientId:    client.ClientID,
+	})
+	require.NoError(err)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(resp.GetAccessToken(), claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(st.Cfg.Tokens.Secret), nil
+	})
+	require.NoError(err)
+
+	expiresAt, err := claims.GetExpirationTime()
+	require.NoError(err)
+	assert.InDelta(issuedAt.Add(client.AccessTTL).Unix(), expiresAt.Unix(), 5)
+
+	// the refresh token keeps the lifetime of its client
+	refreshed, err := st.AuthClient.GetAccessToken(ctx, &sso.GetATRequest{
+		RefreshToken: resp.GetRefreshToken(),
+		Fingerprint:  "fingerprint",
+	})
+	require.NoError(err)
+
+	claims = jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(refreshed.GetAccessToken(), claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(st.Cfg.Tokens.Secret), nil
+	})
+	require.NoError(err)
+	expiresAt, err = claims.GetExpirationTime()
+	require.NoError(err)
+	assert.InDelta(time.Now().Add(client.AccessTTL).Unix(), expiresAt.Unix(), 5)
+}
+
+func TestClients_GrantTypes(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email, pass := gofakeit.Email(), "Violet-Harbor-Lantern-41"
+
+	// unknown clients can't even register
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: "fingerprint",
+		ClientId:    "unknown-" + gofakeit.LetterN(12),
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	// a client without refresh tokens only gets access tokens
+	kiosk, _ := st.RegisterClient(ctx, models.Client{
+		ClientID:   "kiosk",
+		GrantTypes: []string{models.GrantPassword},
+	}, true)
+
+	resp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: "fingerprint",
+		ClientId:    kiosk.ClientID,
+	})
+	require.NoError(err)
+	assert.NotEmpty(resp.GetAccessToken())
+	assert.Empty(resp.GetRefreshToken())
+
+	// clients of the OpenID Connect provider can't log in with passwords
+	partner, _ := st.RegisterClient(ctx, models.Client{
+		ClientID:     "partner",
+		GrantTypes:   []string{models.GrantAuthorizationCode},
+		RedirectURIs: []string{"http://localhost:9999/callback"},
+	}, false)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: "fingerprint",
+		ClientId:    partner.ClientID,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
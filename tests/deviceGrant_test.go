@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeviceGrant_ApprovedDeviceGetsTokens(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       gofakeit.Email(),
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: "browser",
+	})
+	require.NoError(err)
+
+	// callers without a client id can't use the grant
+	_, err = st.AuthClient.StartDeviceAuthorization(ctx, &sso.StartDeviceAuthorizationRequest{})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	cli := registerDeviceClient(ctx, st)
+	device, err := st.AuthClient.StartDeviceAuthorization(ctx, &sso.StartDeviceAuthorizationRequest{ClientId: cli.ClientID})
+	require.NoError(err)
+	assert.NotEmpty(device.GetDeviceCode())
+	assert.Contains(device.GetVerificationUriComplete(), device.GetUserCode())
+	assert.Positive(device.GetInterval())
+
+	_, err = st.AuthClient.PollDeviceAuthorization(ctx, &sso.PollDeviceAuthorizationRequest{
+		DeviceCode:  device.GetDeviceCode(),
+		Fingerprint: "cli",
+	})
+	assert.Equal("authorization_pending", deviceErrorReason(t, err))
+
+	// users type the code the way they like
+	typed := strings.ToLower(strings.ReplaceAll(device.GetUserCode(), "-", " "))
+
+	// the web app asks the user whether to allow the client, looking doesn't approve
+	lookupResp, err := st.AuthClient.LookupDevice(ctx, &sso.LookupDeviceRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		UserCode:    typed,
+	})
+	require.NoError(err)
+	assert.Equal(cli.ClientID, lookupResp.GetClientId())
+	assert.Equal(cli.Name, lookupResp.GetClientName())
+
+	_, err = st.AuthClient.ResolveDevice(ctx, &sso.ResolveDeviceRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		UserCode:    typed,
+		Approve:     true,
+	})
+	require.NoError(err)
+
+	time.Sleep(time.Duration(device.GetInterval()) * time.Second)
+	tokens, err := st.AuthClient.PollDeviceAuthorization(ctx, &sso.PollDeviceAuthorizationRequest{
+		DeviceCode:  device.GetDeviceCode(),
+		Fingerprint: "cli",
+	})
+	require.NoError(err)
+	assert.NotEmpty(tokens.GetRefreshToken())
+
+	// the device has its own session
+	_, err = st.AuthClient.GetAccessToken(ctx, &sso.GetATRequest{RefreshToken: tokens.GetRefreshToken(), Fingerprint: "cli"})
+	require.NoError(err)
+
+	// codes are used once
+	_, err = st.AuthClient.PollDeviceAuthorization(ctx, &sso.PollDeviceAuthorizationRequest{
+		DeviceCode:  device.GetDeviceCode(),
+		Fingerprint: "cli",
+	})
+	assert.Equal("expired_token", deviceErrorReason(t, err))
+
+	_, err = st.AuthClient.ResolveDevice(ctx, &sso.ResolveDeviceRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		UserCode:    device.GetUserCode(),
+		Approve:     true,
+	})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.LookupDevice(ctx, &sso.LookupDeviceRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		UserCode:    device.GetUserCode(),
+	})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestDeviceGrant_SlowDownAndDeny(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       gofakeit.Email(),
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: "browser",
+	})
+	require.NoError(err)
+
+	tv := registerDeviceClient(ctx, st)
+	device, err := st.AuthClient.StartDeviceAuthorization(ctx, &sso.StartDeviceAuthorizationRequest{ClientId: tv.ClientID})
+	require.NoError(err)
+
+	poll := &sso.PollDeviceAuthorizationRequest{DeviceCode: device.GetDeviceCode(), Fingerprint: "tv"}
+	_, err = st.AuthClient.PollDeviceAuthorization(ctx, poll)
+	assert.Equal("authorization_pending", deviceErrorReason(t, err))
+
+	// polling again right away makes the interval longer
+	_, err = st.AuthClient.PollDeviceAuthorization(ctx, poll)
+	require.Equal("slow_down", deviceErrorReason(t, err))
+
+	var retryAfter time.Duration
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryAfter = info.GetRetryDelay().AsDuration()
+		}
+	}
+	assert.Equal(time.Duration(device.GetInterval())*time.Second+5*time.Second, retryAfter)
+
+	_, err = st.AuthClient.ResolveDevice(ctx, &sso.ResolveDeviceRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		UserCode:    device.GetUserCode(),
+		Approve:     false,
+	})
+	require.NoError(err)
+
+	time.Sleep(retryAfter)
+	_, err = st.AuthClient.PollDeviceAuthorization(ctx, poll)
+	assert.Equal("access_denied", deviceErrorReason(t, err))
+}
+
+// registerDeviceClient registers a public client of a device without a browser
+func registerDeviceClient(ctx context.Context, st *suite.Suite) models.Client {
+	client, _ := st.RegisterClient(ctx, models.Client{
+		ClientID:   "cli",
+		Name:       "Miku Notes CLI",
+		GrantTypes: []string{models.GrantDeviceCode, models.GrantRefreshToken},
+	}, true)
+
+	return client
+}
+
+// deviceErrorReason returns the RFC 8628 error code of a failed poll
+func deviceErrorReason(t *testing.T, err error) string {
+	t.Helper()
+
+	require.Error(t, err)
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLockout_LockAndUnlock(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	pass := gofakeit.Password(true, true, true, true, false, 8)
+	fingerprint := "fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	// every attempt before the limit is just invalid credentials
+	for i := 1; i < st.Cfg.Lockout.MaxAttempts; i++ {
+		_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+			Email:       email,
+			Password:    "wrong-password",
+			Fingerprint: fingerprint,
+		})
+		require.Error(err)
+		require.Equal(codes.InvalidArgument, status.Code(err))
+	}
+
+	// the last one locks the account
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    "wrong-password",
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	require.Equal(codes.ResourceExhausted, status.Code(err))
+
+	var retryInfo *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryInfo = info
+		}
+	}
+	require.NotNil(retryInfo)
+	assert.Equal(st.Cfg.Lockout.BaseDelay, retryInfo.GetRetryDelay().AsDuration())
+
+	// even the right password is refused while locked
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	require.Equal(codes.ResourceExhausted, status.Code(err))
+
+	// admin unlocks the account early
+	validateResp, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+
+	_, err = st.AdminClient.UnlockUser(st.AdminContext(ctx), &sso.UnlockUserRequest{UserId: validateResp.GetUserId()})
+	require.NoError(err)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+}
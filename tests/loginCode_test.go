@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/config"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	loginCodeRe = regexp.MustCompile(`login code is (\d{6})`)
+	linkTokenRe = regexp.MustCompile(`[?&]token=([A-Za-z0-9_-]+)`)
+)
+
+func TestLoginCode_Code(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithOutbox())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	fingerprint := "fingerprint"
+
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	_, err = st.AuthClient.RequestLoginCode(ctx, &sso.RequestLoginCodeRequest{Email: email})
+	require.NoError(err)
+
+	// a new code can't be requested right away
+	_, err = st.AuthClient.RequestLoginCode(ctx, &sso.RequestLoginCodeRequest{Email: email})
+	require.Error(err)
+	assert.Equal(codes.ResourceExhausted, status.Code(err))
+
+	code, _ := readLoginMail(t, st, email)
+
+	// the tokens follow the grants of the client
+	kiosk, _ := st.RegisterClient(ctx, models.Client{
+		ClientID:   "kiosk",
+		GrantTypes: []string{models.GrantPassword},
+	}, true)
+
+	loginResp, err := st.AuthClient.LoginWithCode(ctx, &sso.LoginWithCodeRequest{
+		Email:       email,
+		Code:        code,
+		Fingerprint: fingerprint,
+		ClientId:    kiosk.ClientID,
+	})
+	require.NoError(err)
+	require.NotEmpty(loginResp.GetAccessToken())
+	assert.Empty(loginResp.GetRefreshToken())
+
+	_, err = st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: loginResp.GetAccessToken()})
+	require.NoError(err)
+
+	// the code works once
+	_, err = st.AuthClient.LoginWithCode(ctx, &sso.LoginWithCodeRequest{
+		Email:       email,
+		Code:        code,
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestLoginCode_MagicLink(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithOutbox())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	fingerprint := "fingerprint"
+
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	_, err = st.AuthClient.RequestLoginCode(ctx, &sso.RequestLoginCodeRequest{Email: email})
+	require.NoError(err)
+
+	code, linkToken := readLoginMail(t, st, email)
+
+	loginResp, err := st.AuthClient.LoginWithCode(ctx, &sso.LoginWithCodeRequest{
+		LinkToken:   linkToken,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	require.NotEmpty(loginResp.GetAccessToken())
+
+	// the link used up the code sent with it
+	_, err = st.AuthClient.LoginWithCode(ctx, &sso.LoginWithCodeRequest{
+		Email:       email,
+		Code:        code,
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestLoginCode_AttemptsBurnCode(t *testing.T) {
+	// the code has to be burnt before the account lockout kicks in
+	ctx, st := suite.NewSuite(t, suite.WithOutbox(), func(_ *testing.T, cfg *config.Config) {
+		cfg.LoginCode.MaxAttempts = 3
+		cfg.Lockout.MaxAttempts = max(cfg.Lockout.MaxAttempts, cfg.LoginCode.MaxAttempts+2)
+	})
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	fingerprint := "fingerprint"
+
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	_, err = st.AuthClient.RequestLoginCode(ctx, &sso.RequestLoginCodeRequest{Email: email})
+	require.NoError(err)
+
+	code, _ := readLoginMail(t, st, email)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for range st.Cfg.LoginCode.MaxAttempts {
+		_, err = st.AuthClient.LoginWithCode(ctx, &sso.LoginWithCodeRequest{
+			Email:       email,
+			Code:        wrong,
+			Fingerprint: fingerprint,
+		})
+		require.Error(err)
+	}
+
+	_, err = st.AuthClient.LoginWithCode(ctx, &sso.LoginWithCodeRequest{
+		Email:       email,
+		Code:        code,
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+// readLoginMail returns the code and the magic link token of the newest email to the address
+func readLoginMail(t *testing.T, st *suite.Suite, email string) (string, string) {
+	t.Helper()
+
+	data := readMail(t, st, email)
+
+	code := loginCodeRe.FindStringSubmatch(data)
+	require.NotNil(t, code, "no login code in the email")
+	token := linkTokenRe.FindStringSubmatch(data)
+	require.NotNil(t, token, "no magic link in the email")
+
+	return code[1], token[1]
+}
+
+// readMail returns the last email written to the outbox for the address
+func readMail(t *testing.T, st *suite.Suite, email string) string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(st.Cfg.Mail.OutboxDir, "*-"+email+".eml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files, "no email was sent to %s", email)
+
+	// names start with the send time
+	data, err := os.ReadFile(files[len(files)-1])
+	require.NoError(t, err)
+
+	return string(data)
+}
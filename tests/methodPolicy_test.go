@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/auth"
+	mock_auth "github.com/kuromii5/miku-notes-auth/internal/auth/mock"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	gatewayID = "spiffe://miku-notes.local/gateway"
+	reportsID = "spiffe://miku-notes.local/reports"
+)
+
+func TestMethodPolicy_AllowedCallers(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ca := suite.NewCA(t)
+	authService := mock_auth.NewMockAuth(gomock.NewController(t))
+	addr, _ := mtlsServer(t, ca, authService,
+		map[string][]string{
+			notesServiceID: {auth.ScopeValidate},
+			reportsID:      {auth.ScopeValidate},
+		},
+		map[string][]string{"ValidateAccessToken": {notesServiceID}},
+	)
+
+	authService.EXPECT().ValidateAccessToken(gomock.Any(), "user-access-token").Return(int32(7), nil)
+
+	notes := mtlsClient(t, ca, addr, ca.Issue(nil, notesServiceID))
+	_, err := notes.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: "user-access-token"})
+	require.NoError(t, err)
+
+	// the scope is there, but the reports service isn't one of the callers
+	reports := mtlsClient(t, ca, addr, ca.Issue(nil, reportsID))
+	_, err = reports.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: "user-access-token"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestMethodPolicy_UserTokenRequired(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ca := suite.NewCA(t)
+	// the handlers are never reached, so EnrollTOTP has no expectation
+	authService := mock_auth.NewMockAuth(gomock.NewController(t))
+	addr, _ := mtlsServer(t, ca, authService, map[string][]string{gatewayID: {auth.ScopeGateway}}, nil)
+
+	gateway := mtlsClient(t, ca, addr, ca.Issue(nil, gatewayID))
+
+	_, err := gateway.EnrollTOTP(ctx, &sso.EnrollTOTPRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	authService.EXPECT().ValidateAccessToken(gomock.Any(), "expired-access-token").Return(int32(0), errors.New("token is expired"))
+	_, err = gateway.EnrollTOTP(ctx, &sso.EnrollTOTPRequest{AccessToken: "expired-access-token"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
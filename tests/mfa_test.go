@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/pkg/totp"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMFA_EnrollAndLogin(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithMFA())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	pass := gofakeit.Password(true, true, true, true, false, 12)
+	fingerprint := "fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	enrollResp, err := st.AuthClient.EnrollTOTP(ctx, &sso.EnrollTOTPRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+	require.NotEmpty(enrollResp.GetSecret())
+	assert.Contains(enrollResp.GetUri(), "otpauth://totp/")
+
+	// the enrollment doesn't count before it's confirmed
+	loginResp, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	require.NotEmpty(loginResp.GetAccessToken())
+
+	step := totp.Step(time.Now())
+	code, err := totp.Code(enrollResp.GetSecret(), step)
+	require.NoError(err)
+
+	_, err = st.AuthClient.ConfirmTOTP(ctx, &sso.ConfirmTOTPRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		Code:        code,
+	})
+	require.NoError(err)
+
+	// the password alone gives only a challenge
+	loginResp, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	assert.Empty(loginResp.GetAccessToken())
+	assert.Equal("mfa_required", loginResp.GetReason())
+	challenge := loginResp.GetRestrictedToken()
+	require.NotEmpty(challenge)
+
+	// the challenge isn't an access token
+	_, err = st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: challenge})
+	require.Error(err)
+
+	// the code used for confirmation can't be replayed
+	_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{
+		ChallengeToken: challenge,
+		Code:           code,
+		Fingerprint:    fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	// the next step is still inside the allowed skew
+	nextCode, err := totp.Code(enrollResp.GetSecret(), step+1)
+	require.NoError(err)
+
+	verifyResp, err := st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{
+		ChallengeToken: challenge,
+		Code:           nextCode,
+		Fingerprint:    fingerprint,
+	})
+	require.NoError(err)
+	require.NotEmpty(verifyResp.GetAccessToken())
+
+	_, err = st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: verifyResp.GetAccessToken()})
+	require.NoError(err)
+}
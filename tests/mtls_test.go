@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/auth"
+	mock_auth "github.com/kuromii5/miku-notes-auth/internal/auth/mock"
+	"github.com/kuromii5/miku-notes-auth/pkg/certs"
+	offlog "github.com/kuromii5/miku-notes-auth/pkg/logger/off"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+const notesServiceID = "spiffe://miku-notes.local/notes-service"
+
+// mtlsServer runs the auth server over mTLS on a random port with a mocked service
+func mtlsServer(t *testing.T, ca *suite.CA, authService auth.Auth, identities, callers map[string][]string) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	suite.WriteCert(t, ca.Issue([]string{"localhost"}), certFile, keyFile)
+
+	reloader, err := certs.New(offlog.New(), certFile, keyFile, ca.File)
+	require.NoError(t, err)
+	reloader.Watch(50 * time.Millisecond)
+	t.Cleanup(reloader.Close)
+
+	server, err := auth.RegisterServer(
+		authService,
+		identities,
+		callers,
+		false,
+		grpc.Creds(credentials.NewTLS(reloader.Config(true))),
+	)
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return lis.Addr().String(), certFile
+}
+
+func mtlsClient(t *testing.T, ca *suite.CA, addr string, clientCerts ...tls.Certificate) sso.AuthClient {
+	t.Helper()
+
+	cc, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		Certificates: clientCerts,
+		RootCAs:      ca.Pool(),
+		ServerName:   "localhost",
+	})))
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	return sso.NewAuthClient(cc)
+}
+
+func TestMTLS_CertificateIdentityScopes(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ca := suite.NewCA(t)
+	authService := mock_auth.NewMockAuth(gomock.NewController(t))
+	addr, _ := mtlsServer(t, ca, authService, map[string][]string{notesServiceID: {auth.ScopeValidate}}, nil)
+
+	authService.EXPECT().ValidateAccessToken(gomock.Any(), "user-access-token").Return(int32(7), nil)
+
+	// the identity of the certificate is enough, no service token
+	client := mtlsClient(t, ca, addr, ca.Issue(nil, notesServiceID))
+	resp, err := client.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: "user-access-token"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(7), resp.GetUserId())
+
+	// the notes service only validates tokens
+	_, err = client.Login(ctx, &sso.LoginRequest{Email: "miku@example.com", Password: "password", Fingerprint: "browser"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// a verified certificate without a known identity still needs a service token
+	unknown := mtlsClient(t, ca, addr, ca.Issue([]string{"unknown.miku-notes.local"}))
+	_, err = unknown.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: "user-access-token"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// certificates of another CA don't get through the handshake
+	other := mtlsClient(t, ca, addr, suite.NewCA(t).Issue(nil, notesServiceID))
+	_, err = other.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: "user-access-token"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestMTLS_CertificateReload(t *testing.T) {
+	t.Parallel()
+
+	ca := suite.NewCA(t)
+	addr, certFile := mtlsServer(t, ca, mock_auth.NewMockAuth(gomock.NewController(t)), nil, nil)
+	clientCert := ca.Issue(nil, notesServiceID)
+
+	servedSerial := func() string {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      ca.Pool(),
+			ServerName:   "localhost",
+			NextProtos:   []string{"h2"},
+		})
+		if err != nil {
+			return ""
+		}
+		defer conn.Close()
+
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.String()
+	}
+
+	before := servedSerial()
+	require.NotEmpty(t, before)
+
+	// rotate the server certificate in place
+	rotated := ca.Issue([]string{"localhost"})
+	suite.WriteCert(t, rotated, certFile, filepath.Join(filepath.Dir(certFile), "server.key"))
+
+	assert.Eventually(t, func() bool {
+		return servedSerial() == rotated.Leaf.SerialNumber.String()
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.NotEqual(t, before, rotated.Leaf.SerialNumber.String())
+}
@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/pkg/oidc"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// name of the provider the test config points at the fake
+const fakeOAuthProvider = "fake"
+
+var (
+	oidcProviderErr error
+	oidcProviderSet sync.Once
+)
+
+func TestOAuth_SignUpThenLogin(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	startFakeOIDCProvider(t, st)
+
+	subject := gofakeit.UUID()
+	email := gofakeit.Email()
+
+	// the first login creates the user
+	state, code := authorizeAtProvider(ctx, t, st, "", subject, email, true)
+	signUpResp, err := st.AuthClient.CompleteOAuth(ctx, &sso.CompleteOAuthRequest{
+		State:       state,
+		Code:        code,
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+	require.NotEmpty(signUpResp.GetAccessToken())
+
+	signUpUser, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: signUpResp.GetAccessToken()})
+	require.NoError(err)
+
+	// the next one finds it by the provider subject
+	state, code = authorizeAtProvider(ctx, t, st, "", subject, email, true)
+	loginResp, err := st.AuthClient.CompleteOAuth(ctx, &sso.CompleteOAuthRequest{
+		State:       state,
+		Code:        code,
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	loginUser, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: loginResp.GetAccessToken()})
+	require.NoError(err)
+	assert.Equal(signUpUser.GetUserId(), loginUser.GetUserId())
+
+	// every state works once
+	_, err = st.AuthClient.CompleteOAuth(ctx, &sso.CompleteOAuthRequest{
+		State: state,
+		Code:  code,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestOAuth_CodeIsBoundToItsState(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	startFakeOIDCProvider(t, st)
+
+	_, stolenCode := authorizeAtProvider(ctx, t, st, "", gofakeit.UUID(), gofakeit.Email(), true)
+	attackerState, _ := authorizeAtProvider(ctx, t, st, "", gofakeit.UUID(), gofakeit.Email(), true)
+
+	// the code verifier of the attacker's login doesn't match the victim's challenge
+	_, err := st.AuthClient.CompleteOAuth(ctx, &sso.CompleteOAuthRequest{
+		State: attackerState,
+		Code:  stolenCode,
+	})
+	require.Error(err)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	_, err = st.AuthClient.StartOAuth(ctx, &sso.StartOAuthRequest{Provider: "unknown"})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestOAuth_ExistingEmailHasToLink(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	startFakeOIDCProvider(t, st)
+
+	email := gofakeit.Email()
+	subject := gofakeit.UUID()
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	state, code := authorizeAtProvider(ctx, t, st, "", subject, email, true)
+	_, err = st.AuthClient.CompleteOAuth(ctx, &sso.CompleteOAuthRequest{State: state, Code: code})
+	require.Error(err)
+	assert.Equal(codes.AlreadyExists, status.Code(err))
+
+	// a logged in user links the provider account
+	state, code = authorizeAtProvider(ctx, t, st, registerResp.GetAccessToken(), subject, email, true)
+	_, err = st.AuthClient.CompleteOAuth(ctx, &sso.CompleteOAuthRequest{State: state, Code: code})
+	require.NoError(err)
+
+	state, code = authorizeAtProvider(ctx, t, st, "", subject, email, true)
+	loginResp, err := st.AuthClient.CompleteOAuth(ctx, &sso.CompleteOAuthRequest{State: state, Code: code})
+	require.NoError(err)
+
+	registered, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: registerResp.GetAccessToken()})
+	require.NoError(err)
+	loggedIn, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: loginResp.GetAccessToken()})
+	require.NoError(err)
+	assert.Equal(registered.GetUserId(), loggedIn.GetUserId())
+}
+
+func TestOAuth_UnverifiedEmail(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	startFakeOIDCProvider(t, st)
+
+	state, code := authorizeAtProvider(ctx, t, st, "", gofakeit.UUID(), gofakeit.Email(), false)
+	_, err := st.AuthClient.CompleteOAuth(ctx, &sso.CompleteOAuthRequest{State: state, Code: code})
+	require.Error(err)
+	assert.Equal(codes.FailedPrecondition, status.Code(err))
+}
+
+// startFakeOIDCProvider serves the issuer of the fake provider from the test config, all tests share it
+func startFakeOIDCProvider(t *testing.T, st *suite.Suite) {
+	t.Helper()
+
+	cfg, ok := st.Cfg.OAuth.Providers[fakeOAuthProvider]
+	u, err := url.Parse(cfg.Issuer)
+	if !ok || err != nil || (u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1") {
+		t.Skip("oauth tests need a provider named \"fake\" with a localhost issuer in the test config")
+	}
+
+	oidcProviderSet.Do(func() {
+		var provider *oidc.FakeProvider
+		provider, oidcProviderErr = oidc.NewFakeProvider(cfg.Issuer, cfg.ClientID, cfg.ClientSecret)
+		if oidcProviderErr != nil {
+			return
+		}
+
+		var lis net.Listener
+		lis, oidcProviderErr = net.Listen("tcp", u.Host)
+		if oidcProviderErr != nil {
+			return
+		}
+
+		go func() { _ = http.Serve(lis, provider) }()
+	})
+	require.NoError(t, oidcProviderErr)
+}
+
+// authorizeAtProvider starts a login and follows the provider's redirect
+// the way a browser would, returning the state and the code it brought back
+func authorizeAtProvider(
+	ctx context.Context,
+	t *testing.T,
+	st *suite.Suite,
+	accessToken, subject, email string,
+	emailVerified bool,
+) (string, string) {
+	t.Helper()
+
+	startResp, err := st.AuthClient.StartOAuth(ctx, &sso.StartOAuthRequest{
+		Provider:    fakeOAuthProvider,
+		AccessToken: accessToken,
+	})
+	require.NoError(t, err)
+
+	authURL, err := url.Parse(startResp.GetAuthorizationUrl())
+	require.NoError(t, err)
+
+	query := authURL.Query()
+	query.Set("sub", subject)
+	query.Set("email", email)
+	query.Set("email_verified", strconv.FormatBool(emailVerified))
+	authURL.RawQuery = query.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL.String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, startResp.GetState(), callback.Query().Get("state"))
+
+	return callback.Query().Get("state"), callback.Query().Get("code")
+}
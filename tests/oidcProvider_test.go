@@ -0,0 +1,246 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/pkg/oidc"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var requestIDField = regexp.MustCompile(`name="request_id" value="([^"]+)"`)
+
+// the login pages are followed by hand, redirects to the client are only read
+var pageClient = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+func TestOIDCProvider_CodeFlow(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	client, _, rp := relyingParty(ctx, t, st)
+
+	email := gofakeit.Email()
+	pass := "Violet-Harbor-Lantern-41"
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: pass, Fingerprint: "fingerprint"})
+	require.NoError(err)
+	registered, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: registerResp.GetAccessToken()})
+	require.NoError(err)
+
+	verifier, nonce := gofakeit.LetterN(43), gofakeit.LetterN(16)
+	authURL, err := rp.AuthCodeURL(ctx, "client-state", nonce, oidc.CodeChallenge(verifier))
+	require.NoError(err)
+
+	requestID := openLoginPage(t, authURL)
+	page := postPage(t, st, "/authorize/login", url.Values{"request_id": {requestID}, "email": {email}, "password": {"wrong password"}})
+	assert.Equal(http.StatusBadRequest, page.StatusCode)
+
+	page = postPage(t, st, "/authorize/login", url.Values{"request_id": {requestID}, "email": {email}, "password": {pass}})
+	require.Equal(http.StatusOK, page.StatusCode)
+
+	page = postPage(t, st, "/authorize/consent", url.Values{"request_id": {requestID}, "decision": {"allow"}})
+	require.Equal(http.StatusSeeOther, page.StatusCode)
+
+	callback, err := url.Parse(page.Header.Get("Location"))
+	require.NoError(err)
+	assert.True(strings.HasPrefix(callback.String(), client.RedirectURIs[0]))
+	assert.Equal("client-state", callback.Query().Get("state"))
+
+	token, err := rp.Exchange(ctx, callback.Query().Get("code"), verifier)
+	require.NoError(err)
+
+	// the id token is checked against the published keys
+	claims, err := rp.VerifyIDToken(ctx, token.IDToken, nonce)
+	require.NoError(err)
+	assert.Equal(fmt.Sprintf("%d", registered.GetUserId()), claims.Subject)
+	assert.Equal(email, claims.Email)
+
+	info, err := rp.UserInfo(ctx, token.AccessToken)
+	require.NoError(err)
+	assert.Equal(claims.Subject, info.Subject)
+	assert.Equal(email, info.Email)
+
+	// the access token of the client is for the provider only, the app's is the other way round
+	_, err = st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: token.AccessToken})
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = rp.UserInfo(ctx, registerResp.GetAccessToken())
+	require.ErrorIs(err, oidc.ErrUserInfo)
+
+	// codes are redeemed once
+	_, err = rp.Exchange(ctx, callback.Query().Get("code"), verifier)
+	require.Error(err)
+}
+
+func TestOIDCProvider_RefreshAndDeny(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	client, secret, rp := relyingParty(ctx, t, st)
+
+	// an unregistered redirect uri is never followed
+	authURL, err := rp.AuthCodeURL(ctx, "state", "nonce", oidc.CodeChallenge(gofakeit.LetterN(43)))
+	require.NoError(err)
+	evil, err := url.Parse(authURL)
+	require.NoError(err)
+	query := evil.Query()
+	query.Set("redirect_uri", "https://attacker.example/callback")
+	evil.RawQuery = query.Encode()
+
+	resp, err := pageClient.Get(evil.String())
+	require.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// the user can say no
+	requestID := openLoginPage(t, authURL)
+	page := postPage(t, st, "/authorize/consent", url.Values{"request_id": {requestID}, "decision": {"deny"}})
+	require.Equal(http.StatusSeeOther, page.StatusCode)
+	denied, err := url.Parse(page.Header.Get("Location"))
+	require.NoError(err)
+	assert.Equal("access_denied", denied.Query().Get("error"))
+	assert.Equal("state", denied.Query().Get("state"))
+
+	// a full login for the refresh token, without the email scope
+	email, pass := gofakeit.Email(), "Violet-Harbor-Lantern-41"
+	_, err = st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: pass, Fingerprint: "fingerprint"})
+	require.NoError(err)
+
+	openidOnly := oidc.New(oidc.Config{
+		Issuer:       st.Cfg.OIDC.Issuer,
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		RedirectURL:  client.RedirectURIs[0],
+		Scopes:       []string{"openid"},
+	}, 10*time.Second)
+
+	verifier := gofakeit.LetterN(43)
+	authURL, err = openidOnly.AuthCodeURL(ctx, "state", "nonce", oidc.CodeChallenge(verifier))
+	require.NoError(err)
+	requestID = openLoginPage(t, authURL)
+	postPage(t, st, "/authorize/login", url.Values{"request_id": {requestID}, "email": {email}, "password": {pass}})
+	page = postPage(t, st, "/authorize/consent", url.Values{"request_id": {requestID}, "decision": {"allow"}})
+	callback, err := url.Parse(page.Header.Get("Location"))
+	require.NoError(err)
+
+	tokens := tokenRequest(t, st, client, secret, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {callback.Query().Get("code")},
+		"redirect_uri":  {client.RedirectURIs[0]},
+		"code_verifier": {verifier},
+	})
+	require.NotEmpty(tokens["refresh_token"])
+
+	refreshed := tokenRequest(t, st, client, secret, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens["refresh_token"].(string)},
+	})
+	require.NotEmpty(refreshed["access_token"])
+	assert.Equal("openid", refreshed["scope"])
+
+	// the refreshed token keeps the scope, the email wasn't granted
+	info, err := openidOnly.UserInfo(ctx, refreshed["access_token"].(string))
+	require.NoError(err)
+	assert.NotEmpty(info.Subject)
+	assert.Empty(info.Email)
+
+	_, err = st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: refreshed["access_token"].(string)})
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	// the session of the client can't be refreshed as the app's
+	_, err = st.AuthClient.GetAccessToken(ctx, &sso.GetATRequest{
+		RefreshToken: tokens["refresh_token"].(string),
+		Fingerprint:  "oidc:" + client.ClientID,
+	})
+	assert.Equal(codes.NotFound, status.Code(err))
+}
+
+// relyingParty registers a confidential client of the provider
+func relyingParty(ctx context.Context, t *testing.T, st *suite.Suite) (models.Client, string, *oidc.Client) {
+	t.Helper()
+
+	if st.Cfg.OIDC.Issuer == "" {
+		t.Skip("oidc provider tests need an issuer in the test config")
+	}
+
+	client, secret := st.RegisterClient(ctx, models.Client{
+		ClientID:     "notes-extension",
+		Name:         "Notes Extension",
+		GrantTypes:   []string{models.GrantAuthorizationCode, models.GrantRefreshToken},
+		RedirectURIs: []string{"http://localhost:9999/callback"},
+		Scopes:       []string{"openid", "email"},
+	}, false)
+
+	rp := oidc.New(oidc.Config{
+		Issuer:       st.Cfg.OIDC.Issuer,
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		RedirectURL:  client.RedirectURIs[0],
+	}, 10*time.Second)
+
+	return client, secret, rp
+}
+
+// openLoginPage returns the request id the login pages post back
+func openLoginPage(t *testing.T, authURL string) string {
+	t.Helper()
+
+	resp, err := pageClient.Get(authURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	match := requestIDField.FindStringSubmatch(string(body))
+	require.Len(t, match, 2)
+
+	return match[1]
+}
+
+func postPage(t *testing.T, st *suite.Suite, path string, form url.Values) *http.Response {
+	t.Helper()
+
+	resp, err := pageClient.PostForm(st.Cfg.OIDC.Issuer+path, form)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	return resp
+}
+
+func tokenRequest(t *testing.T, st *suite.Suite, client models.Client, secret string, form url.Values) map[string]any {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, st.Cfg.OIDC.Issuer+"/token", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(client.ClientID), url.QueryEscape(secret))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body
+}
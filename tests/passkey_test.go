@@ -0,0 +1,334 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPasskey_SecondFactor(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithPasskeys())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	pass := "Violet-Harbor-Lantern-41"
+	fingerprint := "fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	authenticator := registerPasskey(ctx, t, st, registerResp.GetAccessToken())
+
+	// the tokens after the second factor follow the grants of the client
+	kiosk, _ := st.RegisterClient(ctx, models.Client{
+		ClientID:   "kiosk",
+		GrantTypes: []string{models.GrantPassword},
+	}, true)
+
+	// with a passkey the password alone gives only a challenge
+	loginResp, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+		ClientId:    kiosk.ClientID,
+	})
+	require.NoError(err)
+	assert.Empty(loginResp.GetAccessToken())
+	assert.Equal("mfa_required", loginResp.GetReason())
+
+	beginResp, err := st.AuthClient.BeginPasskeyLogin(ctx, &sso.BeginPasskeyLoginRequest{
+		ChallengeToken: loginResp.GetRestrictedToken(),
+	})
+	require.NoError(err)
+
+	// after the password, presence is enough
+	clientDataJSON, authData, signature := authenticator.get(t, beginResp.GetOptions(), false)
+	finishReq := &sso.FinishPasskeyLoginRequest{
+		SessionId:         beginResp.GetSessionId(),
+		CredentialId:      authenticator.credentialID,
+		ClientDataJson:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		Fingerprint:       fingerprint,
+	}
+
+	finishResp, err := st.AuthClient.FinishPasskeyLogin(ctx, finishReq)
+	require.NoError(err)
+	require.NotEmpty(finishResp.GetAccessToken())
+	assert.Empty(finishResp.GetRefreshToken())
+
+	// the challenge is answered once
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, finishReq)
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestPasskey_Passwordless(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithPasskeys())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	fingerprint := "fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       gofakeit.Email(),
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	authenticator := registerPasskey(ctx, t, st, registerResp.GetAccessToken())
+
+	// replacing the password needs the user verified by the authenticator
+	beginResp, err := st.AuthClient.BeginPasskeyLogin(ctx, &sso.BeginPasskeyLoginRequest{})
+	require.NoError(err)
+
+	clientDataJSON, authData, signature := authenticator.get(t, beginResp.GetOptions(), false)
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, &sso.FinishPasskeyLoginRequest{
+		SessionId:         beginResp.GetSessionId(),
+		CredentialId:      authenticator.credentialID,
+		ClientDataJson:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		Fingerprint:       fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	beginResp, err = st.AuthClient.BeginPasskeyLogin(ctx, &sso.BeginPasskeyLoginRequest{})
+	require.NoError(err)
+
+	clientDataJSON, authData, signature = authenticator.get(t, beginResp.GetOptions(), true)
+	finishResp, err := st.AuthClient.FinishPasskeyLogin(ctx, &sso.FinishPasskeyLoginRequest{
+		SessionId:         beginResp.GetSessionId(),
+		CredentialId:      authenticator.credentialID,
+		ClientDataJson:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		Fingerprint:       fingerprint,
+	})
+	require.NoError(err)
+	require.NotEmpty(finishResp.GetAccessToken())
+
+	// the passkey logs in its owner
+	ownerResp, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: registerResp.GetAccessToken()})
+	require.NoError(err)
+	validateResp, err := st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: finishResp.GetAccessToken()})
+	require.NoError(err)
+	assert.Equal(ownerResp.GetUserId(), validateResp.GetUserId())
+}
+
+func TestPasskey_CounterGoingBackIsRefused(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithPasskeys())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       gofakeit.Email(),
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	authenticator := registerPasskey(ctx, t, st, registerResp.GetAccessToken())
+
+	login := func() error {
+		beginResp, err := st.AuthClient.BeginPasskeyLogin(ctx, &sso.BeginPasskeyLoginRequest{})
+		require.NoError(err)
+
+		clientDataJSON, authData, signature := authenticator.get(t, beginResp.GetOptions(), true)
+		_, err = st.AuthClient.FinishPasskeyLogin(ctx, &sso.FinishPasskeyLoginRequest{
+			SessionId:         beginResp.GetSessionId(),
+			CredentialId:      authenticator.credentialID,
+			ClientDataJson:    clientDataJSON,
+			AuthenticatorData: authData,
+			Signature:         signature,
+			Fingerprint:       "fingerprint",
+		})
+
+		return err
+	}
+
+	require.NoError(login())
+	require.NoError(login())
+
+	// a copy of the key made before the last login counts from an older value
+	authenticator.signCount = 1
+	err = login()
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func registerPasskey(ctx context.Context, t *testing.T, st *suite.Suite, accessToken string) *fakeAuthenticator {
+	t.Helper()
+
+	authenticator := newFakeAuthenticator(t, st.Cfg.WebAuthn.RPID, st.Cfg.WebAuthn.Origins[0])
+
+	beginResp, err := st.AuthClient.BeginPasskeyRegistration(ctx, &sso.BeginPasskeyRegistrationRequest{
+		AccessToken: accessToken,
+	})
+	require.NoError(t, err)
+
+	clientDataJSON, attestationObject := authenticator.create(t, beginResp.GetOptions())
+	_, err = st.AuthClient.FinishPasskeyRegistration(ctx, &sso.FinishPasskeyRegistrationRequest{
+		AccessToken:       accessToken,
+		SessionId:         beginResp.GetSessionId(),
+		ClientDataJson:    clientDataJSON,
+		AttestationObject: attestationObject,
+	})
+	require.NoError(t, err)
+
+	return authenticator
+}
+
+// fakeAuthenticator plays a platform authenticator with a P-256 key
+type fakeAuthenticator struct {
+	origin       string
+	rpIDHash     [32]byte
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func newFakeAuthenticator(t *testing.T, rpID, origin string) *fakeAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	require.NoError(t, err)
+
+	return &fakeAuthenticator{
+		origin:       origin,
+		rpIDHash:     sha256.Sum256([]byte(rpID)),
+		key:          key,
+		credentialID: credentialID,
+	}
+}
+
+// create answers navigator.credentials.create with "none" attestation
+func (a *fakeAuthenticator) create(t *testing.T, options string) ([]byte, []byte) {
+	clientDataJSON := a.clientData(t, options, "webauthn.create")
+
+	coseKey := cborEncode(cborMap{
+		{1, 2},  // kty: EC2
+		{3, -7}, // alg: ES256
+		{-1, 1}, // crv: P-256
+		{-2, a.key.X.FillBytes(make([]byte, 32))},
+		{-3, a.key.Y.FillBytes(make([]byte, 32))},
+	})
+
+	authData := a.authData(0x01|0x04|0x40, 0)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, coseKey...)
+
+	attestationObject := cborEncode(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", authData},
+	})
+
+	return clientDataJSON, attestationObject
+}
+
+// get answers navigator.credentials.get, verified tells whether the user unlocked the key
+func (a *fakeAuthenticator) get(t *testing.T, options string, verified bool) ([]byte, []byte, []byte) {
+	clientDataJSON := a.clientData(t, options, "webauthn.get")
+
+	flags := byte(0x01)
+	if verified {
+		flags |= 0x04
+	}
+	a.signCount++
+	authData := a.authData(flags, a.signCount)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	return clientDataJSON, authData, signature
+}
+
+func (a *fakeAuthenticator) clientData(t *testing.T, options, ceremony string) []byte {
+	var parsed struct {
+		Challenge string `json:"challenge"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(options), &parsed))
+
+	clientDataJSON, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": parsed.Challenge,
+		"origin":    a.origin,
+	})
+	require.NoError(t, err)
+
+	return clientDataJSON
+}
+
+func (a *fakeAuthenticator) authData(flags byte, signCount uint32) []byte {
+	data := append(a.rpIDHash[:0:0], a.rpIDHash[:]...)
+	data = append(data, flags)
+
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// cborMap keeps the key order of the encoded map
+type cborMap [][2]any
+
+// cborEncode covers what the fake authenticator sends
+func cborEncode(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		default:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		}
+	}
+
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case cborMap:
+		out := head(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, cborEncode(pair[0])...)
+			out = append(out, cborEncode(pair[1])...)
+		}
+		return out
+	}
+
+	panic(fmt.Sprintf("cborEncode: unsupported type %T", v))
+}
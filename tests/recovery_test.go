@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecovery_CodeSetsNewPassword(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	oldPass := "Violet-Harbor-Lantern-41"
+	newPass := "Quiet-Marble-Orchard-73"
+	fingerprint := "fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    oldPass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	codesResp, err := st.AuthClient.GenerateRecoveryCodes(ctx, &sso.GenerateRecoveryCodesRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+	require.Len(codesResp.GetCodes(), 10)
+	code := codesResp.GetCodes()[0]
+
+	// codes are accepted however they were typed from paper
+	recoverResp, err := st.AuthClient.RecoverAccount(ctx, &sso.RecoverAccountRequest{
+		Email: email,
+		Code:  " " + strings.ToUpper(code) + " ",
+	})
+	require.NoError(err)
+	require.NotEmpty(recoverResp.GetRestrictedToken())
+
+	// the restricted token isn't an access token
+	_, err = st.AuthClient.ValidateAccessToken(ctx, &sso.ValidateATRequest{AccessToken: recoverResp.GetRestrictedToken()})
+	require.Error(err)
+
+	setResp, err := st.AuthClient.SetNewPassword(ctx, &sso.SetNewPasswordRequest{
+		RestrictedToken: recoverResp.GetRestrictedToken(),
+		NewPassword:     newPass,
+		Fingerprint:     fingerprint,
+	})
+	require.NoError(err)
+	assert.NotEmpty(setResp.GetAccessToken())
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    newPass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	// every code works only once
+	_, err = st.AuthClient.RecoverAccount(ctx, &sso.RecoverAccountRequest{
+		Email: email,
+		Code:  code,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestRecovery_RegenerateInvalidatesOldCodes(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	oldResp, err := st.AuthClient.GenerateRecoveryCodes(ctx, &sso.GenerateRecoveryCodesRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+
+	newResp, err := st.AuthClient.GenerateRecoveryCodes(ctx, &sso.GenerateRecoveryCodesRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+
+	_, err = st.AuthClient.RecoverAccount(ctx, &sso.RecoverAccountRequest{
+		Email: email,
+		Code:  oldResp.GetCodes()[0],
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.RecoverAccount(ctx, &sso.RecoverAccountRequest{
+		Email: email,
+		Code:  newResp.GetCodes()[0],
+	})
+	require.NoError(err)
+}
+
+func TestRecovery_KeepsClient(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	fingerprint := "fingerprint"
+
+	// a client without refresh tokens, the tokens after recovery follow its grants
+	kiosk, _ := st.RegisterClient(ctx, models.Client{
+		ClientID:   "kiosk",
+		GrantTypes: []string{models.GrantPassword},
+	}, true)
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: fingerprint,
+		ClientId:    kiosk.ClientID,
+	})
+	require.NoError(err)
+
+	codesResp, err := st.AuthClient.GenerateRecoveryCodes(ctx, &sso.GenerateRecoveryCodesRequest{
+		AccessToken: registerResp.GetAccessToken(),
+	})
+	require.NoError(err)
+
+	// clients without the password grant can't recover accounts
+	partner, _ := st.RegisterClient(ctx, models.Client{
+		ClientID:     "partner",
+		GrantTypes:   []string{models.GrantAuthorizationCode},
+		RedirectURIs: []string{"http://localhost:9999/callback"},
+	}, false)
+
+	_, err = st.AuthClient.RecoverAccount(ctx, &sso.RecoverAccountRequest{
+		Email:    email,
+		Code:     codesResp.GetCodes()[0],
+		ClientId: partner.ClientID,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	recoverResp, err := st.AuthClient.RecoverAccount(ctx, &sso.RecoverAccountRequest{
+		Email:    email,
+		Code:     codesResp.GetCodes()[0],
+		ClientId: kiosk.ClientID,
+	})
+	require.NoError(err)
+
+	setResp, err := st.AuthClient.SetNewPassword(ctx, &sso.SetNewPasswordRequest{
+		RestrictedToken: recoverResp.GetRestrictedToken(),
+		NewPassword:     "Quiet-Marble-Orchard-73",
+		Fingerprint:     fingerprint,
+	})
+	require.NoError(err)
+	assert.NotEmpty(setResp.GetAccessToken())
+	assert.Empty(setResp.GetRefreshToken())
+}
@@ -2,7 +2,9 @@ package tests
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,12 +13,19 @@ import (
 	"github.com/golang/mock/gomock"
 	sso "github.com/kuromii5/miku-notes-auth/generated"
 	"github.com/kuromii5/miku-notes-auth/internal/auth"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
 	"github.com/kuromii5/miku-notes-auth/internal/service"
+	"github.com/kuromii5/miku-notes-auth/pkg/hasher"
 	"github.com/kuromii5/miku-notes-auth/tests/suite"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+var confirmationCodeRe = regexp.MustCompile(`confirmation code is (\d{6})`)
+
 func TestRegisterLoginHappyPath(t *testing.T) {
 	// ----------------------------------------- REGISTER AND LOGIN TEST ---------------------------------
 	ctx, st := suite.NewSuite(t)
@@ -75,12 +84,13 @@ func TestRegisterLoginHappyPath(t *testing.T) {
 
 	// Setup mock expectation for ValidateRefreshToken
 	mockUserGetter := st.Mocks.UserGetter
-	mockUserGetter.EXPECT().UserID(gomock.Any(), refreshToken, fingerprint).Return(subject, nil)
+	mockUserGetter.EXPECT().UserID(gomock.Any(), refreshToken, fingerprint).Return(subject, "", "", nil)
 
 	// Validate refresh token using token manager instance
-	userIDFromRefresh, err := st.TokenManager.ValidateRefreshToken(ctx, refreshToken, fingerprint)
+	refresh, err := st.TokenManager.ValidateRefreshToken(ctx, refreshToken, fingerprint)
 	require.NoError(err)
-	assert.Equal(userIDFromRefresh, int32(parsedUserID))
+	assert.Equal(refresh.UserID, int32(parsedUserID))
+	assert.Empty(refresh.ClientID)
 }
 
 func TestRegisterLogin_DoubleRegistration(t *testing.T) {
@@ -134,7 +144,7 @@ func TestRegisterLogin_FailCases(t *testing.T) {
 			name:        "Short Password",
 			email:       "test@example.com",
 			password:    "short",
-			expectedErr: auth.ErrShortPassword.Error(),
+			expectedErr: fmt.Sprintf("min password length is %d", st.Cfg.PasswordPolicy.MinLength),
 		},
 		{
 			name:        "Long Email",
@@ -145,8 +155,8 @@ func TestRegisterLogin_FailCases(t *testing.T) {
 		{
 			name:        "Long Password",
 			email:       "test@example.com",
-			password:    string(make([]byte, 65)),
-			expectedErr: auth.ErrLongPassword.Error(),
+			password:    string(make([]byte, st.Cfg.PasswordPolicy.MaxLength+1)),
+			expectedErr: fmt.Sprintf("max password length is %d", st.Cfg.PasswordPolicy.MaxLength),
 		},
 		{
 			name:        "Missing Email",
@@ -163,7 +173,7 @@ func TestRegisterLogin_FailCases(t *testing.T) {
 		{
 			name:        "Invalid Login Credentials",
 			email:       "nonexistent@example.com",
-			password:    "wrongpassword",
+			password:    "Wr0ng-Pa55-Kettle",
 			expectedErr: service.ErrUserExists.Error(),
 		},
 	}
@@ -187,3 +197,142 @@ func TestRegisterLogin_FailCases(t *testing.T) {
 	require.Error(err)
 	require.ErrorContains(err, service.ErrInvalidCreds.Error())
 }
+
+func TestRegisterLogin_EmailCaseInsensitive(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	pass := gofakeit.Password(true, true, true, true, false, 8)
+	fingerprint := "fingerprint"
+
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       strings.ToUpper(email),
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	// the same address in another case is the same account
+	_, err = st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       strings.ToLower(email),
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	require.ErrorContains(err, "user already exists")
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       strings.ToLower(email),
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+}
+
+func TestRegister_AntiEnumerationConfirmsEmail(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithAntiEnumeration())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	pass := "Violet-Harbor-Lantern-41"
+	fingerprint := "fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	assert.Empty(registerResp.GetAccessToken())
+	assert.NotEmpty(registerResp.GetMessage())
+
+	mail := readMail(t, st, email)
+	assert.Contains(mail, "Confirm your email")
+	code := confirmationCodeRe.FindStringSubmatch(mail)
+	require.NotNil(code, "no confirmation code in the email")
+
+	// the password is useless until the email is confirmed
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+
+	loginResp, err := st.AuthClient.LoginWithCode(ctx, &sso.LoginWithCodeRequest{
+		Email:       email,
+		Code:        code[1],
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	assert.NotEmpty(loginResp.GetAccessToken())
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+}
+
+func TestRegister_AntiEnumerationNotifiesOwner(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithAntiEnumeration())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := strings.ToLower(gofakeit.Email())
+	pass := "Violet-Harbor-Lantern-41"
+
+	// an existing account made directly, signing it up first would start the email cooldown
+	hash, err := hasher.NewBcrypt(4).Hash([]byte(pass))
+	require.NoError(err)
+	imported, err := st.DB().ImportUsers(ctx, []models.User{{Email: email, PasswordHash: hash}})
+	require.NoError(err)
+	require.Equal(1, imported)
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+	assert.Empty(registerResp.GetAccessToken())
+
+	mail := readMail(t, st, email)
+	assert.Contains(mail, "You already have an account")
+	assert.NotRegexp(confirmationCodeRe, mail)
+}
+
+func TestRegister_PasswordPolicyViolations(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	require := require.New(st.T)
+
+	// short, contains the email and is easy to guess all at once
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       "kettle@example.com",
+		Password:    "kettle1",
+		Fingerprint: "fingerprint",
+	})
+	require.Error(err)
+	require.Equal(codes.InvalidArgument, status.Code(err))
+
+	var badRequest *errdetails.BadRequest
+	for _, detail := range status.Convert(err).Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			badRequest = br
+		}
+	}
+	require.NotNil(badRequest)
+
+	var descriptions []string
+	for _, v := range badRequest.GetFieldViolations() {
+		require.Equal("password", v.GetField())
+		descriptions = append(descriptions, v.GetDescription())
+	}
+	require.Contains(descriptions, fmt.Sprintf("min password length is %d", st.Cfg.PasswordPolicy.MinLength))
+	require.Contains(descriptions, "password must not contain your email")
+	require.Contains(descriptions, "password is too easy to guess")
+}
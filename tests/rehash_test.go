@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/pkg/hasher"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogin_RehashesOutdatedHash(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := strings.ToLower(gofakeit.Email())
+	pass := "Violet-Harbor-Lantern-41"
+
+	// an imported user with the cheapest bcrypt, which is never the current algorithm
+	oldHash, err := hasher.NewBcrypt(4).Hash([]byte(pass))
+	require.NoError(err)
+	imported, err := st.DB().ImportUsers(ctx, []models.User{{Email: email, PasswordHash: oldHash}})
+	require.NoError(err)
+	require.Equal(1, imported)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: pass, Fingerprint: "browser"})
+	require.NoError(err)
+
+	user, err := st.DB().User(ctx, email)
+	require.NoError(err)
+	assert.False(bytes.Equal(oldHash, user.PasswordHash), "hash wasn't upgraded on login")
+
+	// the upgraded hash keeps working and isn't replaced again
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: pass, Fingerprint: "browser"})
+	require.NoError(err)
+
+	again, err := st.DB().User(ctx, email)
+	require.NoError(err)
+	assert.Equal(user.PasswordHash, again.PasswordHash)
+}
@@ -0,0 +1,349 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/config"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/pkg/sms"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	smsCodeRe      = regexp.MustCompile(`code is (\d{6})`)
+	phoneFormatRe  = regexp.MustCompile(`[^+\d]`)
+	smsProvider    *sms.Memory
+	smsProviderErr error
+	smsProviderSet sync.Once
+)
+
+func TestSMS_SecondFactor(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	provider := fakeSMSProvider(t, st)
+
+	email := gofakeit.Email()
+	pass := "Violet-Harbor-Lantern-41"
+	phone := randomPhone()
+	fingerprint := "fingerprint"
+
+	registerWithPhone(ctx, t, st, provider, email, pass, phone)
+
+	// a verified phone is a second factor
+	loginResp, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	assert.Empty(loginResp.GetAccessToken())
+	assert.Equal(models.ReasonMFARequired, loginResp.GetReason())
+	challenge := loginResp.GetRestrictedToken()
+
+	_, err = st.AuthClient.SendLoginSMS(ctx, &sso.SendLoginSMSRequest{ChallengeToken: challenge})
+	require.NoError(err)
+	code := lastSMSCode(t, provider, phone)
+
+	_, err = st.AuthClient.VerifySMS(ctx, &sso.VerifySMSRequest{
+		ChallengeToken: challenge,
+		Code:           wrongCode(code),
+		Fingerprint:    fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	verifyResp, err := st.AuthClient.VerifySMS(ctx, &sso.VerifySMSRequest{
+		ChallengeToken: challenge,
+		Code:           code,
+		Fingerprint:    fingerprint,
+	})
+	require.NoError(err)
+	require.NotEmpty(verifyResp.GetAccessToken())
+
+	// the code works once
+	_, err = st.AuthClient.VerifySMS(ctx, &sso.VerifySMSRequest{
+		ChallengeToken: challenge,
+		Code:           code,
+		Fingerprint:    fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestSMS_Recovery(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	provider := fakeSMSProvider(t, st)
+
+	email := gofakeit.Email()
+	phone := randomPhone()
+	fingerprint := "fingerprint"
+
+	registerWithPhone(ctx, t, st, provider, email, "Violet-Harbor-Lantern-41", phone)
+
+	// the tokens after recovery follow the grants of the client
+	kiosk, _ := st.RegisterClient(ctx, models.Client{
+		ClientID:   "kiosk",
+		GrantTypes: []string{models.GrantPassword},
+	}, true)
+
+	// unknown emails get the same answer
+	unknownResp, err := st.AuthClient.RequestRecoverySMS(ctx, &sso.RequestRecoverySMSRequest{Email: gofakeit.Email()})
+	require.NoError(err)
+
+	recoveryResp, err := st.AuthClient.RequestRecoverySMS(ctx, &sso.RequestRecoverySMSRequest{Email: email})
+	require.NoError(err)
+	assert.Equal(unknownResp.GetMessage(), recoveryResp.GetMessage())
+	code := lastSMSCode(t, provider, phone)
+
+	recoverResp, err := st.AuthClient.RecoverWithSMS(ctx, &sso.RecoverWithSMSRequest{
+		Email:    email,
+		Code:     code,
+		ClientId: kiosk.ClientID,
+	})
+	require.NoError(err)
+	require.NotEmpty(recoverResp.GetRestrictedToken())
+
+	setResp, err := st.AuthClient.SetNewPassword(ctx, &sso.SetNewPasswordRequest{
+		RestrictedToken: recoverResp.GetRestrictedToken(),
+		NewPassword:     "Quiet-Marble-Orchard-73",
+		Fingerprint:     fingerprint,
+	})
+	require.NoError(err)
+	assert.NotEmpty(setResp.GetAccessToken())
+	assert.Empty(setResp.GetRefreshToken())
+
+	// the code works once
+	_, err = st.AuthClient.RecoverWithSMS(ctx, &sso.RecoverWithSMSRequest{
+		Email: email,
+		Code:  code,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestSMS_RecoveryRefusedWithStrongerFactor(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithPasskeys())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	provider := fakeSMSProvider(t, st)
+
+	email := gofakeit.Email()
+	phone := randomPhone()
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	_, err = st.AuthClient.SetPhone(ctx, &sso.SetPhoneRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		Phone:       phone,
+	})
+	require.NoError(err)
+
+	_, err = st.AuthClient.VerifyPhone(ctx, &sso.VerifyPhoneRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		Code:        lastSMSCode(t, provider, phone),
+	})
+	require.NoError(err)
+
+	// the code is sent while the phone is the only factor
+	_, err = st.AuthClient.RequestRecoverySMS(ctx, &sso.RequestRecoverySMSRequest{Email: email})
+	require.NoError(err)
+	code := lastSMSCode(t, provider, phone)
+
+	registerPasskey(ctx, t, st, registerResp.GetAccessToken())
+
+	// the phone alone can't replace the passkey
+	_, err = st.AuthClient.RecoverWithSMS(ctx, &sso.RecoverWithSMSRequest{
+		Email: email,
+		Code:  code,
+	})
+	require.Error(err)
+	assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	// new requests get the usual answer but no message
+	_, err = st.AuthClient.RequestRecoverySMS(ctx, &sso.RequestRecoverySMSRequest{Email: email})
+	require.NoError(err)
+	assert.Equal(code, lastSMSCode(t, provider, phone))
+}
+
+func TestSMS_PerNumberLimit(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	fakeSMSProvider(t, st)
+
+	limit := st.Cfg.SMS.PerNumberLimit
+	if limit == 0 || st.Cfg.SMS.PerIPLimit != 0 && st.Cfg.SMS.PerIPLimit <= limit {
+		t.Skip("the per number limit has to be on and below the per address limit")
+	}
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       gofakeit.Email(),
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	phone := randomPhone()
+	for range limit {
+		_, err := st.AuthClient.SetPhone(ctx, &sso.SetPhoneRequest{
+			AccessToken: registerResp.GetAccessToken(),
+			Phone:       phone,
+		})
+		require.NoError(err)
+	}
+
+	_, err = st.AuthClient.SetPhone(ctx, &sso.SetPhoneRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		Phone:       phone,
+	})
+	require.Error(err)
+	assert.Equal(codes.ResourceExhausted, status.Code(err))
+
+	_, err = st.AuthClient.SetPhone(ctx, &sso.SetPhoneRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		Phone:       "+0 123",
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestSMS_PerForwardedIPLimit(t *testing.T) {
+	ctx, st := suite.NewSuite(t, func(_ *testing.T, cfg *config.Config) {
+		cfg.SMS.PerNumberLimit = 0
+		cfg.SMS.PerIPLimit = 2
+	})
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	fakeSMSProvider(t, st)
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       gofakeit.Email(),
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	setPhone := func(ip string) error {
+		_, err := st.AuthClient.SetPhone(metadata.AppendToOutgoingContext(ctx, "x-client-ip", ip), &sso.SetPhoneRequest{
+			AccessToken: registerResp.GetAccessToken(),
+			Phone:       randomPhone(),
+		})
+
+		return err
+	}
+
+	// every request comes over the gateway connection, the limit follows the user behind it
+	for range 2 {
+		require.NoError(setPhone("203.0.113.7"))
+	}
+
+	err = setPhone("203.0.113.7")
+	require.Error(err)
+	assert.Equal(codes.ResourceExhausted, status.Code(err))
+
+	require.NoError(setPhone("198.51.100.23"))
+}
+
+// fakeSMSProvider serves the provider url of the test config, all tests share it
+func fakeSMSProvider(t *testing.T, st *suite.Suite) *sms.Memory {
+	t.Helper()
+
+	u, err := url.Parse(st.Cfg.SMS.ProviderURL)
+	if st.Cfg.SMS.ProviderURL == "" || err != nil || (u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1") {
+		t.Skip("sms tests need a localhost provider url in the test config")
+	}
+
+	smsProviderSet.Do(func() {
+		var lis net.Listener
+		lis, smsProviderErr = net.Listen("tcp", u.Host)
+		if smsProviderErr != nil {
+			return
+		}
+
+		smsProvider = sms.NewMemory()
+		mux := http.NewServeMux()
+		mux.Handle(u.Path, smsProvider)
+
+		go func() { _ = http.Serve(lis, mux) }()
+	})
+	require.NoError(t, smsProviderErr)
+
+	return smsProvider
+}
+
+// registerWithPhone registers a user and verifies a phone number for it
+func registerWithPhone(ctx context.Context, t *testing.T, st *suite.Suite, provider *sms.Memory, email, pass, phone string) {
+	t.Helper()
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.SetPhone(ctx, &sso.SetPhoneRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		Phone:       phone,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.VerifyPhone(ctx, &sso.VerifyPhoneRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		Code:        lastSMSCode(t, provider, phone),
+	})
+	require.NoError(t, err)
+}
+
+func lastSMSCode(t *testing.T, provider *sms.Memory, phone string) string {
+	t.Helper()
+
+	text, ok := provider.Last(phoneFormatRe.ReplaceAllString(phone, ""))
+	require.True(t, ok, "no sms was sent to %s", phone)
+
+	code := smsCodeRe.FindStringSubmatch(text)
+	require.NotNil(t, code, "no code in the sms")
+
+	return code[1]
+}
+
+// randomPhone is written the way people type it, the service normalizes it
+func randomPhone() string {
+	return fmt.Sprintf("+44 7700 %06d", rand.IntN(1_000_000))
+}
+
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+
+	return "000000"
+}
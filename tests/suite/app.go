@@ -0,0 +1,110 @@
+package suite
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"testing"
+
+	"github.com/kuromii5/miku-notes-auth/internal/app"
+	"github.com/kuromii5/miku-notes-auth/internal/config"
+	offlog "github.com/kuromii5/miku-notes-auth/pkg/logger/off"
+	"github.com/kuromii5/miku-notes-auth/pkg/secretbox"
+)
+
+// Option changes the test config. A suite with options doesn't use the server
+// started for the whole run but its own in-process one with the changed config.
+type Option func(t *testing.T, cfg *config.Config)
+
+// WithOutbox writes emails to a temporary directory the test reads them from
+func WithOutbox() Option {
+	return func(t *testing.T, cfg *config.Config) {
+		cfg.Mail.SMTPHost = ""
+		cfg.Mail.OutboxDir = t.TempDir()
+	}
+}
+
+// WithAntiEnumeration turns the anti-enumeration mode on, its emails go to the outbox
+func WithAntiEnumeration() Option {
+	return func(t *testing.T, cfg *config.Config) {
+		WithOutbox()(t, cfg)
+		cfg.AntiEnumeration = true
+	}
+}
+
+// WithMFA sets a random encryption key for TOTP secrets and accepts a step of clock drift
+func WithMFA() Option {
+	return func(t *testing.T, cfg *config.Config) {
+		key := make([]byte, secretbox.KeyLength)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatalf("failed to generate mfa key: %v", err)
+		}
+
+		cfg.MFA.EncryptionKey = base64.StdEncoding.EncodeToString(key)
+		cfg.MFA.Skew = max(cfg.MFA.Skew, 1)
+	}
+}
+
+// WithPasskeys scopes passkeys to localhost, the page of the web app calls the authenticator
+func WithPasskeys() Option {
+	return func(_ *testing.T, cfg *config.Config) {
+		cfg.WebAuthn.RPID = "localhost"
+		cfg.WebAuthn.Origins = []string{"http://localhost:3000"}
+	}
+}
+
+// startApp runs the service with the config on free ports until the test ends.
+// It shares the database and redis with the server of the whole run.
+func startApp(t *testing.T, cfg *config.Config) {
+	t.Helper()
+
+	cfg.GRPC.Port = freePort(t)
+	cfg.GRPC.AdminPort = freePort(t)
+	// the provider keeps to the server of the whole run, its issuer url points there
+	cfg.OIDC.Issuer = ""
+
+	application := app.New(
+		offlog.New(),
+		cfg.GRPC.Port,
+		cfg.GRPC.AdminPort,
+		cfg.GRPC.AdminConnectionToken,
+		cfg.GRPC.TLS,
+		cfg.GRPC.Callers,
+		cfg.Postgres.ConnString(),
+		cfg.Tokens.Secret,
+		cfg.Tokens.RedisAddr,
+		cfg.Tokens.AccessTTL,
+		cfg.Tokens.RefreshTTL,
+		cfg.Tokens.ServiceTTL,
+		cfg.Lockout,
+		cfg.Email,
+		cfg.Hasher,
+		cfg.Breach,
+		cfg.PasswordPolicy,
+		cfg.MFA,
+		cfg.WebAuthn,
+		cfg.Mail,
+		cfg.LoginCode,
+		cfg.TrustedDevices,
+		cfg.SMS,
+		cfg.OAuth,
+		cfg.OIDC,
+		cfg.DeviceGrant,
+		cfg.AntiEnumeration,
+	)
+
+	go application.Server.MustRun()
+	t.Cleanup(application.Server.Shutdown)
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
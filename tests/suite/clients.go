@@ -0,0 +1,39 @@
+package suite
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/kuromii5/miku-notes-auth/internal/models"
+	"github.com/kuromii5/miku-notes-auth/internal/service/issuer"
+)
+
+// RegisterClient saves the client to the test database like cmd/clients does,
+// under a fresh id. The secret is empty for public clients.
+func (s *Suite) RegisterClient(ctx context.Context, client models.Client, public bool) (models.Client, string) {
+	s.Helper()
+
+	client.ClientID += "-" + randomString(s)
+
+	var secret string
+	if !public {
+		secret = randomString(s)
+		client.SecretHash = issuer.HashSecret(secret)
+	}
+
+	if err := s.DB().SaveClient(ctx, client); err != nil {
+		s.Fatalf("failed to save client: %v", err)
+	}
+
+	return client, secret
+}
+
+func randomString(s *Suite) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		s.Fatalf("failed to generate random string: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,28 @@
+package suite
+
+import (
+	"sync"
+
+	"github.com/kuromii5/miku-notes-auth/internal/repo/postgres"
+)
+
+// one pool for every test of the run
+var (
+	dbOnce sync.Once
+	db     *postgres.DB
+	dbErr  error
+)
+
+// DB returns the test database, for setups the API can't make
+func (s *Suite) DB() *postgres.DB {
+	s.Helper()
+
+	dbOnce.Do(func() {
+		db, dbErr = postgres.New(s.Cfg.Postgres.ConnString())
+	})
+	if dbErr != nil {
+		s.Fatalf("postgres connection failed: %v", dbErr)
+	}
+
+	return db
+}
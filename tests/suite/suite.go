@@ -9,7 +9,9 @@ import (
 
 	"github.com/golang/mock/gomock"
 	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/auth"
 	"github.com/kuromii5/miku-notes-auth/internal/config"
+	"github.com/kuromii5/miku-notes-auth/internal/models"
 	"github.com/kuromii5/miku-notes-auth/internal/service/tokens"
 	mock_tokens "github.com/kuromii5/miku-notes-auth/internal/service/tokens/mock"
 	"github.com/kuromii5/miku-notes-auth/pkg/logger"
@@ -22,6 +24,7 @@ type Suite struct {
 	*testing.T
 	Cfg          *config.Config
 	AuthClient   sso.AuthClient
+	AdminClient  sso.AuthAdminClient
 	TokenManager *tokens.TokenManager
 	Mocks        *Mocks
 }
@@ -31,7 +34,7 @@ type Mocks struct {
 	UserGetter          *mock_tokens.MockUserGetter
 }
 
-func NewSuite(t *testing.T) (context.Context, *Suite) {
+func NewSuite(t *testing.T, options ...Option) (context.Context, *Suite) {
 	t.Helper()
 	t.Parallel()
 	ctrl := gomock.NewController(t)
@@ -39,6 +42,10 @@ func NewSuite(t *testing.T) (context.Context, *Suite) {
 	cfg := config.ReadConfig("../config/local_test.yaml")
 	log := logger.New(cfg.Env)
 
+	for _, option := range options {
+		option(t, cfg)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
 
 	t.Cleanup(func() {
@@ -49,6 +56,12 @@ func NewSuite(t *testing.T) (context.Context, *Suite) {
 	var opts []grpc.DialOption
 	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 
+	if len(options) > 0 {
+		startApp(t, cfg)
+		// the server is still starting while the first calls are made
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.WaitForReady(true)))
+	}
+
 	cc, err := grpc.NewClient(
 		net.JoinHostPort("localhost", strconv.Itoa(cfg.GRPC.Port)),
 		opts...,
@@ -57,6 +70,14 @@ func NewSuite(t *testing.T) (context.Context, *Suite) {
 		t.Fatalf("grpc server connection failed: %v", err)
 	}
 
+	adminCC, err := grpc.NewClient(
+		net.JoinHostPort("localhost", strconv.Itoa(cfg.GRPC.AdminPort)),
+		opts...,
+	)
+	if err != nil {
+		t.Fatalf("grpc admin server connection failed: %v", err)
+	}
+
 	mockRefreshTokenSetter := mock_tokens.NewMockRefreshTokenSetter(ctrl)
 	mockRefreshTokenDeleter := mock_tokens.NewMockRefreshTokenDeleter(ctrl)
 	mockUserGetter := mock_tokens.NewMockUserGetter(ctrl)
@@ -66,19 +87,17 @@ func NewSuite(t *testing.T) (context.Context, *Suite) {
 		cfg.Tokens.Secret,
 		cfg.Tokens.AccessTTL,
 		cfg.Tokens.RefreshTTL,
+		cfg.Tokens.ServiceTTL,
 		mockRefreshTokenSetter,
 		mockRefreshTokenDeleter,
 		mockUserGetter,
 	)
 
-	// Add the microservice authorization token to the context
-	md := metadata.Pairs("authorization", "Bearer "+cfg.GRPC.ConnectionToken)
-	ctxWithToken := metadata.NewOutgoingContext(ctx, md)
-
-	return ctxWithToken, &Suite{
+	st := &Suite{
 		T:            t,
 		Cfg:          cfg,
 		AuthClient:   sso.NewAuthClient(cc),
+		AdminClient:  sso.NewAuthAdminClient(adminCC),
 		TokenManager: tokenManager,
 		Mocks: &Mocks{
 			RefreshTokenSetter:  mockRefreshTokenSetter,
@@ -86,4 +105,39 @@ func NewSuite(t *testing.T) (context.Context, *Suite) {
 			UserGetter:          mockUserGetter,
 		},
 	}
+
+	// Add the microservice authorization token to the context
+	return st.ServiceContext(ctx, auth.ScopeGateway, auth.ScopeValidate), st
+}
+
+// ServiceContext registers a service with the scopes and adds
+// the service token it gets for its credentials to the context
+func (s *Suite) ServiceContext(ctx context.Context, scopes ...string) context.Context {
+	s.Helper()
+
+	client, secret := s.RegisterClient(ctx, models.Client{
+		ClientID:   "service",
+		Name:       "Test service",
+		GrantTypes: []string{models.GrantClientCredentials},
+		Scopes:     scopes,
+	}, false)
+
+	resp, err := s.AuthClient.IssueServiceToken(ctx, &sso.IssueServiceTokenRequest{
+		ClientId:     client.ClientID,
+		ClientSecret: secret,
+	})
+	if err != nil {
+		s.Fatalf("failed to issue service token: %v", err)
+	}
+
+	md := metadata.Pairs("authorization", "Bearer "+resp.GetAccessToken())
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// AdminContext swaps the service token for the admin connection token
+func (s *Suite) AdminContext(ctx context.Context) context.Context {
+	md := metadata.Pairs("authorization", "Bearer "+s.Cfg.GRPC.AdminConnectionToken)
+
+	return metadata.NewOutgoingContext(ctx, md)
 }
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	timingAccounts = 8
+	// medians of both paths may differ by this factor at most. A missing password
+	// hash comparison makes one of them tens of times faster, so the margin is wide
+	// enough for noise from tests running in parallel.
+	maxTimingRatio = 1.5
+)
+
+func TestLogin_UnknownEmailTakesAsLongAsWrongPassword(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	require := require.New(st.T)
+
+	emails := make([]string, 0, timingAccounts)
+	for range timingAccounts {
+		email := gofakeit.Email()
+		_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+			Email:       email,
+			Password:    gofakeit.Password(true, true, true, true, false, 12),
+			Fingerprint: "fingerprint",
+		})
+		require.NoError(err)
+
+		emails = append(emails, email)
+	}
+
+	// stay below the lockout limit, a locked account answers without hashing
+	attempts := st.Cfg.Lockout.MaxAttempts - 1
+	require.Positive(attempts)
+
+	var known, unknown []time.Duration
+	for range attempts {
+		// interleaved, so load spikes hit both samples the same way
+		for _, email := range emails {
+			known = append(known, timeLogin(ctx, st, email))
+			unknown = append(unknown, timeLogin(ctx, st, gofakeit.Email()))
+		}
+	}
+
+	assertSameTiming(st.T, known, unknown)
+}
+
+func TestRecoverAccount_UnknownEmailTakesAsLongAsWrongCode(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	require := require.New(st.T)
+
+	emails := make([]string, 0, timingAccounts)
+	for range timingAccounts {
+		email := gofakeit.Email()
+		registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+			Email:       email,
+			Password:    gofakeit.Password(true, true, true, true, false, 12),
+			Fingerprint: "fingerprint",
+		})
+		require.NoError(err)
+
+		_, err = st.AuthClient.GenerateRecoveryCodes(ctx, &sso.GenerateRecoveryCodesRequest{
+			AccessToken: registerResp.GetAccessToken(),
+		})
+		require.NoError(err)
+
+		emails = append(emails, email)
+	}
+
+	// recovery codes share the lockout with passwords
+	attempts := st.Cfg.Lockout.MaxAttempts - 1
+	require.Positive(attempts)
+
+	var known, unknown []time.Duration
+	for range attempts {
+		for _, email := range emails {
+			known = append(known, timeRecovery(ctx, st, email))
+			unknown = append(unknown, timeRecovery(ctx, st, gofakeit.Email()))
+		}
+	}
+
+	assertSameTiming(st.T, known, unknown)
+}
+
+func TestRegister_AntiEnumeration(t *testing.T) {
+	ctx, st := suite.NewSuite(t, suite.WithAntiEnumeration())
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	pass := gofakeit.Password(true, true, true, true, false, 12)
+
+	taken := gofakeit.Email()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       taken,
+		Password:    pass,
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	var fresh, existing []time.Duration
+	for range timingAccounts * 2 {
+		start := time.Now()
+		freshResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+			Email:       gofakeit.Email(),
+			Password:    pass,
+			Fingerprint: "fingerprint",
+		})
+		fresh = append(fresh, time.Since(start))
+		require.NoError(err)
+
+		start = time.Now()
+		existingResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+			Email:       taken,
+			Password:    pass,
+			Fingerprint: "fingerprint",
+		})
+		existing = append(existing, time.Since(start))
+		require.NoError(err)
+
+		// nothing in the answer tells the two apart
+		assert.Equal(freshResp.GetMessage(), existingResp.GetMessage())
+		assert.Empty(freshResp.GetAccessToken())
+		assert.Empty(existingResp.GetAccessToken())
+	}
+
+	assertSameTiming(st.T, fresh, existing)
+}
+
+func timeLogin(ctx context.Context, st *suite.Suite, email string) time.Duration {
+	start := time.Now()
+	_, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    "Wr0ng-Pa55-Kettle",
+		Fingerprint: "fingerprint",
+	})
+	elapsed := time.Since(start)
+
+	require.Error(st.T, err)
+	require.Equal(st.T, codes.InvalidArgument, status.Code(err))
+
+	return elapsed
+}
+
+func timeRecovery(ctx context.Context, st *suite.Suite, email string) time.Duration {
+	start := time.Now()
+	_, err := st.AuthClient.RecoverAccount(ctx, &sso.RecoverAccountRequest{
+		Email: email,
+		Code:  "abcde-fghjk",
+	})
+	elapsed := time.Since(start)
+
+	require.Error(st.T, err)
+	require.Equal(st.T, codes.InvalidArgument, status.Code(err))
+
+	return elapsed
+}
+
+// assertSameTiming compares medians, a few slow outliers don't move them
+func assertSameTiming(t *testing.T, a, b []time.Duration) {
+	t.Helper()
+
+	medianA, medianB := median(a), median(b)
+	t.Logf("median %s vs %s over %d samples", medianA, medianB, len(a))
+
+	slower, faster := max(medianA, medianB), min(medianA, medianB)
+	require.Positive(t, faster)
+	assert.LessOrEqual(t, float64(slower)/float64(faster), maxTimingRatio)
+}
+
+func median(samples []time.Duration) time.Duration {
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTrustedDevices_TrustListRevoke(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	pass := "Violet-Harbor-Lantern-41"
+	fingerprint := "laptop-fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	loginResp, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	assert.False(loginResp.GetTrustedDevice())
+
+	trustResp, err := st.AuthClient.TrustDevice(ctx, &sso.TrustDeviceRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		Fingerprint: fingerprint,
+		Name:        "work laptop",
+	})
+	require.NoError(err)
+	assert.Greater(trustResp.GetTrustedUntil(), time.Now().Unix())
+
+	loginResp, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	assert.True(loginResp.GetTrustedDevice())
+
+	// other devices of the same user aren't trusted
+	otherResp, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: "phone-fingerprint",
+	})
+	require.NoError(err)
+	assert.False(otherResp.GetTrustedDevice())
+
+	listResp, err := st.AuthClient.ListTrustedDevices(ctx, &sso.ListTrustedDevicesRequest{
+		AccessToken: loginResp.GetAccessToken(),
+	})
+	require.NoError(err)
+	require.Len(listResp.GetDevices(), 1)
+	device := listResp.GetDevices()[0]
+	assert.Equal("work laptop", device.GetName())
+	assert.Equal(trustResp.GetTrustedUntil(), device.GetTrustedUntil())
+	assert.NotZero(device.GetLastSeenAt())
+
+	_, err = st.AuthClient.RevokeTrustedDevice(ctx, &sso.RevokeTrustedDeviceRequest{
+		AccessToken: loginResp.GetAccessToken(),
+		DeviceId:    device.GetId(),
+	})
+	require.NoError(err)
+
+	loginResp, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	assert.False(loginResp.GetTrustedDevice())
+
+	_, err = st.AuthClient.RevokeTrustedDevice(ctx, &sso.RevokeTrustedDeviceRequest{
+		AccessToken: loginResp.GetAccessToken(),
+		DeviceId:    device.GetId(),
+	})
+	require.Error(err)
+	assert.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestTrustedDevices_OnlyOwnerCanRevoke(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	pass := "Violet-Harbor-Lantern-41"
+	fingerprint := "fingerprint"
+
+	owner, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       gofakeit.Email(),
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	other, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       gofakeit.Email(),
+		Password:    pass,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	_, err = st.AuthClient.TrustDevice(ctx, &sso.TrustDeviceRequest{
+		AccessToken: owner.GetAccessToken(),
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	listResp, err := st.AuthClient.ListTrustedDevices(ctx, &sso.ListTrustedDevicesRequest{
+		AccessToken: owner.GetAccessToken(),
+	})
+	require.NoError(err)
+	require.Len(listResp.GetDevices(), 1)
+
+	_, err = st.AuthClient.RevokeTrustedDevice(ctx, &sso.RevokeTrustedDeviceRequest{
+		AccessToken: other.GetAccessToken(),
+		DeviceId:    listResp.GetDevices()[0].GetId(),
+	})
+	require.Error(err)
+	assert.Equal(codes.NotFound, status.Code(err))
+
+	_, err = st.AuthClient.TrustDevice(ctx, &sso.TrustDeviceRequest{
+		AccessToken: owner.GetAccessToken(),
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
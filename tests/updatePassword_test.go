@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+	sso "github.com/kuromii5/miku-notes-auth/generated"
+	"github.com/kuromii5/miku-notes-auth/internal/auth"
+	"github.com/kuromii5/miku-notes-auth/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUpdatePassword_RejectsReuse(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	assert := assert.New(st.T)
+	require := require.New(st.T)
+
+	email := gofakeit.Email()
+	first := "Violet-Harbor-Lantern-41"
+	second := "Quiet-Marble-Orchard-73"
+	fingerprint := "fingerprint"
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       email,
+		Password:    first,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+	accessToken := registerResp.GetAccessToken()
+
+	// the current password can't be set again
+	_, err = st.AuthClient.UpdatePassword(ctx, &sso.UpdatePasswordRequest{
+		AccessToken: accessToken,
+		OldPassword: first,
+		NewPassword: first,
+	})
+	require.Error(err)
+	assert.Equal(codes.FailedPrecondition, status.Code(err))
+	assert.Equal(auth.ErrPasswordReused.Error(), status.Convert(err).Message())
+
+	_, err = st.AuthClient.UpdatePassword(ctx, &sso.UpdatePasswordRequest{
+		AccessToken: accessToken,
+		OldPassword: first,
+		NewPassword: second,
+	})
+	require.NoError(err)
+
+	// rotating back to the previous password is refused while it's in the history
+	_, err = st.AuthClient.UpdatePassword(ctx, &sso.UpdatePasswordRequest{
+		AccessToken: accessToken,
+		OldPassword: second,
+		NewPassword: first,
+	})
+	require.Error(err)
+	assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+	// the new password is the one that works now
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    second,
+		Fingerprint: fingerprint,
+	})
+	require.NoError(err)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:       email,
+		Password:    first,
+		Fingerprint: fingerprint,
+	})
+	require.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestUpdatePassword_WrongOldPassword(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	require := require.New(st.T)
+
+	registerResp, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{
+		Email:       gofakeit.Email(),
+		Password:    "Violet-Harbor-Lantern-41",
+		Fingerprint: "fingerprint",
+	})
+	require.NoError(err)
+
+	_, err = st.AuthClient.UpdatePassword(ctx, &sso.UpdatePasswordRequest{
+		AccessToken: registerResp.GetAccessToken(),
+		OldPassword: "Wr0ng-Pa55-Kettle",
+		NewPassword: "Quiet-Marble-Orchard-73",
+	})
+	require.Error(err)
+	require.Equal(codes.InvalidArgument, status.Code(err))
+}